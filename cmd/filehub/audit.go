@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/kiry163/filehub/internal/config"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+const auditUsage = "usage: filehub audit verify [-checkpoints <path>] | checkpoint"
+
+// runAudit checks the audit log's hash chain offline, against the signed
+// checkpoints the server writes.
+func runAudit(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(auditUsage)
+	}
+	database, err := db.Open(cfg.Database.Path)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	svc := &service.Service{DB: database, Config: cfg}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "verify":
+		flags := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+		path := flags.String("checkpoints", cfg.Audit.CheckpointPath, "signed checkpoint file to check the log against")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		checkpoints, err := service.ReadAuditCheckpoints(*path)
+		if err != nil {
+			return err
+		}
+		result, err := svc.VerifyAuditChain(ctx, checkpoints)
+		if err != nil {
+			return err
+		}
+		if result.Entries > 0 {
+			fmt.Printf("Verified %d entries (%d-%d), head %s\n", result.Entries, result.FirstID, result.LastID, result.HeadHash)
+		} else if result.BrokenAt == 0 {
+			fmt.Println("Audit log is empty")
+		}
+		if result.PurgedThrough > 0 {
+			fmt.Printf("Entries up to %d removed by retention\n", result.PurgedThrough)
+		}
+		if result.BrokenAt != 0 {
+			fmt.Printf("BROKEN at entry %d: %s\n", result.BrokenAt, result.Reason)
+		}
+		fmt.Printf("Checked %d checkpoints from %s\n", result.Checkpoints, *path)
+		for _, message := range result.CheckpointErrors {
+			fmt.Printf("CHECKPOINT FAILED: %s\n", message)
+		}
+		if !result.OK() {
+			return errors.New("audit log verification failed")
+		}
+		fmt.Println("OK")
+		return nil
+	case "checkpoint":
+		written, err := svc.WriteAuditCheckpoint(ctx)
+		if err != nil {
+			return err
+		}
+		if written {
+			fmt.Printf("checkpoint written to %s\n", cfg.Audit.CheckpointPath)
+		} else {
+			fmt.Println("audit log unchanged since the last checkpoint")
+		}
+		return nil
+	default:
+		return errors.New(auditUsage)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/kiry163/filehub/internal/api"
 	"github.com/kiry163/filehub/internal/config"
 	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/ratelimit"
 	"github.com/kiry163/filehub/internal/service"
 	"github.com/kiry163/filehub/internal/storage"
 	"github.com/kiry163/filehub/internal/version"
@@ -35,26 +36,71 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(cfg, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "audit" {
+		if err := runAudit(cfg, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "user" {
+		if err := runUser(cfg, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	database, err := db.Open(cfg.Database.Path)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	minioStorage, err := storage.NewMinioStorage(context.Background(), cfg.Minio)
+	objectStorage, err := openStorage(context.Background(), cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	svc := &service.Service{
 		DB:      database,
-		Storage: minioStorage,
+		Storage: objectStorage,
 		Config:  cfg,
 	}
 
-	router := api.NewRouter(svc)
+	if err := svc.BootstrapAdmin(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	warnLocalKey(cfg)
+	svc.StartWorkers(context.Background())
+
+	router := api.NewRouter(svc, ratelimit.NewMemory())
 	address := ":" + strconv.Itoa(cfg.Server.Port)
 	log.Printf("filehub server listening on %s", address)
 	if err := http.ListenAndServe(address, router); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// warnLocalKey points deployments still using the shared auth.local_key at
+// scoped API keys.
+func warnLocalKey(cfg config.Config) {
+	switch {
+	case cfg.Auth.LocalKey == "":
+	case cfg.Auth.LocalKeyEnabled:
+		log.Printf("auth.local_key is deprecated: create per-machine API keys with `filehub-cli keys create` and set auth.local_key_enabled to false")
+	default:
+		log.Printf("auth.local_key is set but ignored because auth.local_key_enabled is false; X-Local-Key requests are rejected, use API keys instead")
+	}
+}
+
+func openStorage(ctx context.Context, cfg config.Config) (storage.Storage, error) {
+	if cfg.Storage.Driver == config.StorageDriverFilesystem {
+		log.Printf("using filesystem storage at %s", cfg.Storage.Path)
+		return storage.NewFilesystemStorage(cfg.Storage.Path)
+	}
+	return storage.NewMinioStorage(ctx, cfg.Minio)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/kiry163/filehub/internal/config"
+	"github.com/kiry163/filehub/internal/db"
+)
+
+const migrateUsage = "usage: filehub migrate status|up|down-to <version>"
+
+func runMigrate(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	database, err := db.Connect(cfg.Database.Path)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	ctx := context.Background()
+
+	switch args[0] {
+	case "status":
+		current, err := database.SchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		statuses, err := database.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Database version: %d (binary supports %d)\n", current, db.LatestSchemaVersion())
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt
+			}
+			fmt.Printf("%4d  %-30s %s\n", status.Version, status.Name, state)
+		}
+		return nil
+	case "up":
+		applied, err := database.MigrateUp(ctx)
+		for _, version := range applied {
+			fmt.Printf("applied %d\n", version)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("already up to date")
+		}
+		return nil
+	case "down-to":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		target, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		reverted, err := database.MigrateDownTo(ctx, target)
+		for _, version := range reverted {
+			fmt.Printf("reverted %d\n", version)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("nothing to revert")
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kiry163/filehub/internal/config"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+const userUsage = "usage: filehub user list | add <username> [-role admin|editor|uploader|viewer] [-password <password>] | passwd <username> [-password <password>] | disable <username> | enable <username> | reset-totp <username>"
+
+// runUser manages accounts directly in the database, so the first admin can
+// be created without putting a password in config.yaml.
+func runUser(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+	database, err := db.Open(cfg.Database.Path)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	svc := &service.Service{DB: database, Config: cfg}
+	ctx := context.Background()
+
+	flags := flag.NewFlagSet("user "+args[0], flag.ContinueOnError)
+	role := flags.String("role", service.RoleViewer, "role: admin, editor, uploader or viewer")
+	password := flags.String("password", "", "password (prompted when omitted)")
+	username, err := parseUserArgs(flags, args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		users, err := svc.ListUsers(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-16s %-24s %-9s %-9s %-6s %s\n", "USER_ID", "USERNAME", "ROLE", "DISABLED", "TOTP", "CREATED_AT")
+		for _, user := range users {
+			fmt.Printf("%-16s %-24s %-9s %-9t %-6t %s\n", user.UserID, user.Username, user.Role, user.Disabled, user.TOTPEnabled, user.CreatedAt)
+		}
+		return nil
+	case "add":
+		if username == "" {
+			return errors.New(userUsage)
+		}
+		if *password == "" {
+			if *password, err = promptPassword(); err != nil {
+				return err
+			}
+		}
+		user, err := svc.CreateUser(ctx, username, *password, *role)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %s (%s)\n", user.Username, user.UserID)
+		return nil
+	case "passwd", "disable", "enable", "reset-totp":
+		if username == "" {
+			return errors.New(userUsage)
+		}
+		user, err := database.GetUserByUsername(ctx, username)
+		if err != nil {
+			return fmt.Errorf("user %q not found", username)
+		}
+		switch args[0] {
+		case "passwd":
+			if *password == "" {
+				if *password, err = promptPassword(); err != nil {
+					return err
+				}
+			}
+			if _, err := svc.SetPassword(ctx, user.UserID, *password); err != nil {
+				return err
+			}
+			fmt.Println("password updated")
+		case "reset-totp":
+			if err := svc.ResetTOTP(ctx, user.UserID); err != nil {
+				return err
+			}
+			fmt.Printf("two-factor authentication reset for %s\n", user.Username)
+		default:
+			disabled := args[0] == "disable"
+			if _, err := svc.UpdateUser(ctx, user.UserID, service.UserUpdate{Disabled: &disabled}); err != nil {
+				return err
+			}
+			fmt.Printf("%sd %s\n", args[0], user.Username)
+		}
+		return nil
+	default:
+		return errors.New(userUsage)
+	}
+}
+
+// parseUserArgs accepts flags before or after the username.
+func parseUserArgs(flags *flag.FlagSet, args []string) (string, error) {
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if flags.NArg() == 0 {
+		return "", nil
+	}
+	username := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		return "", err
+	}
+	if flags.NArg() > 0 {
+		return "", errors.New(userUsage)
+	}
+	return username, nil
+}
+
+func promptPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("password required")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
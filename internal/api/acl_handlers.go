@@ -0,0 +1,164 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+type folderACLRequest struct {
+	Entries []struct {
+		User   string `json:"user"`
+		Role   string `json:"role"`
+		Access string `json:"access"`
+	} `json:"entries"`
+}
+
+// GetFolderACL 查看文件夹的访问控制列表，包括从上级继承的条目
+// 权限：read，且对该文件夹有 read 访问级别
+func (h *Handler) GetFolderACL(c *gin.Context) {
+	folderID := c.Param("id")
+	access, ok := h.folderAccess(c)
+	if !ok {
+		return
+	}
+	if _, err := h.Service.DB.GetFolder(c.Request.Context(), folderID); err != nil {
+		Error(c, http.StatusNotFound, 10003, "folder not found")
+		return
+	}
+	if !h.allowFolder(c, access, &folderID, service.AccessRead) {
+		return
+	}
+	explicit, inherited, err := h.Service.FolderACL(c.Request.Context(), folderID)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "get acl failed")
+		return
+	}
+	names := h.usernames(c)
+	inheritedResponse := make([][]gin.H, 0, len(inherited))
+	for _, entries := range inherited {
+		inheritedResponse = append(inheritedResponse, aclResponse(entries, names))
+	}
+	OK(c, gin.H{
+		"folder_id": folderID,
+		"entries":   aclResponse(explicit, names),
+		"inherited": inheritedResponse,
+		"access":    access.Level(&folderID),
+	})
+}
+
+// SetFolderACL 替换文件夹的访问控制列表，空列表表示恢复继承
+// 权限：write，且对该文件夹有 manage 访问级别
+func (h *Handler) SetFolderACL(c *gin.Context) {
+	folderID := c.Param("id")
+	var req folderACLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 10004, "invalid request")
+		return
+	}
+	access, ok := h.folderAccess(c)
+	if !ok {
+		return
+	}
+	if _, err := h.Service.DB.GetFolder(c.Request.Context(), folderID); err != nil {
+		Error(c, http.StatusNotFound, 10003, "folder not found")
+		return
+	}
+	if !h.allowFolder(c, access, &folderID, service.AccessManage) {
+		return
+	}
+	requested := make([]service.ACLEntry, 0, len(req.Entries))
+	for _, entry := range req.Entries {
+		requested = append(requested, service.ACLEntry{User: entry.User, Role: entry.Role, Access: entry.Access})
+	}
+	entries, err := h.Service.SetFolderACL(c.Request.Context(), folderID, getUser(c), requested)
+	if err != nil {
+		if errors.Is(err, service.ErrACLInvalid) {
+			Error(c, http.StatusBadRequest, 10004, "entries need a known user or role and access none, read, write or manage")
+			h.audit(c, "acl_update", "", getUser(c), "failure", folderID+": invalid entries")
+			return
+		}
+		Error(c, http.StatusInternalServerError, 19999, "update acl failed")
+		h.audit(c, "acl_update", "", getUser(c), "failure", folderID+": update failed")
+		return
+	}
+	h.audit(c, "acl_update", "", getUser(c), "success", fmt.Sprintf("%s: %d entries", folderID, len(entries)))
+	OK(c, gin.H{"folder_id": folderID, "entries": aclResponse(entries, h.usernames(c))})
+}
+
+// folderAccess 加载当前调用者的文件夹访问级别，失败时已写入响应
+func (h *Handler) folderAccess(c *gin.Context) (*service.FolderAccess, bool) {
+	caller := service.Caller{UserID: c.GetString("user_id"), Role: c.GetString("role")}
+	if key, ok := apiKey(c); ok {
+		caller.Folder = key.FolderID
+	}
+	access, err := h.Service.FolderAccess(c.Request.Context(), caller)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "acl check failed")
+		return nil, false
+	}
+	return access, true
+}
+
+// allowFolder 检查调用者对文件夹（nil 为根目录）是否有 level 访问级别。
+// 看不到的文件夹返回 404，避免泄露其存在；可见但级别不足返回 403
+func (h *Handler) allowFolder(c *gin.Context, access *service.FolderAccess, folderID *string, level string) bool {
+	if access.Allows(folderID, level) {
+		return true
+	}
+	if access.Allows(folderID, service.AccessRead) {
+		Error(c, http.StatusForbidden, 10002, "permission denied")
+	} else {
+		Error(c, http.StatusNotFound, 10003, "not found")
+	}
+	target := RootFolderID
+	if folderID != nil {
+		target = *folderID
+	}
+	message := fmt.Sprintf("%s %s requires %s access on folder %s", c.Request.Method, c.Request.URL.Path, level, target)
+	h.audit(c, "permission_denied", "", getUser(c), "failure", message)
+	return false
+}
+
+// checkFolder 是只检查一个文件夹时的 folderAccess 加 allowFolder
+func (h *Handler) checkFolder(c *gin.Context, folderID *string, level string) bool {
+	access, ok := h.folderAccess(c)
+	return ok && h.allowFolder(c, access, folderID, level)
+}
+
+// usernames 将用户 ID 映射为用户名，便于展示
+func (h *Handler) usernames(c *gin.Context) map[string]string {
+	names := map[string]string{}
+	users, err := h.Service.ListUsers(c.Request.Context())
+	if err != nil {
+		return names
+	}
+	for _, user := range users {
+		names[user.UserID] = user.Username
+	}
+	return names
+}
+
+func aclResponse(entries []db.FolderACL, names map[string]string) []gin.H {
+	items := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		item := gin.H{
+			"folder_id":  entry.FolderID,
+			"access":     entry.Access,
+			"created_by": entry.CreatedBy,
+			"created_at": entry.CreatedAt,
+		}
+		if entry.PrincipalType == service.PrincipalUser {
+			item["user_id"] = entry.PrincipalID
+			item["user"] = names[entry.PrincipalID]
+		} else {
+			item["role"] = entry.PrincipalID
+		}
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DedupStats 报告去重节省的存储空间
+func (h *Handler) DedupStats(c *gin.Context) {
+	stats, err := h.Service.DedupStats(c.Request.Context())
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "stats failed")
+		return
+	}
+	OK(c, stats)
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+type createAPIKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	FolderID  *string  `json:"folder_id"`
+	ExpiresIn string   `json:"expires_in"`
+	// Owner 为用户名，为空时是调用者本人；为他人创建需要 admin 权限
+	Owner string `json:"owner"`
+}
+
+// ListAPIKeys 列出自己的 API 密钥，管理员列出全部
+// 权限：登录即可
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	ownerID := c.GetString("user_id")
+	if callerIsAdmin(c) {
+		ownerID = ""
+	} else if ownerID == "" {
+		OK(c, gin.H{"keys": []gin.H{}})
+		return
+	}
+	keys, err := h.Service.ListAPIKeys(c.Request.Context(), ownerID)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "list failed")
+		return
+	}
+	names := h.usernames(c)
+	items := make([]gin.H, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, apiKeyResponse(key, names[key.OwnerID]))
+	}
+	OK(c, gin.H{"keys": items})
+}
+
+// CreateAPIKey 新建 API 密钥，明文密钥只在响应中出现一次。
+// 用 API 密钥创建时，新密钥的 scope 和文件夹不能超出当前密钥
+// 权限：登录即可，scope 不能超出所有者角色
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	var req createAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 10004, "invalid request")
+		return
+	}
+	opts := service.APIKeyOptions{Name: req.Name, Scopes: req.Scopes, FolderID: req.FolderID}
+	if req.ExpiresIn != "" {
+		expiresIn, err := parseShareDuration(req.ExpiresIn)
+		if err != nil {
+			Error(c, http.StatusBadRequest, 10004, "invalid expires_in")
+			return
+		}
+		opts.ExpiresIn = expiresIn
+	}
+
+	var owner db.User
+	var err error
+	switch {
+	case req.Owner != "" && req.Owner != getUser(c):
+		if !callerIsAdmin(c) {
+			Error(c, http.StatusForbidden, 10002, "creating keys for other users requires admin")
+			h.audit(c, "api_key_create", "", getUser(c), "failure", req.Name+": not admin")
+			return
+		}
+		owner, err = h.Service.DB.GetUserByUsername(c.Request.Context(), req.Owner)
+	case c.GetString("user_id") == "":
+		Error(c, http.StatusBadRequest, 10004, "owner required")
+		return
+	default:
+		owner, err = h.Service.DB.GetUser(c.Request.Context(), c.GetString("user_id"))
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			Error(c, http.StatusNotFound, 10003, "owner not found")
+			return
+		}
+		Error(c, http.StatusInternalServerError, 19999, "create key failed")
+		return
+	}
+
+	if parent, ok := apiKey(c); ok {
+		for _, scope := range opts.Scopes {
+			if !slices.Contains(parent.Scopes, scope) {
+				Error(c, http.StatusForbidden, 10002, "scopes exceed the calling key")
+				h.audit(c, "api_key_create", "", getUser(c), "failure", req.Name+": scopes exceed the calling key")
+				return
+			}
+		}
+		if parent.FolderID != nil && !h.checkFolder(c, opts.FolderID, service.AccessRead) {
+			return
+		}
+	}
+
+	key, plaintext, err := h.Service.CreateAPIKey(c.Request.Context(), owner, getUser(c), opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAPIKeyExists):
+			Error(c, http.StatusConflict, 10010, err.Error())
+		case errors.Is(err, service.ErrAPIKeyFolder):
+			Error(c, http.StatusNotFound, 10003, err.Error())
+		case errors.Is(err, service.ErrAPIKeyNameInvalid), errors.Is(err, service.ErrAPIKeyScope):
+			Error(c, http.StatusBadRequest, 10004, err.Error())
+		default:
+			Error(c, http.StatusInternalServerError, 19999, "create key failed")
+		}
+		h.audit(c, "api_key_create", "", getUser(c), "failure", req.Name+": "+err.Error())
+		return
+	}
+	h.audit(c, "api_key_create", "", getUser(c), "success", key.Name+" for "+owner.Username)
+	response := apiKeyResponse(key, owner.Username)
+	response["key"] = plaintext
+	OK(c, response)
+}
+
+// RevokeAPIKey 吊销 API 密钥，立即生效
+// 权限：登录即可，只能吊销自己的密钥，管理员可吊销任意密钥
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	keyID := c.Param("id")
+	key, err := h.Service.DB.GetAPIKey(c.Request.Context(), keyID)
+	if err != nil || (key.OwnerID != c.GetString("user_id") && !callerIsAdmin(c)) {
+		Error(c, http.StatusNotFound, 10003, "not found")
+		h.audit(c, "api_key_revoke", "", getUser(c), "failure", keyID+": not found")
+		return
+	}
+	if err := h.Service.RevokeAPIKey(c.Request.Context(), keyID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			Error(c, http.StatusConflict, 10004, "key already revoked")
+			return
+		}
+		Error(c, http.StatusInternalServerError, 19999, "revoke failed")
+		h.audit(c, "api_key_revoke", "", getUser(c), "failure", key.Name+": revoke failed")
+		return
+	}
+	h.audit(c, "api_key_revoke", "", getUser(c), "success", key.Name)
+	Message(c, "revoked")
+}
+
+// callerIsAdmin 判断调用者是否有 admin 权限，API 密钥还需 admin scope
+func callerIsAdmin(c *gin.Context) bool {
+	if !service.RoleAllows(c.GetString("role"), service.PermAdmin) {
+		return false
+	}
+	key, ok := apiKey(c)
+	return !ok || service.ScopeAllows(key.Scopes, service.PermAdmin)
+}
+
+func apiKeyResponse(key db.APIKey, owner string) gin.H {
+	return gin.H{
+		"key_id":       key.KeyID,
+		"name":         key.Name,
+		"prefix":       key.Prefix,
+		"owner":        owner,
+		"scopes":       key.Scopes,
+		"folder_id":    key.FolderID,
+		"status":       service.APIKeyState(key, time.Now().UTC()),
+		"expires_at":   key.ExpiresAt,
+		"last_used_at": key.LastUsedAt,
+		"revoked_at":   key.RevokedAt,
+		"created_by":   key.CreatedBy,
+		"created_at":   key.CreatedAt,
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kiry163/filehub/internal/service"
+)
+
+// createAPIKey creates a key through the API as the holder of token and
+// returns the plaintext key.
+func createAPIKey(t *testing.T, router http.Handler, token, body string) string {
+	t.Helper()
+	resp := requestAs(router, token, "POST", "/api/v1/keys", strings.NewReader(body))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("create key %s: %d %s", body, resp.Code, resp.Body.String())
+	}
+	var data struct {
+		Key string `json:"key"`
+	}
+	decodeData(t, resp, &data)
+	return data.Key
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	router, svc := newTestRouter(t)
+	admin := loginAs(t, svc, "alice", service.RoleAdmin)
+	viewer := loginAs(t, svc, "bob", service.RoleViewer)
+	fileID := uploadTestFile(t, router, "a.txt", "hello")
+	keys := map[string]string{
+		"read":         createAPIKey(t, router, admin, `{"name": "reader", "scopes": ["read"]}`),
+		"upload":       createAPIKey(t, router, admin, `{"name": "uploader", "scopes": ["upload"]}`),
+		"admin":        createAPIKey(t, router, admin, `{"name": "ops", "scopes": ["read", "admin"]}`),
+		"viewer owner": createAPIKey(t, router, viewer, `{"name": "bobs-key", "scopes": ["read"]}`),
+	}
+
+	// The role of the owner and the scopes of the key must both allow a
+	// route.
+	tests := []struct {
+		key    string
+		method string
+		path   string
+		status int
+	}{
+		{"read", "GET", "/api/v1/files", http.StatusOK},
+		{"read", "GET", "/api/v1/files/" + fileID + "/download", http.StatusOK},
+		{"read", "PUT", "/api/v1/files/raw?name=b.txt", http.StatusForbidden},
+		{"read", "DELETE", "/api/v1/files/" + fileID, http.StatusForbidden},
+		{"read", "GET", "/api/v1/admin/users", http.StatusForbidden},
+		{"upload", "PUT", "/api/v1/files/raw?name=b.txt", http.StatusOK},
+		{"upload", "GET", "/api/v1/files", http.StatusForbidden},
+		{"admin", "GET", "/api/v1/admin/users", http.StatusOK},
+		{"viewer owner", "GET", "/api/v1/files", http.StatusOK},
+		{"viewer owner", "GET", "/api/v1/admin/users", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.key+" "+test.method+" "+test.path, func(t *testing.T) {
+			resp := request(router, test.method, test.path, strings.NewReader("data"), map[string]string{"X-Local-Key": "", "X-API-Key": keys[test.key]})
+			if resp.Code != test.status {
+				t.Errorf("status %d, want %d: %s", resp.Code, test.status, resp.Body.String())
+			}
+		})
+	}
+
+	// Keys are also accepted as bearer tokens.
+	if resp := requestAs(router, keys["read"], "GET", "/api/v1/files", nil); resp.Code != http.StatusOK {
+		t.Errorf("bearer key: status %d", resp.Code)
+	}
+	// A viewer cannot hand out more than their role allows.
+	if resp := requestAs(router, viewer, "POST", "/api/v1/keys", strings.NewReader(`{"name": "sneaky", "scopes": ["upload"]}`)); resp.Code != http.StatusBadRequest {
+		t.Errorf("scope beyond role: status %d", resp.Code)
+	}
+}
+
+func TestAPIKeyFolderRestriction(t *testing.T) {
+	router, svc := newTestRouter(t)
+	admin := loginAs(t, svc, "alice", service.RoleAdmin)
+	addTestFolder(t, svc, "docs", "docs", nil)
+	addTestFolder(t, svc, "drafts", "drafts", ptr("docs"))
+	addTestFolder(t, svc, "private", "private", nil)
+	inside := uploadTestFileTo(t, router, "drafts", "in.txt", "inside")
+	outside := uploadTestFileTo(t, router, "private", "out.txt", "outside")
+	atRoot := uploadTestFile(t, router, "root.txt", "root")
+	key := createAPIKey(t, router, admin, `{"name": "docs-bot", "scopes": ["read", "upload"], "folder_id": "docs"}`)
+
+	// Folders outside the key's tree, the root included, do not exist for
+	// it.
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"folder", "GET", "/api/v1/folders/docs/contents", http.StatusOK},
+		{"subfolder", "GET", "/api/v1/folders/drafts/contents", http.StatusOK},
+		{"other folder", "GET", "/api/v1/folders/private/contents", http.StatusNotFound},
+		{"file inside", "GET", "/api/v1/files/" + inside + "/download", http.StatusOK},
+		{"file outside", "GET", "/api/v1/files/" + outside + "/download", http.StatusNotFound},
+		{"file at the root", "GET", "/api/v1/files/" + atRoot, http.StatusNotFound},
+		{"upload inside", "PUT", "/api/v1/files/raw?name=new.txt&folder_id=drafts", http.StatusOK},
+		{"upload outside", "PUT", "/api/v1/files/raw?name=new.txt&folder_id=private", http.StatusNotFound},
+		{"upload to the root", "PUT", "/api/v1/files/raw?name=new.txt", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := request(router, test.method, test.path, strings.NewReader("data"), map[string]string{"X-Local-Key": "", "X-API-Key": key})
+			if resp.Code != test.status {
+				t.Errorf("status %d, want %d: %s", resp.Code, test.status, resp.Body.String())
+			}
+		})
+	}
+
+	// The root listing shows only the key's folder, and its stats count
+	// none of the root files.
+	resp := request(router, "GET", "/api/v1/folders/root/contents", nil, map[string]string{"X-Local-Key": "", "X-API-Key": key})
+	var root FolderContentsResponse
+	decodeData(t, resp, &root)
+	if len(root.Files) != 0 || root.Stats != (FolderStats{FolderCount: 1}) {
+		t.Errorf("root as the key: %d files, stats %+v", len(root.Files), root.Stats)
+	}
+
+	// Keys made with this key stay inside its scopes and folder.
+	derived := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"narrower", `{"name": "drafts-bot", "scopes": ["read"], "folder_id": "drafts"}`, http.StatusOK},
+		{"more scopes", `{"name": "wider", "scopes": ["read", "share"], "folder_id": "docs"}`, http.StatusForbidden},
+		{"other folder", `{"name": "escape", "scopes": ["read"], "folder_id": "private"}`, http.StatusNotFound},
+		{"no folder", `{"name": "everywhere", "scopes": ["read"]}`, http.StatusNotFound},
+	}
+	for _, test := range derived {
+		if resp := requestAs(router, key, "POST", "/api/v1/keys", strings.NewReader(test.body)); resp.Code != test.status {
+			t.Errorf("%s: status %d, want %d: %s", test.name, resp.Code, test.status, resp.Body.String())
+		}
+	}
+}
+
+func TestAPIKeyRevocation(t *testing.T) {
+	router, svc := newTestRouter(t)
+	admin := loginAs(t, svc, "alice", service.RoleAdmin)
+	editor := loginAs(t, svc, "bob", service.RoleEditor)
+	key := createAPIKey(t, router, editor, `{"name": "laptop", "scopes": ["read"]}`)
+	keys, err := svc.ListAPIKeys(context.Background(), "")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("keys %+v, %v", keys, err)
+	}
+	keyID := url.PathEscape(keys[0].KeyID)
+
+	steps := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"other users cannot see the key", loginAs(t, svc, "carol", service.RoleEditor), http.StatusNotFound},
+		{"owner revokes", editor, http.StatusOK},
+		{"already revoked", admin, http.StatusConflict},
+	}
+	for _, step := range steps {
+		if resp := requestAs(router, step.token, "DELETE", "/api/v1/keys/"+keyID, nil); resp.Code != step.status {
+			t.Fatalf("%s: status %d, want %d: %s", step.name, resp.Code, step.status, resp.Body.String())
+		}
+	}
+	if resp := requestAs(router, key, "GET", "/api/v1/files", nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d", resp.Code)
+	}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/config"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+	"github.com/kiry163/filehub/internal/storage"
+)
+
+const testLocalKey = "test-local-key"
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+}
+
+// newTestRouter serves the API from a fresh database and filesystem storage.
+// Requests made with request carry the local key.
+func newTestRouter(t *testing.T) (*gin.Engine, *service.Service) {
+	t.Helper()
+	dir := t.TempDir()
+	database, err := db.Open(filepath.Join(dir, "filehub.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	store, err := storage.NewFilesystemStorage(filepath.Join(dir, "objects"))
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+
+	var cfg config.Config
+	cfg.Auth.JWTSecret = "test-secret"
+	cfg.Auth.JWTExpireHours = 24
+	cfg.Auth.RefreshExpireDays = 7
+	cfg.Auth.LocalKey = testLocalKey
+	cfg.Auth.LocalKeyEnabled = true
+	cfg.Auth.LocalKeyRole = service.RoleAdmin
+	cfg.Upload.MaxSizeMB = 1
+	cfg.Storage.Driver = config.StorageDriverFilesystem
+	cfg.Storage.Path = filepath.Join(dir, "objects")
+	svc := &service.Service{DB: database, Storage: store, Config: cfg}
+	return NewRouter(svc, nil), svc
+}
+
+// request sends an authenticated request through the router.
+func request(router http.Handler, method, path string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptestRequest(method, path, body)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return serve(router, req)
+}
+
+// httptestRequest builds a request carrying the local key. Bodies other than
+// *bytes.Buffer, *bytes.Reader and *strings.Reader are sent without a
+// Content-Length, like a chunked upload.
+func httptestRequest(method, path string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("X-Local-Key", testLocalKey)
+	return req
+}
+
+func serve(router http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// bodyLength reports the length of a body whose size is known up front.
+func bodyLength(body io.Reader) int64 {
+	switch v := body.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len())
+	case *io.LimitedReader:
+		return v.N
+	}
+	return -1
+}
+
+// decodeData unpacks the data field of an API response into out.
+func decodeData(t *testing.T, recorder *httptest.ResponseRecorder, out interface{}) {
+	t.Helper()
+	var resp struct {
+		Code int             `json:"code"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", recorder.Body.String(), err)
+	}
+	if resp.Code != 0 {
+		t.Fatalf("response code %d: %s", resp.Code, recorder.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(resp.Data, out); err != nil {
+			t.Fatalf("decode data %s: %v", resp.Data, err)
+		}
+	}
+}
+
+// uploadTestFile stores content through the raw upload endpoint and returns
+// the new file ID.
+func uploadTestFile(t *testing.T, router http.Handler, name, content string) string {
+	t.Helper()
+	resp := request(router, "PUT", "/api/v1/files/raw?name="+url.QueryEscape(name), strings.NewReader(content), nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("upload %s: %d %s", name, resp.Code, resp.Body.String())
+	}
+	var data struct {
+		FileID string `json:"file_id"`
+	}
+	decodeData(t, resp, &data)
+	return data.FileID
+}
+
+func addTestFolder(t *testing.T, svc *service.Service, folderID, name string, parentID *string) {
+	t.Helper()
+	now := db.NowRFC3339()
+	record := db.FolderRecord{FolderID: folderID, Name: name, ParentID: parentID, CreatedBy: "local", CreatedAt: now, UpdatedAt: now}
+	if err := svc.DB.CreateFolder(context.Background(), record); err != nil {
+		t.Fatalf("create folder %s: %v", folderID, err)
+	}
+}
+
+// uploadTestFileTo stores content in folderID and returns the new file ID.
+func uploadTestFileTo(t *testing.T, router http.Handler, folderID, name, content string) string {
+	t.Helper()
+	resp := request(router, "PUT", "/api/v1/files/raw?name="+url.QueryEscape(name)+"&folder_id="+url.QueryEscape(folderID), strings.NewReader(content), nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("upload %s: %d %s", name, resp.Code, resp.Body.String())
+	}
+	var data struct {
+		FileID string `json:"file_id"`
+	}
+	decodeData(t, resp, &data)
+	return data.FileID
+}
+
+func ptr(value string) *string {
+	return &value
+}
+
+// loginAs creates a user and returns an access token for them.
+func loginAs(t *testing.T, svc *service.Service, username, role string) string {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := svc.CreateUser(ctx, username, "password1", role); err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	tokens, _, err := svc.Login(ctx, username, "password1", service.Client{})
+	if err != nil {
+		t.Fatalf("login %s: %v", username, err)
+	}
+	return tokens.AccessToken
+}
+
+// requestAs sends a request authenticated with an access token instead of
+// the local key.
+func requestAs(router http.Handler, token, method, path string, body io.Reader) *httptest.ResponseRecorder {
+	req := httptestRequest(method, path, body)
+	req.Header.Del("X-Local-Key")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return serve(router, req)
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/db"
+)
+
+const (
+	auditPageLimit   = 50
+	auditMaxLimit    = 1000
+	auditExportBatch = 500
+)
+
+// ListAuditLogs 按条件查询审计日志，最新的在前；next_cursor 作为下一页的 cursor 参数，为空表示没有更多
+// 权限：admin
+func (h *Handler) ListAuditLogs(c *gin.Context) {
+	filter, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+	limit := parseInt(c.DefaultQuery("limit", strconv.Itoa(auditPageLimit)), auditPageLimit)
+	if limit < 1 || limit > auditMaxLimit {
+		Error(c, http.StatusBadRequest, 10004, "limit must be between 1 and "+strconv.Itoa(auditMaxLimit))
+		return
+	}
+	// 多取一条判断是否还有下一页
+	filter.Limit = limit + 1
+	entries, err := h.Service.ListAuditLogs(c.Request.Context(), filter)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "list failed")
+		return
+	}
+	var nextCursor *string
+	if len(entries) > limit {
+		entries = entries[:limit]
+		cursor := strconv.FormatInt(entries[limit-1].ID, 10)
+		nextCursor = &cursor
+	}
+	items := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		items = append(items, auditResponse(entry))
+	}
+	OK(c, gin.H{"logs": items, "next_cursor": nextCursor})
+}
+
+// ExportAuditLogs 按与查询相同的条件导出全部匹配的审计日志，format 为 csv 或 ndjson
+// 权限：admin
+func (h *Handler) ExportAuditLogs(c *gin.Context) {
+	filter, ok := auditFilter(c)
+	if !ok {
+		return
+	}
+	format := c.DefaultQuery("format", "csv")
+	switch format {
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	case "ndjson":
+		c.Header("Content-Type", "application/x-ndjson")
+	default:
+		Error(c, http.StatusBadRequest, 10004, "format must be csv or ndjson")
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=\"audit-"+time.Now().UTC().Format("20060102")+"."+format+"\"")
+	c.Status(http.StatusOK)
+
+	csvWriter := csv.NewWriter(c.Writer)
+	encoder := json.NewEncoder(c.Writer)
+	if format == "csv" {
+		_ = csvWriter.Write([]string{"id", "created_at", "action", "actor", "file_id", "ip_address", "status", "message", "prev_hash", "hash"})
+	}
+	// 按 id 分批读取，避免一次载入整张表
+	exported := 0
+	filter.Limit = auditExportBatch
+	for {
+		entries, err := h.Service.ListAuditLogs(c.Request.Context(), filter)
+		if err != nil {
+			// 响应头已发出，只能中断输出
+			log.Printf("audit export: %v", err)
+			return
+		}
+		for _, entry := range entries {
+			if format == "csv" {
+				err = csvWriter.Write([]string{
+					strconv.FormatInt(entry.ID, 10),
+					entry.CreatedAt,
+					csvCell(entry.Action),
+					csvCell(entry.Actor),
+					csvCell(entry.FileID),
+					csvCell(entry.IPAddress),
+					csvCell(entry.Status),
+					csvCell(entry.Message),
+					entry.PrevHash,
+					entry.Hash,
+				})
+			} else {
+				err = encoder.Encode(auditResponse(entry))
+			}
+			if err != nil {
+				return
+			}
+		}
+		exported += len(entries)
+		csvWriter.Flush()
+		if len(entries) < auditExportBatch {
+			break
+		}
+		filter.Before = entries[len(entries)-1].ID
+	}
+	h.audit(c, "audit_export", "", getUser(c), "success", format+", "+strconv.Itoa(exported)+" entries")
+}
+
+// AuditCheckpoint 返回签名的审计日志链头，供外部系统留存，之后可用 filehub audit verify 比对
+// 权限：admin
+func (h *Handler) AuditCheckpoint(c *gin.Context) {
+	checkpoint, err := h.Service.AuditCheckpoint(c.Request.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		Error(c, http.StatusNotFound, 10003, "audit log is empty")
+		return
+	}
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "checkpoint failed")
+		return
+	}
+	OK(c, checkpoint)
+}
+
+// auditFilter 读取查询和导出共用的过滤条件，since/until 为 RFC3339 时间
+func auditFilter(c *gin.Context) (db.AuditFilter, bool) {
+	filter := db.AuditFilter{
+		Action:    c.Query("action"),
+		Actor:     c.Query("actor"),
+		FileID:    c.Query("file_id"),
+		IPAddress: c.Query("ip"),
+		Status:    c.Query("status"),
+	}
+	for param, target := range map[string]*string{"since": &filter.Since, "until": &filter.Until} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			Error(c, http.StatusBadRequest, 10004, "invalid "+param)
+			return db.AuditFilter{}, false
+		}
+		*target = parsed.UTC().Format(time.RFC3339)
+	}
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || cursor < 1 {
+			Error(c, http.StatusBadRequest, 10004, "invalid cursor")
+			return db.AuditFilter{}, false
+		}
+		filter.Before = cursor
+	}
+	return filter, true
+}
+
+func auditResponse(entry db.AuditLog) gin.H {
+	return gin.H{
+		"id":         entry.ID,
+		"created_at": entry.CreatedAt,
+		"action":     entry.Action,
+		"actor":      entry.Actor,
+		"file_id":    entry.FileID,
+		"ip_address": entry.IPAddress,
+		"status":     entry.Status,
+		"message":    entry.Message,
+		"prev_hash":  entry.PrevHash,
+		"hash":       entry.Hash,
+	}
+}
+
+// csvCell 在可能被表格软件当作公式执行的内容前加单引号
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
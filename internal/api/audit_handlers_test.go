@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kiry163/filehub/internal/service"
+)
+
+func addAuditEntries(t *testing.T, svc *service.Service, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if err := svc.DB.AddAuditLog(context.Background(), "upload", "f1", "alice", "10.0.0.1", "success", "uploaded"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListAuditLogsPages(t *testing.T) {
+	router, svc := newTestRouter(t)
+	addAuditEntries(t, svc, 3)
+
+	type page struct {
+		Logs []struct {
+			ID    int64  `json:"id"`
+			Actor string `json:"actor"`
+		} `json:"logs"`
+		NextCursor *string `json:"next_cursor"`
+	}
+	var first page
+	decodeData(t, request(router, "GET", "/api/v1/admin/audit?actor=alice&limit=2", nil, nil), &first)
+	if len(first.Logs) != 2 || first.NextCursor == nil || first.Logs[0].ID <= first.Logs[1].ID {
+		t.Fatalf("first page: %+v", first)
+	}
+	var second page
+	decodeData(t, request(router, "GET", "/api/v1/admin/audit?actor=alice&limit=2&cursor="+*first.NextCursor, nil, nil), &second)
+	if len(second.Logs) != 1 || second.NextCursor != nil || second.Logs[0].ID >= first.Logs[1].ID {
+		t.Errorf("second page: %+v", second)
+	}
+
+	for _, query := range []string{"limit=0", "limit=1001", "cursor=x", "cursor=0", "since=yesterday", "until=2026-01-01"} {
+		if resp := request(router, "GET", "/api/v1/admin/audit?"+query, nil, nil); resp.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d %s", query, resp.Code, resp.Body.String())
+		}
+	}
+	token := loginAs(t, svc, "bob", service.RoleEditor)
+	if resp := requestAs(router, token, "GET", "/api/v1/admin/audit", nil); resp.Code != http.StatusForbidden {
+		t.Errorf("editor: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestExportAuditLogs(t *testing.T) {
+	router, svc := newTestRouter(t)
+	addAuditEntries(t, svc, 3)
+
+	tests := []struct {
+		format      string
+		status      int
+		contentType string
+		lines       int
+	}{
+		{"csv", http.StatusOK, "text/csv; charset=utf-8", 4},
+		{"ndjson", http.StatusOK, "application/x-ndjson", 3},
+		{"xml", http.StatusBadRequest, "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			resp := request(router, "GET", "/api/v1/admin/audit/export?actor=alice&format="+test.format, nil, nil)
+			if resp.Code != test.status {
+				t.Fatalf("%d %s", resp.Code, resp.Body.String())
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			if got := resp.Header().Get("Content-Type"); got != test.contentType {
+				t.Errorf("content type %q", got)
+			}
+			if !strings.Contains(resp.Header().Get("Content-Disposition"), "."+test.format) {
+				t.Errorf("content disposition %q", resp.Header().Get("Content-Disposition"))
+			}
+			if lines := strings.Count(resp.Body.String(), "\n"); lines != test.lines {
+				t.Errorf("%d lines: %s", lines, resp.Body.String())
+			}
+		})
+	}
+
+	resp := request(router, "GET", "/api/v1/admin/audit/export?actor=alice", nil, nil)
+	records, err := csv.NewReader(strings.NewReader(resp.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0][0] != "id" || records[1][2] != "upload" || records[1][3] != "alice" {
+		t.Errorf("csv: %v", records)
+	}
+}
+
+func TestAuditCheckpoint(t *testing.T) {
+	router, svc := newTestRouter(t)
+	if resp := request(router, "GET", "/api/v1/admin/audit/checkpoint", nil, nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("empty log: %d %s", resp.Code, resp.Body.String())
+	}
+	addAuditEntries(t, svc, 3)
+	var checkpoint service.AuditCheckpoint
+	decodeData(t, request(router, "GET", "/api/v1/admin/audit/checkpoint", nil, nil), &checkpoint)
+	if checkpoint.LastID != 3 || checkpoint.Hash == "" || checkpoint.Signature == "" {
+		t.Fatalf("checkpoint: %+v", checkpoint)
+	}
+	result, err := svc.VerifyAuditChain(context.Background(), []service.AuditCheckpoint{checkpoint})
+	if err != nil || !result.OK() {
+		t.Errorf("verify against the served checkpoint: %+v, %v", result, err)
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"", ""},
+		{"upload", "upload"},
+		{"=HYPERLINK(\"x\")", "'=HYPERLINK(\"x\")"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"\rcmd", "'\rcmd"},
+		{"a=b", "a=b"},
+	}
+	for _, test := range tests {
+		if got := csvCell(test.value); got != test.want {
+			t.Errorf("csvCell(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestExportAuditLogsEscapesFormulas(t *testing.T) {
+	router, svc := newTestRouter(t)
+	if err := svc.DB.AddAuditLog(context.Background(), "upload", "f1", "=cmd|' /C calc'!A0", "10.0.0.1", "success", "+1"); err != nil {
+		t.Fatal(err)
+	}
+	resp := request(router, "GET", "/api/v1/admin/audit/export?action=upload", nil, nil)
+	records, err := csv.NewReader(strings.NewReader(resp.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][3] != "'=cmd|' /C calc'!A0" || records[1][7] != "'+1" {
+		t.Errorf("csv: %q", records)
+	}
+}
@@ -12,10 +12,13 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
 )
 
 const (
 	MaxFolderDepth = 10
+	// RootFolderID 在路径中代表根目录
+	RootFolderID = "root"
 )
 
 // 请求/响应结构体
@@ -131,6 +134,7 @@ func generateRandomString12() string {
 // ==================== 文件夹管理 ====================
 
 // CreateFolder 创建文件夹
+// 权限：write
 func (h *Handler) CreateFolder(c *gin.Context) {
 	var req CreateFolderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -158,6 +162,9 @@ func (h *Handler) CreateFolder(c *gin.Context) {
 		}
 		log.Printf("[CreateFolder] 父文件夹验证通过: %v", *req.ParentID)
 	}
+	if !h.checkFolder(c, req.ParentID, service.AccessWrite) {
+		return
+	}
 
 	// 检查深度限制
 	var depth int
@@ -226,6 +233,7 @@ func (h *Handler) CreateFolder(c *gin.Context) {
 }
 
 // ListFolders 列出文件夹
+// 权限：read
 func (h *Handler) ListFolders(c *gin.Context) {
 	parentID := c.Query("parent_id")
 	var parentIDPtr *string
@@ -233,6 +241,14 @@ func (h *Handler) ListFolders(c *gin.Context) {
 		parentIDPtr = &parentID
 	}
 
+	access, ok := h.folderAccess(c)
+	if !ok {
+		return
+	}
+	if parentIDPtr != nil && !h.allowFolder(c, access, parentIDPtr, service.AccessRead) {
+		return
+	}
+
 	log.Printf("[ListFolders] 查询文件夹: parent_id=%v", parentIDPtr)
 	records, err := h.Service.DB.ListFolders(c.Request.Context(), parentIDPtr)
 	if err != nil {
@@ -244,6 +260,9 @@ func (h *Handler) ListFolders(c *gin.Context) {
 
 	folders := make([]FolderResponse, 0, len(records))
 	for _, record := range records {
+		if !access.Allows(&record.FolderID, service.AccessRead) {
+			continue
+		}
 		itemCount, _ := h.Service.DB.GetFolderItemCount(c.Request.Context(), record.FolderID)
 		folders = append(folders, FolderResponse{
 			FolderID:  record.FolderID,
@@ -258,41 +277,66 @@ func (h *Handler) ListFolders(c *gin.Context) {
 }
 
 // GetFolderContents 获取文件夹内容
+// 权限：read
 func (h *Handler) GetFolderContents(c *gin.Context) {
 	folderID := c.Param("id")
 
 	log.Printf("[GetFolderContents] 获取文件夹内容: %s", folderID)
 
-	// 获取文件夹信息
-	folder, err := h.Service.DB.GetFolder(c.Request.Context(), folderID)
-	if err != nil {
-		log.Printf("[GetFolderContents] 文件夹不存在: %s: %v", folderID, err)
-		Error(c, http.StatusNotFound, 10003, "folder not found")
+	// 获取文件夹信息（root 代表根目录）
+	var folder db.FolderRecord
+	var folderIDPtr *string
+	if folderID == RootFolderID {
+		folder = db.FolderRecord{FolderID: RootFolderID, Name: "Root"}
+	} else {
+		var err error
+		folder, err = h.Service.DB.GetFolder(c.Request.Context(), folderID)
+		if err != nil {
+			log.Printf("[GetFolderContents] 文件夹不存在: %s: %v", folderID, err)
+			Error(c, http.StatusNotFound, 10003, "folder not found")
+			return
+		}
+		folderIDPtr = &folderID
+	}
+	access, ok := h.folderAccess(c)
+	if !ok || (folderIDPtr != nil && !h.allowFolder(c, access, folderIDPtr, service.AccessRead)) {
 		return
 	}
 
-	// 获取子文件夹
-	folders, err := h.Service.DB.ListFolders(c.Request.Context(), &folderID)
+	// 获取子文件夹，跳过无权查看的
+	allFolders, err := h.Service.DB.ListFolders(c.Request.Context(), folderIDPtr)
 	if err != nil {
 		log.Printf("[GetFolderContents] 获取子文件夹失败: %s: %v", folderID, err)
 		Error(c, http.StatusInternalServerError, 19999, "list folders failed")
 		return
 	}
+	folders := make([]db.FolderRecord, 0, len(allFolders))
+	for _, subfolder := range allFolders {
+		if access.Allows(&subfolder.FolderID, service.AccessRead) {
+			folders = append(folders, subfolder)
+		}
+	}
 
-	// 获取文件
-	files, _, err := h.Service.DB.ListFilesByFolder(c.Request.Context(), &folderID, 1000, 0, "desc", "")
-	if err != nil {
-		log.Printf("[GetFolderContents] 获取文件失败: %s: %v", folderID, err)
-		Error(c, http.StatusInternalServerError, 19999, "list files failed")
-		return
+	// 获取文件；限定在某个文件夹内的 API 密钥看不到根目录下的文件
+	files := []db.FileRecord{}
+	if access.Allows(folderIDPtr, service.AccessRead) {
+		files, _, err = h.Service.DB.ListFilesByFolder(c.Request.Context(), folderIDPtr, 1000, 0, "desc", "")
+		if err != nil {
+			log.Printf("[GetFolderContents] 获取文件失败: %s: %v", folderID, err)
+			Error(c, http.StatusInternalServerError, 19999, "list files failed")
+			return
+		}
 	}
 
 	// 获取统计数据
 	folderCount := len(folders)
-	fileCount, totalSize, _ := h.Service.DB.GetFolderStats(c.Request.Context(), folderID)
+	fileCount, totalSize, _ := h.Service.DB.GetFolderStats(c.Request.Context(), folderIDPtr, access.Hidden())
 
 	// 构建面包屑
-	breadcrumbs := h.buildBreadcrumbs(c.Request.Context(), folder)
+	breadcrumbs := []BreadcrumbItem{{FolderID: nil, Name: "Root"}}
+	if folderIDPtr != nil {
+		breadcrumbs = h.buildBreadcrumbs(c.Request.Context(), folder)
+	}
 
 	// 构建文件响应
 	fileResponses := make([]gin.H, 0, len(files))
@@ -302,6 +346,7 @@ func (h *Handler) GetFolderContents(c *gin.Context) {
 			"original_name": file.OriginalName,
 			"size":          file.Size,
 			"mime_type":     file.MimeType,
+			"sha256":        file.SHA256,
 			"filehub_url":   "filehub://" + file.FileID,
 			"created_at":    file.CreatedAt,
 			"download_url":  h.buildDownloadURL(c, file.FileID),
@@ -359,6 +404,7 @@ func (h *Handler) buildBreadcrumbs(ctx context.Context, folder db.FolderRecord)
 }
 
 // UpdateFolder 重命名文件夹
+// 权限：write
 func (h *Handler) UpdateFolder(c *gin.Context) {
 	folderID := c.Param("id")
 
@@ -368,16 +414,31 @@ func (h *Handler) UpdateFolder(c *gin.Context) {
 		Error(c, http.StatusNotFound, 10003, "folder not found")
 		return
 	}
+	if !h.checkFolder(c, &folderID, service.AccessWrite) {
+		return
+	}
+
+	var req UpdateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 10004, "invalid request")
+		return
+	}
 
 	// 验证名称
-	if err := validateFolderName(c.PostForm("name")); err != nil {
+	if err := validateFolderName(req.Name); err != nil {
 		Error(c, http.StatusBadRequest, 10004, err.Error())
 		return
 	}
 
-	newName := c.PostForm("name")
+	newName := strings.TrimSpace(req.Name)
 	if newName == folder.Name {
 		h.audit(c, "rename_folder", folderID, getUser(c), "success", "")
+		OK(c, gin.H{
+			"folder_id":  folder.FolderID,
+			"name":       folder.Name,
+			"parent_id":  folder.ParentID,
+			"updated_at": folder.UpdatedAt,
+		})
 		return
 	}
 
@@ -410,6 +471,7 @@ func (h *Handler) UpdateFolder(c *gin.Context) {
 }
 
 // MoveFolder 移动文件夹
+// 权限：write
 func (h *Handler) MoveFolder(c *gin.Context) {
 	folderID := c.Param("id")
 
@@ -425,43 +487,53 @@ func (h *Handler) MoveFolder(c *gin.Context) {
 		Error(c, http.StatusNotFound, 10003, "folder not found")
 		return
 	}
+	access, ok := h.folderAccess(c)
+	if !ok || !h.allowFolder(c, access, &folderID, service.AccessWrite) {
+		return
+	}
 
-	// 不能移动到自己
-	if *req.ParentID == folderID {
-		Error(c, http.StatusBadRequest, 10013, "cannot move folder to itself")
+	// 目标位置同样需要写权限，否则可借移动绕过目标目录的 ACL
+	if !h.allowFolder(c, access, req.ParentID, service.AccessWrite) {
 		return
 	}
 
-	// 检查目标文件夹是否存在
+	// 移动到根目录时无需检查目标
 	if req.ParentID != nil {
+		// 不能移动到自己
+		if *req.ParentID == folderID {
+			Error(c, http.StatusBadRequest, 10013, "cannot move folder to itself")
+			return
+		}
+
+		// 检查目标文件夹是否存在
 		_, err := h.Service.DB.GetFolder(c.Request.Context(), *req.ParentID)
 		if err != nil {
 			Error(c, http.StatusNotFound, 10003, "target folder not found")
 			return
 		}
-	}
 
-	// 检查循环引用（不能移动到自己内部）
-	isDescendant, err := h.Service.DB.IsDescendant(c.Request.Context(), folderID, *req.ParentID)
-	if err != nil || isDescendant {
-		log.Printf("[MoveFolder] 检查循环引用失败: %v", err)
-		Error(c, http.StatusBadRequest, 10013, "cannot move folder to its own subdirectory")
-		return
-	}
+		// 检查循环引用（不能移动到自己内部）
+		isDescendant, err := h.Service.DB.IsDescendant(c.Request.Context(), folderID, *req.ParentID)
+		if err != nil || isDescendant {
+			log.Printf("[MoveFolder] 检查循环引用失败: %v", err)
+			Error(c, http.StatusBadRequest, 10013, "cannot move folder to its own subdirectory")
+			return
+		}
 
-	// 检查深度限制
-	log.Printf("[MoveFolder] 检查深度: current=%s, target=%s", folder.FolderID, *req.ParentID)
-	targetDepth, _ := h.Service.DB.GetFolderDepth(c.Request.Context(), *req.ParentID)
-	if err != nil {
-		log.Printf("[MoveFolder] 目标文件夹深度检查失败: %v", err)
-		Error(c, http.StatusInternalServerError, 19999, "depth check failed")
-		return
-	}
-	log.Printf("[MoveFolder] 当前文件夹深度: %d, 移动后深度: %d", targetDepth)
+		// 检查深度限制
+		log.Printf("[MoveFolder] 检查深度: current=%s, target=%s", folder.FolderID, *req.ParentID)
+		targetDepth, err := h.Service.DB.GetFolderDepth(c.Request.Context(), *req.ParentID)
+		if err != nil {
+			log.Printf("[MoveFolder] 目标文件夹深度检查失败: %v", err)
+			Error(c, http.StatusInternalServerError, 19999, "depth check failed")
+			return
+		}
+		log.Printf("[MoveFolder] 目标文件夹深度: %d, 移动后深度: %d", targetDepth, targetDepth+1)
 
-	if targetDepth+1 >= MaxFolderDepth {
-		Error(c, http.StatusBadRequest, 10012, "max folder depth exceeded (10)")
-		return
+		if targetDepth+1 >= MaxFolderDepth {
+			Error(c, http.StatusBadRequest, 10012, "max folder depth exceeded (10)")
+			return
+		}
 	}
 
 	// 检查同名（排除自己）
@@ -480,35 +552,45 @@ func (h *Handler) MoveFolder(c *gin.Context) {
 		Error(c, http.StatusInternalServerError, 19999, "move folder failed")
 		return
 	}
-	log.Printf("[MoveFolder] 移动文件夹成功: %s -> %s", folderID, *req.ParentID)
+	log.Printf("[MoveFolder] 移动文件夹成功: %s -> %v", folderID, req.ParentID)
 	h.audit(c, "move_folder", folderID, getUser(c), "success", "")
 	Message(c, "moved")
 }
 
-// DeleteFolder 删除文件夹
+// DeleteFolder 将空文件夹移入回收站，回收站中的内容不算在内
+// 权限：write
 func (h *Handler) DeleteFolder(c *gin.Context) {
 	folderID := c.Param("id")
 
 	log.Printf("[DeleteFolder] 开始删除文件夹: %s", folderID)
 
+	if _, err := h.Service.DB.GetFolder(c.Request.Context(), folderID); err != nil {
+		h.audit(c, "delete_folder", folderID, getUser(c), "failure", "not found")
+		Error(c, http.StatusNotFound, 10003, "folder not found")
+		return
+	}
+	if !h.checkFolder(c, &folderID, service.AccessWrite) {
+		return
+	}
+
 	// 检查是否为空
 	itemCount, err := h.Service.DB.GetFolderItemCount(c.Request.Context(), folderID)
 	if err != nil {
-		log.Printf("[DeleteFolder] 检查文件夹内容失败: %s", err)
+		log.Printf("[DeleteFolder] 检查文件夹内容失败: %v", err)
 		Error(c, http.StatusInternalServerError, 19999, "check folder contents failed")
 		return
 	}
-	log.Printf("[DeleteFolder] 文件夹内容检查完成: %s 个项目", itemCount)
+	log.Printf("[DeleteFolder] 文件夹内容检查完成: %d 个项目", itemCount)
 
 	if itemCount > 0 {
-		log.Printf("[DeleteFolder] 文件夹非空: %s 个项目", itemCount)
+		log.Printf("[DeleteFolder] 文件夹非空: %d 个项目", itemCount)
 		h.audit(c, "delete_folder", folderID, getUser(c), "failure", "folder not empty")
 		Error(c, http.StatusConflict, 10011, "folder is not empty")
 		return
 	}
 
 	// 删除文件夹
-	if err := h.Service.DB.DeleteFolder(c.Request.Context(), folderID); err != nil {
+	if err := h.Service.DB.TrashFolder(c.Request.Context(), folderID, getUser(c)); err != nil {
 		log.Printf("[DeleteFolder] 删除文件夹失败: %v", err)
 		h.audit(c, "delete_folder", folderID, getUser(c), "failure", "delete failed")
 		Error(c, http.StatusInternalServerError, 19999, "delete failed")
@@ -520,6 +602,7 @@ func (h *Handler) DeleteFolder(c *gin.Context) {
 }
 
 // GetFolderViewURL 获取文件夹访问链接
+// 权限：read
 func (h *Handler) GetFolderViewURL(c *gin.Context) {
 	folderID := c.Param("id")
 
@@ -530,6 +613,9 @@ func (h *Handler) GetFolderViewURL(c *gin.Context) {
 		Error(c, http.StatusNotFound, 10003, "folder not found")
 		return
 	}
+	if !h.checkFolder(c, &folderID, service.AccessRead) {
+		return
+	}
 
 	url := h.buildBaseURL(c) + "/app/folders/" + folderID
 	OK(c, gin.H{"url": url})
@@ -538,6 +624,7 @@ func (h *Handler) GetFolderViewURL(c *gin.Context) {
 // ==================== 文件移动相关 ====================
 
 // MoveFile 移动文件到文件夹
+// 权限：write
 func (h *Handler) MoveFile(c *gin.Context) {
 	fileID := c.Param("id")
 
@@ -548,22 +635,29 @@ func (h *Handler) MoveFile(c *gin.Context) {
 	}
 
 	// 获取文件
-	file, err := h.Service.DB.GetFileWithFolder(c.Request.Context(), fileID)
+	file, err := h.Service.DB.GetFile(c.Request.Context(), fileID)
 	if err != nil {
 		Error(c, http.StatusNotFound, 10003, "file not found")
 		return
 	}
+	access, ok := h.folderAccess(c)
+	if !ok || !h.allowFolder(c, access, file.FolderID, service.AccessWrite) {
+		return
+	}
 
 	// 检查目标文件夹是否存在（如果指定了）
 	if req.FolderID != nil {
 		_, err := h.Service.DB.GetFolder(c.Request.Context(), *req.FolderID)
 		if err != nil {
-			log.Printf("[MoveFile] 目标文件夹不存在: %s", *req.FolderID, err)
+			log.Printf("[MoveFile] 目标文件夹不存在: %s: %v", *req.FolderID, err)
 			Error(c, http.StatusNotFound, 10003, "target folder not found")
 			return
 		}
 		log.Printf("[MoveFile] 目标文件夹验证通过: %s", *req.FolderID)
 	}
+	if !h.allowFolder(c, access, req.FolderID, service.AccessWrite) {
+		return
+	}
 
 	// 检查同名文件
 	files, _, err := h.Service.DB.ListFilesByFolder(c.Request.Context(), req.FolderID, 1000, 0, "desc", "")
@@ -572,7 +666,7 @@ func (h *Handler) MoveFile(c *gin.Context) {
 		Error(c, http.StatusInternalServerError, 19999, "check files failed")
 		return
 	}
-	log.Printf("[MoveFile] 开始检查同名文件，当前文件夹: %s, 共有 %d 个文件", req.FolderID, len(files))
+	log.Printf("[MoveFile] 开始检查同名文件，当前文件夹: %v, 共有 %d 个文件", req.FolderID, len(files))
 
 	for _, f := range files {
 		if f.OriginalName == file.OriginalName && f.FileID != fileID {
@@ -591,22 +685,26 @@ func (h *Handler) MoveFile(c *gin.Context) {
 		Error(c, http.StatusInternalServerError, 19999, "move file failed")
 		return
 	}
-	log.Printf("[MoveFile] 移动文件成功: %s -> %s", fileID, *req.FolderID)
+	log.Printf("[MoveFile] 移动文件成功: %s -> %v", fileID, req.FolderID)
 
 	h.audit(c, "move_file", fileID, getUser(c), "success", "")
 	Message(c, "moved")
 }
 
 // GetFileViewURL 获取文件访问页面链接
+// 权限：read
 func (h *Handler) GetFileViewURL(c *gin.Context) {
 	fileID := c.Param("id")
 
 	// 验证文件存在
-	_, err := h.Service.DB.GetFile(c.Request.Context(), fileID)
+	file, err := h.Service.DB.GetFile(c.Request.Context(), fileID)
 	if err != nil {
 		Error(c, http.StatusNotFound, 10003, "file not found")
 		return
 	}
+	if !h.checkFolder(c, file.FolderID, service.AccessRead) {
+		return
+	}
 
 	url := h.buildBaseURL(c) + "/app/files/" + fileID
 	OK(c, gin.H{"url": url})
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUpdateFolder(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		want        string
+	}{
+		{"rename", "application/json", `{"name": "reports & notes"}`, http.StatusOK, "reports & notes"},
+		{"surrounding spaces", "application/json", `{"name": "  reports  "}`, http.StatusOK, "reports"},
+		{"same name", "application/json", `{"name": "docs"}`, http.StatusOK, "docs"},
+		{"sibling name", "application/json", `{"name": "other"}`, http.StatusConflict, "docs"},
+		{"invalid characters", "application/json", `{"name": "a/b"}`, http.StatusBadRequest, "docs"},
+		{"missing name", "application/json", `{}`, http.StatusBadRequest, "docs"},
+		{"form body", "application/x-www-form-urlencoded", "name=reports", http.StatusBadRequest, "docs"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router, svc := newTestRouter(t)
+			addTestFolder(t, svc, "docs", "docs", nil)
+			addTestFolder(t, svc, "other", "other", nil)
+			resp := request(router, "PUT", "/api/v1/folders/docs", strings.NewReader(test.body), map[string]string{"Content-Type": test.contentType})
+			if resp.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", resp.Code, test.status, resp.Body.String())
+			}
+			folder, err := svc.DB.GetFolder(context.Background(), "docs")
+			if err != nil || folder.Name != test.want {
+				t.Errorf("folder name %q, %v, want %q", folder.Name, err, test.want)
+			}
+		})
+	}
+}
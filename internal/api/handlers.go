@@ -1,23 +1,25 @@
 package api
 
 import (
-	"crypto/rand"
-	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"io"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/ratelimit"
 	"github.com/kiry163/filehub/internal/service"
 )
 
 type Handler struct {
 	Service *service.Service
+	Limiter ratelimit.Limiter
 }
 
 type loginRequest struct {
@@ -25,14 +27,22 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
+type mfaLoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
 type refreshRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+// Health 健康检查
 func (h *Handler) Health(c *gin.Context) {
 	OK(c, gin.H{"status": "ok", "time": time.Now().UTC().Format(time.RFC3339)})
 }
 
+// Login 用户名密码登录，返回访问令牌和刷新令牌；
+// 开启了两步验证的用户返回 mfa_required 和 mfa_token，需再调用 LoginMFA
 func (h *Handler) Login(c *gin.Context) {
 	var req loginRequest
 	if err := c.ShouldBindJSON(&req); err != nil || req.Username == "" || req.Password == "" {
@@ -40,16 +50,48 @@ func (h *Handler) Login(c *gin.Context) {
 		h.audit(c, "login", "", req.Username, "failure", "invalid request")
 		return
 	}
-	tokens, err := h.Service.Login(c.Request.Context(), req.Username, req.Password)
+	tokens, challenge, err := h.Service.Login(c.Request.Context(), req.Username, req.Password, clientInfo(c))
 	if err != nil {
+		markFailure(c)
 		Error(c, http.StatusUnauthorized, 10008, "login failed")
 		h.audit(c, "login", "", req.Username, "failure", "login failed")
 		return
 	}
+	if challenge != nil {
+		OK(c, gin.H{"mfa_required": true, "mfa_token": challenge.Token, "expires_in": challenge.ExpiresIn})
+		return
+	}
 	h.audit(c, "login", "", req.Username, "success", "")
 	OK(c, tokens)
 }
 
+// LoginMFA 用 mfa_token 加两步验证码或恢复码完成登录
+func (h *Handler) LoginMFA(c *gin.Context) {
+	var req mfaLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		Error(c, http.StatusBadRequest, 10004, "invalid request")
+		return
+	}
+	tokens, user, method, err := h.Service.LoginMFA(c.Request.Context(), req.MFAToken, req.Code, clientInfo(c))
+	if err != nil {
+		actor := user.Username
+		if actor == "" {
+			actor = "system"
+		}
+		markFailure(c)
+		if errors.Is(err, service.ErrTOTPCode) {
+			Error(c, http.StatusUnauthorized, 10008, err.Error())
+		} else {
+			Error(c, http.StatusUnauthorized, 10008, "login failed")
+		}
+		h.audit(c, "login", "", actor, "failure", "mfa: "+err.Error())
+		return
+	}
+	h.audit(c, "login", "", user.Username, "success", method)
+	OK(c, tokens)
+}
+
+// Refresh 用刷新令牌换取新的令牌
 func (h *Handler) Refresh(c *gin.Context) {
 	var req refreshRequest
 	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
@@ -57,18 +99,25 @@ func (h *Handler) Refresh(c *gin.Context) {
 		h.audit(c, "refresh", "", "system", "failure", "invalid request")
 		return
 	}
-	tokens, err := h.Service.Refresh(c.Request.Context(), req.RefreshToken)
+	tokens, err := h.Service.Refresh(c.Request.Context(), req.RefreshToken, clientInfo(c))
 	if err != nil {
+		markFailure(c)
 		Error(c, http.StatusUnauthorized, 10009, "refresh token invalid")
-		h.audit(c, "refresh", "", "system", "failure", "refresh failed")
+		message := "refresh failed"
+		if errors.Is(err, service.ErrRefreshReused) {
+			message = "reuse detected, session revoked"
+		}
+		h.audit(c, "refresh", "", "system", "failure", message)
 		return
 	}
 	h.audit(c, "refresh", "", "system", "success", "")
 	OK(c, tokens)
 }
 
+// Logout 结束当前会话，同一用户在其他设备上的会话不受影响
+// 权限：登录即可
 func (h *Handler) Logout(c *gin.Context) {
-	if err := h.Service.Logout(c.Request.Context()); err != nil {
+	if err := h.Service.Logout(c.Request.Context(), c.GetString("session_id")); err != nil {
 		Error(c, http.StatusInternalServerError, 19999, "logout failed")
 		h.audit(c, "logout", "", getUser(c), "failure", "logout failed")
 		return
@@ -77,6 +126,8 @@ func (h *Handler) Logout(c *gin.Context) {
 	Message(c, "logged_out")
 }
 
+// UploadFile 上传文件（multipart 字段 file）
+// 权限：upload
 func (h *Handler) UploadFile(c *gin.Context) {
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -104,6 +155,9 @@ func (h *Handler) UploadFile(c *gin.Context) {
 		}
 		folderIDPtr = &folderID
 	}
+	if !h.checkFolder(c, folderIDPtr, service.AccessWrite) {
+		return
+	}
 
 	user := getUser(c)
 	record, err := h.Service.Upload(c.Request.Context(), file, user, folderIDPtr)
@@ -118,11 +172,62 @@ func (h *Handler) UploadFile(c *gin.Context) {
 		"filehub_url":   "filehub://" + record.FileID,
 		"original_name": record.OriginalName,
 		"size":          record.Size,
+		"sha256":        record.SHA256,
+		"created_at":    record.CreatedAt,
+		"download_url":  h.buildDownloadURL(c, record.FileID),
+	})
+}
+
+// UploadRaw 将请求体直接流式写入存储，无需 multipart 封装
+// 权限：upload
+func (h *Handler) UploadRaw(c *gin.Context) {
+	name := strings.TrimSpace(filepath.Base(c.Query("name")))
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		Error(c, http.StatusBadRequest, 10004, "name required")
+		h.audit(c, "upload", "", getUser(c), "failure", "name required")
+		return
+	}
+
+	folderID := c.Query("folder_id")
+	var folderIDPtr *string
+	if folderID != "" {
+		if _, err := h.Service.DB.GetFolder(c.Request.Context(), folderID); err != nil {
+			Error(c, http.StatusNotFound, 10003, "folder not found")
+			h.audit(c, "upload", "", getUser(c), "failure", "folder not found")
+			return
+		}
+		folderIDPtr = &folderID
+	}
+	if !h.checkFolder(c, folderIDPtr, service.AccessWrite) {
+		return
+	}
+
+	user := getUser(c)
+	record, err := h.Service.UploadStream(c.Request.Context(), c.Request.Body, c.Request.ContentLength, name, user, folderIDPtr)
+	if err != nil {
+		if errors.Is(err, service.ErrFileTooLarge) {
+			Error(c, http.StatusRequestEntityTooLarge, 10004, "file too large")
+			h.audit(c, "upload", "", user, "failure", "file too large")
+			return
+		}
+		Error(c, http.StatusUnprocessableEntity, 10005, "upload failed")
+		h.audit(c, "upload", "", user, "failure", "upload failed")
+		return
+	}
+	h.audit(c, "upload", record.FileID, user, "success", "raw")
+	OK(c, gin.H{
+		"file_id":       record.FileID,
+		"filehub_url":   "filehub://" + record.FileID,
+		"original_name": record.OriginalName,
+		"size":          record.Size,
+		"sha256":        record.SHA256,
 		"created_at":    record.CreatedAt,
 		"download_url":  h.buildDownloadURL(c, record.FileID),
 	})
 }
 
+// GetFile 获取文件元数据
+// 权限：read
 func (h *Handler) GetFile(c *gin.Context) {
 	fileID := c.Param("id")
 	record, err := h.Service.GetFile(c.Request.Context(), fileID)
@@ -130,17 +235,25 @@ func (h *Handler) GetFile(c *gin.Context) {
 		Error(c, http.StatusNotFound, 10003, "not found")
 		return
 	}
+	if !h.checkFolder(c, record.FolderID, service.AccessRead) {
+		return
+	}
 	OK(c, gin.H{
 		"file_id":       record.FileID,
 		"original_name": record.OriginalName,
 		"size":          record.Size,
 		"mime_type":     record.MimeType,
+		"sha256":        record.SHA256,
+		"md5":           record.MD5,
+		"version":       record.Version,
 		"filehub_url":   "filehub://" + record.FileID,
 		"created_at":    record.CreatedAt,
 		"download_url":  h.buildDownloadURL(c, record.FileID),
 	})
 }
 
+// ListFiles 分页列出文件
+// 权限：read
 func (h *Handler) ListFiles(c *gin.Context) {
 	limit := parseInt(c.DefaultQuery("limit", "20"), 20)
 	offset := parseInt(c.DefaultQuery("offset", "0"), 0)
@@ -153,7 +266,14 @@ func (h *Handler) ListFiles(c *gin.Context) {
 		folderIDPtr = &folderID
 	}
 
-	records, total, err := h.Service.ListFiles(c.Request.Context(), limit, offset, order, keyword, folderIDPtr)
+	access, ok := h.folderAccess(c)
+	if !ok {
+		return
+	}
+	if folderIDPtr != nil && !h.allowFolder(c, access, folderIDPtr, service.AccessRead) {
+		return
+	}
+	records, total, err := h.Service.ListFiles(c.Request.Context(), limit, offset, order, keyword, folderIDPtr, access.Hidden())
 	if err != nil {
 		Error(c, http.StatusInternalServerError, 19999, "list failed")
 		return
@@ -164,6 +284,7 @@ func (h *Handler) ListFiles(c *gin.Context) {
 			"file_id":       record.FileID,
 			"original_name": record.OriginalName,
 			"size":          record.Size,
+			"sha256":        record.SHA256,
 			"filehub_url":   "filehub://" + record.FileID,
 			"created_at":    record.CreatedAt,
 			"download_url":  h.buildDownloadURL(c, record.FileID),
@@ -172,19 +293,20 @@ func (h *Handler) ListFiles(c *gin.Context) {
 	OK(c, gin.H{"total": total, "files": files})
 }
 
+// PreviewFile 生成短期有效的预览地址
+// 权限：read
 func (h *Handler) PreviewFile(c *gin.Context) {
 	fileID := c.Param("id")
-	actor, ok := h.authorize(c)
-	if !ok {
-		Error(c, http.StatusUnauthorized, 10001, "unauthorized")
-		return
-	}
-	_, err := h.Service.GetFile(c.Request.Context(), fileID)
+	actor := getUser(c)
+	record, err := h.Service.GetFile(c.Request.Context(), fileID)
 	if err != nil {
 		Error(c, http.StatusNotFound, 10003, "not found")
 		h.audit(c, "preview", fileID, actor, "failure", "not found")
 		return
 	}
+	if !h.checkFolder(c, record.FolderID, service.AccessRead) {
+		return
+	}
 	token, err := h.Service.NewPreviewToken(fileID, 10*time.Minute)
 	if err != nil {
 		Error(c, http.StatusInternalServerError, 19999, "preview failed")
@@ -196,6 +318,8 @@ func (h *Handler) PreviewFile(c *gin.Context) {
 	OK(c, gin.H{"url": url})
 }
 
+// StreamFile 凭预览令牌输出文件内容
+// 权限：无需登录，凭预览令牌访问
 func (h *Handler) StreamFile(c *gin.Context) {
 	token := c.Query("token")
 	claims, err := h.Service.ParsePreviewToken(token)
@@ -215,9 +339,15 @@ func (h *Handler) StreamFile(c *gin.Context) {
 	}
 }
 
+// DeleteFile 将文件移入回收站
+// 权限：write
 func (h *Handler) DeleteFile(c *gin.Context) {
 	fileID := c.Param("id")
-	_, err := h.Service.DeleteFile(c.Request.Context(), fileID)
+	record, err := h.Service.GetFile(c.Request.Context(), fileID)
+	if err == nil && !h.checkFolder(c, record.FolderID, service.AccessWrite) {
+		return
+	}
+	_, err = h.Service.DeleteFile(c.Request.Context(), fileID, getUser(c))
 	if err != nil {
 		Error(c, http.StatusNotFound, 10003, "not found")
 		h.audit(c, "delete", fileID, getUser(c), "failure", "not found")
@@ -227,6 +357,8 @@ func (h *Handler) DeleteFile(c *gin.Context) {
 	Message(c, "deleted")
 }
 
+// DownloadFile 下载文件，支持 Range，?version=N 下载指定版本
+// 权限：read
 func (h *Handler) DownloadFile(c *gin.Context) {
 	fileID := c.Param("id")
 	record, err := h.Service.GetFile(c.Request.Context(), fileID)
@@ -235,79 +367,26 @@ func (h *Handler) DownloadFile(c *gin.Context) {
 		h.audit(c, "download", fileID, getUser(c), "failure", "not found")
 		return
 	}
-	if err := h.streamObject(c, record, false); err != nil {
-		Error(c, http.StatusInternalServerError, 10006, "download failed")
-		h.audit(c, "download", fileID, getUser(c), "failure", "stream error")
-		return
-	}
-	h.audit(c, "download", fileID, getUser(c), "success", "")
-}
-
-func (h *Handler) ShareFile(c *gin.Context) {
-	fileID := c.Param("id")
-	_, err := h.Service.GetFile(c.Request.Context(), fileID)
-	if err != nil {
-		Error(c, http.StatusNotFound, 10003, "not found")
-		h.audit(c, "share", fileID, getUser(c), "failure", "not found")
-		return
-	}
-
-	now := time.Now().UTC()
-	link, err := h.Service.DB.GetActiveShareLink(c.Request.Context(), fileID, now.Format(time.RFC3339))
-	if err == nil {
-		h.audit(c, "share", fileID, getUser(c), "success", "reused")
-		OK(c, gin.H{"url": h.buildShareDownloadURL(c, link.Token), "expires_at": link.ExpiresAt})
-		return
-	}
-	if !errors.Is(err, sql.ErrNoRows) {
-		Error(c, http.StatusInternalServerError, 19999, "share failed")
-		h.audit(c, "share", fileID, getUser(c), "failure", "query failed")
+	if !h.checkFolder(c, record.FolderID, service.AccessRead) {
 		return
 	}
-
-	expiresAt := now.Add(7 * 24 * time.Hour)
-	link = db.ShareLink{
-		Token:     generateShareToken(32),
-		FileID:    fileID,
-		ExpiresAt: expiresAt.Format(time.RFC3339),
-		CreatedAt: now.Format(time.RFC3339),
-		CreatedBy: getUser(c),
-		Status:    "active",
-	}
-	if err := h.Service.DB.CreateShareLink(c.Request.Context(), link); err != nil {
-		Error(c, http.StatusInternalServerError, 19999, "share failed")
-		h.audit(c, "share", fileID, getUser(c), "failure", "create failed")
-		return
-	}
-	h.audit(c, "share", fileID, getUser(c), "success", "created")
-	OK(c, gin.H{"url": h.buildShareDownloadURL(c, link.Token), "expires_at": link.ExpiresAt})
-}
-
-func (h *Handler) DownloadShare(c *gin.Context) {
-	token := c.Param("token")
-	link, err := h.Service.DB.GetShareLink(c.Request.Context(), token)
-	if err != nil {
-		c.Status(http.StatusNotFound)
-		return
-	}
-	if link.Status != "active" {
-		c.Status(http.StatusNotFound)
-		return
-	}
-	expiresAt, err := time.Parse(time.RFC3339, link.ExpiresAt)
-	if err != nil || time.Now().UTC().After(expiresAt) {
-		c.Status(http.StatusNotFound)
-		return
-	}
-	record, err := h.Service.GetFile(c.Request.Context(), link.FileID)
-	if err != nil {
-		c.Status(http.StatusNotFound)
-		return
+	if value := c.Query("version"); value != "" {
+		version, err := strconv.Atoi(value)
+		if err == nil {
+			record, err = h.Service.FileAtVersion(c.Request.Context(), record, version)
+		}
+		if err != nil {
+			Error(c, http.StatusNotFound, 10003, "version not found")
+			h.audit(c, "download", fileID, getUser(c), "failure", "version not found")
+			return
+		}
 	}
 	if err := h.streamObject(c, record, false); err != nil {
-		c.Status(http.StatusInternalServerError)
+		Error(c, http.StatusInternalServerError, 10006, "download failed")
+		h.audit(c, "download", fileID, getUser(c), "failure", "stream error")
 		return
 	}
+	h.audit(c, "download", fileID, getUser(c), "success", "")
 }
 
 func getUser(c *gin.Context) string {
@@ -339,12 +418,6 @@ func (h *Handler) buildPreviewStreamURL(c *gin.Context, token string) string {
 	return h.buildBaseURL(c) + "/api/v1/files/stream?token=" + token
 }
 
-func generateShareToken(length int) string {
-	buf := make([]byte, length)
-	_, _ = rand.Read(buf)
-	return base64.RawURLEncoding.EncodeToString(buf)
-}
-
 func (h *Handler) buildBaseURL(c *gin.Context) string {
 	if h.Service.Config.Server.PublicEndpoint != "" {
 		return h.Service.Config.Server.PublicEndpoint
@@ -413,19 +486,16 @@ func (h *Handler) audit(c *gin.Context, action, fileID, actor, status, message s
 	_ = h.Service.DB.AddAuditLog(c.Request.Context(), action, fileID, actor, c.ClientIP(), status, message)
 }
 
-func (h *Handler) authorize(c *gin.Context) (string, bool) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
-		claims, err := h.Service.ParseAccessToken(strings.TrimPrefix(authHeader, "Bearer "))
-		if err == nil {
-			return claims.Subject, true
-		}
+// setChecksumHeaders exposes the stored SHA-256 as a strong ETag and as an
+// RFC 3230 Digest of the full representation.
+func setChecksumHeaders(c *gin.Context, record db.FileRecord) {
+	if record.SHA256 == "" {
+		return
 	}
-	localKey := c.GetHeader("X-Local-Key")
-	if localKey != "" && localKey == h.Service.Config.Auth.LocalKey {
-		return "local", true
+	c.Header("ETag", "\""+record.SHA256+"\"")
+	if sum, err := hex.DecodeString(record.SHA256); err == nil {
+		c.Header("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum))
 	}
-	return "", false
 }
 
 func (h *Handler) streamObject(c *gin.Context, record db.FileRecord, inline bool) error {
@@ -451,6 +521,7 @@ func (h *Handler) streamObject(c *gin.Context, record db.FileRecord, inline bool
 	c.Header("Accept-Ranges", "bytes")
 	c.Header("Content-Type", objectInfo.ContentType)
 	c.Header("Content-Disposition", disposition+"; filename=\""+record.OriginalName+"\"")
+	setChecksumHeaders(c, record)
 	if partial {
 		c.Status(http.StatusPartialContent)
 		c.Header("Content-Range", buildContentRange(*start, *end, objectInfo.Size))
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// endlessBody serves an unbounded stream of bytes and counts how many were
+// read, so a test can tell where the server stopped reading.
+type endlessBody struct {
+	read int64
+}
+
+func (e *endlessBody) Read(buf []byte) (int, error) {
+	for i := range buf {
+		buf[i] = 'x'
+	}
+	e.read += int64(len(buf))
+	return len(buf), nil
+}
+
+// storedObjects counts the objects in the test router's storage.
+func storedObjects(t *testing.T, root string) int {
+	t.Helper()
+	count := 0
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err == nil && !info.IsDir() {
+			count++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestUploadRawLimits(t *testing.T) {
+	const maxBytes = 1 << 20
+	tests := []struct {
+		name    string
+		path    string
+		body    io.Reader
+		chunked bool
+		status  int
+		size    int64
+	}{
+		{"declared length", "/api/v1/files/raw?name=a.txt", strings.NewReader("hello"), false, http.StatusOK, 5},
+		{"chunked body", "/api/v1/files/raw?name=a.txt", strings.NewReader("hello"), true, http.StatusOK, 5},
+		{"chunked body at the limit", "/api/v1/files/raw?name=a.bin", io.LimitReader(&endlessBody{}, maxBytes), true, http.StatusOK, maxBytes},
+		{"declared length over the limit", "/api/v1/files/raw?name=a.bin", io.LimitReader(&endlessBody{}, maxBytes+1), false, http.StatusRequestEntityTooLarge, 0},
+		{"chunked body over the limit", "/api/v1/files/raw?name=a.bin", io.LimitReader(&endlessBody{}, maxBytes+1), true, http.StatusRequestEntityTooLarge, 0},
+		{"missing name", "/api/v1/files/raw", strings.NewReader("hello"), false, http.StatusBadRequest, 0},
+		{"unknown folder", "/api/v1/files/raw?name=a.txt&folder_id=nope", strings.NewReader("hello"), false, http.StatusNotFound, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router, svc := newTestRouter(t)
+			req := httptestRequest("PUT", test.path, test.body)
+			req.ContentLength = bodyLength(test.body)
+			if test.chunked {
+				req.ContentLength = -1
+			}
+			resp := serve(router, req)
+			if resp.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", resp.Code, test.status, resp.Body.String())
+			}
+			want := 0
+			if test.status == http.StatusOK {
+				var data struct {
+					Size int64 `json:"size"`
+				}
+				decodeData(t, resp, &data)
+				if data.Size != test.size {
+					t.Errorf("stored %d bytes, want %d", data.Size, test.size)
+				}
+				want = 1
+			}
+			if got := storedObjects(t, svc.Config.Storage.Path); got != want {
+				t.Errorf("%d objects stored, want %d", got, want)
+			}
+		})
+	}
+}
+
+// TestUploadRawStopsReadingOverLimit checks the limit is applied while the
+// body streams in rather than after it has all been read.
+func TestUploadRawStopsReadingOverLimit(t *testing.T) {
+	router, _ := newTestRouter(t)
+	body := &endlessBody{}
+	resp := serve(router, httptestRequest("PUT", "/api/v1/files/raw?name=big.bin", body))
+	if resp.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status %d: %s", resp.Code, resp.Body.String())
+	}
+	if body.read > 2<<20 {
+		t.Errorf("read %d bytes of an endless body", body.read)
+	}
+}
@@ -1,29 +1,55 @@
 package api
 
 import (
+	"crypto/subtle"
+	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/db"
 	"github.com/kiry163/filehub/internal/service"
 )
 
+// AuthMiddleware 接受访问令牌、API 密钥（X-API-Key 或 Bearer fhk_...），以及开启时的 auth.local_key
 func AuthMiddleware(svc *service.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
-		if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			claims, err := svc.ParseAccessToken(tokenString)
+		keyString := c.GetHeader("X-API-Key")
+		if bearer, ok := strings.CutPrefix(authHeader, "Bearer "); ok && strings.HasPrefix(bearer, service.APIKeyPrefix) {
+			keyString = bearer
+		}
+		if keyString != "" {
+			// API 密钥以所有者身份访问，审计中的操作者为密钥名称
+			key, owner, err := svc.AuthenticateAPIKey(c.Request.Context(), keyString)
 			if err == nil {
-				c.Set("user", claims.Subject)
+				setUser(c, owner.UserID, key.Name, owner.Role)
+				c.Set("api_key", key)
 				c.Next()
 				return
 			}
+		} else if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
+			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+			claims, err := svc.ParseAccessToken(tokenString)
+			if err == nil {
+				// 令牌签发后被禁用或删除的用户立即失效
+				user, err := svc.ActiveUser(c.Request.Context(), claims.Subject)
+				// 会话被撤销（登出、踢下线、刷新令牌被重放）后其访问令牌也随之失效；
+				// 不带会话 ID 的令牌一律拒绝
+				if err == nil && claims.ID != "" && svc.SessionActive(c.Request.Context(), claims.ID) {
+					setUser(c, user.UserID, user.Username, user.Role)
+					c.Set("session_id", claims.ID)
+					c.Next()
+					return
+				}
+			}
 		}
 
+		// 已弃用的共享密钥，需显式开启 auth.local_key_enabled
 		localKey := c.GetHeader("X-Local-Key")
-		if localKey != "" && svc.Config.Auth.LocalKey != "" && localKey == svc.Config.Auth.LocalKey {
-			c.Set("user", "local")
+		if svc.Config.Auth.LocalKeyEnabled && localKey != "" && svc.Config.Auth.LocalKey != "" &&
+			subtle.ConstantTimeCompare([]byte(localKey), []byte(svc.Config.Auth.LocalKey)) == 1 {
+			setUser(c, "", service.LocalActor, svc.Config.Auth.LocalKeyRole)
 			c.Next()
 			return
 		}
@@ -32,3 +58,39 @@ func AuthMiddleware(svc *service.Service) gin.HandlerFunc {
 		c.Abort()
 	}
 }
+
+// RequirePermission 检查调用者的角色（API 密钥还需其 scope）是否具备 permission，
+// 需放在 AuthMiddleware 之后；拒绝时返回 403/10002 并写入审计日志
+func RequirePermission(svc *service.Service, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		key, isKey := apiKey(c)
+		if service.RoleAllows(role, permission) && (!isKey || service.ScopeAllows(key.Scopes, permission)) {
+			c.Next()
+			return
+		}
+		Error(c, http.StatusForbidden, 10002, "permission denied")
+		message := fmt.Sprintf("%s %s requires %s (role %s)", c.Request.Method, c.Request.URL.Path, permission, role)
+		if isKey {
+			message = fmt.Sprintf("%s %s requires %s (role %s, scopes %s)", c.Request.Method, c.Request.URL.Path, permission, role, strings.Join(key.Scopes, ","))
+		}
+		_ = svc.DB.AddAuditLog(c.Request.Context(), "permission_denied", "", getUser(c), c.ClientIP(), "failure", message)
+		c.Abort()
+	}
+}
+
+func setUser(c *gin.Context, userID, username, role string) {
+	c.Set("user_id", userID)
+	c.Set("user", username)
+	c.Set("role", role)
+}
+
+// apiKey 返回本次请求使用的 API 密钥
+func apiKey(c *gin.Context) (db.APIKey, bool) {
+	value, ok := c.Get("api_key")
+	if !ok {
+		return db.APIKey{}, false
+	}
+	key, ok := value.(db.APIKey)
+	return key, ok
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	router, svc := newTestRouter(t)
+	admin := loginAs(t, svc, "alice", service.RoleAdmin)
+	member := loginAs(t, svc, "bob", service.RoleViewer)
+	disabled := loginAs(t, svc, "carol", service.RoleViewer)
+	carol, err := svc.DB.GetUserByUsername(context.Background(), "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	yes := true
+	if _, err := svc.UpdateUser(context.Background(), carol.UserID, service.UserUpdate{Disabled: &yes}); err != nil {
+		t.Fatal(err)
+	}
+	// A correctly signed token for an active user that names no session.
+	bob, err := svc.DB.GetUserByUsername(context.Background(), "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionless, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   bob.UserID,
+		Issuer:    "filehub",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte(svc.Config.Auth.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		path    string
+		status  int
+	}{
+		{"no credentials", nil, "/api/v1/files", http.StatusUnauthorized},
+		{"garbage token", map[string]string{"Authorization": "Bearer nope"}, "/api/v1/files", http.StatusUnauthorized},
+		{"wrong local key", map[string]string{"X-Local-Key": "nope"}, "/api/v1/files", http.StatusUnauthorized},
+		{"local key", map[string]string{"X-Local-Key": testLocalKey}, "/api/v1/files", http.StatusOK},
+		{"member", map[string]string{"Authorization": "Bearer " + member}, "/api/v1/files", http.StatusOK},
+		{"token without a session", map[string]string{"Authorization": "Bearer " + sessionless}, "/api/v1/files", http.StatusUnauthorized},
+		{"disabled after login", map[string]string{"Authorization": "Bearer " + disabled}, "/api/v1/files", http.StatusUnauthorized},
+		{"admin route as member", map[string]string{"Authorization": "Bearer " + member}, "/api/v1/admin/users", http.StatusForbidden},
+		{"admin route as admin", map[string]string{"Authorization": "Bearer " + admin}, "/api/v1/admin/users", http.StatusOK},
+		{"admin route with the local key", map[string]string{"X-Local-Key": testLocalKey}, "/api/v1/admin/users", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptestRequest("GET", test.path, nil)
+			req.Header.Del("X-Local-Key")
+			for key, value := range test.headers {
+				req.Header.Set(key, value)
+			}
+			if resp := serve(router, req); resp.Code != test.status {
+				t.Errorf("status %d, want %d: %s", resp.Code, test.status, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminUserManagement(t *testing.T) {
+	router, svc := newTestRouter(t)
+	admin := loginAs(t, svc, "alice", service.RoleAdmin)
+
+	resp := requestAs(router, admin, "POST", "/api/v1/admin/users", strings.NewReader(`{"username": "bob", "password": "password1"}`))
+	var bob struct {
+		UserID string `json:"user_id"`
+	}
+	decodeData(t, resp, &bob)
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"duplicate username", "POST", "/api/v1/admin/users", `{"username": "bob", "password": "password1"}`, http.StatusConflict},
+		{"short password", "POST", "/api/v1/admin/users", `{"username": "dave", "password": "short"}`, http.StatusBadRequest},
+		{"reset password", "PUT", "/api/v1/admin/users/" + bob.UserID + "/password", `{"password": "password2"}`, http.StatusOK},
+		{"unknown user", "PATCH", "/api/v1/admin/users/u_nope", `{"disabled": true}`, http.StatusNotFound},
+		{"disable", "PATCH", "/api/v1/admin/users/" + bob.UserID, `{"disabled": true}`, http.StatusOK},
+	}
+	for _, step := range steps {
+		if resp := requestAs(router, admin, step.method, step.path, strings.NewReader(step.body)); resp.Code != step.status {
+			t.Fatalf("%s: status %d, want %d: %s", step.name, resp.Code, step.status, resp.Body.String())
+		}
+	}
+	if _, err := svc.Authenticate(context.Background(), "bob", "password2"); err == nil {
+		t.Error("disabled user can still log in")
+	}
+}
+
+func TestRoutePermissions(t *testing.T) {
+	router, svc := newTestRouter(t)
+	tokens := map[string]string{}
+	for _, role := range []string{service.RoleViewer, service.RoleUploader, service.RoleEditor, service.RoleAdmin} {
+		tokens[role] = loginAs(t, svc, role+"-user", role)
+	}
+	fileID := uploadTestFile(t, router, "a.txt", "hello")
+
+	// Each route is called with a request that fails validation after the
+	// permission check, so a 403 can only come from the role.
+	routes := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		allows []string
+	}{
+		{"list files", "GET", "/api/v1/files", "", []string{service.RoleViewer, service.RoleUploader, service.RoleEditor, service.RoleAdmin}},
+		{"download", "GET", "/api/v1/files/" + fileID + "/download", "", []string{service.RoleViewer, service.RoleUploader, service.RoleEditor, service.RoleAdmin}},
+		{"upload", "PUT", "/api/v1/files/raw", "", []string{service.RoleUploader, service.RoleEditor, service.RoleAdmin}},
+		{"start resumable upload", "POST", "/api/v1/uploads", "", []string{service.RoleUploader, service.RoleEditor, service.RoleAdmin}},
+		{"create folder", "POST", "/api/v1/folders", "{}", []string{service.RoleEditor, service.RoleAdmin}},
+		{"move file", "PUT", "/api/v1/files/f_nope/move", "{}", []string{service.RoleEditor, service.RoleAdmin}},
+		{"delete file", "DELETE", "/api/v1/files/f_nope", "", []string{service.RoleEditor, service.RoleAdmin}},
+		{"share file", "POST", "/api/v1/files/f_nope/share", "{}", []string{service.RoleEditor, service.RoleAdmin}},
+		{"list shares", "GET", "/api/v1/shares", "", []string{service.RoleEditor, service.RoleAdmin}},
+		{"list users", "GET", "/api/v1/admin/users", "", []string{service.RoleAdmin}},
+	}
+	for _, route := range routes {
+		for role, token := range tokens {
+			t.Run(route.name+" as "+role, func(t *testing.T) {
+				var body io.Reader
+				if route.body != "" {
+					body = strings.NewReader(route.body)
+				}
+				resp := requestAs(router, token, route.method, route.path, body)
+				if denied := resp.Code == http.StatusForbidden; denied == slices.Contains(route.allows, role) {
+					t.Errorf("status %d: %s", resp.Code, resp.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestLocalKeyRole(t *testing.T) {
+	tests := []struct {
+		role   string
+		path   string
+		status int
+	}{
+		{service.RoleAdmin, "/api/v1/admin/users", http.StatusOK},
+		{service.RoleEditor, "/api/v1/admin/users", http.StatusForbidden},
+		{service.RoleEditor, "/api/v1/shares", http.StatusOK},
+		{service.RoleViewer, "/api/v1/shares", http.StatusForbidden},
+		{service.RoleViewer, "/api/v1/files", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.role+" "+test.path, func(t *testing.T) {
+			router, svc := newTestRouter(t)
+			svc.Config.Auth.LocalKeyRole = test.role
+			if resp := request(router, "GET", test.path, nil, nil); resp.Code != test.status {
+				t.Errorf("status %d, want %d: %s", resp.Code, test.status, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestLocalKeyDisabledByDefault(t *testing.T) {
+	router, svc := newTestRouter(t)
+	svc.Config.Auth.LocalKeyEnabled = false
+	if resp := request(router, "GET", "/api/v1/files", nil, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("status %d: %s", resp.Code, resp.Body.String())
+	}
+}
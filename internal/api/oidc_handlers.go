@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+const (
+	oidcCookieName = "filehub_oidc"
+	oidcCookiePath = "/api/v1/auth/oidc"
+)
+
+// OIDCInfo 返回是否启用了 OIDC 单点登录，供登录页决定是否显示按钮
+// 权限：无需登录
+func (h *Handler) OIDCInfo(c *gin.Context) {
+	OK(c, gin.H{"enabled": h.Service.OIDCEnabled(), "login_url": oidcCookiePath + "/login"})
+}
+
+// OIDCLogin 跳转到 OIDC 提供方登录，redirect 为登录后返回的站内路径
+// 权限：无需登录
+func (h *Handler) OIDCLogin(c *gin.Context) {
+	if !h.Service.OIDCEnabled() {
+		Error(c, http.StatusNotFound, 10003, "oidc not configured")
+		return
+	}
+	redirect := c.Query("redirect")
+	if !localRedirect(redirect) {
+		redirect = "/"
+	}
+	authURL, cookie, err := h.Service.OIDCBegin(c.Request.Context(), h.oidcCallbackURL(c), redirect)
+	if err != nil {
+		log.Printf("oidc login: %v", err)
+		Error(c, http.StatusBadGateway, 19999, "oidc provider unavailable")
+		return
+	}
+	h.setOIDCCookie(c, cookie, int(service.OIDCFlowTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback 处理 OIDC 提供方的回调，签发令牌后带着令牌跳回站内页面；
+// 请求头 Accept 为 application/json 时直接返回令牌
+// 权限：无需登录
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	if !h.Service.OIDCEnabled() {
+		Error(c, http.StatusNotFound, 10003, "oidc not configured")
+		return
+	}
+	cookie, _ := c.Cookie(oidcCookieName)
+	h.setOIDCCookie(c, "", -1)
+	if errorCode := c.Query("error"); errorCode != "" {
+		Error(c, http.StatusUnauthorized, 10008, "login failed")
+		h.audit(c, "login", "", "system", "failure", "oidc: "+errorCode)
+		return
+	}
+	tokens, user, redirect, err := h.Service.OIDCLogin(c.Request.Context(), h.oidcCallbackURL(c), cookie, c.Query("state"), c.Query("code"), clientInfo(c))
+	if err != nil {
+		markFailure(c)
+		switch {
+		case errors.Is(err, service.ErrOIDCState):
+			Error(c, http.StatusBadRequest, 10004, err.Error())
+		case errors.Is(err, service.ErrOIDCUsername), errors.Is(err, service.ErrOIDCLinked),
+			errors.Is(err, service.ErrOIDCNoRole), errors.Is(err, service.ErrUserDisabled):
+			Error(c, http.StatusForbidden, 10008, err.Error())
+		default:
+			log.Printf("oidc callback: %v", err)
+			Error(c, http.StatusUnauthorized, 10008, "login failed")
+		}
+		h.audit(c, "login", "", "system", "failure", "oidc: "+err.Error())
+		return
+	}
+	h.audit(c, "login", "", user.Username, "success", "oidc")
+	if strings.Contains(c.GetHeader("Accept"), "application/json") {
+		OK(c, tokens)
+		return
+	}
+	fragment := url.Values{
+		"access_token":  {tokens.AccessToken},
+		"refresh_token": {tokens.RefreshToken},
+		"expires_in":    {strconv.FormatInt(tokens.ExpiresIn, 10)},
+	}
+	c.Redirect(http.StatusFound, redirect+"#"+fragment.Encode())
+}
+
+// oidcCallbackURL 是在 OIDC 提供方登记的回调地址
+func (h *Handler) oidcCallbackURL(c *gin.Context) string {
+	if redirectURL := h.Service.Config.Auth.OIDC.RedirectURL; redirectURL != "" {
+		return redirectURL
+	}
+	return h.buildBaseURL(c) + oidcCookiePath + "/callback"
+}
+
+func (h *Handler) setOIDCCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		Secure:   strings.HasPrefix(h.oidcCallbackURL(c), "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// localRedirect 只允许站内路径，防止登录后被带到外部站点
+func localRedirect(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") && !strings.Contains(path, "\\")
+}
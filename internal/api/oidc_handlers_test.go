@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kiry163/filehub/internal/oidc/oidctest"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+func TestLocalRedirect(t *testing.T) {
+	tests := []struct {
+		path  string
+		local bool
+	}{
+		{"/", true},
+		{"/files/abc?view=grid", true},
+		{"", false},
+		{"files", false},
+		{"//evil.test/", false},
+		{"/\\evil.test", false},
+		{"https://evil.test/", false},
+	}
+	for _, test := range tests {
+		if got := localRedirect(test.path); got != test.local {
+			t.Errorf("localRedirect(%q) = %v", test.path, got)
+		}
+	}
+}
+
+func TestOIDCFlow(t *testing.T) {
+	router, svc := newTestRouter(t)
+	if resp := request(router, "GET", "/api/v1/auth/oidc/login", nil, nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("login without oidc configured: status %d", resp.Code)
+	}
+	issuer := oidctest.NewIssuer(t, "filehub")
+	svc.Config.Auth.OIDC.Issuer = issuer.URL
+	svc.Config.Auth.OIDC.ClientID = issuer.ClientID
+	svc.Config.Auth.OIDC.Scopes = []string{"openid", "email"}
+	svc.Config.Auth.OIDC.UsernameClaim = "email"
+	svc.Config.Auth.OIDC.DefaultRole = service.RoleViewer
+
+	tests := []struct {
+		name     string
+		redirect string
+		want     string
+	}{
+		{"redirect kept", "/files/abc", "/files/abc"},
+		{"external redirect dropped", "//evil.test/", "/"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := request(router, "GET", "/api/v1/auth/oidc/login?redirect="+url.QueryEscape(test.redirect), nil, nil)
+			location := resp.Header().Get("Location")
+			if resp.Code != http.StatusFound || !strings.HasPrefix(location, issuer.URL+"/authorize?") {
+				t.Fatalf("login: status %d, location %q", resp.Code, location)
+			}
+			cookie := resp.Result().Cookies()[0]
+			if cookie.Name != oidcCookieName || !cookie.HttpOnly {
+				t.Fatalf("flow cookie %+v", cookie)
+			}
+			code, state := issuer.Authorize(t, location)
+
+			callback := "/api/v1/auth/oidc/callback?code=" + url.QueryEscape(code) + "&state=" + url.QueryEscape(state)
+			resp = request(router, "GET", callback, nil, map[string]string{"Cookie": cookie.Name + "=" + cookie.Value})
+			target, err := url.Parse(resp.Header().Get("Location"))
+			if resp.Code != http.StatusFound || err != nil || target.Path != test.want {
+				t.Fatalf("callback: status %d, location %q", resp.Code, resp.Header().Get("Location"))
+			}
+			fragment, _ := url.ParseQuery(target.Fragment)
+			if access := fragment.Get("access_token"); access == "" || fragment.Get("refresh_token") == "" {
+				t.Fatalf("fragment %q", target.Fragment)
+			} else if resp := requestAs(router, access, "GET", "/api/v1/files", nil); resp.Code != http.StatusOK {
+				t.Errorf("sso access token: status %d", resp.Code)
+			}
+
+			// The flow cookie is cleared, so the callback cannot be replayed.
+			if resp := request(router, "GET", callback, nil, nil); resp.Code != http.StatusBadRequest {
+				t.Errorf("replayed callback: status %d", resp.Code)
+			}
+		})
+	}
+
+	if resp := request(router, "GET", "/api/v1/auth/oidc/callback?error=access_denied", nil, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("issuer error: status %d", resp.Code)
+	}
+}
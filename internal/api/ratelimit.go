@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/config"
+	"github.com/kiry163/filehub/internal/ratelimit"
+)
+
+const rateLimitFailedKey = "rate_limit_failed"
+
+// subjectFunc 返回请求除 IP 外还要计数的对象，如 "user:alice"；为空时只按 IP
+type subjectFunc func(c *gin.Context) string
+
+// rateLimit 按 IP 和 subjects 给出的对象限制一组路由的请求速率。
+// 处理函数用 markFailure 标记失败，连续失败过多的 IP 或对象被临时锁定，
+// 受限时返回 429 和 Retry-After
+func (h *Handler) rateLimit(group string, subjects ...subjectFunc) gin.HandlerFunc {
+	settings := h.Service.Config.RateLimit
+	var cfg config.RateLimitRule
+	switch group {
+	case "auth":
+		cfg = settings.Auth
+	case "share":
+		cfg = settings.Share
+	case "api":
+		cfg = settings.API
+	}
+	if !settings.Enabled || h.Limiter == nil || cfg.Requests <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	rule := ratelimit.Rule{
+		Rate:        float64(cfg.Requests) / cfg.Per.Seconds(),
+		Burst:       cfg.Burst,
+		MaxFailures: cfg.MaxFailures,
+		Lockout:     cfg.Lockout,
+	}
+
+	return func(c *gin.Context) {
+		keys := []string{group + ":ip:" + c.ClientIP()}
+		for _, subject := range subjects {
+			if value := subject(c); value != "" {
+				keys = append(keys, group+":"+value)
+			}
+		}
+		for _, key := range keys {
+			if wait := h.Limiter.Allow(key, rule); wait > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				Error(c, http.StatusTooManyRequests, 10016, "too many requests")
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+
+		if c.GetBool(rateLimitFailedKey) {
+			for _, key := range keys {
+				if lockout := h.Limiter.Fail(key, rule); lockout > 0 {
+					message := fmt.Sprintf("%s locked out for %s after %d failures", key, lockout.Round(time.Second), rule.MaxFailures)
+					h.audit(c, "lockout", "", "system", "failure", message)
+				}
+			}
+		} else if c.Writer.Status() < http.StatusBadRequest {
+			for _, key := range keys {
+				h.Limiter.Reset(key)
+			}
+		}
+	}
+}
+
+// markFailure 记录一次失败的尝试（密码错误、令牌无效等），供 rateLimit 计数
+func markFailure(c *gin.Context) {
+	c.Set(rateLimitFailedKey, true)
+}
+
+// loginSubject 按登录请求中的用户名计数
+func loginSubject(c *gin.Context) string {
+	if username := peekJSONField(c, "username"); username != "" {
+		return "user:" + username
+	}
+	return ""
+}
+
+// mfaSubject 按两步验证挑战所属的用户计数，换新挑战也不会重置
+func (h *Handler) mfaSubject(c *gin.Context) string {
+	if userID := h.Service.MFAChallengeUser(peekJSONField(c, "mfa_token")); userID != "" {
+		return "mfa:" + userID
+	}
+	return ""
+}
+
+// shareSubject 按分享令牌计数，防止猜测分享密码
+func shareSubject(c *gin.Context) string {
+	return "share:" + c.Param("token")
+}
+
+// callerSubject 按 API 密钥或用户计数
+func callerSubject(c *gin.Context) string {
+	if key, ok := apiKey(c); ok {
+		return "key:" + key.KeyID
+	}
+	if userID := c.GetString("user_id"); userID != "" {
+		return "user:" + userID
+	}
+	return "user:" + getUser(c)
+}
+
+// peekJSONField 读取 JSON 请求体中的一个字符串字段，并保留请求体供处理函数使用
+func peekJSONField(c *gin.Context, name string) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<10))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil {
+		return ""
+	}
+	var fields map[string]json.RawMessage
+	var value string
+	if json.Unmarshal(body, &fields) != nil || json.Unmarshal(fields[name], &value) != nil {
+		return ""
+	}
+	return value
+}
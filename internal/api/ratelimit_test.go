@@ -0,0 +1,127 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/config"
+	"github.com/kiry163/filehub/internal/ratelimit"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+// newLimitedRouter returns a test router with rate limiting on for rules.
+func newLimitedRouter(t *testing.T, rules config.RateLimitConfig) (*gin.Engine, *service.Service) {
+	t.Helper()
+	_, svc := newTestRouter(t)
+	rules.Enabled = true
+	svc.Config.RateLimit = rules
+	return NewRouter(svc, ratelimit.NewMemory()), svc
+}
+
+func TestLoginLockout(t *testing.T) {
+	rule := config.RateLimitRule{Requests: 100, Per: time.Minute, Burst: 100, MaxFailures: 3, Lockout: time.Minute}
+	router, svc := newLimitedRouter(t, config.RateLimitConfig{Auth: rule})
+	loginAs(t, svc, "alice", service.RoleViewer)
+	loginAs(t, svc, "bob", service.RoleViewer)
+
+	login := func(username, password, ip string) int {
+		body := `{"username": "` + username + `", "password": "` + password + `"}`
+		req := httptestRequest("POST", "/api/v1/auth/login", strings.NewReader(body))
+		req.RemoteAddr = ip + ":1234"
+		return serve(router, req).Code
+	}
+	steps := []struct {
+		name     string
+		username string
+		password string
+		ip       string
+		status   int
+	}{
+		{"wrong password 1", "alice", "nope", "10.0.0.1", http.StatusUnauthorized},
+		{"success resets the count", "alice", "password1", "10.0.0.1", http.StatusOK},
+		{"wrong password 2", "alice", "nope", "10.0.0.1", http.StatusUnauthorized},
+		{"wrong password 3", "alice", "nope", "10.0.0.2", http.StatusUnauthorized},
+		{"wrong password 4 locks the user", "alice", "nope", "10.0.0.3", http.StatusUnauthorized},
+		{"user locked from a new ip", "alice", "password1", "10.0.0.4", http.StatusTooManyRequests},
+		{"other users on a fresh ip unaffected", "bob", "password1", "10.0.0.4", http.StatusOK},
+		{"failures from one ip", "bob", "nope", "10.0.0.5", http.StatusUnauthorized},
+		{"more failures from it", "carol", "nope", "10.0.0.5", http.StatusUnauthorized},
+		{"third failure locks the ip", "dave", "nope", "10.0.0.5", http.StatusUnauthorized},
+		{"ip locked for every user", "erin", "password1", "10.0.0.5", http.StatusTooManyRequests},
+	}
+	for _, step := range steps {
+		if status := login(step.username, step.password, step.ip); status != step.status {
+			t.Fatalf("%s: status %d, want %d", step.name, status, step.status)
+		}
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	rule := config.RateLimitRule{Requests: 2, Per: time.Minute, Burst: 2}
+	router, _ := newLimitedRouter(t, config.RateLimitConfig{API: rule})
+	for i := 0; i < 2; i++ {
+		if resp := request(router, "GET", "/api/v1/files", nil, nil); resp.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i+1, resp.Code)
+		}
+	}
+	resp := request(router, "GET", "/api/v1/files", nil, nil)
+	if resp.Code != http.StatusTooManyRequests || resp.Header().Get("Retry-After") != "30" {
+		t.Errorf("status %d, Retry-After %q", resp.Code, resp.Header().Get("Retry-After"))
+	}
+	// Groups are limited separately.
+	if resp := request(router, "GET", "/health", nil, nil); resp.Code != http.StatusOK {
+		t.Errorf("health: status %d", resp.Code)
+	}
+}
+
+func TestRateLimitOff(t *testing.T) {
+	rule := config.RateLimitRule{Requests: 1, Per: time.Minute, Burst: 1}
+	tests := []struct {
+		name    string
+		enabled bool
+		limiter ratelimit.Limiter
+	}{
+		{"disabled", false, ratelimit.NewMemory()},
+		{"no limiter", true, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, svc := newTestRouter(t)
+			svc.Config.RateLimit = config.RateLimitConfig{Enabled: test.enabled, API: rule}
+			router := NewRouter(svc, test.limiter)
+			for i := 0; i < 3; i++ {
+				if resp := request(router, "GET", "/api/v1/files", nil, nil); resp.Code != http.StatusOK {
+					t.Fatalf("request %d: status %d", i+1, resp.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestPeekJSONField(t *testing.T) {
+	tests := []struct {
+		body  string
+		value string
+	}{
+		{`{"username": "alice", "password": "x"}`, "alice"},
+		{`{"username": 42}`, ""},
+		{`{"password": "x"}`, ""},
+		{`not json`, ""},
+		{``, ""},
+	}
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptestRequest("POST", "/", strings.NewReader(test.body))
+		if got := peekJSONField(c, "username"); got != test.value {
+			t.Errorf("%q: got %q, want %q", test.body, got, test.value)
+		}
+		// The handler still reads the whole body.
+		if rest, err := io.ReadAll(c.Request.Body); err != nil || string(rest) != test.body {
+			t.Errorf("%q: body left %q, %v", test.body, rest, err)
+		}
+	}
+}
@@ -2,45 +2,154 @@ package api
 
 import (
 	"io/fs"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/ratelimit"
 	"github.com/kiry163/filehub/internal/service"
 	"github.com/kiry163/filehub/web"
 )
 
-func NewRouter(svc *service.Service) *gin.Engine {
+// NewRouter wires the API. limiter keeps the rate limit state; nil turns
+// rate limiting off.
+func NewRouter(svc *service.Service, limiter ratelimit.Limiter) *gin.Engine {
 	router := gin.Default()
 	router.RedirectTrailingSlash = false
 	router.RedirectFixedPath = false
+	if proxies := svc.Config.Server.TrustedProxies; len(proxies) > 0 {
+		if err := router.SetTrustedProxies(proxies); err != nil {
+			log.Printf("invalid server.trusted_proxies: %v", err)
+		}
+	}
 	if svc.Config.Upload.MaxSizeMB > 0 {
 		router.MaxMultipartMemory = svc.Config.Upload.MaxSizeMB * 1024 * 1024
 	}
 
 	registerWebRoutes(router)
 
-	handler := &Handler{Service: svc}
+	handler := &Handler{Service: svc, Limiter: limiter}
+	// 限流分组见 config.RateLimitConfig：auth 和 share 按 IP 及用户名或分享令牌，
+	// 其余接口按 IP 及调用者
+	limitAuth, limitShare := handler.rateLimit("auth"), handler.rateLimit("share", shareSubject)
+	limitAPI := handler.rateLimit("api", callerSubject)
+
 	router.GET("/health", handler.Health)
-	router.GET("/s/:token", handler.DownloadShare)
+	router.GET("/s/:token", limitShare, handler.DownloadShare)
+	router.POST("/s/:token", limitShare, handler.UnlockShare)
+	router.GET("/s/:token/files/:file_id", limitShare, handler.DownloadShareFile)
+	router.GET("/s/:token/zip", limitShare, handler.DownloadShareZip)
+	router.POST("/s/:token/upload", limitShare, handler.UploadShare)
 
 	api := router.Group("/api/v1")
 	auth := api.Group("/auth")
-	auth.POST("/login", handler.Login)
-	auth.POST("/refresh", handler.Refresh)
-	auth.POST("/logout", AuthMiddleware(svc), handler.Logout)
+	auth.POST("/login", handler.rateLimit("auth", loginSubject), handler.Login)
+	auth.POST("/login/mfa", handler.rateLimit("auth", handler.mfaSubject), handler.LoginMFA)
+	auth.POST("/refresh", limitAuth, handler.Refresh)
+	auth.POST("/logout", AuthMiddleware(svc), limitAPI, handler.Logout)
+	auth.GET("/oidc", handler.OIDCInfo)
+	auth.GET("/oidc/login", limitAuth, handler.OIDCLogin)
+	auth.GET("/oidc/callback", limitAuth, handler.OIDCCallback)
+
+	totp := auth.Group("/totp")
+	totp.Use(AuthMiddleware(svc), limitAPI)
+	totp.GET("", handler.TOTPStatus)
+	totp.POST("", handler.EnrollTOTP)
+	totp.POST("/confirm", handler.ConfirmTOTP)
+	totp.POST("/recovery-codes", handler.RegenerateRecoveryCodes)
+	totp.DELETE("", handler.DisableTOTP)
+
+	sessions := auth.Group("/sessions")
+	sessions.Use(AuthMiddleware(svc), limitAPI)
+	sessions.GET("", handler.ListSessions)
+	sessions.DELETE("", handler.RevokeAllSessions)
+	sessions.DELETE("/:id", handler.RevokeSession)
+
+	// 每个受保护路由都标注所需权限，角色与权限的对应见 service.RoleAllows
+	require := func(permission string) gin.HandlerFunc {
+		return RequirePermission(svc, permission)
+	}
+	read, upload, write, share := require(service.PermRead), require(service.PermUpload), require(service.PermWrite), require(service.PermShare)
 
-	api.GET("/files/:id/preview", handler.PreviewFile)
+	api.GET("/files/:id/preview", AuthMiddleware(svc), limitAPI, read, handler.PreviewFile)
 	api.GET("/files/stream", handler.StreamFile)
 
 	files := api.Group("/files")
-	files.Use(AuthMiddleware(svc))
-	files.POST("", handler.UploadFile)
-	files.GET("", handler.ListFiles)
-	files.GET("/:id", handler.GetFile)
-	files.GET("/:id/download", handler.DownloadFile)
-	files.DELETE("/:id", handler.DeleteFile)
-	files.GET("/:id/share", handler.ShareFile)
+	files.Use(AuthMiddleware(svc), limitAPI)
+	files.POST("", upload, handler.UploadFile)
+	files.PUT("/raw", upload, handler.UploadRaw)
+	files.GET("", read, handler.ListFiles)
+	files.GET("/search", read, handler.SearchFiles)
+	files.GET("/:id", read, handler.GetFile)
+	files.GET("/:id/download", read, handler.DownloadFile)
+	files.POST("/:id/versions", upload, handler.UploadVersion)
+	files.GET("/:id/versions", read, handler.ListVersions)
+	files.DELETE("/:id/versions", write, handler.PruneVersions)
+	files.POST("/:id/versions/:version/promote", write, handler.PromoteVersion)
+	files.DELETE("/:id/versions/:version", write, handler.DeleteVersion)
+	files.DELETE("/:id", write, handler.DeleteFile)
+	files.GET("/:id/share", share, handler.ShareFile)
+	files.POST("/:id/share", share, handler.CreateShare)
+	files.GET("/:id/shares", share, handler.ListFileShares)
+	files.PUT("/:id/move", write, handler.MoveFile)
+	files.GET("/:id/url", read, handler.GetFileViewURL)
+
+	shares := api.Group("/shares")
+	shares.Use(AuthMiddleware(svc), limitAPI, share)
+	shares.GET("", handler.ListShares)
+	shares.GET("/:token", handler.GetShare)
+	shares.GET("/:token/accesses", handler.ListShareAccesses)
+	shares.PATCH("/:token", handler.UpdateShare)
+	shares.DELETE("/:token", handler.RevokeShare)
+
+	api.OPTIONS("/uploads", handler.TusOptions)
+	api.OPTIONS("/uploads/:id", handler.TusOptions)
+	uploads := api.Group("/uploads")
+	uploads.Use(AuthMiddleware(svc), limitAPI, upload)
+	uploads.POST("", handler.CreateUpload)
+	uploads.HEAD("/:id", handler.HeadUpload)
+	uploads.PATCH("/:id", handler.PatchUpload)
+	uploads.DELETE("/:id", handler.DeleteUpload)
+
+	folders := api.Group("/folders")
+	folders.Use(AuthMiddleware(svc), limitAPI)
+	folders.POST("", write, handler.CreateFolder)
+	folders.GET("", read, handler.ListFolders)
+	folders.GET("/:id/contents", read, handler.GetFolderContents)
+	folders.GET("/:id/url", read, handler.GetFolderViewURL)
+	folders.POST("/:id/share", share, handler.CreateFolderShare)
+	folders.GET("/:id/shares", share, handler.ListFolderShares)
+	folders.GET("/:id/acl", read, handler.GetFolderACL)
+	folders.PUT("/:id/acl", write, handler.SetFolderACL)
+	folders.PUT("/:id", write, handler.UpdateFolder)
+	folders.PUT("/:id/move", write, handler.MoveFolder)
+	folders.DELETE("/:id", write, handler.DeleteFolder)
+
+	trash := api.Group("/trash")
+	trash.Use(AuthMiddleware(svc), limitAPI, write)
+	trash.GET("", handler.ListTrash)
+	trash.DELETE("", handler.EmptyTrash)
+	trash.POST("/:id/restore", handler.RestoreTrash)
+	trash.DELETE("/:id", handler.PurgeTrash)
+
+	keys := api.Group("/keys")
+	keys.Use(AuthMiddleware(svc), limitAPI)
+	keys.GET("", handler.ListAPIKeys)
+	keys.POST("", handler.CreateAPIKey)
+	keys.DELETE("/:id", handler.RevokeAPIKey)
+
+	admin := api.Group("/admin")
+	admin.Use(AuthMiddleware(svc), limitAPI, require(service.PermAdmin))
+	admin.GET("/storage/dedup", handler.DedupStats)
+	admin.GET("/users", handler.ListUsers)
+	admin.POST("/users", handler.CreateUser)
+	admin.PATCH("/users/:id", handler.UpdateUser)
+	admin.PUT("/users/:id/password", handler.ResetPassword)
+	admin.DELETE("/users/:id/totp", handler.ResetTOTP)
+	admin.GET("/audit", handler.ListAuditLogs)
+	admin.GET("/audit/export", handler.ExportAuditLogs)
+	admin.GET("/audit/checkpoint", handler.AuditCheckpoint)
 
 	return router
 }
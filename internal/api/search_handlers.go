@@ -0,0 +1,144 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+const searchMaxLimit = 1000
+
+// SearchFiles 按名称（子串、通配符或正则）、类型、扩展名、大小、日期、创建者和文件夹搜索文件，可包含子文件夹并排序
+// 权限：read
+func (h *Handler) SearchFiles(c *gin.Context) {
+	query := db.FileQuery{
+		Name:       c.Query("q"),
+		Match:      c.DefaultQuery("match", db.MatchSubstring),
+		MimeTypes:  queryList(c, "mime"),
+		Extensions: queryList(c, "ext"),
+		CreatedBy:  c.Query("created_by"),
+		Sort:       c.DefaultQuery("sort", "created"),
+		Order:      c.DefaultQuery("order", "desc"),
+		Recursive:  c.Query("recursive") == "true" || c.Query("recursive") == "1",
+		Limit:      parseInt(c.DefaultQuery("limit", "20"), 20),
+		Offset:     parseInt(c.DefaultQuery("offset", "0"), 0),
+	}
+	switch query.Match {
+	case db.MatchSubstring, db.MatchGlob:
+	case db.MatchRegex:
+		if _, err := regexp.Compile(query.Name); err != nil {
+			Error(c, http.StatusBadRequest, 10004, "invalid regex: "+err.Error())
+			return
+		}
+	default:
+		Error(c, http.StatusBadRequest, 10004, "match must be substring, glob or regex")
+		return
+	}
+	switch query.Sort {
+	case "name", "size", "created", "updated":
+	default:
+		Error(c, http.StatusBadRequest, 10004, "sort must be name, size, created or updated")
+		return
+	}
+	if query.Order != "asc" && query.Order != "desc" {
+		Error(c, http.StatusBadRequest, 10004, "order must be asc or desc")
+		return
+	}
+	if query.Limit < 1 || query.Limit > searchMaxLimit || query.Offset < 0 {
+		Error(c, http.StatusBadRequest, 10004, "limit must be between 1 and "+strconv.Itoa(searchMaxLimit))
+		return
+	}
+	for param, target := range map[string]**int64{"min_size": &query.MinSize, "max_size": &query.MaxSize} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 0 {
+			Error(c, http.StatusBadRequest, 10004, "invalid "+param)
+			return
+		}
+		*target = &size
+	}
+	for param, target := range map[string]*string{
+		"created_after":  &query.CreatedAfter,
+		"created_before": &query.CreatedBefore,
+		"updated_after":  &query.UpdatedAfter,
+		"updated_before": &query.UpdatedBefore,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			Error(c, http.StatusBadRequest, 10004, "invalid "+param)
+			return
+		}
+		*target = parsed.UTC().Format(time.RFC3339)
+	}
+
+	access, ok := h.folderAccess(c)
+	if !ok {
+		return
+	}
+	switch folderID := c.Query("folder_id"); folderID {
+	case "":
+	case RootFolderID:
+		// 根目录下递归即全部文件
+		query.RootOnly = !query.Recursive
+	default:
+		if _, err := h.Service.DB.GetFolder(c.Request.Context(), folderID); err != nil {
+			Error(c, http.StatusNotFound, 10003, "folder not found")
+			return
+		}
+		if !h.allowFolder(c, access, &folderID, service.AccessRead) {
+			return
+		}
+		query.FolderID = folderID
+	}
+	query.Hidden = access.Hidden()
+
+	records, total, err := h.Service.SearchFiles(c.Request.Context(), query)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "search failed")
+		return
+	}
+	files := make([]gin.H, 0, len(records))
+	for _, record := range records {
+		files = append(files, gin.H{
+			"file_id":       record.FileID,
+			"original_name": record.OriginalName,
+			"size":          record.Size,
+			"mime_type":     record.MimeType,
+			"sha256":        record.SHA256,
+			"folder_id":     record.FolderID,
+			"version":       record.Version,
+			"created_by":    record.CreatedBy,
+			"created_at":    record.CreatedAt,
+			"updated_at":    record.UpdatedAt,
+			"filehub_url":   "filehub://" + record.FileID,
+			"download_url":  h.buildDownloadURL(c, record.FileID),
+		})
+	}
+	OK(c, gin.H{"total": total, "files": files})
+}
+
+// queryList 读取可重复或以逗号分隔的查询参数
+func queryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, value := range c.QueryArray(key) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
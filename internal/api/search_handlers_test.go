@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/kiry163/filehub/internal/service"
+)
+
+type searchResult struct {
+	Total int `json:"total"`
+	Files []struct {
+		OriginalName string `json:"original_name"`
+	} `json:"files"`
+}
+
+func searchNames(result searchResult) []string {
+	names := make([]string, 0, len(result.Files))
+	for _, file := range result.Files {
+		names = append(names, file.OriginalName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSearchFiles(t *testing.T) {
+	router, svc := newTestRouter(t)
+	addTestFolder(t, svc, "docs", "docs", nil)
+	addTestFolder(t, svc, "2024", "2024", ptr("docs"))
+	uploadTestFileTo(t, router, "docs", "report.pdf", "pdf")
+	uploadTestFileTo(t, router, "2024", "photo_1.jpg", "jpeg!")
+	uploadTestFileTo(t, router, "2024", "photo11.png", "p")
+	uploadTestFile(t, router, "notes.txt", "notes, a little longer")
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"notes.txt", "photo11.png", "photo_1.jpg", "report.pdf"}},
+		{"q=photo_", []string{"photo_1.jpg"}},
+		{"q=PHOTO*&match=glob", []string{"photo11.png", "photo_1.jpg"}},
+		{"q=" + url.QueryEscape(`^photo\d`) + "&match=regex", []string{"photo11.png"}},
+		{"ext=pdf,png", []string{"photo11.png", "report.pdf"}},
+		{"ext=pdf&ext=jpg", []string{"photo_1.jpg", "report.pdf"}},
+		{"min_size=4&max_size=10", []string{"photo_1.jpg"}},
+		{"folder_id=docs", []string{"report.pdf"}},
+		{"folder_id=docs&recursive=true", []string{"photo11.png", "photo_1.jpg", "report.pdf"}},
+		{"folder_id=root", []string{"notes.txt"}},
+		{"folder_id=root&recursive=1", []string{"notes.txt", "photo11.png", "photo_1.jpg", "report.pdf"}},
+		{"created_by=nobody", []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			resp := request(router, "GET", "/api/v1/files/search?"+test.query, nil, nil)
+			var result searchResult
+			decodeData(t, resp, &result)
+			if got := searchNames(result); !reflect.DeepEqual(got, test.want) || result.Total != len(test.want) {
+				t.Errorf("got %v (total %d), want %v", got, result.Total, test.want)
+			}
+		})
+	}
+
+	resp := request(router, "GET", "/api/v1/files/search?sort=size&order=asc&limit=2&offset=1", nil, nil)
+	var page searchResult
+	decodeData(t, resp, &page)
+	if page.Total != 4 || len(page.Files) != 2 || page.Files[0].OriginalName != "report.pdf" || page.Files[1].OriginalName != "photo_1.jpg" {
+		t.Errorf("sorted page: %+v", page)
+	}
+}
+
+func TestSearchFilesValidation(t *testing.T) {
+	router, _ := newTestRouter(t)
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"match=fuzzy", http.StatusBadRequest},
+		{"q=" + url.QueryEscape("(") + "&match=regex", http.StatusBadRequest},
+		{"sort=owner", http.StatusBadRequest},
+		{"order=up", http.StatusBadRequest},
+		{"limit=0", http.StatusBadRequest},
+		{"limit=1001", http.StatusBadRequest},
+		{"offset=-1", http.StatusBadRequest},
+		{"min_size=-1", http.StatusBadRequest},
+		{"max_size=1MB", http.StatusBadRequest},
+		{"created_after=2026-01-01", http.StatusBadRequest},
+		{"updated_before=yesterday", http.StatusBadRequest},
+		{"folder_id=missing", http.StatusNotFound},
+		{"q=" + url.QueryEscape("[") + "&match=glob", http.StatusOK},
+	}
+	for _, test := range tests {
+		if resp := request(router, "GET", "/api/v1/files/search?"+test.query, nil, nil); resp.Code != test.status {
+			t.Errorf("%s: %d %s, want %d", test.query, resp.Code, resp.Body.String(), test.status)
+		}
+	}
+}
+
+func TestSearchFilesHonoursACL(t *testing.T) {
+	router, svc := newTestRouter(t)
+	addTestFolder(t, svc, "secret", "secret", nil)
+	uploadTestFileTo(t, router, "secret", "plans.txt", "plans")
+	uploadTestFile(t, router, "public.txt", "public")
+	if _, err := svc.SetFolderACL(context.Background(), "secret", "local", []service.ACLEntry{{Role: service.RoleAdmin, Access: service.AccessRead}}); err != nil {
+		t.Fatal(err)
+	}
+	token := loginAs(t, svc, "bob", service.RoleViewer)
+
+	resp := requestAs(router, token, "GET", "/api/v1/files/search?q=txt", nil)
+	var result searchResult
+	decodeData(t, resp, &result)
+	if got := searchNames(result); !reflect.DeepEqual(got, []string{"public.txt"}) {
+		t.Errorf("viewer sees %v", got)
+	}
+	if resp := requestAs(router, token, "GET", "/api/v1/files/search?folder_id=secret", nil); resp.Code != http.StatusForbidden && resp.Code != http.StatusNotFound {
+		t.Errorf("search in a hidden folder: %d %s", resp.Code, resp.Body.String())
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+// ListSessions 列出自己仍有效的登录会话，current 标记当前请求所在的会话
+// 权限：登录即可，仅限用户会话
+func (h *Handler) ListSessions(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	sessions, err := h.Service.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "list failed")
+		return
+	}
+	current := c.GetString("session_id")
+	items := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, sessionResponse(session, current))
+	}
+	OK(c, gin.H{"sessions": items})
+}
+
+// RevokeSession 结束自己的一个会话，该设备需重新登录
+// 权限：登录即可，仅限用户会话
+func (h *Handler) RevokeSession(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	sessionID := c.Param("id")
+	if err := h.Service.RevokeSession(c.Request.Context(), userID, sessionID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			Error(c, http.StatusNotFound, 10003, "session not found")
+		} else {
+			Error(c, http.StatusInternalServerError, 19999, "revoke failed")
+		}
+		h.audit(c, "session_revoke", "", getUser(c), "failure", sessionID+": "+err.Error())
+		return
+	}
+	h.audit(c, "session_revoke", "", getUser(c), "success", sessionID)
+	Message(c, "revoked")
+}
+
+// RevokeAllSessions 结束自己的全部会话，包括当前会话
+// 权限：登录即可，仅限用户会话
+func (h *Handler) RevokeAllSessions(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	count, err := h.Service.RevokeAllSessions(c.Request.Context(), userID)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "revoke failed")
+		h.audit(c, "session_revoke", "", getUser(c), "failure", "all: "+err.Error())
+		return
+	}
+	h.audit(c, "session_revoke", "", getUser(c), "success", "all: "+strconv.FormatInt(count, 10))
+	OK(c, gin.H{"revoked": count})
+}
+
+func sessionResponse(session db.Session, current string) gin.H {
+	return gin.H{
+		"session_id":   session.SessionID,
+		"user_agent":   session.UserAgent,
+		"ip_address":   session.IPAddress,
+		"created_at":   session.CreatedAt,
+		"last_used_at": session.LastUsedAt,
+		"expires_at":   session.ExpiresAt,
+		"current":      session.SessionID == current,
+	}
+}
+
+// clientInfo 记录登录和刷新令牌时的设备信息，显示在会话列表中
+func clientInfo(c *gin.Context) service.Client {
+	return service.Client{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
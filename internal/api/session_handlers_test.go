@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kiry163/filehub/internal/service"
+)
+
+func TestSessions(t *testing.T) {
+	router, svc := newTestRouter(t)
+	laptop := loginAs(t, svc, "alice", service.RoleViewer)
+	phone, _, err := svc.Login(context.Background(), "alice", "password1", service.Client{UserAgent: "phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := loginAs(t, svc, "bob", service.RoleViewer)
+
+	var list struct {
+		Sessions []struct {
+			SessionID string `json:"session_id"`
+			UserAgent string `json:"user_agent"`
+			Current   bool   `json:"current"`
+		} `json:"sessions"`
+	}
+	decodeData(t, requestAs(router, laptop, "GET", "/api/v1/auth/sessions", nil), &list)
+	if len(list.Sessions) != 2 {
+		t.Fatalf("sessions %+v", list.Sessions)
+	}
+	var phoneSession string
+	for _, session := range list.Sessions {
+		if session.UserAgent == "phone" {
+			phoneSession = session.SessionID
+			if session.Current {
+				t.Error("phone session marked current")
+			}
+		}
+	}
+
+	steps := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		status int
+	}{
+		{"other users cannot end it", bob, "DELETE", "/api/v1/auth/sessions/" + phoneSession, http.StatusNotFound},
+		{"phone still signed in", phone.AccessToken, "GET", "/api/v1/files", http.StatusOK},
+		{"end the phone session", laptop, "DELETE", "/api/v1/auth/sessions/" + phoneSession, http.StatusOK},
+		{"phone access token rejected", phone.AccessToken, "GET", "/api/v1/files", http.StatusUnauthorized},
+		{"laptop unaffected", laptop, "GET", "/api/v1/files", http.StatusOK},
+		{"log out", laptop, "POST", "/api/v1/auth/logout", http.StatusOK},
+		{"laptop access token rejected", laptop, "GET", "/api/v1/files", http.StatusUnauthorized},
+		{"bob unaffected", bob, "GET", "/api/v1/files", http.StatusOK},
+	}
+	for _, step := range steps {
+		if resp := requestAs(router, step.token, step.method, step.path, nil); resp.Code != step.status {
+			t.Fatalf("%s: status %d, want %d: %s", step.name, resp.Code, step.status, resp.Body.String())
+		}
+	}
+	body := `{"refresh_token": "` + phone.RefreshToken + `"}`
+	if resp := request(router, "POST", "/api/v1/auth/refresh", strings.NewReader(body), nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("refresh of an ended session: status %d", resp.Code)
+	}
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+type sharedFolderEntry struct {
+	ID   string
+	Name string
+	URL  string
+}
+
+type sharedFileEntry struct {
+	ID   string
+	Name string
+	Size int64
+	URL  string
+}
+
+// browseShare 显示文件夹分享的只读目录，?folder= 指定子目录
+func (h *Handler) browseShare(c *gin.Context, link db.ShareLink) {
+	ctx := c.Request.Context()
+	folderID, ok := h.sharedFolderParam(c, link)
+	if !ok {
+		return
+	}
+	folder, err := h.Service.DB.GetFolder(ctx, folderID)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	subfolders, err := h.Service.DB.ListFolders(ctx, &folderID)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	files, _, err := h.Service.DB.ListFilesByFolder(ctx, &folderID, -1, 0, "asc", "")
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	base := "/s/" + link.Token
+	// 面包屑从分享根目录开始，不暴露其上层目录
+	breadcrumbs := []sharedFolderEntry{}
+	for current := folder; ; {
+		breadcrumbs = append([]sharedFolderEntry{{ID: current.FolderID, Name: current.Name, URL: base + "?folder=" + url.QueryEscape(current.FolderID)}}, breadcrumbs...)
+		if current.FolderID == *link.FolderID || current.ParentID == nil {
+			break
+		}
+		if current, err = h.Service.DB.GetFolder(ctx, *current.ParentID); err != nil {
+			break
+		}
+	}
+	folderEntries := make([]sharedFolderEntry, 0, len(subfolders))
+	for _, sub := range subfolders {
+		folderEntries = append(folderEntries, sharedFolderEntry{ID: sub.FolderID, Name: sub.Name, URL: base + "?folder=" + url.QueryEscape(sub.FolderID)})
+	}
+	fileEntries := make([]sharedFileEntry, 0, len(files))
+	for _, file := range files {
+		fileEntries = append(fileEntries, sharedFileEntry{ID: file.FileID, Name: file.OriginalName, Size: file.Size, URL: base + "/files/" + file.FileID})
+	}
+	zipURL := base + "/zip?folder=" + url.QueryEscape(folderID)
+
+	defer h.recordShareAccess(c, link, "share_browse", "", false)
+	if !acceptsHTML(c) {
+		baseURL := h.buildBaseURL(c)
+		folders := make([]gin.H, 0, len(folderEntries))
+		for _, entry := range folderEntries {
+			folders = append(folders, gin.H{"folder_id": entry.ID, "name": entry.Name, "url": baseURL + entry.URL})
+		}
+		items := make([]gin.H, 0, len(fileEntries))
+		for _, entry := range fileEntries {
+			items = append(items, gin.H{"file_id": entry.ID, "name": entry.Name, "size": entry.Size, "download_url": baseURL + entry.URL})
+		}
+		OK(c, gin.H{
+			"folder_id": folder.FolderID,
+			"name":      folder.Name,
+			"folders":   folders,
+			"files":     items,
+			"zip_url":   baseURL + zipURL,
+		})
+		return
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	_ = shareFolderTemplate.Execute(c.Writer, gin.H{
+		"Name":        folder.Name,
+		"Note":        link.Note,
+		"ExpiresAt":   link.ExpiresAt,
+		"Breadcrumbs": breadcrumbs,
+		"Folders":     folderEntries,
+		"Files":       fileEntries,
+		"ZipURL":      zipURL,
+	})
+}
+
+// DownloadShareFile 下载文件夹分享中的单个文件
+func (h *Handler) DownloadShareFile(c *gin.Context) {
+	link, ok := h.openShare(c)
+	if !ok {
+		return
+	}
+	fileID := c.Param("file_id")
+	record, err := h.Service.GetSharedFile(c.Request.Context(), link, fileID)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		h.recordShareAccess(c, link, "share_download", fileID, false)
+		return
+	}
+	h.sendSharedFile(c, link, record)
+}
+
+// DownloadShareZip 将分享的文件夹（或其子目录）实时打包为 zip 流式输出
+func (h *Handler) DownloadShareZip(c *gin.Context) {
+	link, ok := h.openShare(c)
+	if !ok {
+		return
+	}
+	folderID, ok := h.sharedFolderParam(c, link)
+	if !ok {
+		return
+	}
+	folder, err := h.Service.DB.GetFolder(c.Request.Context(), folderID)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	completed := false
+	defer func() { h.recordShareAccess(c, link, "share_download", "", completed) }()
+
+	if err := h.Service.CountShareDownload(c.Request.Context(), link.Token); err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q; filename*=UTF-8''%s", folder.Name+".zip", url.PathEscape(folder.Name+".zip")))
+	c.Status(http.StatusOK)
+	// 大小未知，使用分块传输；出错时连接中断，客户端会得到不完整的压缩包
+	completed = h.Service.WriteFolderZip(c.Request.Context(), c.Writer, folderID) == nil
+}
+
+// sharedFolderParam 解析 ?folder=，并确认其位于分享的目录树内
+func (h *Handler) sharedFolderParam(c *gin.Context, link db.ShareLink) (string, bool) {
+	if link.FolderID == nil || link.Kind != service.ShareKindDownload {
+		c.Status(http.StatusNotFound)
+		return "", false
+	}
+	folderID := c.Query("folder")
+	if folderID == "" || folderID == *link.FolderID {
+		return *link.FolderID, true
+	}
+	included, err := h.Service.ShareIncludesFolder(c.Request.Context(), link, folderID)
+	if err != nil || !included {
+		c.Status(http.StatusNotFound)
+		return "", false
+	}
+	return folderID, true
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+var shareFolderTemplate = template.Must(template.New("folder").Funcs(template.FuncMap{"size": humanSize}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}} - FileHub</title>
+<style>
+body { font-family: sans-serif; max-width: 900px; margin: 32px auto; padding: 0 16px; color: #222; }
+a { color: #1565c0; text-decoration: none; }
+table { width: 100%; border-collapse: collapse; margin-top: 16px; }
+td { padding: 8px; border-bottom: 1px solid #eee; }
+td.size { text-align: right; color: #666; white-space: nowrap; }
+.crumbs { color: #666; }
+.meta { color: #666; font-size: 14px; }
+.zip { float: right; padding: 6px 12px; border: 1px solid #1565c0; border-radius: 4px; }
+</style>
+</head>
+<body>
+<a class="zip" href="{{.ZipURL}}">Download all (zip)</a>
+<div class="crumbs">{{range $i, $b := .Breadcrumbs}}{{if $i}} / {{end}}<a href="{{$b.URL}}">{{$b.Name}}</a>{{end}}</div>
+{{if .Note}}<p>{{.Note}}</p>{{end}}
+<div class="meta">Link expires {{.ExpiresAt}}</div>
+<table>
+{{range .Folders}}<tr><td>📁 <a href="{{.URL}}">{{.Name}}</a></td><td class="size"></td></tr>
+{{end}}{{range .Files}}<tr><td><a href="{{.URL}}">{{.Name}}</a></td><td class="size">{{size .Size}}</td></tr>
+{{end}}{{if and (not .Folders) (not .Files)}}<tr><td>This folder is empty.</td><td></td></tr>{{end}}
+</table>
+</body>
+</html>
+`))
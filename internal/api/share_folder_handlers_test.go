@@ -0,0 +1,123 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFolderShare(t *testing.T) {
+	router, svc := newTestRouter(t)
+	addTestFolder(t, svc, "shared", "shared", nil)
+	addTestFolder(t, svc, "docs", "docs", ptr("shared"))
+	addTestFolder(t, svc, "outside", "outside", nil)
+	top := uploadTestFileTo(t, router, "shared", "top.txt", "top")
+	nested := uploadTestFileTo(t, router, "docs", "nested.txt", "nested")
+	secret := uploadTestFileTo(t, router, "outside", "secret.txt", "secret")
+	root := uploadTestFile(t, router, "root.txt", "root")
+
+	resp := request(router, "POST", "/api/v1/folders/shared/share", nil, nil)
+	var link struct {
+		Token string `json:"token"`
+	}
+	decodeData(t, resp, &link)
+	base := "/s/" + link.Token
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+	}{
+		{"browse the root", base, http.StatusOK, `"name":"top.txt"`},
+		{"browse a subfolder", base + "?folder=docs", http.StatusOK, `"name":"nested.txt"`},
+		{"browse outside the share", base + "?folder=outside", http.StatusNotFound, ""},
+		{"browse an unknown folder", base + "?folder=nope", http.StatusNotFound, ""},
+		{"file in the share", base + "/files/" + top, http.StatusOK, "top"},
+		{"file in a subfolder", base + "/files/" + nested, http.StatusOK, "nested"},
+		{"file outside the share", base + "/files/" + secret, http.StatusNotFound, ""},
+		{"file at the root", base + "/files/" + root, http.StatusNotFound, ""},
+		{"zip outside the share", base + "/zip?folder=outside", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := serve(router, httptestRequest("GET", test.path, nil))
+			if resp.Code != test.status || !strings.Contains(resp.Body.String(), test.body) {
+				t.Errorf("%d %q, want %d containing %q", resp.Code, resp.Body.String(), test.status, test.body)
+			}
+		})
+	}
+}
+
+func TestFolderShareZip(t *testing.T) {
+	router, svc := newTestRouter(t)
+	addTestFolder(t, svc, "shared", "shared", nil)
+	addTestFolder(t, svc, "docs", "docs", ptr("shared"))
+	uploadTestFileTo(t, router, "shared", "top.txt", "top")
+	uploadTestFileTo(t, router, "docs", "nested.txt", "nested")
+
+	resp := request(router, "POST", "/api/v1/folders/shared/share", nil, nil)
+	var link struct {
+		Token string `json:"token"`
+	}
+	decodeData(t, resp, &link)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"docs/", "docs/nested.txt", "top.txt"}},
+		{"?folder=docs", []string{"nested.txt"}},
+	}
+	for _, test := range tests {
+		resp := serve(router, httptestRequest("GET", "/s/"+link.Token+"/zip"+test.query, nil))
+		if resp.Code != http.StatusOK || resp.Header().Get("Content-Type") != "application/zip" {
+			t.Fatalf("zip%s: %d %s", test.query, resp.Code, resp.Header().Get("Content-Type"))
+		}
+		archive, err := zip.NewReader(bytes.NewReader(resp.Body.Bytes()), int64(resp.Body.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, entry := range archive.File {
+			names = append(names, entry.Name)
+		}
+		sort.Strings(names)
+		if strings.Join(names, ",") != strings.Join(test.want, ",") {
+			t.Errorf("zip%s holds %v, want %v", test.query, names, test.want)
+		}
+	}
+}
+
+func TestFolderShareDownloadLimit(t *testing.T) {
+	router, svc := newTestRouter(t)
+	addTestFolder(t, svc, "shared", "shared", nil)
+	fileID := uploadTestFileTo(t, router, "shared", "top.txt", "top")
+	resp := request(router, "POST", "/api/v1/folders/shared/share", strings.NewReader(`{"max_downloads": 2}`), map[string]string{"Content-Type": "application/json"})
+	var link struct {
+		Token string `json:"token"`
+	}
+	decodeData(t, resp, &link)
+	base := "/s/" + link.Token
+
+	// Browsing is free; single files and zips draw on the same limit.
+	steps := []struct {
+		path   string
+		status int
+	}{
+		{base, http.StatusOK},
+		{base + "/zip", http.StatusOK},
+		{base, http.StatusOK},
+		{base + "/files/" + fileID, http.StatusOK},
+		{base + "/zip", http.StatusNotFound},
+		{base, http.StatusNotFound},
+	}
+	for i, step := range steps {
+		if resp := serve(router, httptestRequest("GET", step.path, nil)); resp.Code != step.status {
+			t.Fatalf("step %d %s: %d, want %d", i, step.path, resp.Code, step.status)
+		}
+	}
+}
@@ -0,0 +1,582 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+const (
+	// SharePasswordHeader 供脚本访问受密码保护的分享链接
+	SharePasswordHeader = "X-Share-Password"
+	shareUnlockCookie   = "filehub_share"
+	// shareRangeStartKey 记录本次下载的起始字节，随访问记录保存
+	shareRangeStartKey = "share_range_start"
+)
+
+type createShareRequest struct {
+	Type         string `json:"type"`
+	ExpiresIn    string `json:"expires_in"`
+	Password     string `json:"password"`
+	MaxDownloads int64  `json:"max_downloads"`
+	Note         string `json:"note"`
+	MaxFiles     int64  `json:"max_files"`
+	MaxBytes     int64  `json:"max_bytes"`
+}
+
+type updateShareRequest struct {
+	ExpiresIn    *string `json:"expires_in"`
+	Password     *string `json:"password"`
+	MaxDownloads *int64  `json:"max_downloads"`
+	Note         *string `json:"note"`
+	MaxFiles     *int64  `json:"max_files"`
+	MaxBytes     *int64  `json:"max_bytes"`
+}
+
+// ShareFile 返回文件的默认分享链接（7 天有效，无密码），已存在则复用
+func (h *Handler) ShareFile(c *gin.Context) {
+	fileID := c.Param("id")
+	record, err := h.Service.GetFile(c.Request.Context(), fileID)
+	if err != nil {
+		Error(c, http.StatusNotFound, 10003, "not found")
+		h.audit(c, "share", fileID, getUser(c), "failure", "not found")
+		return
+	}
+	if !h.checkFolder(c, record.FolderID, service.AccessWrite) {
+		return
+	}
+	link, reused, err := h.Service.ShareFile(c.Request.Context(), fileID, getUser(c))
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "share failed")
+		h.audit(c, "share", fileID, getUser(c), "failure", "create failed")
+		return
+	}
+	if reused {
+		h.audit(c, "share", fileID, getUser(c), "success", "reused")
+	} else {
+		h.audit(c, "share", fileID, getUser(c), "success", "created")
+	}
+	OK(c, h.shareResponse(c, link))
+}
+
+// CreateShare 按请求参数新建文件分享链接
+func (h *Handler) CreateShare(c *gin.Context) {
+	fileID := c.Param("id")
+	kind, opts, ok := bindShareOptions(c)
+	if !ok {
+		return
+	}
+	if kind != service.ShareKindDownload {
+		Error(c, http.StatusBadRequest, 10004, "upload links require a folder")
+		return
+	}
+	record, err := h.Service.GetFile(c.Request.Context(), fileID)
+	if err != nil {
+		Error(c, http.StatusNotFound, 10003, "not found")
+		h.audit(c, "share", fileID, getUser(c), "failure", "not found")
+		return
+	}
+	if !h.checkFolder(c, record.FolderID, service.AccessWrite) {
+		return
+	}
+	link, err := h.Service.CreateShare(c.Request.Context(), fileID, getUser(c), opts)
+	h.writeCreatedShare(c, link, fileID, err)
+}
+
+// CreateFolderShare 新建文件夹分享链接，访问者可浏览子目录并打包下载；
+// type 为 upload 时创建只能上传的收集链接
+func (h *Handler) CreateFolderShare(c *gin.Context) {
+	folderID := c.Param("id")
+	kind, opts, ok := bindShareOptions(c)
+	if !ok {
+		return
+	}
+	if _, err := h.Service.DB.GetFolder(c.Request.Context(), folderID); err != nil {
+		Error(c, http.StatusNotFound, 10003, "folder not found")
+		h.audit(c, "share", "", getUser(c), "failure", "folder not found")
+		return
+	}
+	if !h.checkFolder(c, &folderID, service.AccessWrite) {
+		return
+	}
+	var link db.ShareLink
+	var err error
+	if kind == service.ShareKindUpload {
+		link, err = h.Service.CreateUploadLink(c.Request.Context(), folderID, getUser(c), opts)
+	} else {
+		link, err = h.Service.CreateFolderShare(c.Request.Context(), folderID, getUser(c), opts)
+	}
+	h.writeCreatedShare(c, link, "", err)
+}
+
+func (h *Handler) writeCreatedShare(c *gin.Context, link db.ShareLink, fileID string, err error) {
+	if err != nil {
+		if errors.Is(err, service.ErrShareOptionsInvalid) {
+			Error(c, http.StatusBadRequest, 10004, err.Error())
+			return
+		}
+		Error(c, http.StatusInternalServerError, 19999, "share failed")
+		h.audit(c, "share", fileID, getUser(c), "failure", "create failed")
+		return
+	}
+	message := "created"
+	if link.FolderID != nil {
+		message = link.Kind + " folder " + *link.FolderID
+	}
+	h.audit(c, "share", fileID, getUser(c), "success", message)
+	OK(c, h.shareResponse(c, link))
+}
+
+func bindShareOptions(c *gin.Context) (string, service.ShareOptions, bool) {
+	var req createShareRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			Error(c, http.StatusBadRequest, 10004, "invalid request")
+			return "", service.ShareOptions{}, false
+		}
+	}
+	kind := req.Type
+	switch kind {
+	case "":
+		kind = service.ShareKindDownload
+	case service.ShareKindDownload, service.ShareKindUpload:
+	default:
+		Error(c, http.StatusBadRequest, 10004, "invalid type")
+		return "", service.ShareOptions{}, false
+	}
+	opts := service.ShareOptions{
+		Password:     req.Password,
+		MaxDownloads: req.MaxDownloads,
+		Note:         req.Note,
+		MaxFiles:     req.MaxFiles,
+		MaxBytes:     req.MaxBytes,
+	}
+	if req.ExpiresIn != "" {
+		expiresIn, err := parseShareDuration(req.ExpiresIn)
+		if err != nil {
+			Error(c, http.StatusBadRequest, 10004, "invalid expires_in")
+			return "", service.ShareOptions{}, false
+		}
+		opts.ExpiresIn = expiresIn
+	}
+	return kind, opts, true
+}
+
+// UpdateShare 延长有效期或修改下载次数、上传限额、密码、备注
+func (h *Handler) UpdateShare(c *gin.Context) {
+	token := c.Param("token")
+	if !h.checkShareTarget(c, token, service.AccessWrite) {
+		return
+	}
+	var req updateShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 10004, "invalid request")
+		return
+	}
+	update := service.ShareUpdate{
+		Password:     req.Password,
+		MaxDownloads: req.MaxDownloads,
+		Note:         req.Note,
+		MaxFiles:     req.MaxFiles,
+		MaxBytes:     req.MaxBytes,
+	}
+	if req.ExpiresIn != nil {
+		expiresIn, err := parseShareDuration(*req.ExpiresIn)
+		if err != nil {
+			Error(c, http.StatusBadRequest, 10004, "invalid expires_in")
+			return
+		}
+		update.ExpiresIn = &expiresIn
+	}
+	link, err := h.Service.UpdateShare(c.Request.Context(), token, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			Error(c, http.StatusNotFound, 10003, "not found")
+		case errors.Is(err, service.ErrShareOptionsInvalid):
+			Error(c, http.StatusBadRequest, 10004, err.Error())
+		case errors.Is(err, service.ErrShareUnavailable):
+			Error(c, http.StatusConflict, 10004, "share link revoked")
+		default:
+			Error(c, http.StatusInternalServerError, 19999, "update share failed")
+		}
+		h.audit(c, "share_update", link.FileID, getUser(c), "failure", err.Error())
+		return
+	}
+	h.audit(c, "share_update", link.FileID, getUser(c), "success", "")
+	OK(c, h.shareResponse(c, link))
+}
+
+// RevokeShare 撤销分享链接，之后访问返回 404
+func (h *Handler) RevokeShare(c *gin.Context) {
+	if !h.checkShareTarget(c, c.Param("token"), service.AccessWrite) {
+		return
+	}
+	link, err := h.Service.RevokeShare(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			Error(c, http.StatusNotFound, 10003, "not found")
+			return
+		}
+		Error(c, http.StatusInternalServerError, 19999, "revoke share failed")
+		h.audit(c, "share_revoke", link.FileID, getUser(c), "failure", "update failed")
+		return
+	}
+	h.audit(c, "share_revoke", link.FileID, getUser(c), "success", "")
+	Message(c, "revoked")
+}
+
+// DownloadShare 公开访问入口：文件分享直接下载，文件夹分享显示只读目录页，
+// 上传链接显示上传页
+func (h *Handler) DownloadShare(c *gin.Context) {
+	link, ok := h.openShare(c)
+	if !ok {
+		return
+	}
+	if link.Kind == service.ShareKindUpload {
+		h.showShareUpload(c, link, http.StatusOK, "")
+		return
+	}
+	if link.FolderID != nil {
+		h.browseShare(c, link)
+		return
+	}
+	record, err := h.Service.GetFile(c.Request.Context(), link.FileID)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		h.recordShareAccess(c, link, "share_download", link.FileID, false)
+		return
+	}
+	h.sendSharedFile(c, link, record)
+}
+
+// openShare 校验分享链接状态和密码；不可访问时写入响应并返回 false
+func (h *Handler) openShare(c *gin.Context) (db.ShareLink, bool) {
+	link, err := h.Service.OpenShare(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		if link.Token != "" {
+			h.recordShareAccess(c, link, "share_download", link.FileID, false)
+		} else {
+			markFailure(c)
+		}
+		return db.ShareLink{}, false
+	}
+	if link.PasswordHash == "" || h.shareUnlocked(c, link) {
+		return link, true
+	}
+	if err := h.Service.CheckSharePassword(link, c.GetHeader(SharePasswordHeader)); err != nil {
+		if errors.Is(err, service.ErrSharePasswordInvalid) {
+			markFailure(c)
+		}
+		if acceptsHTML(c) {
+			renderShareUnlock(c, http.StatusUnauthorized, link, "")
+		} else {
+			Error(c, http.StatusUnauthorized, 10014, err.Error())
+		}
+		h.recordShareAccess(c, link, "share_download", link.FileID, false)
+		return db.ShareLink{}, false
+	}
+	return link, true
+}
+
+// sendSharedFile 计入下载次数并输出文件内容
+func (h *Handler) sendSharedFile(c *gin.Context, link db.ShareLink, record db.FileRecord) {
+	completed := false
+	defer func() { h.recordShareAccess(c, link, "share_download", record.FileID, completed) }()
+
+	// 按实际提供的起始位置计数：只有从同一客户端上次传输停止处接着下载的请求不重复计数
+	start, _, _, err := parseRangeHeader(c.GetHeader("Range"), record.Size)
+	if err != nil {
+		c.Status(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	var offset int64
+	if start != nil {
+		offset = *start
+	}
+	c.Set(shareRangeStartKey, offset)
+	if !h.Service.ResumesShareDownload(c.Request.Context(), link.Token, record.FileID, c.ClientIP(), offset) {
+		if err := h.Service.CountShareDownload(c.Request.Context(), link.Token); err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+	}
+	if err := h.streamObject(c, record, false); err != nil {
+		if !c.Writer.Written() {
+			c.Status(http.StatusInternalServerError)
+		}
+		return
+	}
+	completed = strconv.Itoa(c.Writer.Size()) == c.Writer.Header().Get("Content-Length")
+}
+
+// recordShareAccess 记录一次公开访问，并写入审计日志
+func (h *Handler) recordShareAccess(c *gin.Context, link db.ShareLink, action, fileID string, completed bool) {
+	bytesSent := int64(c.Writer.Size())
+	if bytesSent < 0 {
+		bytesSent = 0
+	}
+	h.Service.RecordShareAccess(c.Request.Context(), db.ShareAccess{
+		Token:      link.Token,
+		FileID:     fileID,
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		StatusCode: c.Writer.Status(),
+		RangeStart: c.GetInt64(shareRangeStartKey),
+		BytesSent:  bytesSent,
+		Completed:  completed,
+	})
+	status, message := "success", ""
+	switch {
+	case c.Writer.Status() >= http.StatusBadRequest:
+		status, message = "failure", http.StatusText(c.Writer.Status())
+	case !completed && action == "share_download":
+		status, message = "failure", "incomplete"
+	}
+	h.audit(c, action, fileID, service.ShareActor(link), status, message)
+}
+
+// ListShares 列出全部分享链接，可按 file_id、folder_id、状态和到期时间过滤
+func (h *Handler) ListShares(c *gin.Context) {
+	h.listShares(c, db.ShareFilter{FileID: c.Query("file_id"), FolderID: c.Query("folder_id")})
+}
+
+// ListFileShares 列出某个文件的分享链接
+func (h *Handler) ListFileShares(c *gin.Context) {
+	fileID := c.Param("id")
+	record, err := h.Service.GetFile(c.Request.Context(), fileID)
+	if err != nil {
+		Error(c, http.StatusNotFound, 10003, "not found")
+		return
+	}
+	if !h.checkFolder(c, record.FolderID, service.AccessRead) {
+		return
+	}
+	h.listShares(c, db.ShareFilter{FileID: fileID})
+}
+
+// ListFolderShares 列出某个文件夹的分享链接
+func (h *Handler) ListFolderShares(c *gin.Context) {
+	folderID := c.Param("id")
+	if _, err := h.Service.DB.GetFolder(c.Request.Context(), folderID); err != nil {
+		Error(c, http.StatusNotFound, 10003, "folder not found")
+		return
+	}
+	if !h.checkFolder(c, &folderID, service.AccessRead) {
+		return
+	}
+	h.listShares(c, db.ShareFilter{FolderID: folderID})
+}
+
+func (h *Handler) listShares(c *gin.Context, filter db.ShareFilter) {
+	filter.Status = c.Query("status")
+	filter.Limit = parseInt(c.DefaultQuery("limit", "20"), 20)
+	filter.Offset = parseInt(c.DefaultQuery("offset", "0"), 0)
+	for param, target := range map[string]*string{"expires_before": &filter.ExpiresBefore, "expires_after": &filter.ExpiresAfter} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			Error(c, http.StatusBadRequest, 10004, "invalid "+param)
+			return
+		}
+		*target = parsed.UTC().Format(time.RFC3339)
+	}
+	access, ok := h.folderAccess(c)
+	if !ok {
+		return
+	}
+	filter.Hidden = access.Hidden()
+	links, total, err := h.Service.ListShares(c.Request.Context(), filter)
+	if err != nil {
+		if errors.Is(err, service.ErrShareOptionsInvalid) {
+			Error(c, http.StatusBadRequest, 10004, "invalid status")
+			return
+		}
+		Error(c, http.StatusInternalServerError, 19999, "list failed")
+		return
+	}
+	items := make([]gin.H, 0, len(links))
+	for _, link := range links {
+		items = append(items, h.shareStatsResponse(c, link))
+	}
+	OK(c, gin.H{"total": total, "shares": items})
+}
+
+// GetShare 返回分享链接及其访问统计
+func (h *Handler) GetShare(c *gin.Context) {
+	if !h.checkShareTarget(c, c.Param("token"), service.AccessRead) {
+		return
+	}
+	stats, err := h.Service.GetShareStats(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		Error(c, http.StatusNotFound, 10003, "not found")
+		return
+	}
+	OK(c, h.shareStatsResponse(c, stats))
+}
+
+// ListShareAccesses 返回分享链接的访问记录，最新的在前
+func (h *Handler) ListShareAccesses(c *gin.Context) {
+	token := c.Param("token")
+	if !h.checkShareTarget(c, token, service.AccessRead) {
+		return
+	}
+	limit := parseInt(c.DefaultQuery("limit", "50"), 50)
+	offset := parseInt(c.DefaultQuery("offset", "0"), 0)
+	accesses, total, err := h.Service.ListShareAccesses(c.Request.Context(), token, limit, offset)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "list failed")
+		return
+	}
+	items := make([]gin.H, 0, len(accesses))
+	for _, access := range accesses {
+		items = append(items, gin.H{
+			"accessed_at": access.AccessedAt,
+			"ip_address":  access.IPAddress,
+			"user_agent":  access.UserAgent,
+			"status_code": access.StatusCode,
+			"range_start": access.RangeStart,
+			"bytes_sent":  access.BytesSent,
+			"completed":   access.Completed,
+		})
+	}
+	OK(c, gin.H{"total": total, "accesses": items})
+}
+
+// checkShareTarget 检查调用者对分享链接所指文件或文件夹的权限；看不到目标时与链接不存在一样返回 404
+func (h *Handler) checkShareTarget(c *gin.Context, token string, level string) bool {
+	folderID, err := h.Service.DB.ShareTargetFolder(c.Request.Context(), token)
+	if err != nil {
+		Error(c, http.StatusNotFound, 10003, "not found")
+		return false
+	}
+	return h.checkFolder(c, folderID, level)
+}
+
+// UnlockShare 处理解锁页提交的密码，成功后写入 Cookie 并跳回下载地址
+func (h *Handler) UnlockShare(c *gin.Context) {
+	token := c.Param("token")
+	link, err := h.Service.OpenShare(c.Request.Context(), token)
+	if err != nil {
+		if link.Token == "" {
+			markFailure(c)
+		}
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err := h.Service.CheckSharePassword(link, c.PostForm("password")); err != nil {
+		markFailure(c)
+		h.audit(c, "share_unlock", link.FileID, service.ShareActor(link), "failure", err.Error())
+		renderShareUnlock(c, http.StatusUnauthorized, link, "Incorrect password")
+		return
+	}
+	maxAge := 0
+	if expiresAt, err := time.Parse(time.RFC3339, link.ExpiresAt); err == nil {
+		maxAge = int(time.Until(expiresAt).Seconds())
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(shareUnlockCookie, h.Service.ShareUnlockKey(link), maxAge, "/s/"+token, "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusSeeOther, "/s/"+token)
+}
+
+func (h *Handler) shareUnlocked(c *gin.Context, link db.ShareLink) bool {
+	value, err := c.Cookie(shareUnlockCookie)
+	return err == nil && value == h.Service.ShareUnlockKey(link)
+}
+
+func (h *Handler) shareResponse(c *gin.Context, link db.ShareLink) gin.H {
+	return gin.H{
+		"token":          link.Token,
+		"url":            h.buildShareDownloadURL(c, link.Token),
+		"file_id":        link.FileID,
+		"folder_id":      link.FolderID,
+		"status":         service.ShareState(link, time.Now()),
+		"expires_at":     link.ExpiresAt,
+		"max_downloads":  link.MaxDownloads,
+		"download_count": link.DownloadCount,
+		"has_password":   link.PasswordHash != "",
+		"note":           link.Note,
+		"type":           link.Kind,
+		"max_files":      link.MaxUploadFiles,
+		"max_bytes":      link.MaxUploadBytes,
+		"uploaded_files": link.UploadedFiles,
+		"uploaded_bytes": link.UploadedBytes,
+		"created_at":     link.CreatedAt,
+		"created_by":     link.CreatedBy,
+	}
+}
+
+func (h *Handler) shareStatsResponse(c *gin.Context, stats db.ShareLinkStats) gin.H {
+	response := h.shareResponse(c, stats.ShareLink)
+	response["accesses"] = stats.Accesses
+	response["completed_downloads"] = stats.Completed
+	response["bytes_sent"] = stats.BytesSent
+	response["last_accessed_at"] = stats.LastAccessedAt
+	return response
+}
+
+// parseShareDuration accepts Go durations ("36h") plus a day suffix ("7d").
+func parseShareDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, errors.New("invalid duration")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, errors.New("invalid duration")
+	}
+	return duration, nil
+}
+
+func acceptsHTML(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), "text/html")
+}
+
+var shareUnlockTemplate = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>FileHub</title>
+<style>
+body { font-family: sans-serif; display: flex; justify-content: center; padding-top: 15vh; background: #f5f5f5; }
+form { background: #fff; padding: 24px; border-radius: 8px; box-shadow: 0 1px 4px rgba(0,0,0,.1); min-width: 280px; }
+input, button { width: 100%; box-sizing: border-box; padding: 8px; margin-top: 12px; }
+.error { color: #c00; }
+.note { color: #555; }
+</style>
+</head>
+<body>
+<form method="post" action="/s/{{.Token}}">
+<div>This file is password protected.</div>
+{{if .Note}}<div class="note">{{.Note}}</div>{{end}}
+{{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+<input type="password" name="password" placeholder="Password" autofocus required>
+<button type="submit">Unlock</button>
+</form>
+</body>
+</html>
+`))
+
+func renderShareUnlock(c *gin.Context, status int, link db.ShareLink, message string) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	_ = shareUnlockTemplate.Execute(c.Writer, gin.H{"Token": link.Token, "Note": link.Note, "Error": message})
+}
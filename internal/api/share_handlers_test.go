@@ -0,0 +1,291 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kiry163/filehub/internal/service"
+)
+
+func TestParseShareDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"7d", 7 * 24 * time.Hour, true},
+		{"1d", 24 * time.Hour, true},
+		{"36h", 36 * time.Hour, true},
+		{" 90m ", 90 * time.Minute, true},
+		{"0d", 0, false},
+		{"-1d", 0, false},
+		{"0s", 0, false},
+		{"-5m", 0, false},
+		{"d", 0, false},
+		{"1.5d", 0, false},
+		{"soon", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseShareDuration(test.value)
+			if (err == nil) != test.ok || got != test.want {
+				t.Errorf("got %v, %v; want %v", got, err, test.want)
+			}
+		})
+	}
+}
+
+// createTestShare creates a share link for fileID with the given JSON
+// options and returns its token.
+func createTestShare(t *testing.T, router http.Handler, fileID, options string) string {
+	t.Helper()
+	resp := request(router, "POST", "/api/v1/files/"+fileID+"/share", strings.NewReader(options), map[string]string{"Content-Type": "application/json"})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("create share: %d %s", resp.Code, resp.Body.String())
+	}
+	var data struct {
+		Token string `json:"token"`
+	}
+	decodeData(t, resp, &data)
+	return data.Token
+}
+
+// getShare downloads a share anonymously.
+func getShare(router http.Handler, token string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptestRequest("GET", "/s/"+token, nil)
+	req.Header.Del("X-Local-Key")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return serve(router, req)
+}
+
+func TestShareDownloadLimitAndRanges(t *testing.T) {
+	router, _ := newTestRouter(t)
+	fileID := uploadTestFile(t, router, "a.txt", "0123456789")
+	token := createTestShare(t, router, fileID, `{"max_downloads": 2}`)
+
+	steps := []struct {
+		name   string
+		rng    string
+		status int
+		body   string
+	}{
+		{"unsatisfiable range", "bytes=20-", http.StatusRequestedRangeNotSatisfiable, ""},
+		{"interrupted first download", "bytes=0-3", http.StatusPartialContent, "0123"},
+		// Picking up exactly where the last transfer stopped is not counted.
+		{"resumed download", "bytes=4-", http.StatusPartialContent, "456789"},
+		{"second download", "", http.StatusOK, "0123456789"},
+		// A range that does not continue a transfer is a new download.
+		{"range skipping ahead after the limit", "bytes=4-", http.StatusNotFound, ""},
+		{"new download after the limit", "", http.StatusNotFound, ""},
+	}
+	for _, step := range steps {
+		headers := map[string]string{}
+		if step.rng != "" {
+			headers["Range"] = step.rng
+		}
+		resp := getShare(router, token, headers)
+		if resp.Code != step.status || resp.Body.String() != step.body && step.body != "" {
+			t.Fatalf("%s: %d %q, want %d %q", step.name, resp.Code, resp.Body.String(), step.status, step.body)
+		}
+	}
+}
+
+func TestSharePassword(t *testing.T) {
+	router, _ := newTestRouter(t)
+	fileID := uploadTestFile(t, router, "a.txt", "secret data")
+	token := createTestShare(t, router, fileID, `{"password": "s3cret", "note": "for <bob>"}`)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		body    string
+	}{
+		{"no password", nil, http.StatusUnauthorized, `"code":10014`},
+		{"wrong password", map[string]string{SharePasswordHeader: "secret"}, http.StatusUnauthorized, `"code":10014`},
+		{"browser gets the unlock page", map[string]string{"Accept": "text/html"}, http.StatusUnauthorized, "for &lt;bob&gt;"},
+		{"right password", map[string]string{SharePasswordHeader: "s3cret"}, http.StatusOK, "secret data"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := getShare(router, token, test.headers)
+			if resp.Code != test.status || !strings.Contains(resp.Body.String(), test.body) {
+				t.Errorf("%d %q, want %d containing %q", resp.Code, resp.Body.String(), test.status, test.body)
+			}
+		})
+	}
+
+	t.Run("unlock form", func(t *testing.T) {
+		for _, test := range []struct {
+			password string
+			status   int
+		}{
+			{"wrong", http.StatusUnauthorized},
+			{"s3cret", http.StatusSeeOther},
+		} {
+			req := httptestRequest("POST", "/s/"+token, strings.NewReader(url.Values{"password": {test.password}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			resp := serve(router, req)
+			if resp.Code != test.status {
+				t.Fatalf("unlock with %q: %d", test.password, resp.Code)
+			}
+			if resp.Code != http.StatusSeeOther {
+				continue
+			}
+			cookie := resp.Result().Cookies()[0]
+			download := getShare(router, token, map[string]string{"Cookie": cookie.Name + "=" + cookie.Value})
+			if download.Code != http.StatusOK || download.Body.String() != "secret data" {
+				t.Errorf("download with unlock cookie: %d %q", download.Code, download.Body.String())
+			}
+		}
+	})
+}
+
+func TestRevokedShare(t *testing.T) {
+	router, _ := newTestRouter(t)
+	fileID := uploadTestFile(t, router, "a.txt", "abc")
+	token := createTestShare(t, router, fileID, "")
+	if resp := request(router, "DELETE", "/api/v1/shares/"+token, nil, nil); resp.Code != http.StatusOK {
+		t.Fatalf("revoke: %d", resp.Code)
+	}
+	if resp := getShare(router, token, nil); resp.Code != http.StatusNotFound {
+		t.Errorf("download revoked link: %d", resp.Code)
+	}
+	resp := request(router, "PATCH", "/api/v1/shares/"+token, strings.NewReader(`{"expires_in": "1d"}`), map[string]string{"Content-Type": "application/json"})
+	if resp.Code != http.StatusConflict {
+		t.Errorf("extend revoked link: %d", resp.Code)
+	}
+}
+
+func TestShareAccessCounters(t *testing.T) {
+	router, _ := newTestRouter(t)
+	fileID := uploadTestFile(t, router, "a.txt", "0123456789")
+	token := createTestShare(t, router, fileID, `{"password": "pw"}`)
+
+	getShare(router, token, nil)
+	getShare(router, token, map[string]string{SharePasswordHeader: "pw"})
+	getShare(router, token, map[string]string{SharePasswordHeader: "pw", "Range": "bytes=0-3"})
+
+	resp := request(router, "GET", "/api/v1/shares/"+token, nil, nil)
+	var stats struct {
+		Accesses           int64   `json:"accesses"`
+		CompletedDownloads int64   `json:"completed_downloads"`
+		BytesSent          int64   `json:"bytes_sent"`
+		DownloadCount      int64   `json:"download_count"`
+		LastAccessedAt     *string `json:"last_accessed_at"`
+	}
+	decodeData(t, resp, &stats)
+	// The 401 is recorded as an access, and both downloads ran to the end
+	// of what they asked for.
+	if stats.Accesses != 3 || stats.CompletedDownloads != 2 || stats.DownloadCount != 2 || stats.LastAccessedAt == nil {
+		t.Errorf("stats %+v", stats)
+	}
+
+	resp = request(router, "GET", "/api/v1/shares/"+token+"/accesses?limit=10", nil, nil)
+	var accesses struct {
+		Total    int `json:"total"`
+		Accesses []struct {
+			StatusCode int  `json:"status_code"`
+			Completed  bool `json:"completed"`
+		} `json:"accesses"`
+	}
+	decodeData(t, resp, &accesses)
+	if accesses.Total != 3 || accesses.Accesses[0].StatusCode != http.StatusPartialContent || accesses.Accesses[2].StatusCode != http.StatusUnauthorized {
+		t.Errorf("accesses %+v", accesses)
+	}
+
+	tests := []struct {
+		query string
+		total int
+	}{
+		{"", 1},
+		{"?status=active", 1},
+		{"?status=revoked", 0},
+		{"?file_id=nope", 0},
+	}
+	for _, test := range tests {
+		resp := request(router, "GET", "/api/v1/shares"+test.query, nil, nil)
+		var list struct {
+			Total int `json:"total"`
+		}
+		decodeData(t, resp, &list)
+		if list.Total != test.total {
+			t.Errorf("list%s: %d, want %d", test.query, list.Total, test.total)
+		}
+	}
+	if resp := request(router, "GET", "/api/v1/shares?status=pending", nil, nil); resp.Code != http.StatusBadRequest {
+		t.Errorf("unknown status: %d", resp.Code)
+	}
+}
+
+func TestShareManagementFollowsACL(t *testing.T) {
+	router, svc := newTestRouter(t)
+	ctx := context.Background()
+	addTestFolder(t, svc, "secret", "secret", nil)
+	addTestFolder(t, svc, "readonly", "readonly", nil)
+	if _, err := svc.SetFolderACL(ctx, "secret", "local", []service.ACLEntry{{Role: service.RoleAdmin, Access: service.AccessWrite}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetFolderACL(ctx, "readonly", "local", []service.ACLEntry{{Role: service.RoleEditor, Access: service.AccessRead}}); err != nil {
+		t.Fatal(err)
+	}
+	tokens := map[string]string{
+		"public":   createTestShare(t, router, uploadTestFile(t, router, "public.txt", "public"), `{}`),
+		"secret":   createTestShare(t, router, uploadTestFileTo(t, router, "secret", "plans.txt", "plans"), `{}`),
+		"readonly": createTestShare(t, router, uploadTestFileTo(t, router, "readonly", "memo.txt", "memo"), `{}`),
+	}
+	bob := loginAs(t, svc, "bob", service.RoleEditor)
+
+	var listing struct {
+		Total  int `json:"total"`
+		Shares []struct {
+			Token string `json:"token"`
+		} `json:"shares"`
+	}
+	decodeData(t, requestAs(router, bob, "GET", "/api/v1/shares", nil), &listing)
+	listed := map[string]bool{}
+	for _, link := range listing.Shares {
+		listed[link.Token] = true
+	}
+	if listing.Total != 2 || !listed[tokens["public"]] || !listed[tokens["readonly"]] {
+		t.Errorf("editor lists %+v", listing)
+	}
+
+	tests := []struct {
+		method, target, suffix string
+		body                   string
+		status                 int
+	}{
+		{"GET", "secret", "", "", http.StatusNotFound},
+		{"GET", "secret", "/accesses", "", http.StatusNotFound},
+		{"PATCH", "secret", "", `{"note": "mine"}`, http.StatusNotFound},
+		{"DELETE", "secret", "", "", http.StatusNotFound},
+		{"GET", "readonly", "", "", http.StatusOK},
+		{"GET", "readonly", "/accesses", "", http.StatusOK},
+		{"PATCH", "readonly", "", `{"note": "mine"}`, http.StatusForbidden},
+		{"DELETE", "readonly", "", "", http.StatusForbidden},
+		{"PATCH", "public", "", `{"note": "mine"}`, http.StatusOK},
+		{"DELETE", "public", "", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		var body io.Reader
+		if test.body != "" {
+			body = strings.NewReader(test.body)
+		}
+		resp := requestAs(router, bob, test.method, "/api/v1/shares/"+tokens[test.target]+test.suffix, body)
+		if resp.Code != test.status {
+			t.Errorf("%s %s share%s: %d %s, want %d", test.method, test.target, test.suffix, resp.Code, resp.Body.String(), test.status)
+		}
+	}
+	if resp := request(router, "DELETE", "/api/v1/shares/"+tokens["secret"], nil, nil); resp.Code != http.StatusOK {
+		t.Errorf("admin revoking: %d %s", resp.Code, resp.Body.String())
+	}
+}
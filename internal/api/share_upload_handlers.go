@@ -0,0 +1,169 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+// shareUploadOverhead 为请求体上限额外留出的 multipart 边界和头部空间
+const shareUploadOverhead = 64 << 10
+
+// UploadShare 通过上传链接接收外部文件，字段 file 可重复；不提供列表或下载
+func (h *Handler) UploadShare(c *gin.Context) {
+	link, ok := h.openShare(c)
+	if !ok {
+		return
+	}
+	if link.Kind != service.ShareKindUpload {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	actor := service.ShareActor(link)
+	// 请求体按链接剩余额度（不超过 MaxSizeMB）截断，超出时边读边拒绝
+	limit, limitErr := h.Service.ShareUploadLimit(link)
+	if limit > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+shareUploadOverhead)
+	}
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		h.rejectShareUpload(c, link, http.StatusBadRequest, 10004, "file required")
+		return
+	}
+	uploaded := make([]gin.H, 0, 1)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			h.rejectShareUploadError(c, link, err, limitErr)
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		record, err := h.Service.UploadToShare(c.Request.Context(), link, part, part.FileName())
+		part.Close()
+		if err != nil {
+			h.rejectShareUploadError(c, link, err, limitErr)
+			return
+		}
+		link.UploadedFiles++
+		link.UploadedBytes += record.Size
+		h.audit(c, "upload", record.FileID, actor, "success", "")
+		uploaded = append(uploaded, gin.H{"name": record.OriginalName, "size": record.Size, "sha256": record.SHA256})
+	}
+	if len(uploaded) == 0 {
+		h.rejectShareUpload(c, link, http.StatusBadRequest, 10004, "file required")
+		return
+	}
+	h.recordShareAccess(c, link, "share_upload", "", true)
+
+	if acceptsHTML(c) {
+		if current, err := h.Service.DB.GetShareLink(c.Request.Context(), link.Token); err == nil {
+			link = current
+		}
+		h.showShareUpload(c, link, http.StatusOK, fmt.Sprintf("Uploaded %d file(s)", len(uploaded)))
+		return
+	}
+	OK(c, gin.H{"files": uploaded})
+}
+
+// rejectShareUploadError 按上传错误选择状态码；请求体超长按 limitErr 处理
+func (h *Handler) rejectShareUploadError(c *gin.Context, link db.ShareLink, err, limitErr error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		err = limitErr
+	}
+	switch {
+	case errors.Is(err, service.ErrShareUploadLimit):
+		h.rejectShareUpload(c, link, http.StatusRequestEntityTooLarge, 10015, err.Error())
+	case errors.Is(err, service.ErrFileTooLarge):
+		h.rejectShareUpload(c, link, http.StatusRequestEntityTooLarge, 10004, "file too large")
+	default:
+		h.rejectShareUpload(c, link, http.StatusUnprocessableEntity, 10005, "upload failed")
+	}
+}
+
+// rejectShareUpload 返回上传失败；浏览器提交时重新显示上传页
+func (h *Handler) rejectShareUpload(c *gin.Context, link db.ShareLink, status, code int, message string) {
+	if acceptsHTML(c) {
+		h.showShareUpload(c, link, status, message)
+	} else {
+		Error(c, status, code, message)
+	}
+	h.recordShareAccess(c, link, "share_upload", "", false)
+}
+
+// showShareUpload 显示上传页；非浏览器请求返回链接的剩余额度
+func (h *Handler) showShareUpload(c *gin.Context, link db.ShareLink, status int, message string) {
+	remainingFiles := int64(-1)
+	if link.MaxUploadFiles > 0 {
+		remainingFiles = max(link.MaxUploadFiles-link.UploadedFiles, 0)
+	}
+	remainingBytes := int64(-1)
+	if link.MaxUploadBytes > 0 {
+		remainingBytes = max(link.MaxUploadBytes-link.UploadedBytes, 0)
+	}
+	if !acceptsHTML(c) {
+		OK(c, gin.H{
+			"type":            link.Kind,
+			"upload_url":      h.buildShareDownloadURL(c, link.Token) + "/upload",
+			"expires_at":      link.ExpiresAt,
+			"note":            link.Note,
+			"max_files":       link.MaxUploadFiles,
+			"max_bytes":       link.MaxUploadBytes,
+			"remaining_files": remainingFiles,
+			"remaining_bytes": remainingBytes,
+		})
+		return
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	_ = shareUploadTemplate.Execute(c.Writer, gin.H{
+		"Token":          link.Token,
+		"Note":           link.Note,
+		"ExpiresAt":      link.ExpiresAt,
+		"RemainingFiles": remainingFiles,
+		"RemainingBytes": remainingBytes,
+		"Message":        message,
+		"Failed":         status >= http.StatusBadRequest,
+	})
+}
+
+var shareUploadTemplate = template.Must(template.New("upload").Funcs(template.FuncMap{"size": humanSize}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Upload - FileHub</title>
+<style>
+body { font-family: sans-serif; display: flex; justify-content: center; padding-top: 15vh; background: #f5f5f5; }
+form { background: #fff; padding: 24px; border-radius: 8px; box-shadow: 0 1px 4px rgba(0,0,0,.1); min-width: 320px; }
+input, button { width: 100%; box-sizing: border-box; padding: 8px; margin-top: 12px; }
+.meta, .note { color: #555; font-size: 14px; }
+.error { color: #c00; }
+.ok { color: #2e7d32; }
+</style>
+</head>
+<body>
+<form method="post" action="/s/{{.Token}}/upload" enctype="multipart/form-data">
+<div>Upload files</div>
+{{if .Note}}<div class="note">{{.Note}}</div>{{end}}
+<div class="meta">Link expires {{.ExpiresAt}}{{if ge .RemainingFiles 0}} · {{.RemainingFiles}} files left{{end}}{{if ge .RemainingBytes 0}} · {{size .RemainingBytes}} left{{end}}</div>
+{{if .Message}}<div class="{{if .Failed}}error{{else}}ok{{end}}">{{.Message}}</div>{{end}}
+<input type="file" name="file" multiple required>
+<button type="submit">Upload</button>
+</form>
+</body>
+</html>
+`))
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// postShareUpload submits files to an upload link as a browser form would.
+func postShareUpload(t *testing.T, router http.Handler, token string, files map[string]string, order ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, name := range order {
+		part, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(files[name]))
+	}
+	writer.Close()
+	req := httptestRequest("POST", "/s/"+token+"/upload", &body)
+	req.Header.Del("X-Local-Key")
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return serve(router, req)
+}
+
+func createUploadLink(t *testing.T, router http.Handler, folderID, options string) string {
+	t.Helper()
+	resp := request(router, "POST", "/api/v1/folders/"+folderID+"/share", strings.NewReader(options), map[string]string{"Content-Type": "application/json"})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("create upload link: %d %s", resp.Code, resp.Body.String())
+	}
+	var data struct {
+		Token string `json:"token"`
+	}
+	decodeData(t, resp, &data)
+	return data.Token
+}
+
+func TestShareUploadLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+		// each request uploads the listed files; status is the response
+		requests [][]string
+		statuses []int
+		stored   int
+	}{
+		{
+			"file limit", `{"type": "upload", "max_files": 2}`,
+			// b.txt uses the last slot and c.txt is refused; after that the
+			// link is exhausted and no longer found.
+			[][]string{{"a.txt"}, {"b.txt", "c.txt"}, {"d.txt"}},
+			[]int{http.StatusOK, http.StatusRequestEntityTooLarge, http.StatusNotFound},
+			2,
+		},
+		{
+			"byte limit", `{"type": "upload", "max_bytes": 10}`,
+			[][]string{{"a.txt"}, {"long.txt"}, {"b.txt", "c.txt"}},
+			[]int{http.StatusOK, http.StatusRequestEntityTooLarge, http.StatusRequestEntityTooLarge},
+			2,
+		},
+		{
+			// the test router allows 1 MiB per upload
+			"max size", `{"type": "upload"}`,
+			[][]string{{"big.txt"}, {"a.txt"}},
+			[]int{http.StatusRequestEntityTooLarge, http.StatusOK},
+			1,
+		},
+		{
+			// the request body is capped at 1 MiB, so the second file is
+			// cut off while it streams
+			"request body", `{"type": "upload"}`,
+			[][]string{{"m1.txt", "m2.txt"}},
+			[]int{http.StatusRequestEntityTooLarge},
+			1,
+		},
+		{
+			"unlimited", `{"type": "upload"}`,
+			[][]string{{"a.txt", "b.txt"}, {"long.txt"}},
+			[]int{http.StatusOK, http.StatusOK},
+			3,
+		},
+	}
+	files := map[string]string{"a.txt": "aaaa", "b.txt": "bbbb", "c.txt": "cccc", "d.txt": "dddd", "long.txt": "0123456789ab",
+		"big.txt": strings.Repeat("x", 1<<20+1), "m1.txt": strings.Repeat("1", 700<<10), "m2.txt": strings.Repeat("2", 700<<10)}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router, svc := newTestRouter(t)
+			addTestFolder(t, svc, "inbox", "inbox", nil)
+			token := createUploadLink(t, router, "inbox", test.options)
+			for i, names := range test.requests {
+				resp := postShareUpload(t, router, token, files, names...)
+				if resp.Code != test.statuses[i] {
+					t.Fatalf("request %d %v: %d %s", i, names, resp.Code, resp.Body.String())
+				}
+			}
+			resp := request(router, "GET", "/api/v1/folders/inbox/contents", nil, nil)
+			if count := strings.Count(resp.Body.String(), `"file_id"`); count != test.stored {
+				t.Errorf("%d files stored, want %d: %s", count, test.stored, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestUploadLinkIsWriteOnly(t *testing.T) {
+	router, svc := newTestRouter(t)
+	addTestFolder(t, svc, "inbox", "inbox", nil)
+	existing := uploadTestFileTo(t, router, "inbox", "private.txt", "private")
+	token := createUploadLink(t, router, "inbox", `{"type": "upload", "max_files": 3}`)
+	download := createTestShare(t, router, existing, "")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"info instead of a listing", "GET", "/s/" + token, http.StatusOK, `"remaining_files":3`},
+		{"no file downloads", "GET", "/s/" + token + "/files/" + existing, http.StatusNotFound, ""},
+		{"no zip", "GET", "/s/" + token + "/zip", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := serve(router, httptestRequest(test.method, test.path, nil))
+			if resp.Code != test.status || !strings.Contains(resp.Body.String(), test.body) || strings.Contains(resp.Body.String(), "private") {
+				t.Errorf("%d %q, want %d containing %q", resp.Code, resp.Body.String(), test.status, test.body)
+			}
+		})
+	}
+
+	if resp := postShareUpload(t, router, download, map[string]string{"a.txt": "a"}, "a.txt"); resp.Code != http.StatusNotFound {
+		t.Errorf("upload through a download link: %d", resp.Code)
+	}
+	if resp := request(router, "POST", "/api/v1/files/"+existing+"/share", strings.NewReader(`{"type": "upload"}`), map[string]string{"Content-Type": "application/json"}); resp.Code != http.StatusBadRequest {
+		t.Errorf("upload link for a file: %d", resp.Code)
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TOTPStatus 查看自己的两步验证状态
+// 权限：登录即可，仅限用户会话
+func (h *Handler) TOTPStatus(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	status, err := h.Service.TOTPStatus(c.Request.Context(), userID)
+	if err != nil {
+		h.totpError(c, err, "get totp status failed")
+		return
+	}
+	OK(c, status)
+}
+
+// EnrollTOTP 开始绑定验证器，返回密钥、otpauth 链接、二维码和恢复码，
+// 需调用 ConfirmTOTP 提交一次验证码后才生效。?format=png 时只返回二维码图片
+// 权限：登录即可，仅限用户会话
+func (h *Handler) EnrollTOTP(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	enrollment, err := h.Service.EnrollTOTP(c.Request.Context(), userID)
+	if err != nil {
+		h.totpError(c, err, "totp enrollment failed")
+		h.audit(c, "totp_enroll", "", getUser(c), "failure", err.Error())
+		return
+	}
+	h.audit(c, "totp_enroll", "", getUser(c), "success", "")
+	if c.Query("format") == "png" {
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, "image/png", enrollment.QRCode)
+		return
+	}
+	OK(c, gin.H{
+		"secret":         enrollment.Secret,
+		"uri":            enrollment.URI,
+		"qr_code":        "data:image/png;base64," + base64.StdEncoding.EncodeToString(enrollment.QRCode),
+		"recovery_codes": enrollment.RecoveryCodes,
+	})
+}
+
+// ConfirmTOTP 提交验证器上的验证码，开启两步验证
+// 权限：登录即可，仅限用户会话
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	userID, req, ok := h.totpRequest(c)
+	if !ok {
+		return
+	}
+	if err := h.Service.ConfirmTOTP(c.Request.Context(), userID, req.Code); err != nil {
+		h.totpError(c, err, "totp confirm failed")
+		h.audit(c, "totp_enable", "", getUser(c), "failure", err.Error())
+		return
+	}
+	h.audit(c, "totp_enable", "", getUser(c), "success", "")
+	Message(c, "enabled")
+}
+
+// DisableTOTP 用验证码或恢复码关闭两步验证
+// 权限：登录即可，仅限用户会话
+func (h *Handler) DisableTOTP(c *gin.Context) {
+	userID, req, ok := h.totpRequest(c)
+	if !ok {
+		return
+	}
+	if err := h.Service.DisableTOTP(c.Request.Context(), userID, req.Code); err != nil {
+		h.totpError(c, err, "totp disable failed")
+		h.audit(c, "totp_disable", "", getUser(c), "failure", err.Error())
+		return
+	}
+	h.audit(c, "totp_disable", "", getUser(c), "success", "")
+	Message(c, "disabled")
+}
+
+// RegenerateRecoveryCodes 用验证码换一组新的恢复码，旧恢复码全部失效
+// 权限：登录即可，仅限用户会话
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, req, ok := h.totpRequest(c)
+	if !ok {
+		return
+	}
+	codes, err := h.Service.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		h.totpError(c, err, "regenerate recovery codes failed")
+		h.audit(c, "totp_recovery_codes", "", getUser(c), "failure", err.Error())
+		return
+	}
+	h.audit(c, "totp_recovery_codes", "", getUser(c), "success", "")
+	OK(c, gin.H{"recovery_codes": codes})
+}
+
+// ResetTOTP 管理员清除用户的两步验证绑定和恢复码，用于用户丢失设备
+// 权限：admin
+func (h *Handler) ResetTOTP(c *gin.Context) {
+	userID := c.Param("id")
+	user, err := h.Service.DB.GetUser(c.Request.Context(), userID)
+	if err == nil {
+		err = h.Service.ResetTOTP(c.Request.Context(), userID)
+	}
+	if err != nil {
+		h.userError(c, err, "reset totp failed")
+		h.audit(c, "totp_reset", "", getUser(c), "failure", userID+": "+err.Error())
+		return
+	}
+	h.audit(c, "totp_reset", "", getUser(c), "success", user.Username)
+	Message(c, "totp_reset")
+}
+
+func (h *Handler) totpRequest(c *gin.Context) (string, totpCodeRequest, bool) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return "", totpCodeRequest{}, false
+	}
+	var req totpCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		Error(c, http.StatusBadRequest, 10004, "invalid request")
+		return "", totpCodeRequest{}, false
+	}
+	return userID, req, true
+}
+
+func (h *Handler) totpError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		Error(c, http.StatusNotFound, 10003, "user not found")
+	case errors.Is(err, service.ErrTOTPCode):
+		Error(c, http.StatusBadRequest, 10004, err.Error())
+	case errors.Is(err, service.ErrTOTPEnabled), errors.Is(err, service.ErrTOTPNotEnrolled):
+		Error(c, http.StatusConflict, 10004, err.Error())
+	default:
+		Error(c, http.StatusInternalServerError, 19999, fallback)
+	}
+}
+
+// sessionUserID 返回登录用户的 ID；local key 和 API 密钥不能管理两步验证
+func sessionUserID(c *gin.Context) (string, bool) {
+	userID := c.GetString("user_id")
+	if _, isKey := apiKey(c); isKey || userID == "" {
+		Error(c, http.StatusForbidden, 10002, "requires a signed-in user")
+		return "", false
+	}
+	return userID, true
+}
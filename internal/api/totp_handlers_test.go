@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kiry163/filehub/internal/service"
+)
+
+// currentTOTP computes the code an authenticator app shows for secret now.
+func currentTOTP(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff%1000000)
+}
+
+func TestTOTPLoginFlow(t *testing.T) {
+	router, svc := newTestRouter(t)
+	token := loginAs(t, svc, "alice", service.RoleEditor)
+
+	resp := requestAs(router, token, "POST", "/api/v1/auth/totp", nil)
+	var enrollment struct {
+		Secret        string   `json:"secret"`
+		QRCode        string   `json:"qr_code"`
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	decodeData(t, resp, &enrollment)
+	if !strings.HasPrefix(enrollment.QRCode, "data:image/png;base64,") || len(enrollment.RecoveryCodes) == 0 {
+		t.Fatalf("enrollment %+v", enrollment)
+	}
+	// Password logins keep working until the code is confirmed.
+	if resp := request(router, "POST", "/api/v1/auth/login", strings.NewReader(`{"username": "alice", "password": "password1"}`), nil); !strings.Contains(resp.Body.String(), "access_token") {
+		t.Fatalf("login while pending: %s", resp.Body.String())
+	}
+	confirm := fmt.Sprintf(`{"code": %q}`, currentTOTP(t, enrollment.Secret))
+	if resp := requestAs(router, token, "POST", "/api/v1/auth/totp/confirm", strings.NewReader(confirm)); resp.Code != http.StatusOK {
+		t.Fatalf("confirm: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = request(router, "POST", "/api/v1/auth/login", strings.NewReader(`{"username": "alice", "password": "password1"}`), nil)
+	var challenge struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		AccessToken string `json:"access_token"`
+	}
+	decodeData(t, resp, &challenge)
+	if !challenge.MFARequired || challenge.MFAToken == "" || challenge.AccessToken != "" {
+		t.Fatalf("login with a second factor: %s", resp.Body.String())
+	}
+
+	steps := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"missing code", fmt.Sprintf(`{"mfa_token": %q}`, challenge.MFAToken), http.StatusBadRequest},
+		{"wrong code", fmt.Sprintf(`{"mfa_token": %q, "code": "000000"}`, challenge.MFAToken), http.StatusUnauthorized},
+		{"recovery code", fmt.Sprintf(`{"mfa_token": %q, "code": %q}`, challenge.MFAToken, enrollment.RecoveryCodes[0]), http.StatusOK},
+		{"challenge used up", fmt.Sprintf(`{"mfa_token": %q, "code": %q}`, challenge.MFAToken, enrollment.RecoveryCodes[1]), http.StatusUnauthorized},
+	}
+	for _, step := range steps {
+		if resp := request(router, "POST", "/api/v1/auth/login/mfa", strings.NewReader(step.body), nil); resp.Code != step.status {
+			t.Fatalf("%s: status %d, want %d: %s", step.name, resp.Code, step.status, resp.Body.String())
+		}
+	}
+
+	// Only signed-in users manage their own second factor.
+	if resp := request(router, "POST", "/api/v1/auth/totp", nil, nil); resp.Code != http.StatusForbidden {
+		t.Errorf("enroll with the local key: status %d", resp.Code)
+	}
+
+	admin := loginAs(t, svc, "root", service.RoleAdmin)
+	alice, err := svc.DB.GetUserByUsername(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := requestAs(router, admin, "DELETE", "/api/v1/admin/users/"+alice.UserID+"/totp", nil); resp.Code != http.StatusOK {
+		t.Fatalf("reset: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := request(router, "POST", "/api/v1/auth/login", strings.NewReader(`{"username": "alice", "password": "password1"}`), nil); !strings.Contains(resp.Body.String(), "access_token") {
+		t.Errorf("login after reset: %s", resp.Body.String())
+	}
+}
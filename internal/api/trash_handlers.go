@@ -0,0 +1,142 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+// ListTrash 列出回收站中调用者有写权限的文件和文件夹，最近删除的在前
+// 权限：write
+func (h *Handler) ListTrash(c *gin.Context) {
+	access, ok := h.folderAccess(c)
+	if !ok {
+		return
+	}
+	items, err := h.Service.ListTrash(c.Request.Context())
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "list failed")
+		return
+	}
+	result := make([]gin.H, 0, len(items))
+	for _, item := range items {
+		if access.Allows(item.AccessFolder(), service.AccessWrite) {
+			result = append(result, h.trashResponse(item))
+		}
+	}
+	OK(c, gin.H{"items": result, "retention_days": h.Service.Config.Trash.RetentionDays})
+}
+
+// RestoreTrash 将回收站中的文件或文件夹还原到原位置，其所在的已删除文件夹一并还原
+// 权限：write
+func (h *Handler) RestoreTrash(c *gin.Context) {
+	item, ok := h.trashItem(c, "trash_restore")
+	if !ok {
+		return
+	}
+	if err := h.Service.RestoreTrashItem(c.Request.Context(), item); err != nil {
+		switch {
+		case errors.Is(err, service.ErrTrashConflict):
+			Error(c, http.StatusConflict, 10010, err.Error())
+		case errors.Is(err, sql.ErrNoRows):
+			Error(c, http.StatusNotFound, 10003, "not found")
+		default:
+			log.Printf("restore %s: %v", item.ID, err)
+			Error(c, http.StatusInternalServerError, 19999, "restore failed")
+		}
+		h.audit(c, "trash_restore", item.ID, getUser(c), "failure", err.Error())
+		return
+	}
+	h.audit(c, "trash_restore", item.ID, getUser(c), "success", item.Type+" "+item.Name)
+	Message(c, "restored")
+}
+
+// PurgeTrash 彻底删除回收站中的一项，文件夹连同其中已删除的内容一起删除
+// 权限：write
+func (h *Handler) PurgeTrash(c *gin.Context) {
+	item, ok := h.trashItem(c, "trash_purge")
+	if !ok {
+		return
+	}
+	count, err := h.Service.PurgeTrashItem(c.Request.Context(), item)
+	if err != nil {
+		log.Printf("purge %s: %v", item.ID, err)
+		Error(c, http.StatusInternalServerError, 19999, "purge failed")
+		h.audit(c, "trash_purge", item.ID, getUser(c), "failure", err.Error())
+		return
+	}
+	h.audit(c, "trash_purge", item.ID, getUser(c), "success", item.Type+" "+item.Name)
+	OK(c, gin.H{"purged_files": count})
+}
+
+// EmptyTrash 彻底删除回收站中调用者有写权限的全部内容
+// 权限：write
+func (h *Handler) EmptyTrash(c *gin.Context) {
+	access, ok := h.folderAccess(c)
+	if !ok {
+		return
+	}
+	items, err := h.Service.ListTrash(c.Request.Context())
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "empty trash failed")
+		return
+	}
+	purgedItems, purgedFiles := 0, 0
+	for _, item := range items {
+		if !access.Allows(item.AccessFolder(), service.AccessWrite) {
+			continue
+		}
+		count, err := h.Service.PurgeTrashItem(c.Request.Context(), item)
+		purgedFiles += count
+		// 文件夹已随其上层文件夹一起删除
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			log.Printf("empty trash: purge %s: %v", item.ID, err)
+			Error(c, http.StatusInternalServerError, 19999, "empty trash failed")
+			h.audit(c, "trash_empty", "", getUser(c), "failure", err.Error())
+			return
+		}
+		purgedItems++
+	}
+	h.audit(c, "trash_empty", "", getUser(c), "success", strconv.Itoa(purgedItems)+" items")
+	OK(c, gin.H{"purged_items": purgedItems, "purged_files": purgedFiles})
+}
+
+// trashItem 读取路径中的回收站条目并检查调用者对其原位置的写权限
+func (h *Handler) trashItem(c *gin.Context, action string) (service.TrashItem, bool) {
+	id := c.Param("id")
+	item, err := h.Service.GetTrashItem(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			Error(c, http.StatusNotFound, 10003, "not found")
+		} else {
+			Error(c, http.StatusInternalServerError, 19999, "lookup failed")
+		}
+		h.audit(c, action, id, getUser(c), "failure", "not found")
+		return service.TrashItem{}, false
+	}
+	if !h.checkFolder(c, item.AccessFolder(), service.AccessWrite) {
+		return service.TrashItem{}, false
+	}
+	return item, true
+}
+
+func (h *Handler) trashResponse(item service.TrashItem) gin.H {
+	return gin.H{
+		"type":       item.Type,
+		"id":         item.ID,
+		"name":       item.Name,
+		"parent_id":  item.ParentID,
+		"size":       item.Size,
+		"deleted_at": item.DeletedAt,
+		"deleted_by": item.DeletedBy,
+		"purge_at":   h.Service.TrashPurgeAt(item),
+	}
+}
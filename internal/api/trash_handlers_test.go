@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+type trashListing struct {
+	Items []struct {
+		Type    string `json:"type"`
+		ID      string `json:"id"`
+		Name    string `json:"name"`
+		PurgeAt string `json:"purge_at"`
+	} `json:"items"`
+	RetentionDays int `json:"retention_days"`
+}
+
+func listTrash(t *testing.T, router http.Handler) trashListing {
+	t.Helper()
+	resp := request(router, "GET", "/api/v1/trash", nil, nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("list trash: %d %s", resp.Code, resp.Body.String())
+	}
+	var listing trashListing
+	decodeData(t, resp, &listing)
+	return listing
+}
+
+func TestTrashFlow(t *testing.T) {
+	router, svc := newTestRouter(t)
+	svc.Config.Trash.RetentionDays = 30
+	addTestFolder(t, svc, "docs", "docs", nil)
+	fileID := uploadTestFileTo(t, router, "docs", "report.pdf", "pdf")
+	otherID := uploadTestFile(t, router, "notes.txt", "notes")
+
+	steps := []struct {
+		method, path string
+		status       int
+	}{
+		{"DELETE", "/api/v1/folders/docs", http.StatusConflict},
+		{"DELETE", "/api/v1/files/" + fileID, http.StatusOK},
+		{"DELETE", "/api/v1/files/" + otherID, http.StatusOK},
+		{"DELETE", "/api/v1/folders/docs", http.StatusOK},
+		{"GET", "/api/v1/files/" + fileID, http.StatusNotFound},
+		{"POST", "/api/v1/trash/missing/restore", http.StatusNotFound},
+		{"DELETE", "/api/v1/trash/missing", http.StatusNotFound},
+	}
+	for _, step := range steps {
+		if resp := request(router, step.method, step.path, nil, nil); resp.Code != step.status {
+			t.Fatalf("%s %s: %d %s, want %d", step.method, step.path, resp.Code, resp.Body.String(), step.status)
+		}
+	}
+
+	listing := listTrash(t, router)
+	if len(listing.Items) != 3 || listing.RetentionDays != 30 {
+		t.Fatalf("trash: %+v", listing)
+	}
+	for _, item := range listing.Items {
+		if item.PurgeAt == "" {
+			t.Errorf("%s has no purge time", item.Name)
+		}
+	}
+
+	if resp := request(router, "POST", "/api/v1/trash/"+fileID+"/restore", nil, nil); resp.Code != http.StatusOK {
+		t.Fatalf("restore: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := request(router, "GET", "/api/v1/folders/docs/contents", nil, nil); resp.Code != http.StatusOK {
+		t.Errorf("folder not restored with the file: %d %s", resp.Code, resp.Body.String())
+	}
+	if listing := listTrash(t, router); len(listing.Items) != 1 || listing.Items[0].ID != otherID {
+		t.Errorf("trash after restore: %+v", listing)
+	}
+
+	if resp := request(router, "DELETE", "/api/v1/files/"+fileID, nil, nil); resp.Code != http.StatusOK {
+		t.Fatalf("delete again: %d %s", resp.Code, resp.Body.String())
+	}
+	resp := request(router, "DELETE", "/api/v1/trash", nil, nil)
+	var emptied struct {
+		PurgedItems int `json:"purged_items"`
+		PurgedFiles int `json:"purged_files"`
+	}
+	decodeData(t, resp, &emptied)
+	if emptied.PurgedItems != 2 || emptied.PurgedFiles != 2 {
+		t.Errorf("empty trash: %+v", emptied)
+	}
+	if listing := listTrash(t, router); len(listing.Items) != 0 {
+		t.Errorf("trash after emptying: %+v", listing)
+	}
+}
+
+func TestRestoreFolderConflict(t *testing.T) {
+	router, svc := newTestRouter(t)
+	addTestFolder(t, svc, "old", "docs", nil)
+	if resp := request(router, "DELETE", "/api/v1/folders/old", nil, nil); resp.Code != http.StatusOK {
+		t.Fatalf("delete folder: %d %s", resp.Code, resp.Body.String())
+	}
+	addTestFolder(t, svc, "new", "docs", nil)
+	if resp := request(router, "POST", "/api/v1/trash/old/restore", nil, nil); resp.Code != http.StatusConflict {
+		t.Errorf("restore over a live folder: %d %s", resp.Code, resp.Body.String())
+	}
+}
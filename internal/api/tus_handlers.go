@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+// tus 1.0 resumable upload protocol, see https://tus.io/protocols/resumable-upload
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,termination,expiration"
+	// FileIDHeader 上传完成后返回生成的 file_id
+	FileIDHeader = "X-FileHub-File-ID"
+)
+
+// TusOptions 返回服务端支持的 tus 能力
+func (h *Handler) TusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	if maxBytes := h.Service.Config.Upload.MaxSizeMB * 1024 * 1024; maxBytes > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(maxBytes, 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload 创建断点续传上传（tus creation）
+func (h *Handler) CreateUpload(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	c.Header("Tus-Resumable", tusVersion)
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		Error(c, http.StatusBadRequest, 10004, "Upload-Length required")
+		h.audit(c, "upload", "", getUser(c), "failure", "invalid upload length")
+		return
+	}
+	maxBytes := h.Service.Config.Upload.MaxSizeMB * 1024 * 1024
+	if maxBytes > 0 && length > maxBytes {
+		Error(c, http.StatusRequestEntityTooLarge, 10004, "file too large")
+		h.audit(c, "upload", "", getUser(c), "failure", "file too large")
+		return
+	}
+
+	metadata := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	name := metadata["filename"]
+	if name == "" {
+		name = metadata["name"]
+	}
+	if strings.TrimSpace(name) == "" {
+		Error(c, http.StatusBadRequest, 10004, "filename metadata required")
+		h.audit(c, "upload", "", getUser(c), "failure", "filename required")
+		return
+	}
+	var folderIDPtr *string
+	if folderID := metadata["folder_id"]; folderID != "" {
+		if _, err := h.Service.DB.GetFolder(c.Request.Context(), folderID); err != nil {
+			Error(c, http.StatusNotFound, 10003, "folder not found")
+			h.audit(c, "upload", "", getUser(c), "failure", "folder not found")
+			return
+		}
+		folderIDPtr = &folderID
+	}
+	if !h.checkFolder(c, folderIDPtr, service.AccessWrite) {
+		return
+	}
+
+	upload, err := h.Service.CreateResumableUpload(c.Request.Context(), name, length, folderIDPtr, getUser(c))
+	if err != nil {
+		if errors.Is(err, service.ErrResumableUnsupported) {
+			Error(c, http.StatusNotImplemented, 10005, err.Error())
+			return
+		}
+		Error(c, http.StatusUnprocessableEntity, 10005, "upload failed")
+		h.audit(c, "upload", "", getUser(c), "failure", "create upload failed")
+		return
+	}
+	c.Header("Location", h.buildBaseURL(c)+"/api/v1/uploads/"+upload.UploadID)
+
+	// creation-with-upload：创建请求可携带第一个分块
+	if c.GetHeader("Content-Type") == "application/offset+octet-stream" && upload.Status != service.UploadStatusCompleted {
+		upload, err = h.Service.WriteResumableChunk(c.Request.Context(), upload.UploadID, 0, c.Request.Body, c.Request.ContentLength)
+		if err != nil && !errors.Is(err, service.ErrUploadChunkTooSmall) {
+			h.writeUploadError(c, upload, err)
+			return
+		}
+	}
+	h.setUploadHeaders(c, upload)
+	if upload.Status == service.UploadStatusCompleted {
+		h.audit(c, "upload", upload.FileID, getUser(c), "success", "resumable")
+	}
+	c.Status(http.StatusCreated)
+}
+
+// HeadUpload 查询上传进度，客户端据此续传
+func (h *Handler) HeadUpload(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	upload, err := h.Service.GetResumableUpload(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	h.setUploadHeaders(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload 在指定偏移写入一个分块
+func (h *Handler) PatchUpload(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Content-Type") != "application/offset+octet-stream" {
+		Error(c, http.StatusUnsupportedMediaType, 10004, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		Error(c, http.StatusBadRequest, 10004, "Upload-Offset required")
+		return
+	}
+	upload, err := h.Service.WriteResumableChunk(c.Request.Context(), c.Param("id"), offset, c.Request.Body, c.Request.ContentLength)
+	if err != nil {
+		h.writeUploadError(c, upload, err)
+		return
+	}
+	h.setUploadHeaders(c, upload)
+	if upload.Status == service.UploadStatusCompleted {
+		h.audit(c, "upload", upload.FileID, getUser(c), "success", "resumable")
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUpload 终止上传并清理已写入的分块（tus termination）
+func (h *Handler) DeleteUpload(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	c.Header("Tus-Resumable", tusVersion)
+	if err := h.Service.TerminateResumableUpload(c.Request.Context(), c.Param("id")); err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) setUploadHeaders(c *gin.Context, upload db.Upload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", formatHTTPDate(upload.ExpiresAt))
+	if upload.Status == service.UploadStatusCompleted {
+		c.Header(FileIDHeader, upload.FileID)
+	}
+}
+
+func (h *Handler) writeUploadError(c *gin.Context, upload db.Upload, err error) {
+	if upload.UploadID != "" {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	}
+	switch {
+	case errors.Is(err, service.ErrUploadOffsetMismatch):
+		Error(c, http.StatusConflict, 10004, err.Error())
+	case errors.Is(err, service.ErrUploadCompleted):
+		Error(c, http.StatusConflict, 10004, err.Error())
+	case errors.Is(err, service.ErrUploadTooLarge):
+		Error(c, http.StatusRequestEntityTooLarge, 10004, err.Error())
+	case errors.Is(err, service.ErrUploadChunkTooSmall), errors.Is(err, service.ErrUploadLengthRequired):
+		Error(c, http.StatusBadRequest, 10004, err.Error())
+	case errors.Is(err, service.ErrResumableUnsupported):
+		Error(c, http.StatusNotImplemented, 10005, err.Error())
+	case upload.UploadID == "":
+		Error(c, http.StatusNotFound, 10003, "not found")
+	default:
+		Error(c, http.StatusUnprocessableEntity, 10005, "upload failed")
+		h.audit(c, "upload", upload.FileID, getUser(c), "failure", "chunk failed")
+	}
+}
+
+func checkTusResumable(c *gin.Context) bool {
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.Status(http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes "key base64value,key2 base64value2".
+func parseUploadMetadata(value string) map[string]string {
+	result := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		result[key] = string(decoded)
+	}
+	return result
+}
+
+func formatHTTPDate(rfc3339 string) string {
+	parsed, err := time.Parse(time.RFC3339, rfc3339)
+	if err != nil {
+		return ""
+	}
+	return parsed.UTC().Format(http.TimeFormat)
+}
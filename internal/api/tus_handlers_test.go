@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// chunkedBody hides the length of a body so the request is sent without a
+// Content-Length, as with Transfer-Encoding: chunked.
+type chunkedBody struct {
+	io.Reader
+}
+
+func createTusUpload(t *testing.T, router http.Handler, length int) string {
+	t.Helper()
+	resp := request(router, "POST", "/api/v1/uploads", nil, map[string]string{
+		"Tus-Resumable":   tusVersion,
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("hello.txt")),
+	})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create upload: %d %s", resp.Code, resp.Body.String())
+	}
+	location := resp.Header().Get("Location")
+	return location[strings.Index(location, "/api/v1/uploads/"):]
+}
+
+func TestTusCreateChecks(t *testing.T) {
+	router, _ := newTestRouter(t)
+	filename := "filename " + base64.StdEncoding.EncodeToString([]byte("a.txt"))
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"missing Tus-Resumable", map[string]string{"Upload-Length": "10", "Upload-Metadata": filename}, http.StatusPreconditionFailed},
+		{"missing length", map[string]string{"Tus-Resumable": tusVersion, "Upload-Metadata": filename}, http.StatusBadRequest},
+		{"negative length", map[string]string{"Tus-Resumable": tusVersion, "Upload-Length": "-1", "Upload-Metadata": filename}, http.StatusBadRequest},
+		{"over max size", map[string]string{"Tus-Resumable": tusVersion, "Upload-Length": strconv.Itoa(1<<20 + 1), "Upload-Metadata": filename}, http.StatusRequestEntityTooLarge},
+		{"missing filename", map[string]string{"Tus-Resumable": tusVersion, "Upload-Length": "10"}, http.StatusBadRequest},
+		{"ok", map[string]string{"Tus-Resumable": tusVersion, "Upload-Length": "10", "Upload-Metadata": filename}, http.StatusCreated},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if resp := request(router, "POST", "/api/v1/uploads", nil, test.headers); resp.Code != test.status {
+				t.Errorf("status %d, want %d: %s", resp.Code, test.status, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestTusOffsetAndLengthChecks(t *testing.T) {
+	router, svc := newTestRouter(t)
+	location := createTusUpload(t, router, 10)
+
+	steps := []struct {
+		name    string
+		offset  string
+		body    string
+		chunked bool
+		status  int
+		// offset reported by the response, and by a HEAD afterwards
+		wantOffset string
+	}{
+		{"first chunk", "0", "hell", false, http.StatusNoContent, "4"},
+		{"stale offset", "0", "hell", false, http.StatusConflict, "4"},
+		{"offset ahead", "6", "xx", false, http.StatusConflict, "4"},
+		{"missing offset", "", "o, w", false, http.StatusBadRequest, "4"},
+		{"declared length past the end", "4", "o, world!", false, http.StatusRequestEntityTooLarge, "4"},
+		{"chunked body past the end", "4", "o, world!", true, http.StatusRequestEntityTooLarge, "4"},
+		{"chunked body", "4", "o, ", true, http.StatusNoContent, "7"},
+		{"last chunk", "7", "you", false, http.StatusNoContent, "10"},
+		{"after completion", "10", "!", false, http.StatusConflict, "10"},
+	}
+	for _, step := range steps {
+		var body io.Reader = strings.NewReader(step.body)
+		if step.chunked {
+			body = chunkedBody{body}
+		}
+		headers := map[string]string{"Tus-Resumable": tusVersion, "Content-Type": "application/offset+octet-stream"}
+		if step.offset != "" {
+			headers["Upload-Offset"] = step.offset
+		}
+		resp := request(router, "PATCH", location, body, headers)
+		if resp.Code != step.status {
+			t.Fatalf("%s: status %d, want %d: %s", step.name, resp.Code, step.status, resp.Body.String())
+		}
+		if got := resp.Header().Get("Upload-Offset"); got != step.wantOffset && step.status != http.StatusBadRequest {
+			t.Fatalf("%s: response offset %q, want %s", step.name, got, step.wantOffset)
+		}
+		head := request(router, "HEAD", location, nil, map[string]string{"Tus-Resumable": tusVersion})
+		if got := head.Header().Get("Upload-Offset"); got != step.wantOffset {
+			t.Fatalf("%s: HEAD offset %q, want %s", step.name, got, step.wantOffset)
+		}
+	}
+
+	head := request(router, "HEAD", location, nil, map[string]string{"Tus-Resumable": tusVersion})
+	fileID := head.Header().Get(FileIDHeader)
+	record, err := svc.GetFile(context.Background(), fileID)
+	if err != nil {
+		t.Fatalf("completed file %q: %v", fileID, err)
+	}
+	_, reader, err := svc.GetObject(context.Background(), record.ObjectKey, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if data, _ := io.ReadAll(reader); string(data) != "hello, you" || record.Size != 10 {
+		t.Errorf("assembled %q (%d bytes)", data, record.Size)
+	}
+}
+
+func TestTusTerminate(t *testing.T) {
+	router, _ := newTestRouter(t)
+	location := createTusUpload(t, router, 10)
+	headers := map[string]string{"Tus-Resumable": tusVersion}
+	if resp := request(router, "DELETE", location, nil, headers); resp.Code != http.StatusNoContent {
+		t.Fatalf("terminate: %d", resp.Code)
+	}
+	if resp := request(router, "HEAD", location, nil, headers); resp.Code != http.StatusNotFound {
+		t.Errorf("HEAD after terminate: %d", resp.Code)
+	}
+}
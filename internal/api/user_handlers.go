@@ -0,0 +1,123 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+type createUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+type updateUserRequest struct {
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
+
+type passwordRequest struct {
+	Password string `json:"password"`
+}
+
+// ListUsers 列出全部用户
+func (h *Handler) ListUsers(c *gin.Context) {
+	users, err := h.Service.ListUsers(c.Request.Context())
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "list failed")
+		return
+	}
+	items := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		items = append(items, userResponse(user))
+	}
+	OK(c, gin.H{"users": items})
+}
+
+// CreateUser 新建用户
+func (h *Handler) CreateUser(c *gin.Context) {
+	var req createUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 10004, "invalid request")
+		return
+	}
+	if req.Role == "" {
+		req.Role = service.RoleViewer
+	}
+	user, err := h.Service.CreateUser(c.Request.Context(), req.Username, req.Password, req.Role)
+	if err != nil {
+		h.userError(c, err, "create user failed")
+		h.audit(c, "user_create", "", getUser(c), "failure", req.Username+": "+err.Error())
+		return
+	}
+	h.audit(c, "user_create", "", getUser(c), "success", user.Username)
+	OK(c, userResponse(user))
+}
+
+// UpdateUser 禁用/启用用户或修改角色
+func (h *Handler) UpdateUser(c *gin.Context) {
+	var req updateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Role == nil && req.Disabled == nil) {
+		Error(c, http.StatusBadRequest, 10004, "invalid request")
+		return
+	}
+	userID := c.Param("id")
+	user, err := h.Service.UpdateUser(c.Request.Context(), userID, service.UserUpdate{Role: req.Role, Disabled: req.Disabled})
+	if err != nil {
+		h.userError(c, err, "update user failed")
+		h.audit(c, "user_update", "", getUser(c), "failure", userID+": "+err.Error())
+		return
+	}
+	h.audit(c, "user_update", "", getUser(c), "success", user.Username)
+	OK(c, userResponse(user))
+}
+
+// ResetPassword 重置用户密码，并使其已登录的会话失效
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req passwordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Error(c, http.StatusBadRequest, 10004, "invalid request")
+		return
+	}
+	userID := c.Param("id")
+	user, err := h.Service.SetPassword(c.Request.Context(), userID, req.Password)
+	if err != nil {
+		h.userError(c, err, "reset password failed")
+		h.audit(c, "user_password", "", getUser(c), "failure", userID+": "+err.Error())
+		return
+	}
+	h.audit(c, "user_password", "", getUser(c), "success", user.Username)
+	Message(c, "password_reset")
+}
+
+func (h *Handler) userError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		Error(c, http.StatusNotFound, 10003, "user not found")
+	case errors.Is(err, service.ErrUserExists):
+		Error(c, http.StatusConflict, 10010, err.Error())
+	case errors.Is(err, service.ErrUsernameInvalid), errors.Is(err, service.ErrPasswordInvalid), errors.Is(err, service.ErrRoleInvalid):
+		Error(c, http.StatusBadRequest, 10004, err.Error())
+	case errors.Is(err, service.ErrLastAdmin):
+		Error(c, http.StatusConflict, 10004, err.Error())
+	default:
+		Error(c, http.StatusInternalServerError, 19999, fallback)
+	}
+}
+
+func userResponse(user db.User) gin.H {
+	return gin.H{
+		"user_id":      user.UserID,
+		"username":     user.Username,
+		"role":         user.Role,
+		"disabled":     user.Disabled,
+		"totp_enabled": user.TOTPEnabled,
+		"created_at":   user.CreatedAt,
+		"updated_at":   user.UpdatedAt,
+	}
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/service"
+)
+
+// UploadVersion 为已有文件上传新版本（multipart 字段 file），新版本成为当前版本，旧版本保留
+// 权限：upload
+func (h *Handler) UploadVersion(c *gin.Context) {
+	fileID := c.Param("id")
+	user := getUser(c)
+	file, err := c.FormFile("file")
+	if err != nil {
+		Error(c, http.StatusBadRequest, 10004, "file required")
+		h.audit(c, "upload_version", fileID, user, "failure", "file required")
+		return
+	}
+	maxBytes := h.Service.Config.Upload.MaxSizeMB * 1024 * 1024
+	if maxBytes > 0 && file.Size > maxBytes {
+		Error(c, http.StatusBadRequest, 10004, "file too large")
+		h.audit(c, "upload_version", fileID, user, "failure", "file too large")
+		return
+	}
+	record, ok := h.versionedFile(c, "upload_version", service.AccessWrite)
+	if !ok {
+		return
+	}
+
+	version, err := h.Service.UploadVersion(c.Request.Context(), record.FileID, file, user)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			Error(c, http.StatusNotFound, 10003, "not found")
+		} else {
+			log.Printf("upload version %s: %v", fileID, err)
+			Error(c, http.StatusUnprocessableEntity, 10005, "upload failed")
+		}
+		h.audit(c, "upload_version", fileID, user, "failure", "upload failed")
+		return
+	}
+	h.audit(c, "upload_version", fileID, user, "success", "version "+strconv.Itoa(version.Version))
+	OK(c, h.versionResponse(c, version, version.Version))
+}
+
+// ListVersions 列出文件的全部版本，最新的在前
+// 权限：read
+func (h *Handler) ListVersions(c *gin.Context) {
+	record, ok := h.versionedFile(c, "", service.AccessRead)
+	if !ok {
+		return
+	}
+	versions, err := h.Service.ListVersions(c.Request.Context(), record.FileID)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "list failed")
+		return
+	}
+	items := make([]gin.H, 0, len(versions))
+	for _, version := range versions {
+		items = append(items, h.versionResponse(c, version, record.Version))
+	}
+	OK(c, gin.H{"file_id": record.FileID, "current_version": record.Version, "versions": items})
+}
+
+// PromoteVersion 将旧版本重新设为当前版本，不产生新版本
+// 权限：write
+func (h *Handler) PromoteVersion(c *gin.Context) {
+	record, ok := h.versionedFile(c, "promote_version", service.AccessWrite)
+	if !ok {
+		return
+	}
+	number, ok := h.versionParam(c, "promote_version")
+	if !ok {
+		return
+	}
+	version, err := h.Service.PromoteVersion(c.Request.Context(), record.FileID, number)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			Error(c, http.StatusNotFound, 10003, "version not found")
+		} else {
+			Error(c, http.StatusInternalServerError, 19999, "promote failed")
+		}
+		h.audit(c, "promote_version", record.FileID, getUser(c), "failure", err.Error())
+		return
+	}
+	h.audit(c, "promote_version", record.FileID, getUser(c), "success", "version "+strconv.Itoa(number))
+	OK(c, h.versionResponse(c, version, version.Version))
+}
+
+// DeleteVersion 删除一个非当前版本
+// 权限：write
+func (h *Handler) DeleteVersion(c *gin.Context) {
+	record, ok := h.versionedFile(c, "delete_version", service.AccessWrite)
+	if !ok {
+		return
+	}
+	number, ok := h.versionParam(c, "delete_version")
+	if !ok {
+		return
+	}
+	if err := h.Service.DeleteVersion(c.Request.Context(), record.FileID, number); err != nil {
+		switch {
+		case errors.Is(err, service.ErrCurrentVersion):
+			Error(c, http.StatusConflict, 10010, err.Error())
+		case errors.Is(err, sql.ErrNoRows):
+			Error(c, http.StatusNotFound, 10003, "version not found")
+		default:
+			Error(c, http.StatusInternalServerError, 19999, "delete failed")
+		}
+		h.audit(c, "delete_version", record.FileID, getUser(c), "failure", err.Error())
+		return
+	}
+	h.audit(c, "delete_version", record.FileID, getUser(c), "success", "version "+strconv.Itoa(number))
+	Message(c, "deleted")
+}
+
+// PruneVersions 只保留最新的 keep 个版本和当前版本，删除其余版本
+// 权限：write
+func (h *Handler) PruneVersions(c *gin.Context) {
+	record, ok := h.versionedFile(c, "prune_versions", service.AccessWrite)
+	if !ok {
+		return
+	}
+	keep, err := strconv.Atoi(c.Query("keep"))
+	if err != nil || keep < 1 {
+		Error(c, http.StatusBadRequest, 10004, "keep must be a positive integer")
+		h.audit(c, "prune_versions", record.FileID, getUser(c), "failure", "invalid keep")
+		return
+	}
+	deleted, err := h.Service.PruneVersions(c.Request.Context(), record.FileID, keep)
+	if err != nil {
+		Error(c, http.StatusInternalServerError, 19999, "prune failed")
+		h.audit(c, "prune_versions", record.FileID, getUser(c), "failure", err.Error())
+		return
+	}
+	numbers := make([]int, 0, len(deleted))
+	for _, version := range deleted {
+		numbers = append(numbers, version.Version)
+	}
+	h.audit(c, "prune_versions", record.FileID, getUser(c), "success", "keep "+strconv.Itoa(keep)+", deleted "+strconv.Itoa(len(deleted)))
+	OK(c, gin.H{"deleted": numbers})
+}
+
+// versionedFile 读取路径中的文件并检查调用者对其所在文件夹的权限；action 为空时不记审计
+func (h *Handler) versionedFile(c *gin.Context, action string, level string) (db.FileRecord, bool) {
+	fileID := c.Param("id")
+	record, err := h.Service.GetFile(c.Request.Context(), fileID)
+	if err != nil {
+		Error(c, http.StatusNotFound, 10003, "not found")
+		if action != "" {
+			h.audit(c, action, fileID, getUser(c), "failure", "not found")
+		}
+		return db.FileRecord{}, false
+	}
+	if !h.checkFolder(c, record.FolderID, level) {
+		return db.FileRecord{}, false
+	}
+	return record, true
+}
+
+func (h *Handler) versionParam(c *gin.Context, action string) (int, bool) {
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil || number < 1 {
+		Error(c, http.StatusBadRequest, 10004, "invalid version")
+		h.audit(c, action, c.Param("id"), getUser(c), "failure", "invalid version")
+		return 0, false
+	}
+	return number, true
+}
+
+func (h *Handler) versionResponse(c *gin.Context, version db.FileVersion, current int) gin.H {
+	return gin.H{
+		"file_id":       version.FileID,
+		"version":       version.Version,
+		"current":       version.Version == current,
+		"original_name": version.OriginalName,
+		"size":          version.Size,
+		"mime_type":     version.MimeType,
+		"sha256":        version.SHA256,
+		"md5":           version.MD5,
+		"created_by":    version.CreatedBy,
+		"created_at":    version.CreatedAt,
+		"download_url":  h.buildDownloadURL(c, version.FileID) + "?version=" + strconv.Itoa(version.Version),
+	}
+}
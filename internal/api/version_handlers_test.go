@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func uploadVersion(t *testing.T, router http.Handler, fileID, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+	return request(router, "POST", "/api/v1/files/"+fileID+"/versions", &body, map[string]string{"Content-Type": writer.FormDataContentType()})
+}
+
+func TestVersionFlow(t *testing.T) {
+	router, _ := newTestRouter(t)
+	fileID := uploadTestFile(t, router, "report.txt", "one")
+	for _, content := range []string{"two", "three"} {
+		if resp := uploadVersion(t, router, fileID, content); resp.Code != http.StatusOK {
+			t.Fatalf("upload version: %d %s", resp.Code, resp.Body.String())
+		}
+	}
+
+	resp := request(router, "GET", "/api/v1/files/"+fileID+"/versions", nil, nil)
+	var listing struct {
+		CurrentVersion int `json:"current_version"`
+		Versions       []struct {
+			Version int  `json:"version"`
+			Current bool `json:"current"`
+		} `json:"versions"`
+	}
+	decodeData(t, resp, &listing)
+	if listing.CurrentVersion != 3 || len(listing.Versions) != 3 || !listing.Versions[0].Current {
+		t.Fatalf("versions: %+v", listing)
+	}
+
+	downloads := []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"", http.StatusOK, "three"},
+		{"?version=1", http.StatusOK, "one"},
+		{"?version=2", http.StatusOK, "two"},
+		{"?version=9", http.StatusNotFound, ""},
+		{"?version=x", http.StatusNotFound, ""},
+	}
+	for _, test := range downloads {
+		resp := request(router, "GET", "/api/v1/files/"+fileID+"/download"+test.query, nil, nil)
+		if resp.Code != test.status || (test.body != "" && resp.Body.String() != test.body) {
+			t.Errorf("download%s: %d %q", test.query, resp.Code, resp.Body.String())
+		}
+	}
+
+	steps := []struct {
+		method, path string
+		status       int
+	}{
+		{"POST", "/versions/1/promote", http.StatusOK},
+		{"POST", "/versions/9/promote", http.StatusNotFound},
+		{"POST", "/versions/x/promote", http.StatusBadRequest},
+		{"DELETE", "/versions/1", http.StatusConflict},
+		{"DELETE", "/versions/2", http.StatusOK},
+		{"DELETE", "/versions/2", http.StatusNotFound},
+		{"DELETE", "/versions?keep=0", http.StatusBadRequest},
+		{"DELETE", "/versions?keep=1", http.StatusOK},
+	}
+	for _, step := range steps {
+		if resp := request(router, step.method, "/api/v1/files/"+fileID+step.path, nil, nil); resp.Code != step.status {
+			t.Errorf("%s %s: %d %s, want %d", step.method, step.path, resp.Code, resp.Body.String(), step.status)
+		}
+	}
+
+	resp = request(router, "GET", "/api/v1/files/"+fileID+"/download", nil, nil)
+	if resp.Body.String() != "one" {
+		t.Errorf("promoted download %q", resp.Body.String())
+	}
+	resp = request(router, "GET", "/api/v1/files/"+fileID+"/versions", nil, nil)
+	decodeData(t, resp, &listing)
+	if listing.CurrentVersion != 1 || len(listing.Versions) != 2 {
+		t.Errorf("versions after prune: %+v", listing)
+	}
+	if resp := uploadVersion(t, router, "missing", "x"); resp.Code != http.StatusNotFound {
+		t.Errorf("version of a missing file: %d %s", resp.Code, resp.Body.String())
+	}
+}
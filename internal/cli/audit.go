@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// AuditLog 一条审计日志
+type AuditLog struct {
+	ID        int64  `json:"id"`
+	CreatedAt string `json:"created_at"`
+	Action    string `json:"action"`
+	Actor     string `json:"actor"`
+	FileID    string `json:"file_id"`
+	IPAddress string `json:"ip_address"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	PrevHash  string `json:"prev_hash"`
+	Hash      string `json:"hash"`
+}
+
+// AuditFilter 审计日志过滤条件，空字段不过滤；Since 和 Until 为 RFC3339 时间
+type AuditFilter struct {
+	Action    string
+	Actor     string
+	FileID    string
+	IPAddress string
+	Status    string
+	Since     string
+	Until     string
+}
+
+func (f AuditFilter) query() url.Values {
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"action":  f.Action,
+		"actor":   f.Actor,
+		"file_id": f.FileID,
+		"ip":      f.IPAddress,
+		"status":  f.Status,
+		"since":   f.Since,
+		"until":   f.Until,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	return query
+}
+
+// ListAuditLogs 查询一页审计日志，返回下一页的 cursor，为空表示没有更多
+func (c *Client) ListAuditLogs(filter AuditFilter, limit int, cursor string) ([]AuditLog, string, error) {
+	query := filter.query()
+	query.Set("limit", strconv.Itoa(limit))
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	var data struct {
+		Logs       []AuditLog `json:"logs"`
+		NextCursor *string    `json:"next_cursor"`
+	}
+	if err := c.doJSON("GET", "/api/v1/admin/audit?"+query.Encode(), nil, &data, "list audit logs"); err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if data.NextCursor != nil {
+		next = *data.NextCursor
+	}
+	return data.Logs, next, nil
+}
+
+// ExportAuditLogs 将全部匹配的审计日志以 csv 或 ndjson 格式写入 w
+func (c *Client) ExportAuditLogs(filter AuditFilter, format string, w io.Writer) error {
+	query := filter.query()
+	query.Set("format", format)
+	req, err := http.NewRequest("GET", c.Endpoint+"/api/v1/admin/audit/export?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	c.attachAuth(req)
+	resp, err := c.Transfer.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var payload APIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err == nil && payload.Message != "" {
+			return errors.New("export audit logs failed: " + payload.Message)
+		}
+		return fmt.Errorf("export audit logs failed: %s", resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeFlag(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"2026-03-01T08:00:00Z", "2026-03-01T08:00:00Z", true},
+		{"2026-03-01T16:00:00+08:00", "2026-03-01T08:00:00Z", true},
+		{"24h", "2026-03-09T12:00:00Z", true},
+		{"90m", "2026-03-10T10:30:00Z", true},
+		{"7d", "2026-03-03T12:00:00Z", true},
+		{"xd", "", false},
+		{"2026-03-01", "", false},
+		{"yesterday", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseTimeFlag(test.value, now)
+			if (err == nil) != test.ok || got != test.want {
+				t.Errorf("got %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestAuditFilterQuery(t *testing.T) {
+	filter := AuditFilter{Action: "login", IPAddress: "10.0.0.1", Since: "2026-03-01T08:00:00Z"}
+	if got, want := filter.query().Encode(), "action=login&ip=10.0.0.1&since=2026-03-01T08%3A00%3A00Z"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got := (AuditFilter{}).query().Encode(); got != "" {
+		t.Errorf("empty filter: %s", got)
+	}
+}
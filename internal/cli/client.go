@@ -2,11 +2,15 @@ package cli
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -17,7 +21,10 @@ import (
 type Client struct {
 	Endpoint string
 	LocalKey string
+	APIKey   string
 	HTTP     *http.Client
+	// Transfer 用于上传/下载，不设整体超时，避免大文件传输被中断
+	Transfer *http.Client
 }
 
 type APIResponse struct {
@@ -27,22 +34,41 @@ type APIResponse struct {
 }
 
 type FileItem struct {
-	FileID       string `json:"file_id"`
-	OriginalName string `json:"original_name"`
-	Size         int64  `json:"size"`
-	MimeType     string `json:"mime_type"`
-	FilehubURL   string `json:"filehub_url"`
-	CreatedAt    string `json:"created_at"`
-	DownloadURL  string `json:"download_url"`
+	FileID       string  `json:"file_id"`
+	OriginalName string  `json:"original_name"`
+	Size         int64   `json:"size"`
+	MimeType     string  `json:"mime_type"`
+	SHA256       string  `json:"sha256"`
+	MD5          string  `json:"md5"`
+	Version      int     `json:"version"`
+	FolderID     *string `json:"folder_id"`
+	FilehubURL   string  `json:"filehub_url"`
+	CreatedBy    string  `json:"created_by"`
+	CreatedAt    string  `json:"created_at"`
+	UpdatedAt    string  `json:"updated_at"`
+	DownloadURL  string  `json:"download_url"`
 }
 
 func NewClient(cfg Config) *Client {
 	return &Client{
 		Endpoint: strings.TrimRight(cfg.Endpoint, "/"),
 		LocalKey: cfg.LocalKey,
+		APIKey:   cfg.APIKey,
 		HTTP: &http.Client{
 			Timeout: 60 * time.Second,
 		},
+		Transfer: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 10 * time.Minute,
+				IdleConnTimeout:       90 * time.Second,
+			},
+		},
 	}
 }
 
@@ -56,33 +82,74 @@ func (c *Client) UploadFile(path string, folderID *string, progress func(int)) (
 	if err != nil {
 		return FileItem{}, err
 	}
-	var body bytes.Buffer
-	writer := multipart.NewWriter(&body)
-	part, err := writer.CreateFormFile("file", filepath.Base(path))
+	if stat.Size() > resumableThreshold {
+		item, err := c.uploadResumable(path, folderID, progress)
+		if !errors.Is(err, errResumableUnavailable) {
+			return item, err
+		}
+	}
+	// 构建 URL，folder_id 作为查询参数
+	url := c.Endpoint + "/api/v1/files"
+	if folderID != nil {
+		url += "?folder_id=" + *folderID
+	}
+	return c.postMultipart(url, path, file, stat.Size(), progress)
+}
+
+// UploadVersion 为已有文件上传新版本，新版本成为当前版本
+func (c *Client) UploadVersion(fileID, path string, progress func(int)) (FileItem, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return FileItem{}, err
 	}
-	progressReader := NewProgressReader(file, stat.Size(), progress)
-	if _, err := io.Copy(part, progressReader); err != nil {
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
 		return FileItem{}, err
 	}
-	if err := writer.Close(); err != nil {
+	return c.postMultipart(c.Endpoint+"/api/v1/files/"+fileID+"/versions", path, file, stat.Size(), progress)
+}
+
+// postMultipart 以 multipart 字段 file 流式上传文件内容
+func (c *Client) postMultipart(url, path string, file io.Reader, size int64, progress func(int)) (FileItem, error) {
+	// 先用同一 boundary 计算 multipart 包装的长度，以便设置 Content-Length
+	filename := filepath.Base(path)
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	overhead, err := multipartOverhead(boundary, filename)
+	if err != nil {
 		return FileItem{}, err
 	}
 
-	// 构建 URL，folder_id 作为查询参数
-	url := c.Endpoint + "/api/v1/files"
-	if folderID != nil {
-		url += "?folder_id=" + *folderID
+	// 通过 io.Pipe 边读文件边发送，进度反映实际网络发送量
+	pipeReader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return FileItem{}, err
 	}
+	go func() {
+		part, err := writer.CreateFormFile("file", filename)
+		if err != nil {
+			pipeWriter.CloseWithError(err)
+			return
+		}
+		progressReader := NewProgressReader(file, size, progress)
+		if _, err := io.Copy(part, progressReader); err != nil {
+			pipeWriter.CloseWithError(err)
+			return
+		}
+		pipeWriter.CloseWithError(writer.Close())
+	}()
 
-	req, err := http.NewRequest("POST", url, &body)
+	req, err := http.NewRequest("POST", url, pipeReader)
 	if err != nil {
+		pipeReader.Close()
 		return FileItem{}, err
 	}
+	req.ContentLength = overhead + size
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	c.attachLocalKey(req)
-	resp, err := c.HTTP.Do(req)
+	c.attachAuth(req)
+	resp, err := c.Transfer.Do(req)
+	pipeReader.Close()
 	if err != nil {
 		return FileItem{}, err
 	}
@@ -90,13 +157,36 @@ func (c *Client) UploadFile(path string, folderID *string, progress func(int)) (
 	return decodeFileResponse(resp)
 }
 
+// multipartOverhead 返回单文件 multipart 请求体中除文件内容外的字节数
+func multipartOverhead(boundary, filename string) (int64, error) {
+	var counter byteCounter
+	writer := multipart.NewWriter(&counter)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return 0, err
+	}
+	if _, err := writer.CreateFormFile("file", filename); err != nil {
+		return 0, err
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	return int64(counter), nil
+}
+
+type byteCounter int64
+
+func (b *byteCounter) Write(p []byte) (int, error) {
+	*b += byteCounter(len(p))
+	return len(p), nil
+}
+
 func (c *Client) DownloadFile(fileID, outputPath string, progress func(int)) (string, error) {
 	req, err := http.NewRequest("GET", c.Endpoint+"/api/v1/files/"+fileID+"/download", nil)
 	if err != nil {
 		return "", err
 	}
-	c.attachLocalKey(req)
-	resp, err := c.HTTP.Do(req)
+	c.attachAuth(req)
+	resp, err := c.Transfer.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -126,13 +216,55 @@ func (c *Client) DownloadFile(fileID, outputPath string, progress func(int)) (st
 	if contentLength <= 0 {
 		contentLength = 0
 	}
-	progressReader := NewProgressReader(resp.Body, contentLength, progress)
+	hasher := sha256.New()
+	progressReader := NewProgressReader(io.TeeReader(resp.Body, hasher), contentLength, progress)
 	if _, err := io.Copy(file, progressReader); err != nil {
 		return "", err
 	}
+
+	// 完整下载时校验服务端返回的 SHA-256
+	expected := digestSHA256(resp.Header.Get("Digest"))
+	if resp.StatusCode == http.StatusOK && expected != "" {
+		actual := hex.EncodeToString(hasher.Sum(nil))
+		if actual != expected {
+			file.Close()
+			_ = os.Remove(outputPath)
+			return "", fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", expected, actual)
+		}
+	}
 	return outputPath, nil
 }
 
+// digestSHA256 extracts the hex SHA-256 from an RFC 3230 Digest header.
+func digestSHA256(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		algorithm, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || !strings.EqualFold(algorithm, "sha-256") {
+			continue
+		}
+		sum, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return ""
+		}
+		return hex.EncodeToString(sum)
+	}
+	return ""
+}
+
+// FileSHA256 computes the hex SHA-256 of a local file.
+func FileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
 func (c *Client) ListFiles(folderID *string, limit, offset int, order, keyword string) ([]FileItem, int, error) {
 	url := fmt.Sprintf("%s/api/v1/files?limit=%d&offset=%d&order=%s", c.Endpoint, limit, offset, order)
 	if folderID != nil {
@@ -145,7 +277,7 @@ func (c *Client) ListFiles(folderID *string, limit, offset int, order, keyword s
 	if err != nil {
 		return nil, 0, err
 	}
-	c.attachLocalKey(req)
+	c.attachAuth(req)
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return nil, 0, err
@@ -176,7 +308,7 @@ func (c *Client) GetFile(fileID string) (*FileItem, error) {
 	if err != nil {
 		return nil, err
 	}
-	c.attachLocalKey(req)
+	c.attachAuth(req)
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return nil, err
@@ -204,7 +336,7 @@ func (c *Client) DeleteFile(fileID string) error {
 	if err != nil {
 		return err
 	}
-	c.attachLocalKey(req)
+	c.attachAuth(req)
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return err
@@ -221,7 +353,7 @@ func (c *Client) ShareFile(fileID string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	c.attachLocalKey(req)
+	c.attachAuth(req)
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return "", err
@@ -230,7 +362,54 @@ func (c *Client) ShareFile(fileID string) (string, error) {
 	return decodeShareURL(resp)
 }
 
-func (c *Client) attachLocalKey(req *http.Request) {
+// doJSON 发送 JSON 请求并将响应中的 data 解码到 out（可为 nil）
+func (c *Client) doJSON(method, path string, body, out interface{}, action string) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.Endpoint+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.attachAuth(req)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var payload APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s failed: %s", action, resp.Status)
+		}
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || payload.Code != 0 {
+		if payload.Message != "" {
+			return fmt.Errorf("%s failed: %s", action, payload.Message)
+		}
+		return fmt.Errorf("%s failed: %s", action, resp.Status)
+	}
+	if out == nil || len(payload.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(payload.Data, out)
+}
+
+// attachAuth 优先使用 API 密钥，未配置时使用 local_key
+func (c *Client) attachAuth(req *http.Request) {
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+		return
+	}
 	if c.LocalKey != "" {
 		req.Header.Set("X-Local-Key", c.LocalKey)
 	}
@@ -312,7 +491,7 @@ func (c *Client) CreateFolder(name string, parentID *string) (*FolderItem, error
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	c.attachLocalKey(req)
+	c.attachAuth(req)
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return nil, err
@@ -345,7 +524,7 @@ func (c *Client) ListFolders(parentID *string) ([]FolderItem, error) {
 	if err != nil {
 		return nil, err
 	}
-	c.attachLocalKey(req)
+	c.attachAuth(req)
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return nil, err
@@ -376,7 +555,7 @@ func (c *Client) GetFolder(folderID string) (*FolderContents, error) {
 	if err != nil {
 		return nil, err
 	}
-	c.attachLocalKey(req)
+	c.attachAuth(req)
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return nil, err
@@ -405,7 +584,7 @@ func (c *Client) DeleteFolder(folderID string) error {
 	if err != nil {
 		return err
 	}
-	c.attachLocalKey(req)
+	c.attachAuth(req)
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return err
@@ -419,13 +598,16 @@ func (c *Client) DeleteFolder(folderID string) error {
 
 // RenameFolder 重命名文件夹
 func (c *Client) RenameFolder(folderID, newName string) error {
-	body := "name=" + newName
-	req, err := http.NewRequest("PUT", c.Endpoint+"/api/v1/folders/"+folderID, strings.NewReader(body))
+	data, err := json.Marshal(map[string]string{"name": newName})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PUT", c.Endpoint+"/api/v1/folders/"+folderID, bytes.NewReader(data))
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	c.attachLocalKey(req)
+	req.Header.Set("Content-Type", "application/json")
+	c.attachAuth(req)
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return err
@@ -454,7 +636,7 @@ func (c *Client) MoveFolder(folderID string, parentID *string) error {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	c.attachLocalKey(req)
+	c.attachAuth(req)
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return err
@@ -489,13 +671,16 @@ type BreadcrumbItem struct {
 	Name     string  `json:"name"`
 }
 
-// GetFolderContents 获取文件夹内容
+// GetFolderContents 获取文件夹内容（folderID 为空时返回根目录）
 func (c *Client) GetFolderContents(folderID string) (*FolderContents, error) {
+	if folderID == "" {
+		folderID = "root"
+	}
 	req, err := http.NewRequest("GET", c.Endpoint+"/api/v1/folders/"+folderID+"/contents", nil)
 	if err != nil {
 		return nil, err
 	}
-	c.attachLocalKey(req)
+	c.attachAuth(req)
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return nil, err
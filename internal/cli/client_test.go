@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDigestSHA256(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"sha-256=ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"md5=kAFQmDzST7DWlj99KOF/cg==, SHA-256=ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"md5=kAFQmDzST7DWlj99KOF/cg==", ""},
+		{"sha-256=not base64!", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			if got := digestSHA256(test.header); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDownloadFileVerifiesDigest(t *testing.T) {
+	tests := []struct {
+		name   string
+		digest string
+		ok     bool
+	}{
+		{"matching digest", "sha-256=ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=", true},
+		{"no digest", "", true},
+		{"mismatched digest", "sha-256=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Disposition", `attachment; filename="abc.txt"`)
+				if test.digest != "" {
+					w.Header().Set("Digest", test.digest)
+				}
+				w.Write([]byte("abc"))
+			}))
+			defer server.Close()
+
+			output := filepath.Join(t.TempDir(), "abc.txt")
+			client := NewClient(Config{Endpoint: server.URL})
+			_, err := client.DownloadFile("f1", output, nil)
+			if (err == nil) != test.ok {
+				t.Fatalf("download error: %v", err)
+			}
+			if _, statErr := os.Stat(output); (statErr == nil) != test.ok {
+				t.Errorf("output file kept: %v", statErr)
+			}
+		})
+	}
+}
+
+func TestUploadFileStreamsWithKnownLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+	}{
+		{"empty file", "empty.txt", ""},
+		{"small file", "notes.txt", "hello, filehub"},
+		{"quoted name", `say "hi".txt`, "hi"},
+		{"unicode name", "报告 2024.pdf", strings.Repeat("x", 64<<10)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if len(r.TransferEncoding) > 0 {
+					t.Errorf("sent with transfer encoding %v", r.TransferEncoding)
+				}
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if int64(len(body)) != r.ContentLength {
+					t.Errorf("Content-Length %d, body %d bytes", r.ContentLength, len(body))
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				file, header, err := r.FormFile("file")
+				if err != nil {
+					t.Errorf("parse multipart: %v", err)
+					return
+				}
+				data, _ := io.ReadAll(file)
+				if header.Filename != test.filename || string(data) != test.content {
+					t.Errorf("received %q with %d bytes", header.Filename, len(data))
+				}
+				w.Write([]byte(`{"code":0,"data":{"file_id":"f1"}}`))
+			}))
+			defer server.Close()
+
+			path := filepath.Join(t.TempDir(), test.filename)
+			if err := os.WriteFile(path, []byte(test.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			percent := -1
+			item, err := NewClient(Config{Endpoint: server.URL}).UploadFile(path, nil, func(p int) { percent = p })
+			if err != nil || item.FileID != "f1" {
+				t.Fatalf("upload: %+v, %v", item, err)
+			}
+			if test.content != "" && percent != 100 {
+				t.Errorf("progress ended at %d%%", percent)
+			}
+		})
+	}
+}
+
+func TestRenameFolderSendsJSON(t *testing.T) {
+	tests := []string{"reports", "a & b=c", "报告 2024", `say "hi"`}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Name string `json:"name"`
+				}
+				if r.Method != "PUT" || r.URL.Path != "/api/v1/folders/f1" || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("%s %s with %q", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name != name {
+					t.Errorf("body name %q, %v", body.Name, err)
+				}
+				w.Write([]byte(`{"code":0}`))
+			}))
+			defer server.Close()
+			if err := NewClient(Config{Endpoint: server.URL}).RenameFolder("f1", name); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "查询或导出审计日志（需要 admin 权限）",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := auditFilterFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		format, _ := cmd.Flags().GetString("format")
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		client := NewClient(cfg)
+
+		switch format {
+		case "table":
+		case "csv", "ndjson":
+			output, _ := cmd.Flags().GetString("output")
+			var w io.Writer = os.Stdout
+			if output != "" {
+				file, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				w = file
+			}
+			return client.ExportAuditLogs(filter, format, w)
+		default:
+			return errors.New("--format must be table, csv or ndjson")
+		}
+
+		limit, _ := cmd.Flags().GetInt("limit")
+		cursor, _ := cmd.Flags().GetString("cursor")
+		logs, next, err := client.ListAuditLogs(filter, limit, cursor)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-8s %-20s %-18s %-16s %-14s %-15s %-8s %s\n", "ID", "TIME", "ACTION", "ACTOR", "FILE", "IP", "STATUS", "MESSAGE")
+		for _, entry := range logs {
+			fmt.Printf("%-8d %-20s %-18s %-16s %-14s %-15s %-8s %s\n", entry.ID, entry.CreatedAt, entry.Action, entry.Actor, entry.FileID, entry.IPAddress, entry.Status, entry.Message)
+		}
+		if next != "" {
+			fmt.Printf("\nMore entries: --cursor %s\n", next)
+		}
+		return nil
+	},
+}
+
+func init() {
+	auditCmd.Flags().String("action", "", "按操作过滤，如 login、upload、download")
+	auditCmd.Flags().String("actor", "", "按操作者过滤")
+	auditCmd.Flags().String("file", "", "按文件过滤（filehub://key 或文件ID）")
+	auditCmd.Flags().String("ip", "", "按客户端 IP 过滤")
+	auditCmd.Flags().String("status", "", "按结果过滤：success 或 failure")
+	auditCmd.Flags().String("since", "", "起始时间，RFC3339 或相对时长如 24h、7d")
+	auditCmd.Flags().String("until", "", "结束时间，RFC3339 或相对时长如 24h、7d")
+	auditCmd.Flags().Int("limit", 50, "每页条数（table 格式）")
+	auditCmd.Flags().String("cursor", "", "从上一页给出的 cursor 继续（table 格式）")
+	auditCmd.Flags().String("format", "table", "输出格式：table、csv 或 ndjson（csv/ndjson 导出全部匹配记录）")
+	auditCmd.Flags().StringP("output", "o", "", "导出到文件，默认输出到标准输出")
+}
+
+func auditFilterFromFlags(cmd *cobra.Command) (AuditFilter, error) {
+	var filter AuditFilter
+	filter.Action, _ = cmd.Flags().GetString("action")
+	filter.Actor, _ = cmd.Flags().GetString("actor")
+	filter.IPAddress, _ = cmd.Flags().GetString("ip")
+	filter.Status, _ = cmd.Flags().GetString("status")
+	file, _ := cmd.Flags().GetString("file")
+	filter.FileID = strings.TrimPrefix(file, "filehub://")
+	for flag, target := range map[string]*string{"since": &filter.Since, "until": &filter.Until} {
+		value, _ := cmd.Flags().GetString(flag)
+		if value == "" {
+			continue
+		}
+		at, err := parseTimeFlag(value, time.Now())
+		if err != nil {
+			return AuditFilter{}, fmt.Errorf("invalid --%s: %w", flag, err)
+		}
+		*target = at
+	}
+	return filter, nil
+}
+
+// parseTimeFlag 接受 RFC3339 时间，或 24h、7d 这类相对 now 之前的时长，用于 --since 等时间参数
+func parseTimeFlag(value string, now time.Time) (string, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed.UTC().Format(time.RFC3339), nil
+	}
+	var ago time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return "", errors.New("expected RFC3339 time or duration like 24h or 7d")
+		}
+		ago = time.Duration(count) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return "", errors.New("expected RFC3339 time or duration like 24h or 7d")
+		}
+		ago = parsed
+	}
+	return now.Add(-ago).UTC().Format(time.RFC3339), nil
+}
@@ -17,7 +17,8 @@ var configInitCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		endpoint, _ := cmd.Flags().GetString("endpoint")
 		localKey, _ := cmd.Flags().GetString("local-key")
-		path, err := InitConfig(endpoint, localKey)
+		apiKey, _ := cmd.Flags().GetString("api-key")
+		path, err := InitConfig(endpoint, localKey, apiKey)
 		if err != nil {
 			return err
 		}
@@ -29,5 +30,6 @@ var configInitCmd = &cobra.Command{
 func init() {
 	configInitCmd.Flags().String("endpoint", "", "API endpoint")
 	configInitCmd.Flags().String("local-key", "", "Local key")
+	configInitCmd.Flags().String("api-key", "", "API key（filehub-cli keys create 生成）")
 	configCmd.AddCommand(configInitCmd)
 }
@@ -9,7 +9,7 @@ import (
 
 var deleteCmd = &cobra.Command{
 	Use:   "delete <filehub://key>",
-	Short: "删除文件",
+	Short: "删除文件（移入回收站，可用 trash restore 还原）",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) != 1 {
 			return errors.New("please provide filehub:// key")
@@ -26,7 +26,7 @@ var deleteCmd = &cobra.Command{
 		if err := client.DeleteFile(fileID); err != nil {
 			return err
 		}
-		fmt.Println("deleted")
+		fmt.Println("moved to trash")
 		return nil
 	},
 }
@@ -187,7 +187,7 @@ var rmdirCmd = &cobra.Command{
 		if err := client.DeleteFolder(args[0]); err != nil {
 			return err
 		}
-		fmt.Println("deleted")
+		fmt.Println("moved to trash")
 		return nil
 	},
 }
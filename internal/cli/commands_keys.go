@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "管理 API 密钥",
+}
+
+var keysCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "新建 API 密钥，密钥只显示一次",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		folderID, _ := cmd.Flags().GetString("folder")
+		expires, _ := cmd.Flags().GetString("expires")
+		owner, _ := cmd.Flags().GetString("owner")
+		opts := APIKeyOptions{Name: args[0], Scopes: scopes, ExpiresIn: expires, Owner: owner}
+		if folderID != "" {
+			opts.FolderID = &folderID
+		}
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		client := NewClient(cfg)
+		key, err := client.CreateAPIKey(opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(key.Key)
+		fmt.Printf("key_id: %s  owner: %s  scopes: %s\n", key.KeyID, key.Owner, strings.Join(key.Scopes, ","))
+		return nil
+	},
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "列出 API 密钥",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		client := NewClient(cfg)
+		keys, err := client.ListAPIKeys()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-16s %-20s %-10s %-12s %-8s %-28s %-20s %-20s %s\n", "KEY_ID", "NAME", "PREFIX", "OWNER", "STATUS", "SCOPES", "EXPIRES_AT", "LAST_USED_AT", "FOLDER")
+		for _, key := range keys {
+			fmt.Printf("%-16s %-20s %-10s %-12s %-8s %-28s %-20s %-20s %s\n", key.KeyID, key.Name, key.Prefix, key.Owner, key.Status,
+				strings.Join(key.Scopes, ","), valueOr(key.ExpiresAt, "never"), valueOr(key.LastUsedAt, "-"), valueOr(key.FolderID, "-"))
+		}
+		return nil
+	},
+}
+
+var keysRevokeCmd = &cobra.Command{
+	Use:   "revoke <key_id>",
+	Short: "吊销 API 密钥",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		client := NewClient(cfg)
+		if err := client.RevokeAPIKey(args[0]); err != nil {
+			return err
+		}
+		fmt.Println("revoked")
+		return nil
+	},
+}
+
+func valueOr(value *string, fallback string) string {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
+
+func init() {
+	keysCreateCmd.Flags().StringSlice("scope", []string{"read"}, "read、upload、delete、share、admin，可重复或逗号分隔")
+	keysCreateCmd.Flags().String("folder", "", "只允许访问该文件夹及其子文件夹")
+	keysCreateCmd.Flags().String("expires", "", "有效期，如 30d、720h，默认不过期")
+	keysCreateCmd.Flags().String("owner", "", "所有者用户名，默认为当前用户；为他人创建需要 admin")
+	keysCmd.AddCommand(keysCreateCmd)
+	keysCmd.AddCommand(keysListCmd)
+	keysCmd.AddCommand(keysRevokeCmd)
+}
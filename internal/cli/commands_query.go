@@ -1,8 +1,11 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -29,6 +32,9 @@ var statCmd = &cobra.Command{
 		fmt.Printf("Original Name: %s\n", file.OriginalName)
 		fmt.Printf("Size:          %d bytes\n", file.Size)
 		fmt.Printf("MIME Type:     %s\n", file.MimeType)
+		if file.SHA256 != "" {
+			fmt.Printf("SHA-256:       %s\n", file.SHA256)
+		}
 		fmt.Printf("Created At:     %s\n", file.CreatedAt)
 		fmt.Printf("FileHub URL:    filehub://%s\n", file.FileID)
 		fmt.Printf("Download URL:   %s\n", file.DownloadURL)
@@ -119,32 +125,125 @@ func init() {
 }
 
 var findCmd = &cobra.Command{
-	Use:   "find <pattern>",
-	Short: "搜索文件（支持通配符）",
-	Args:  cobra.ExactArgs(1),
+	Use:   "find [pattern]",
+	Short: "搜索文件（支持通配符、正则和多种过滤条件）",
+	Long: `按名称搜索文件。pattern 含 * ? [ 时按通配符匹配完整文件名（不区分大小写），
+加 --regex 时按正则匹配，否则按子串匹配。省略 pattern 时只按过滤条件搜索。`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		folderIDStr, _ := cmd.Flags().GetString("folder")
-		var folderIDPtr *string
-		if folderIDStr != "" {
-			folderIDPtr = &folderIDStr
+		opts := SearchOptions{Match: "substring", Sort: "created", Order: "desc"}
+		if len(args) == 1 {
+			opts.Name = args[0]
+			if regex, _ := cmd.Flags().GetBool("regex"); regex {
+				opts.Match = "regex"
+			} else if strings.ContainsAny(opts.Name, "*?[") {
+				opts.Match = "glob"
+			}
+		}
+		opts.MimeTypes, _ = cmd.Flags().GetStringSlice("type")
+		opts.Extensions, _ = cmd.Flags().GetStringSlice("ext")
+		opts.CreatedBy, _ = cmd.Flags().GetString("creator")
+		opts.FolderID, _ = cmd.Flags().GetString("folder")
+		opts.Recursive, _ = cmd.Flags().GetBool("recursive")
+		opts.Sort, _ = cmd.Flags().GetString("sort")
+		opts.Limit, _ = cmd.Flags().GetInt("limit")
+		opts.Offset, _ = cmd.Flags().GetInt("offset")
+		if asc, _ := cmd.Flags().GetBool("asc"); asc {
+			opts.Order = "asc"
 		}
+		for flag, target := range map[string]*string{"min-size": &opts.MinSize, "max-size": &opts.MaxSize} {
+			value, _ := cmd.Flags().GetString(flag)
+			if value == "" {
+				continue
+			}
+			size, err := parseSize(value)
+			if err != nil {
+				return fmt.Errorf("invalid --%s: %w", flag, err)
+			}
+			*target = strconv.FormatInt(size, 10)
+		}
+		for flag, target := range map[string]*string{
+			"created-after":  &opts.CreatedAfter,
+			"created-before": &opts.CreatedBefore,
+			"updated-after":  &opts.UpdatedAfter,
+			"updated-before": &opts.UpdatedBefore,
+		} {
+			value, _ := cmd.Flags().GetString(flag)
+			if value == "" {
+				continue
+			}
+			at, err := parseTimeFlag(value, time.Now())
+			if err != nil {
+				return fmt.Errorf("invalid --%s: %w", flag, err)
+			}
+			*target = at
+		}
+
 		cfg, err := LoadConfig()
 		if err != nil {
 			return err
 		}
 		client := NewClient(cfg)
-		files, total, err := client.ListFiles(folderIDPtr, 100, 0, "desc", args[0])
+		files, total, err := client.SearchFiles(opts)
 		if err != nil {
 			return err
 		}
-		fmt.Printf("Found %d files matching '%s':\n", total, args[0])
+		fmt.Printf("Found %d files\n", total)
+		fmt.Printf("%-14s %-12s %-20s %-24s %s\n", "ID", "SIZE", "UPDATED_AT", "TYPE", "NAME")
 		for _, file := range files {
-			fmt.Printf("%s\t%s\t%s\n", file.FileID, file.OriginalName, file.CreatedAt)
+			fmt.Printf("%-14s %-12d %-20s %-24s %s\n", file.FileID, file.Size, file.UpdatedAt, mimeBase(file.MimeType), file.OriginalName)
+		}
+		if shown := opts.Offset + len(files); shown < total {
+			fmt.Printf("\nShowing %d-%d, next page: --offset %d\n", opts.Offset+1, shown, shown)
 		}
 		return nil
 	},
 }
 
 func init() {
-	findCmd.Flags().StringP("folder", "f", "", "搜索文件夹（默认根目录）")
+	findCmd.Flags().Bool("regex", false, "按正则表达式匹配文件名")
+	findCmd.Flags().StringSliceP("type", "t", nil, "MIME 类型，如 application/pdf 或 image/*，可重复或逗号分隔")
+	findCmd.Flags().StringSliceP("ext", "e", nil, "扩展名，如 pdf,docx")
+	findCmd.Flags().String("min-size", "", "最小大小，如 512KB、10MB")
+	findCmd.Flags().String("max-size", "", "最大大小，如 1GB")
+	findCmd.Flags().String("created-after", "", "创建时间下限，RFC3339 或相对时长如 7d")
+	findCmd.Flags().String("created-before", "", "创建时间上限，RFC3339 或相对时长如 7d")
+	findCmd.Flags().String("updated-after", "", "修改时间下限，RFC3339 或相对时长如 24h")
+	findCmd.Flags().String("updated-before", "", "修改时间上限，RFC3339 或相对时长如 24h")
+	findCmd.Flags().String("creator", "", "按创建者过滤")
+	findCmd.Flags().StringP("folder", "f", "", "搜索文件夹ID（root 为根目录，默认全部）")
+	findCmd.Flags().BoolP("recursive", "r", false, "包含子文件夹")
+	findCmd.Flags().String("sort", "created", "排序字段：name、size、created 或 updated")
+	findCmd.Flags().Bool("asc", false, "升序排列（默认降序）")
+	findCmd.Flags().Int("limit", 100, "返回条数")
+	findCmd.Flags().Int("offset", 0, "偏移量")
+}
+
+// parseSize 解析 512、10KB、1.5GB 这类大小，单位按 1024 进位
+func parseSize(value string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		bytes  int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, unit.suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(upper, 64)
+	if err != nil || number < 0 {
+		return 0, errors.New("expected a size like 512, 10KB or 1.5GB")
+	}
+	return int64(number * float64(multiplier)), nil
+}
+
+// mimeBase 去掉 MIME 类型中的参数，如 "; charset=utf-8"
+func mimeBase(mimeType string) string {
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		return mimeType[:i]
+	}
+	return mimeType
 }
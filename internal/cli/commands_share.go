@@ -8,9 +8,41 @@ import (
 )
 
 var shareCmd = &cobra.Command{
-	Use:   "share <filehub://key>",
+	Use:   "share <filehub://key> | --folder <folder_id> [--upload]",
 	Short: "获取分享链接",
+	Long:  "获取分享链接。不带参数时复用默认链接（7 天有效）；指定 --expires/--password/--max-downloads/--note 时创建新链接；--folder 分享整个文件夹；--folder 加 --upload 创建只能上传的收集链接。",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := ShareOptions{}
+		opts.ExpiresIn, _ = cmd.Flags().GetString("expires")
+		opts.Password, _ = cmd.Flags().GetString("password")
+		opts.MaxDownloads, _ = cmd.Flags().GetInt64("max-downloads")
+		opts.Note, _ = cmd.Flags().GetString("note")
+		folderID, _ := cmd.Flags().GetString("folder")
+		upload, _ := cmd.Flags().GetBool("upload")
+		if upload {
+			if folderID == "" {
+				return errors.New("--upload requires --folder")
+			}
+			opts.Type = "upload"
+			opts.MaxFiles, _ = cmd.Flags().GetInt64("max-files")
+			maxSizeMB, _ := cmd.Flags().GetInt64("max-size-mb")
+			opts.MaxBytes = maxSizeMB * 1024 * 1024
+		}
+		if folderID != "" {
+			if len(args) != 0 {
+				return errors.New("--folder cannot be combined with a filehub:// key")
+			}
+			cfg, err := LoadConfig()
+			if err != nil {
+				return err
+			}
+			link, err := NewClient(cfg).CreateFolderShare(folderID, opts)
+			if err != nil {
+				return err
+			}
+			fmt.Println(link.URL)
+			return nil
+		}
 		if len(args) != 1 {
 			return errors.New("please provide filehub:// key")
 		}
@@ -23,11 +55,101 @@ var shareCmd = &cobra.Command{
 			return err
 		}
 		client := NewClient(cfg)
-		url, err := client.ShareFile(fileID)
+		if opts == (ShareOptions{}) {
+			url, err := client.ShareFile(fileID)
+			if err != nil {
+				return err
+			}
+			fmt.Println(url)
+			return nil
+		}
+		link, err := client.CreateShare(fileID, opts)
 		if err != nil {
 			return err
 		}
-		fmt.Println(url)
+		fmt.Println(link.URL)
 		return nil
 	},
 }
+
+var shareRevokeCmd = &cobra.Command{
+	Use:   "revoke <token|url>",
+	Short: "撤销分享链接",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		client := NewClient(cfg)
+		if err := client.RevokeShare(parseShareToken(args[0])); err != nil {
+			return err
+		}
+		fmt.Println("revoked")
+		return nil
+	},
+}
+
+var shareUpdateCmd = &cobra.Command{
+	Use:     "update <token|url>",
+	Aliases: []string{"extend"},
+	Short:   "延长或修改分享链接",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		update := ShareUpdate{}
+		if cmd.Flags().Changed("expires") {
+			value, _ := cmd.Flags().GetString("expires")
+			update.ExpiresIn = &value
+		}
+		if cmd.Flags().Changed("password") {
+			value, _ := cmd.Flags().GetString("password")
+			update.Password = &value
+		}
+		if cmd.Flags().Changed("max-downloads") {
+			value, _ := cmd.Flags().GetInt64("max-downloads")
+			update.MaxDownloads = &value
+		}
+		if cmd.Flags().Changed("note") {
+			value, _ := cmd.Flags().GetString("note")
+			update.Note = &value
+		}
+		if cmd.Flags().Changed("max-files") {
+			value, _ := cmd.Flags().GetInt64("max-files")
+			update.MaxFiles = &value
+		}
+		if cmd.Flags().Changed("max-size-mb") {
+			value, _ := cmd.Flags().GetInt64("max-size-mb")
+			value *= 1024 * 1024
+			update.MaxBytes = &value
+		}
+		if update == (ShareUpdate{}) {
+			return errors.New("nothing to update")
+		}
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		client := NewClient(cfg)
+		link, err := client.UpdateShare(parseShareToken(args[0]), update)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s expires %s\n", link.URL, link.ExpiresAt)
+		return nil
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{shareCmd, shareUpdateCmd} {
+		cmd.Flags().String("expires", "", "有效期，如 24h、7d")
+		cmd.Flags().String("password", "", "访问密码（update 时传空字符串可移除）")
+		cmd.Flags().Int64("max-downloads", 0, "最大下载次数，0 表示不限")
+		cmd.Flags().String("note", "", "备注")
+		cmd.Flags().Int64("max-files", 0, "上传链接最多接收的文件数，0 表示不限")
+		cmd.Flags().Int64("max-size-mb", 0, "上传链接最多接收的总大小（MB），0 表示不限")
+	}
+	shareCmd.Flags().Bool("upload", false, "创建上传链接，只能向 --folder 上传，不能列出或下载")
+	shareCmd.Flags().String("folder", "", "分享整个文件夹（文件夹 ID）")
+	shareCmd.AddCommand(shareRevokeCmd)
+	shareCmd.AddCommand(shareUpdateCmd)
+}
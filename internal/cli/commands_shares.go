@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var sharesCmd = &cobra.Command{
+	Use:   "shares [filehub://key]",
+	Short: "列出分享链接及访问统计",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fileID := ""
+		if len(args) == 1 {
+			var err error
+			if fileID, err = parseFilehubURL(args[0]); err != nil {
+				return err
+			}
+		}
+		folderID, _ := cmd.Flags().GetString("folder")
+		status, _ := cmd.Flags().GetString("status")
+		limit, _ := cmd.Flags().GetInt("limit")
+		offset, _ := cmd.Flags().GetInt("offset")
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		client := NewClient(cfg)
+		links, total, err := client.ListShares(fileID, folderID, status, limit, offset)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Total: %d\n", total)
+		fmt.Printf("%-43s %-20s %-10s %-20s %-9s %-8s %s\n", "TOKEN", "TARGET", "STATUS", "EXPIRES_AT", "DOWNLOADS", "ACCESSES", "NOTE")
+		for _, link := range links {
+			downloads := fmt.Sprintf("%d", link.DownloadCount)
+			if link.MaxDownloads > 0 {
+				downloads = fmt.Sprintf("%d/%d", link.DownloadCount, link.MaxDownloads)
+			}
+			if link.Type == "upload" {
+				downloads = uploadCount(link)
+			}
+			fmt.Printf("%-43s %-20s %-10s %-20s %-9s %-8d %s\n", link.Token, shareTarget(link), link.Status, link.ExpiresAt, downloads, link.Accesses, link.Note)
+		}
+		return nil
+	},
+}
+
+var sharesShowCmd = &cobra.Command{
+	Use:   "show <token|url>",
+	Short: "查看分享链接详情和访问记录",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		limit, _ := cmd.Flags().GetInt("limit")
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		client := NewClient(cfg)
+		token := parseShareToken(args[0])
+		link, err := client.GetShare(token)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("URL:            %s\n", link.URL)
+		fmt.Printf("Target:         %s\n", shareTarget(link))
+		fmt.Printf("Status:         %s\n", link.Status)
+		fmt.Printf("Expires At:     %s\n", link.ExpiresAt)
+		fmt.Printf("Password:       %t\n", link.HasPassword)
+		if link.Type == "upload" {
+			fmt.Printf("Uploads:        %s files, %d bytes", uploadCount(link), link.UploadedBytes)
+			if link.MaxBytes > 0 {
+				fmt.Printf(" of %d", link.MaxBytes)
+			}
+			fmt.Println()
+		} else if link.MaxDownloads > 0 {
+			fmt.Printf("Downloads:      %d/%d\n", link.DownloadCount, link.MaxDownloads)
+		} else {
+			fmt.Printf("Downloads:      %d\n", link.DownloadCount)
+		}
+		fmt.Printf("Accesses:       %d (%d completed, %d bytes sent)\n", link.Accesses, link.CompletedDownloads, link.BytesSent)
+		if link.Note != "" {
+			fmt.Printf("Note:           %s\n", link.Note)
+		}
+		fmt.Printf("Created At:     %s by %s\n", link.CreatedAt, link.CreatedBy)
+
+		accesses, total, err := client.ListShareAccesses(token, limit)
+		if err != nil {
+			return err
+		}
+		if total == 0 {
+			return nil
+		}
+		fmt.Printf("\nRecent accesses (%d of %d):\n", len(accesses), total)
+		for _, access := range accesses {
+			state := "incomplete"
+			if access.Completed {
+				state = "completed"
+			}
+			fmt.Printf("%s  %-15s %3d %10d  %-10s %s\n", access.AccessedAt, access.IPAddress, access.StatusCode, access.BytesSent, state, access.UserAgent)
+		}
+		return nil
+	},
+}
+
+// shareTarget 返回 filehub://<file_id> 或 folder:<folder_id>
+func shareTarget(link ShareLink) string {
+	if link.Type == "upload" && link.FolderID != nil {
+		return "upload:" + *link.FolderID
+	}
+	if link.FolderID != nil {
+		return "folder:" + *link.FolderID
+	}
+	return "filehub://" + link.FileID
+}
+
+// uploadCount 上传链接已接收的文件数，有上限时显示为 n/max
+func uploadCount(link ShareLink) string {
+	if link.MaxFiles > 0 {
+		return fmt.Sprintf("%d/%d", link.UploadedFiles, link.MaxFiles)
+	}
+	return fmt.Sprintf("%d", link.UploadedFiles)
+}
+
+func init() {
+	sharesCmd.Flags().String("folder", "", "只列出该文件夹的分享链接")
+	sharesCmd.Flags().String("status", "", "按状态过滤（active/expired/exhausted/revoked）")
+	sharesCmd.Flags().Int("limit", 20, "Limit")
+	sharesCmd.Flags().Int("offset", 0, "Offset")
+	sharesShowCmd.Flags().Int("limit", 20, "显示的访问记录条数")
+	sharesCmd.AddCommand(sharesShowCmd)
+}
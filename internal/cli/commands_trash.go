@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "管理回收站",
+}
+
+var trashListCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "列出回收站中的文件和文件夹",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		client := NewClient(cfg)
+		items, err := client.ListTrash()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-24s %-6s %-12s %-20s %-20s %-12s %s\n", "ID", "TYPE", "SIZE", "DELETED_AT", "PURGE_AT", "DELETED_BY", "NAME")
+		for _, item := range items {
+			size := "-"
+			if item.Type == "file" {
+				size = fmt.Sprint(item.Size)
+			}
+			purgeAt := item.PurgeAt
+			if purgeAt == "" {
+				purgeAt = "never"
+			}
+			fmt.Printf("%-24s %-6s %-12s %-20s %-20s %-12s %s\n", item.ID, item.Type, size, item.DeletedAt, purgeAt, item.DeletedBy, item.Name)
+		}
+		return nil
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore <id|filehub://id>...",
+	Short: "还原回收站中的文件或文件夹到原位置",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		client := NewClient(cfg)
+		for _, arg := range args {
+			id := strings.TrimPrefix(arg, "filehub://")
+			if err := client.RestoreTrash(id); err != nil {
+				return err
+			}
+			fmt.Printf("restored %s\n", id)
+		}
+		return nil
+	},
+}
+
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty [id|filehub://id]...",
+	Short: "彻底删除回收站中的指定条目，不带参数时清空回收站",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		client := NewClient(cfg)
+		if len(args) == 0 {
+			items, files, err := client.EmptyTrash()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("purged %d items (%d files)\n", items, files)
+			return nil
+		}
+		for _, arg := range args {
+			id := strings.TrimPrefix(arg, "filehub://")
+			files, err := client.PurgeTrash(id)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("purged %s (%d files)\n", id, files)
+		}
+		return nil
+	},
+}
+
+func init() {
+	trashCmd.AddCommand(trashListCmd)
+	trashCmd.AddCommand(trashRestoreCmd)
+	trashCmd.AddCommand(trashEmptyCmd)
+}
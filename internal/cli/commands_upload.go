@@ -17,6 +17,10 @@ var uploadCmd = &cobra.Command{
 		if len(args) == 0 {
 			return errors.New("please provide file paths")
 		}
+		replace, _ := cmd.Flags().GetString("replace")
+		if replace != "" {
+			return uploadVersion(replace, args)
+		}
 		recursive, _ := cmd.Flags().GetBool("recursive")
 		folderIDStr, _ := cmd.Flags().GetString("folder")
 		var folderIDPtr *string
@@ -52,6 +56,40 @@ var uploadCmd = &cobra.Command{
 func init() {
 	uploadCmd.Flags().Bool("recursive", false, "Upload directories recursively")
 	uploadCmd.Flags().StringP("folder", "f", "", "目标文件夹ID")
+	uploadCmd.Flags().String("replace", "", "上传为已有文件的新版本（filehub://key）")
+}
+
+// uploadVersion 将单个文件上传为 target 的新版本，旧版本保留
+func uploadVersion(target string, args []string) error {
+	if len(args) != 1 {
+		return errors.New("--replace takes exactly one file")
+	}
+	fileID, err := parseFilehubURL(target)
+	if err != nil {
+		return err
+	}
+	if fileID == "" {
+		return errors.New("invalid filehub URL")
+	}
+	info, err := os.Stat(args[0])
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", args[0])
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Uploading %s as a new version of filehub://%s...\n", args[0], fileID)
+	item, err := NewClient(cfg).UploadVersion(fileID, args[0], nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("filehub://%s (version %d)\n", item.FileID, item.Version)
+	fmt.Println(item.DownloadURL)
+	return nil
 }
 
 func collectFiles(args []string, recursive bool) ([]string, error) {
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <filehub://key> <localfile>",
+	Short: "校验本地文件与服务端 SHA-256 是否一致",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fileID, err := parseFilehubURL(args[0])
+		if err != nil {
+			return err
+		}
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		client := NewClient(cfg)
+		file, err := client.GetFile(fileID)
+		if err != nil {
+			return err
+		}
+		if file.SHA256 == "" {
+			return errors.New("no checksum recorded for this file")
+		}
+		local, err := FileSHA256(args[1])
+		if err != nil {
+			return err
+		}
+		if local != file.SHA256 {
+			return fmt.Errorf("checksum mismatch: remote %s, local %s", file.SHA256, local)
+		}
+		fmt.Printf("OK  sha256:%s\n", local)
+		return nil
+	},
+}
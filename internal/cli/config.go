@@ -14,7 +14,9 @@ import (
 
 type Config struct {
 	Endpoint string `yaml:"endpoint"`
-	LocalKey string `yaml:"local_key"`
+	LocalKey string `yaml:"local_key,omitempty"`
+	// APIKey 为 filehub-cli keys create 生成的密钥，设置后代替 local_key
+	APIKey string `yaml:"api_key,omitempty"`
 }
 
 func LoadConfig() (Config, error) {
@@ -30,21 +32,21 @@ func LoadConfig() (Config, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return Config{}, err
 	}
-	if cfg.Endpoint == "" || cfg.LocalKey == "" {
-		return Config{}, errors.New("invalid config: endpoint/local_key required")
+	if cfg.Endpoint == "" || (cfg.LocalKey == "" && cfg.APIKey == "") {
+		return Config{}, errors.New("invalid config: endpoint and api_key or local_key required")
 	}
 	return cfg, nil
 }
 
-func InitConfig(endpoint, localKey string) (string, error) {
+func InitConfig(endpoint, localKey, apiKey string) (string, error) {
 	if endpoint == "" {
 		endpoint = prompt("API endpoint", "http://localhost:8080")
 	}
-	if localKey == "" {
-		localKey = prompt("Local key", "")
+	if localKey == "" && apiKey == "" {
+		apiKey = prompt("API key", "")
 	}
-	if endpoint == "" || localKey == "" {
-		return "", errors.New("endpoint and local_key are required")
+	if endpoint == "" || (localKey == "" && apiKey == "") {
+		return "", errors.New("endpoint and api_key or local_key are required")
 	}
 	path, err := configPath()
 	if err != nil {
@@ -53,7 +55,7 @@ func InitConfig(endpoint, localKey string) (string, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return "", err
 	}
-	data, err := yaml.Marshal(Config{Endpoint: endpoint, LocalKey: localKey})
+	data, err := yaml.Marshal(Config{Endpoint: endpoint, LocalKey: localKey, APIKey: apiKey})
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,47 @@
+package cli
+
+import "net/url"
+
+// APIKey API 密钥，Key 只在创建时返回
+type APIKey struct {
+	KeyID      string   `json:"key_id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Owner      string   `json:"owner"`
+	Scopes     []string `json:"scopes"`
+	FolderID   *string  `json:"folder_id"`
+	Status     string   `json:"status"`
+	ExpiresAt  *string  `json:"expires_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+	CreatedAt  string   `json:"created_at"`
+	Key        string   `json:"key"`
+}
+
+// APIKeyOptions 创建 API 密钥的参数
+type APIKeyOptions struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	FolderID  *string  `json:"folder_id,omitempty"`
+	ExpiresIn string   `json:"expires_in,omitempty"`
+	Owner     string   `json:"owner,omitempty"`
+}
+
+func (c *Client) CreateAPIKey(opts APIKeyOptions) (APIKey, error) {
+	var key APIKey
+	err := c.doJSON("POST", "/api/v1/keys", opts, &key, "create key")
+	return key, err
+}
+
+func (c *Client) ListAPIKeys() ([]APIKey, error) {
+	var data struct {
+		Keys []APIKey `json:"keys"`
+	}
+	if err := c.doJSON("GET", "/api/v1/keys", nil, &data, "list keys"); err != nil {
+		return nil, err
+	}
+	return data.Keys, nil
+}
+
+func (c *Client) RevokeAPIKey(keyID string) error {
+	return c.doJSON("DELETE", "/api/v1/keys/"+url.PathEscape(keyID), nil, nil, "revoke key")
+}
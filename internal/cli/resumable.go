@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 超过该大小的文件自动使用 tus 断点续传
+	resumableThreshold = 64 << 20
+	// 分块大小需不小于 S3 分片下限（5 MiB）
+	resumableChunkSize = 8 << 20
+	resumableRetries   = 5
+	tusVersion         = "1.0.0"
+)
+
+var errResumableUnavailable = errors.New("resumable upload not available")
+
+// uploadResumable 通过 tus 协议分块上传，连接中断时从服务端记录的偏移继续
+func (c *Client) uploadResumable(path string, folderID *string, progress func(int)) (FileItem, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return FileItem{}, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return FileItem{}, err
+	}
+	size := stat.Size()
+
+	location, err := c.createUpload(filepath.Base(path), size, folderID)
+	if err != nil {
+		return FileItem{}, err
+	}
+
+	progressReader := NewProgressReader(file, size, progress)
+	var offset int64
+	var fileID string
+	failures := 0
+	for offset < size {
+		chunk := int64(resumableChunkSize)
+		if size-offset < chunk {
+			chunk = size - offset
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return FileItem{}, err
+		}
+		progressReader.current = offset
+		next, id, err := c.patchUpload(location, offset, io.LimitReader(progressReader, chunk), chunk)
+		if err != nil {
+			failures++
+			if failures > resumableRetries {
+				return FileItem{}, fmt.Errorf("upload failed after %d retries: %w", resumableRetries, err)
+			}
+			time.Sleep(time.Duration(failures) * time.Second)
+			// 以服务端记录的偏移为准继续上传
+			if current, headErr := c.headUpload(location); headErr == nil {
+				offset = current
+			}
+			continue
+		}
+		failures = 0
+		offset = next
+		fileID = id
+	}
+	if fileID == "" {
+		return FileItem{}, errors.New("upload finished without file id")
+	}
+	item, err := c.GetFile(fileID)
+	if err != nil {
+		return FileItem{}, err
+	}
+	return *item, nil
+}
+
+func (c *Client) createUpload(name string, size int64, folderID *string) (string, error) {
+	req, err := http.NewRequest("POST", c.Endpoint+"/api/v1/uploads", nil)
+	if err != nil {
+		return "", err
+	}
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte(name))
+	if folderID != nil {
+		metadata += ",folder_id " + base64.StdEncoding.EncodeToString([]byte(*folderID))
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	req.Header.Set("Upload-Metadata", metadata)
+	c.attachAuth(req)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return "", errResumableUnavailable
+	default:
+		return "", fmt.Errorf("create upload failed: %s", resp.Status)
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", errors.New("create upload failed: missing Location")
+	}
+	if strings.HasPrefix(location, "/") {
+		location = c.Endpoint + location
+	}
+	return location, nil
+}
+
+func (c *Client) patchUpload(location string, offset int64, body io.Reader, size int64) (int64, string, error) {
+	req, err := http.NewRequest("PATCH", location, body)
+	if err != nil {
+		return 0, "", err
+	}
+	req.ContentLength = size
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.attachAuth(req)
+	resp, err := c.Transfer.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, "", fmt.Errorf("upload chunk failed: %s", resp.Status)
+	}
+	next, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, "", errors.New("upload chunk failed: missing Upload-Offset")
+	}
+	return next, resp.Header.Get("X-FileHub-File-ID"), nil
+}
+
+func (c *Client) headUpload(location string) (int64, error) {
+	req, err := http.NewRequest("HEAD", location, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	c.attachAuth(req)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("query upload failed: %s", resp.Status)
+	}
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
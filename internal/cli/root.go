@@ -37,6 +37,7 @@ func init() {
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(deleteCmd)
 	rootCmd.AddCommand(shareCmd)
+	rootCmd.AddCommand(sharesCmd)
 	rootCmd.AddCommand(mkdirCmd)
 	rootCmd.AddCommand(lsFoldersCmd)
 	rootCmd.AddCommand(lsCmd)
@@ -48,4 +49,8 @@ func init() {
 	rootCmd.AddCommand(urlFileCmd)
 	rootCmd.AddCommand(urlFolderCmd)
 	rootCmd.AddCommand(findCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(keysCmd)
+	rootCmd.AddCommand(trashCmd)
+	rootCmd.AddCommand(auditCmd)
 }
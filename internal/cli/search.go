@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SearchOptions 高级搜索条件，零值不过滤；时间为 RFC3339
+type SearchOptions struct {
+	Name          string
+	Match         string
+	MimeTypes     []string
+	Extensions    []string
+	MinSize       string
+	MaxSize       string
+	CreatedAfter  string
+	CreatedBefore string
+	UpdatedAfter  string
+	UpdatedBefore string
+	CreatedBy     string
+	FolderID      string
+	Recursive     bool
+	Sort          string
+	Order         string
+	Limit         int
+	Offset        int
+}
+
+// SearchFiles 按条件搜索文件，返回当前页和匹配总数
+func (c *Client) SearchFiles(opts SearchOptions) ([]FileItem, int, error) {
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"q":              opts.Name,
+		"match":          opts.Match,
+		"mime":           strings.Join(opts.MimeTypes, ","),
+		"ext":            strings.Join(opts.Extensions, ","),
+		"min_size":       opts.MinSize,
+		"max_size":       opts.MaxSize,
+		"created_after":  opts.CreatedAfter,
+		"created_before": opts.CreatedBefore,
+		"updated_after":  opts.UpdatedAfter,
+		"updated_before": opts.UpdatedBefore,
+		"created_by":     opts.CreatedBy,
+		"folder_id":      opts.FolderID,
+		"sort":           opts.Sort,
+		"order":          opts.Order,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if opts.Recursive {
+		query.Set("recursive", "true")
+	}
+	query.Set("limit", strconv.Itoa(opts.Limit))
+	query.Set("offset", strconv.Itoa(opts.Offset))
+	var data struct {
+		Total int        `json:"total"`
+		Files []FileItem `json:"files"`
+	}
+	if err := c.doJSON("GET", "/api/v1/files/search?"+query.Encode(), nil, &data, "search"); err != nil {
+		return nil, 0, err
+	}
+	return data.Files, data.Total, nil
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		ok    bool
+	}{
+		{"512", 512, true},
+		{"512B", 512, true},
+		{"10KB", 10 << 10, true},
+		{"10k", 10 << 10, true},
+		{"1.5GB", 3 << 29, true},
+		{" 2 MB ", 2 << 20, true},
+		{"1T", 1 << 40, true},
+		{"", 0, false},
+		{"MB", 0, false},
+		{"-1KB", 0, false},
+		{"ten", 0, false},
+	}
+	for _, test := range tests {
+		got, err := parseSize(test.value)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("parseSize(%q) = %d, %v", test.value, got, err)
+		}
+	}
+}
+
+func TestMimeBase(t *testing.T) {
+	for value, want := range map[string]string{
+		"text/plain; charset=utf-8": "text/plain",
+		"image/png":                 "image/png",
+		"":                          "",
+	} {
+		if got := mimeBase(value); got != want {
+			t.Errorf("mimeBase(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestSearchFilesQuery(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte(`{"code":0,"data":{"total":7,"files":[{"file_id":"f1","original_name":"a.pdf"}]}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{Endpoint: server.URL})
+	files, total, err := client.SearchFiles(SearchOptions{
+		Name:       "*.pdf",
+		Match:      "glob",
+		MimeTypes:  []string{"application/pdf", "image/*"},
+		Extensions: []string{"pdf"},
+		MinSize:    "1024",
+		Recursive:  true,
+		Limit:      10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 7 || len(files) != 1 || files[0].FileID != "f1" {
+		t.Errorf("result: %d, %+v", total, files)
+	}
+	want := "ext=pdf&limit=10&match=glob&mime=application%2Fpdf%2Cimage%2F%2A&min_size=1024&offset=0&q=%2A.pdf&recursive=true"
+	if query != want {
+		t.Errorf("query %s, want %s", query, want)
+	}
+}
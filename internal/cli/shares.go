@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ShareLink 分享链接
+type ShareLink struct {
+	Token         string  `json:"token"`
+	URL           string  `json:"url"`
+	FileID        string  `json:"file_id"`
+	FolderID      *string `json:"folder_id"`
+	Status        string  `json:"status"`
+	ExpiresAt     string  `json:"expires_at"`
+	MaxDownloads  int64   `json:"max_downloads"`
+	DownloadCount int64   `json:"download_count"`
+	HasPassword   bool    `json:"has_password"`
+	Note          string  `json:"note"`
+	Type          string  `json:"type"`
+	MaxFiles      int64   `json:"max_files"`
+	MaxBytes      int64   `json:"max_bytes"`
+	UploadedFiles int64   `json:"uploaded_files"`
+	UploadedBytes int64   `json:"uploaded_bytes"`
+	CreatedAt     string  `json:"created_at"`
+	CreatedBy     string  `json:"created_by"`
+	// 以下统计字段仅在列表和详情接口中返回
+	Accesses           int64   `json:"accesses"`
+	CompletedDownloads int64   `json:"completed_downloads"`
+	BytesSent          int64   `json:"bytes_sent"`
+	LastAccessedAt     *string `json:"last_accessed_at"`
+}
+
+// ShareAccess 分享链接的一次访问记录
+type ShareAccess struct {
+	AccessedAt string `json:"accessed_at"`
+	IPAddress  string `json:"ip_address"`
+	UserAgent  string `json:"user_agent"`
+	StatusCode int    `json:"status_code"`
+	BytesSent  int64  `json:"bytes_sent"`
+	Completed  bool   `json:"completed"`
+}
+
+// ShareOptions 创建分享链接的参数，零值表示使用服务端默认
+type ShareOptions struct {
+	Type         string `json:"type,omitempty"`
+	ExpiresIn    string `json:"expires_in,omitempty"`
+	Password     string `json:"password,omitempty"`
+	MaxDownloads int64  `json:"max_downloads,omitempty"`
+	Note         string `json:"note,omitempty"`
+	MaxFiles     int64  `json:"max_files,omitempty"`
+	MaxBytes     int64  `json:"max_bytes,omitempty"`
+}
+
+// ShareUpdate 修改分享链接，nil 字段保持不变
+type ShareUpdate struct {
+	ExpiresIn    *string `json:"expires_in,omitempty"`
+	Password     *string `json:"password,omitempty"`
+	MaxDownloads *int64  `json:"max_downloads,omitempty"`
+	Note         *string `json:"note,omitempty"`
+	MaxFiles     *int64  `json:"max_files,omitempty"`
+	MaxBytes     *int64  `json:"max_bytes,omitempty"`
+}
+
+func (c *Client) CreateShare(fileID string, opts ShareOptions) (ShareLink, error) {
+	var link ShareLink
+	err := c.doJSON("POST", "/api/v1/files/"+fileID+"/share", opts, &link, "share")
+	return link, err
+}
+
+// CreateFolderShare 创建文件夹分享链接
+func (c *Client) CreateFolderShare(folderID string, opts ShareOptions) (ShareLink, error) {
+	var link ShareLink
+	err := c.doJSON("POST", "/api/v1/folders/"+url.PathEscape(folderID)+"/share", opts, &link, "share folder")
+	return link, err
+}
+
+func (c *Client) UpdateShare(token string, update ShareUpdate) (ShareLink, error) {
+	var link ShareLink
+	err := c.doJSON("PATCH", "/api/v1/shares/"+url.PathEscape(token), update, &link, "update share")
+	return link, err
+}
+
+// ListShares 列出分享链接，fileID 和 folderID 均为空时列出全部
+func (c *Client) ListShares(fileID, folderID, status string, limit, offset int) ([]ShareLink, int, error) {
+	query := url.Values{}
+	if folderID != "" {
+		query.Set("folder_id", folderID)
+	}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+	if status != "" {
+		query.Set("status", status)
+	}
+	path := "/api/v1/shares"
+	if fileID != "" {
+		path = "/api/v1/files/" + url.PathEscape(fileID) + "/shares"
+	}
+	var data struct {
+		Total  int         `json:"total"`
+		Shares []ShareLink `json:"shares"`
+	}
+	if err := c.doJSON("GET", path+"?"+query.Encode(), nil, &data, "list shares"); err != nil {
+		return nil, 0, err
+	}
+	return data.Shares, data.Total, nil
+}
+
+func (c *Client) GetShare(token string) (ShareLink, error) {
+	var link ShareLink
+	err := c.doJSON("GET", "/api/v1/shares/"+url.PathEscape(token), nil, &link, "get share")
+	return link, err
+}
+
+func (c *Client) ListShareAccesses(token string, limit int) ([]ShareAccess, int, error) {
+	var data struct {
+		Total    int           `json:"total"`
+		Accesses []ShareAccess `json:"accesses"`
+	}
+	path := "/api/v1/shares/" + url.PathEscape(token) + "/accesses?limit=" + strconv.Itoa(limit)
+	if err := c.doJSON("GET", path, nil, &data, "list share accesses"); err != nil {
+		return nil, 0, err
+	}
+	return data.Accesses, data.Total, nil
+}
+
+func (c *Client) RevokeShare(token string) error {
+	return c.doJSON("DELETE", "/api/v1/shares/"+url.PathEscape(token), nil, nil, "revoke share")
+}
+
+// parseShareToken 接受分享 token 或完整的 /s/<token> 链接
+func parseShareToken(value string) string {
+	value = strings.TrimSpace(value)
+	if index := strings.LastIndex(value, "/s/"); index >= 0 {
+		value = value[index+3:]
+	}
+	return strings.TrimSuffix(value, "/")
+}
@@ -0,0 +1,48 @@
+package cli
+
+import "net/url"
+
+// TrashItem 回收站中的文件或文件夹，Type 为 file 或 folder
+type TrashItem struct {
+	Type      string  `json:"type"`
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	ParentID  *string `json:"parent_id"`
+	Size      int64   `json:"size"`
+	DeletedAt string  `json:"deleted_at"`
+	DeletedBy string  `json:"deleted_by"`
+	PurgeAt   string  `json:"purge_at"`
+}
+
+func (c *Client) ListTrash() ([]TrashItem, error) {
+	var data struct {
+		Items []TrashItem `json:"items"`
+	}
+	if err := c.doJSON("GET", "/api/v1/trash", nil, &data, "list trash"); err != nil {
+		return nil, err
+	}
+	return data.Items, nil
+}
+
+func (c *Client) RestoreTrash(id string) error {
+	return c.doJSON("POST", "/api/v1/trash/"+url.PathEscape(id)+"/restore", nil, nil, "restore")
+}
+
+// PurgeTrash 彻底删除回收站中的一项，返回删除的文件数
+func (c *Client) PurgeTrash(id string) (int, error) {
+	var data struct {
+		PurgedFiles int `json:"purged_files"`
+	}
+	err := c.doJSON("DELETE", "/api/v1/trash/"+url.PathEscape(id), nil, &data, "purge")
+	return data.PurgedFiles, err
+}
+
+// EmptyTrash 清空回收站，返回删除的条目数和文件数
+func (c *Client) EmptyTrash() (int, int, error) {
+	var data struct {
+		PurgedItems int `json:"purged_items"`
+		PurgedFiles int `json:"purged_files"`
+	}
+	err := c.doJSON("DELETE", "/api/v1/trash", nil, &data, "empty trash")
+	return data.PurgedItems, data.PurgedFiles, err
+}
@@ -3,42 +3,121 @@ package config
 import (
 	"errors"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	Auth     AuthConfig     `yaml:"auth"`
-	Upload   UploadConfig   `yaml:"upload"`
-	Minio    MinioConfig    `yaml:"minio"`
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Auth      AuthConfig      `yaml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Upload    UploadConfig    `yaml:"upload"`
+	Trash     TrashConfig     `yaml:"trash"`
+	Audit     AuditConfig     `yaml:"audit"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Minio     MinioConfig     `yaml:"minio"`
 }
 
+// ServerConfig.TrustedProxies lists the proxies whose X-Forwarded-For is
+// believed for client IPs; empty trusts every peer.
 type ServerConfig struct {
-	Port           int    `yaml:"port"`
-	LogLevel       string `yaml:"log_level"`
-	PublicEndpoint string `yaml:"public_endpoint"`
+	Port           int      `yaml:"port"`
+	LogLevel       string   `yaml:"log_level"`
+	PublicEndpoint string   `yaml:"public_endpoint"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 type DatabaseConfig struct {
 	Path string `yaml:"path"`
 }
 
+// AuthConfig holds token settings. AdminUsername and AdminPassword only seed
+// the first admin account while the users table is empty.
 type AuthConfig struct {
 	JWTSecret         string `yaml:"jwt_secret"`
 	JWTExpireHours    int64  `yaml:"jwt_expire_hours"`
 	RefreshExpireDays int64  `yaml:"refresh_expire_days"`
 	AdminUsername     string `yaml:"admin_username"`
 	AdminPassword     string `yaml:"admin_password"`
-	LocalKey          string `yaml:"local_key"`
+	// LocalKey is the deprecated shared X-Local-Key. It is only accepted
+	// with LocalKeyEnabled; scoped API keys replace it.
+	LocalKey        string     `yaml:"local_key"`
+	LocalKeyEnabled bool       `yaml:"local_key_enabled"`
+	LocalKeyRole    string     `yaml:"local_key_role"`
+	OIDC            OIDCConfig `yaml:"oidc"`
+}
+
+// OIDCConfig enables single sign-on when Issuer is set. Users are matched by
+// UsernameClaim and get the highest role mapped from their GroupsClaim, or
+// DefaultRole; an empty DefaultRole refuses users without a mapped group.
+type OIDCConfig struct {
+	Issuer        string            `yaml:"issuer"`
+	ClientID      string            `yaml:"client_id"`
+	ClientSecret  string            `yaml:"client_secret"`
+	RedirectURL   string            `yaml:"redirect_url"`
+	Scopes        []string          `yaml:"scopes"`
+	UsernameClaim string            `yaml:"username_claim"`
+	GroupsClaim   string            `yaml:"groups_claim"`
+	RoleMapping   map[string]string `yaml:"role_mapping"`
+	DefaultRole   string            `yaml:"default_role"`
+}
+
+// RateLimitConfig throttles each route group per client IP and per
+// username, share token or API caller.
+type RateLimitConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Auth    RateLimitRule `yaml:"auth"`
+	Share   RateLimitRule `yaml:"share"`
+	API     RateLimitRule `yaml:"api"`
+}
+
+// RateLimitRule allows Requests per Per, in bursts of up to Burst (default
+// Requests). MaxFailures failed attempts in a row lock the IP or subject
+// out for Lockout. Requests 0 turns the limit off.
+type RateLimitRule struct {
+	Requests    int           `yaml:"requests"`
+	Per         time.Duration `yaml:"per"`
+	Burst       int           `yaml:"burst"`
+	MaxFailures int           `yaml:"max_failures"`
+	Lockout     time.Duration `yaml:"lockout"`
 }
 
 type UploadConfig struct {
 	MaxSizeMB int64 `yaml:"max_size_mb"`
 }
 
+// TrashConfig.RetentionDays is how long deleted files and folders stay in
+// the trash before they are purged; 0 keeps them until the trash is emptied.
+type TrashConfig struct {
+	RetentionDays int `yaml:"retention_days"`
+}
+
+// AuditConfig.RetentionDays is how long audit log entries are kept; 0 keeps
+// them forever. Every hour the head of the audit hash chain is signed with
+// CheckpointKey (auth.jwt_secret when empty) and appended to
+// CheckpointPath, which defaults to audit-checkpoints.ndjson next to the
+// database.
+type AuditConfig struct {
+	RetentionDays  int    `yaml:"retention_days"`
+	CheckpointPath string `yaml:"checkpoint_path"`
+	CheckpointKey  string `yaml:"checkpoint_key"`
+}
+
+const (
+	StorageDriverMinio      = "minio"
+	StorageDriverFilesystem = "filesystem"
+)
+
+type StorageConfig struct {
+	Driver string `yaml:"driver"`
+	Path   string `yaml:"path"`
+	Dedup  bool   `yaml:"dedup"`
+}
+
 type MinioConfig struct {
 	Endpoint  string `yaml:"endpoint"`
 	AccessKey string `yaml:"access_key"`
@@ -60,11 +139,59 @@ func Load(path string) (Config, error) {
 	if config.Auth.JWTSecret == "" {
 		return Config{}, errors.New("missing auth.jwt_secret")
 	}
-	if config.Auth.AdminPassword == "" {
-		return Config{}, errors.New("missing auth.admin_password")
+	if !validRole(config.Auth.LocalKeyRole) {
+		return Config{}, errors.New("unknown auth.local_key_role: " + config.Auth.LocalKeyRole)
+	}
+	if oidc := config.Auth.OIDC; oidc.Issuer != "" {
+		if oidc.ClientID == "" {
+			return Config{}, errors.New("missing auth.oidc.client_id")
+		}
+		for group, role := range oidc.RoleMapping {
+			if !validRole(role) {
+				return Config{}, errors.New("unknown role in auth.oidc.role_mapping." + group + ": " + role)
+			}
+		}
+		if oidc.DefaultRole != "" && !validRole(oidc.DefaultRole) {
+			return Config{}, errors.New("unknown auth.oidc.default_role: " + oidc.DefaultRole)
+		}
+	}
+	for name, rule := range map[string]*RateLimitRule{"auth": &config.RateLimit.Auth, "share": &config.RateLimit.Share, "api": &config.RateLimit.API} {
+		if rule.Requests < 0 || rule.Per < 0 || rule.Burst < 0 || rule.MaxFailures < 0 || rule.Lockout < 0 {
+			return Config{}, errors.New("negative value in rate_limit." + name)
+		}
+		if rule.Per == 0 {
+			rule.Per = time.Minute
+		}
+		if rule.Burst == 0 {
+			rule.Burst = rule.Requests
+		}
+		if rule.MaxFailures > 0 && rule.Lockout == 0 {
+			rule.Lockout = 15 * time.Minute
+		}
+	}
+	if config.Trash.RetentionDays < 0 {
+		return Config{}, errors.New("negative trash.retention_days")
+	}
+	if config.Audit.RetentionDays < 0 {
+		return Config{}, errors.New("negative audit.retention_days")
 	}
-	if config.Minio.Endpoint == "" || config.Minio.AccessKey == "" || config.Minio.SecretKey == "" {
-		return Config{}, errors.New("missing minio config")
+	if config.Audit.CheckpointPath == "" {
+		config.Audit.CheckpointPath = filepath.Join(filepath.Dir(config.Database.Path), "audit-checkpoints.ndjson")
+	}
+	if config.Audit.CheckpointKey == "" {
+		config.Audit.CheckpointKey = config.Auth.JWTSecret
+	}
+	switch config.Storage.Driver {
+	case StorageDriverMinio:
+		if config.Minio.Endpoint == "" || config.Minio.AccessKey == "" || config.Minio.SecretKey == "" {
+			return Config{}, errors.New("missing minio config")
+		}
+	case StorageDriverFilesystem:
+		if config.Storage.Path == "" {
+			return Config{}, errors.New("missing storage.path")
+		}
+	default:
+		return Config{}, errors.New("unknown storage.driver: " + config.Storage.Driver)
 	}
 	if config.Minio.Bucket == "" {
 		config.Minio.Bucket = "filehub"
@@ -85,10 +212,32 @@ func defaultConfig() Config {
 			JWTExpireHours:    24,
 			RefreshExpireDays: 7,
 			AdminUsername:     "admin",
+			LocalKeyRole:      "admin",
+			OIDC: OIDCConfig{
+				Scopes:        []string{"openid", "email", "profile"},
+				UsernameClaim: "email",
+				GroupsClaim:   "groups",
+				DefaultRole:   "viewer",
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Auth:    RateLimitRule{Requests: 20, Per: time.Minute, MaxFailures: 5, Lockout: 15 * time.Minute},
+			Share:   RateLimitRule{Requests: 60, Per: time.Minute, MaxFailures: 10, Lockout: 15 * time.Minute},
 		},
 		Upload: UploadConfig{
 			MaxSizeMB: 1024,
 		},
+		Trash: TrashConfig{
+			RetentionDays: 30,
+		},
+		Audit: AuditConfig{
+			RetentionDays: 365,
+		},
+		Storage: StorageConfig{
+			Driver: StorageDriverMinio,
+			Path:   "./data/objects",
+		},
 		Minio: MinioConfig{
 			Bucket: "filehub",
 			UseSSL: false,
@@ -138,9 +287,51 @@ func overrideWithEnv(config *Config) {
 	if value := os.Getenv("FILEHUB_AUTH_LOCAL_KEY"); value != "" {
 		config.Auth.LocalKey = value
 	}
+	if value := os.Getenv("FILEHUB_AUTH_LOCAL_KEY_ENABLED"); value != "" {
+		config.Auth.LocalKeyEnabled = parseBool(value, config.Auth.LocalKeyEnabled)
+	}
+	if value := os.Getenv("FILEHUB_AUTH_LOCAL_KEY_ROLE"); value != "" {
+		config.Auth.LocalKeyRole = value
+	}
+	if value := os.Getenv("FILEHUB_AUTH_OIDC_ISSUER"); value != "" {
+		config.Auth.OIDC.Issuer = value
+	}
+	if value := os.Getenv("FILEHUB_AUTH_OIDC_CLIENT_ID"); value != "" {
+		config.Auth.OIDC.ClientID = value
+	}
+	if value := os.Getenv("FILEHUB_AUTH_OIDC_CLIENT_SECRET"); value != "" {
+		config.Auth.OIDC.ClientSecret = value
+	}
+	if value := os.Getenv("FILEHUB_AUTH_OIDC_REDIRECT_URL"); value != "" {
+		config.Auth.OIDC.RedirectURL = value
+	}
+	if value := os.Getenv("FILEHUB_RATE_LIMIT_ENABLED"); value != "" {
+		config.RateLimit.Enabled = parseBool(value, config.RateLimit.Enabled)
+	}
 	if value := os.Getenv("FILEHUB_UPLOAD_MAX_SIZE_MB"); value != "" {
 		config.Upload.MaxSizeMB = parseInt64(value, config.Upload.MaxSizeMB)
 	}
+	if value := os.Getenv("FILEHUB_TRASH_RETENTION_DAYS"); value != "" {
+		config.Trash.RetentionDays = parseInt(value, config.Trash.RetentionDays)
+	}
+	if value := os.Getenv("FILEHUB_AUDIT_RETENTION_DAYS"); value != "" {
+		config.Audit.RetentionDays = parseInt(value, config.Audit.RetentionDays)
+	}
+	if value := os.Getenv("FILEHUB_AUDIT_CHECKPOINT_PATH"); value != "" {
+		config.Audit.CheckpointPath = value
+	}
+	if value := os.Getenv("FILEHUB_AUDIT_CHECKPOINT_KEY"); value != "" {
+		config.Audit.CheckpointKey = value
+	}
+	if value := os.Getenv("FILEHUB_STORAGE_DRIVER"); value != "" {
+		config.Storage.Driver = value
+	}
+	if value := os.Getenv("FILEHUB_STORAGE_PATH"); value != "" {
+		config.Storage.Path = value
+	}
+	if value := os.Getenv("FILEHUB_STORAGE_DEDUP"); value != "" {
+		config.Storage.Dedup = parseBool(value, config.Storage.Dedup)
+	}
 	if value := os.Getenv("FILEHUB_MINIO_ENDPOINT"); value != "" {
 		config.Minio.Endpoint = value
 	}
@@ -161,6 +352,14 @@ func overrideWithEnv(config *Config) {
 	}
 }
 
+func validRole(role string) bool {
+	switch role {
+	case "admin", "editor", "uploader", "viewer":
+		return true
+	}
+	return false
+}
+
 func parseInt(value string, fallback int) int {
 	parsed, err := strconv.Atoi(value)
 	if err != nil {
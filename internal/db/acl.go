@@ -0,0 +1,197 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// FolderACL grants one user or role an access level on a folder and, unless
+// overridden further down, on everything below it.
+type FolderACL struct {
+	FolderID      string
+	PrincipalType string
+	PrincipalID   string
+	Access        string
+	CreatedBy     string
+	CreatedAt     string
+}
+
+// ACLCaller is who folder ACLs are resolved for. IgnoreACLs skips the
+// entries, as for admins; Folder, when set, confines the caller to that
+// folder's tree.
+type ACLCaller struct {
+	UserID     string
+	Role       string
+	IgnoreACLs bool
+	Folder     *string
+}
+
+// aclRank orders access levels from none (0) to manage (3).
+const aclRank = `CASE a.access WHEN 'read' THEN 1 WHEN 'write' THEN 2 WHEN 'manage' THEN 3 ELSE 0 END`
+
+// folderRankCTE defines ranks(folder_id, rank): the caller's access rank on
+// each folder chosen by seed, found by walking the folder's ancestor chain.
+// The nearest folder with an entry matching the caller decides, a user
+// entry winning over a role entry on the same folder. A chain with entries
+// but no match gives none; a chain without entries is unrestricted
+// (manage). Its parameters are those of seed, then the user ID and role.
+func folderRankCTE(seed string) string {
+	return `
+    WITH RECURSIVE chain(folder_id, ancestor_id, depth) AS (
+      SELECT folder_id, folder_id, 0 FROM folders WHERE ` + seed + `
+      UNION ALL
+      SELECT chain.folder_id, f.parent_id, chain.depth + 1
+      FROM chain JOIN folders f ON f.folder_id = chain.ancestor_id
+      WHERE f.parent_id IS NOT NULL AND chain.depth < 64
+    ),
+    matches(folder_id, depth, rank) AS (
+      SELECT chain.folder_id, chain.depth, COALESCE(
+        MAX(CASE WHEN a.principal_type = 'user' AND a.principal_id = ? THEN ` + aclRank + ` END),
+        MAX(CASE WHEN a.principal_type = 'role' AND a.principal_id = ? THEN ` + aclRank + ` END))
+      FROM chain JOIN folder_acls a ON a.folder_id = chain.ancestor_id
+      GROUP BY chain.folder_id, chain.depth
+    ),
+    ranks(folder_id, rank) AS (
+      SELECT c.folder_id, COALESCE(
+        (SELECT m.rank FROM matches m WHERE m.folder_id = c.folder_id AND m.rank IS NOT NULL ORDER BY m.depth LIMIT 1),
+        CASE WHEN EXISTS (SELECT 1 FROM matches m WHERE m.folder_id = c.folder_id) THEN 0 ELSE 3 END)
+      FROM chain c WHERE c.depth = 0
+    )`
+}
+
+// folderTreeCTE defines tree(folder_id): the given folder and every folder
+// beneath it, trashed ones included.
+const folderTreeCTE = `
+    WITH RECURSIVE tree(folder_id) AS (
+      SELECT ?
+      UNION
+      SELECT f.folder_id FROM folders f JOIN tree t ON f.parent_id = t.folder_id
+    )`
+
+// hiddenFolders returns a query selecting the folders the caller cannot
+// read, or an empty query when there are none.
+func (c ACLCaller) hiddenFolders() (string, []interface{}) {
+	queries := []string{}
+	args := []interface{}{}
+	if c.Folder != nil {
+		queries = append(queries, `SELECT folder_id FROM folders WHERE folder_id NOT IN (`+folderTreeCTE+` SELECT folder_id FROM tree)`)
+		args = append(args, *c.Folder)
+	}
+	if !c.IgnoreACLs {
+		queries = append(queries, `SELECT folder_id FROM (`+folderRankCTE("1 = 1")+` SELECT folder_id FROM ranks WHERE rank < 1)`)
+		args = append(args, c.UserID, c.Role)
+	}
+	return strings.Join(queries, " UNION "), args
+}
+
+// HasFolderACLs reports whether any folder has ACL entries.
+func (db *DB) HasFolderACLs(ctx context.Context) (bool, error) {
+	var exists bool
+	err := db.sql.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM folder_acls)`).Scan(&exists)
+	return exists, err
+}
+
+// FolderACLRank returns the rank, from none (0) to manage (3), that the
+// ACL entries on folderID and its ancestors give userID with role. Unknown
+// folders are unrestricted.
+func (db *DB) FolderACLRank(ctx context.Context, folderID, userID, role string) (int, error) {
+	var rank int
+	err := db.sql.QueryRowContext(ctx, folderRankCTE("folder_id = ?")+` SELECT rank FROM ranks`, folderID, userID, role).Scan(&rank)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 3, nil
+	}
+	return rank, err
+}
+
+const folderACLColumns = `folder_id, principal_type, principal_id, access, created_by, created_at`
+
+func scanFolderACL(row rowScanner) (FolderACL, error) {
+	var entry FolderACL
+	if err := row.Scan(
+		&entry.FolderID,
+		&entry.PrincipalType,
+		&entry.PrincipalID,
+		&entry.Access,
+		&entry.CreatedBy,
+		&entry.CreatedAt,
+	); err != nil {
+		return FolderACL{}, err
+	}
+	return entry, nil
+}
+
+// ListFolderACLs returns the entries of folderID, or of every folder when
+// folderID is empty.
+func (db *DB) ListFolderACLs(ctx context.Context, folderID string) ([]FolderACL, error) {
+	query := `SELECT ` + folderACLColumns + ` FROM folder_acls`
+	args := []interface{}{}
+	if folderID != "" {
+		query += ` WHERE folder_id = ?`
+		args = append(args, folderID)
+	}
+	rows, err := db.sql.QueryContext(ctx, query+` ORDER BY folder_id, principal_type, principal_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]FolderACL, 0)
+	for rows.Next() {
+		entry, err := scanFolderACL(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// ReplaceFolderACL swaps the explicit entries of a folder in one transaction.
+func (db *DB) ReplaceFolderACL(ctx context.Context, folderID string, entries []FolderACL) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM folder_acls WHERE folder_id = ?`, folderID); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO folder_acls (`+folderACLColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+			folderID,
+			entry.PrincipalType,
+			entry.PrincipalID,
+			entry.Access,
+			entry.CreatedBy,
+			entry.CreatedAt,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListFolderParents maps every folder to its parent (nil at the root level).
+func (db *DB) ListFolderParents(ctx context.Context) (map[string]*string, error) {
+	rows, err := db.sql.QueryContext(ctx, `SELECT folder_id, parent_id FROM folders`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := map[string]*string{}
+	for rows.Next() {
+		var folderID string
+		var parentID *string
+		if err := rows.Scan(&folderID, &parentID); err != nil {
+			return nil, err
+		}
+		parents[folderID] = parentID
+	}
+	return parents, rows.Err()
+}
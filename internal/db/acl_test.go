@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// setACL replaces the entries of folderID; each entry is a principal type,
+// principal ID and access level.
+func setACL(t *testing.T, db *DB, folderID string, entries ...[3]string) {
+	t.Helper()
+	acl := make([]FolderACL, 0, len(entries))
+	for _, entry := range entries {
+		acl = append(acl, FolderACL{PrincipalType: entry[0], PrincipalID: entry[1], Access: entry[2], CreatedBy: "test", CreatedAt: NowRFC3339()})
+	}
+	if err := db.ReplaceFolderACL(context.Background(), folderID, acl); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFolderACLRank(t *testing.T) {
+	ctx := context.Background()
+	// docs/reports/2024 and photos, with entries on docs and reports.
+	db := newFolderTree(t)
+	setACL(t, db, "docs", [3]string{"role", "editor", "write"}, [3]string{"user", "u_bob", "read"})
+	setACL(t, db, "reports", [3]string{"user", "u_alice", "manage"}, [3]string{"role", "editor", "none"})
+
+	tests := []struct {
+		name     string
+		folderID string
+		userID   string
+		role     string
+		want     int
+	}{
+		{"role entry", "docs", "u_alice", "editor", 2},
+		{"user entry wins over role entry", "docs", "u_bob", "editor", 1},
+		{"nearest entry wins", "reports", "u_bob", "editor", 0},
+		{"user entry on a nearer folder", "reports", "u_alice", "editor", 3},
+		{"inherited from two levels up", "2024", "u_alice", "editor", 3},
+		{"inherited past a folder without a match", "2024", "u_bob", "viewer", 1},
+		{"no match below entries", "2024", "u_carol", "viewer", 0},
+		{"unrestricted folder", "photos", "u_carol", "viewer", 3},
+		{"unknown folder", "missing", "u_carol", "viewer", 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rank, err := db.FolderACLRank(ctx, test.folderID, test.userID, test.role)
+			if err != nil || rank != test.want {
+				t.Errorf("rank = %d, %v, want %d", rank, err, test.want)
+			}
+		})
+	}
+
+	if exists, err := db.HasFolderACLs(ctx); err != nil || !exists {
+		t.Errorf("HasFolderACLs = %v, %v", exists, err)
+	}
+	if exists, err := newTestDB(t).HasFolderACLs(ctx); err != nil || exists {
+		t.Errorf("HasFolderACLs without entries = %v, %v", exists, err)
+	}
+}
+
+func TestVisibilityHidesFolders(t *testing.T) {
+	ctx := context.Background()
+	db := newFolderTree(t)
+	setACL(t, db, "reports", [3]string{"role", "editor", "read"})
+
+	tests := []struct {
+		name   string
+		hidden Visibility
+		want   []string
+	}{
+		{"nothing hidden", Visibility{}, []string{"f1", "f2", "f3"}},
+		{"acl", Visibility{Caller: &ACLCaller{UserID: "u_carol", Role: "viewer"}}, []string{"f1", "f3"}},
+		{"acl grants", Visibility{Caller: &ACLCaller{UserID: "u_alice", Role: "editor"}}, []string{"f1", "f2", "f3"}},
+		{"acls ignored", Visibility{Caller: &ACLCaller{Role: "viewer", IgnoreACLs: true}}, []string{"f1", "f2", "f3"}},
+		{"folder restriction", Visibility{Root: true, Caller: &ACLCaller{IgnoreACLs: true, Folder: ptr("reports")}}, []string{"f2"}},
+		{"folder restriction and acl", Visibility{Root: true, Caller: &ACLCaller{Role: "viewer", Folder: ptr("docs")}}, []string{"f1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records, total, err := db.ListFiles(ctx, 100, 0, "asc", "", nil, test.hidden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, record := range records {
+				got = append(got, record.FileID)
+			}
+			sort.Strings(got)
+			if total != len(test.want) || !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v (total %d), want %v", got, total, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// APIKey lets scripts and agents call the API as their owner, limited to
+// Scopes and, when FolderID is set, to one folder tree.
+type APIKey struct {
+	KeyID   string
+	Name    string
+	KeyHash string
+	// Prefix is the start of the plaintext key, shown in listings.
+	Prefix     string
+	OwnerID    string
+	Scopes     []string
+	FolderID   *string
+	ExpiresAt  *string
+	LastUsedAt *string
+	RevokedAt  *string
+	CreatedBy  string
+	CreatedAt  string
+}
+
+const apiKeyColumns = `key_id, name, key_hash, prefix, owner_id, scopes, folder_id, expires_at, last_used_at, revoked_at, created_by, created_at`
+
+func scanAPIKey(row rowScanner) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	var folderID, expiresAt, lastUsedAt, revokedAt sql.NullString
+	if err := row.Scan(
+		&key.KeyID,
+		&key.Name,
+		&key.KeyHash,
+		&key.Prefix,
+		&key.OwnerID,
+		&scopes,
+		&folderID,
+		&expiresAt,
+		&lastUsedAt,
+		&revokedAt,
+		&key.CreatedBy,
+		&key.CreatedAt,
+	); err != nil {
+		return APIKey{}, err
+	}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	key.FolderID = nullStringPtr(folderID)
+	key.ExpiresAt = nullStringPtr(expiresAt)
+	key.LastUsedAt = nullStringPtr(lastUsedAt)
+	key.RevokedAt = nullStringPtr(revokedAt)
+	return key, nil
+}
+
+func (db *DB) CreateAPIKey(ctx context.Context, key APIKey) error {
+	_, err := db.sql.ExecContext(
+		ctx,
+		`INSERT INTO api_keys (key_id, name, key_hash, prefix, owner_id, scopes, folder_id, expires_at, created_by, created_at)
+     VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.KeyID,
+		key.Name,
+		key.KeyHash,
+		key.Prefix,
+		key.OwnerID,
+		strings.Join(key.Scopes, ","),
+		key.FolderID,
+		key.ExpiresAt,
+		key.CreatedBy,
+		key.CreatedAt,
+	)
+	return err
+}
+
+func (db *DB) GetAPIKey(ctx context.Context, keyID string) (APIKey, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_id = ?`, keyID)
+	return scanAPIKey(row)
+}
+
+func (db *DB) GetAPIKeyByName(ctx context.Context, name string) (APIKey, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE name = ?`, name)
+	return scanAPIKey(row)
+}
+
+func (db *DB) GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ?`, keyHash)
+	return scanAPIKey(row)
+}
+
+// ListAPIKeys returns the keys of ownerID, or every key when ownerID is
+// empty, newest first.
+func (db *DB) ListAPIKeys(ctx context.Context, ownerID string) ([]APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys`
+	args := []interface{}{}
+	if ownerID != "" {
+		query += ` WHERE owner_id = ?`
+		args = append(args, ownerID)
+	}
+	rows, err := db.sql.QueryContext(ctx, query+` ORDER BY created_at DESC, name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (db *DB) RevokeAPIKey(ctx context.Context, keyID string) error {
+	result, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE api_keys SET revoked_at = ? WHERE key_id = ? AND revoked_at IS NULL`,
+		NowRFC3339(),
+		keyID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// TouchAPIKey records a use of the key, writing at most once per minute.
+func (db *DB) TouchAPIKey(ctx context.Context, keyID, now, staleBefore string) error {
+	_, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE api_keys SET last_used_at = ? WHERE key_id = ? AND (last_used_at IS NULL OR last_used_at < ?)`,
+		now,
+		keyID,
+		staleBefore,
+	)
+	return err
+}
@@ -0,0 +1,279 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// AuditLog is one audit entry. Entries form a hash chain: PrevHash is the
+// Hash of the entry before, and Hash covers PrevHash and every other field,
+// so editing, removing or reordering rows breaks the chain.
+type AuditLog struct {
+	ID        int64
+	Action    string
+	FileID    string
+	Actor     string
+	IPAddress string
+	Status    string
+	Message   string
+	CreatedAt string
+	PrevHash  string
+	Hash      string
+}
+
+// AuditHash computes the chain hash of entry on top of prevHash. The fields
+// are encoded as a JSON array so no value can run into the next.
+func AuditHash(prevHash string, entry AuditLog) string {
+	data, _ := json.Marshal([]interface{}{
+		prevHash,
+		entry.ID,
+		entry.CreatedAt,
+		entry.Action,
+		entry.Actor,
+		entry.FileID,
+		entry.IPAddress,
+		entry.Status,
+		entry.Message,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditFilter narrows ListAuditLogs. Since and Until are RFC3339 bounds on
+// created_at, Since inclusive. Before is a cursor: only rows with a smaller
+// ID are returned.
+type AuditFilter struct {
+	Action    string
+	Actor     string
+	FileID    string
+	IPAddress string
+	Status    string
+	Since     string
+	Until     string
+	Before    int64
+	Limit     int
+}
+
+const auditColumns = `id, action, file_id, actor, ip_address, status, message, created_at, prev_hash, hash`
+
+func scanAuditLog(row rowScanner) (AuditLog, error) {
+	var entry AuditLog
+	var fileID, ipAddress, status, message sql.NullString
+	if err := row.Scan(
+		&entry.ID,
+		&entry.Action,
+		&fileID,
+		&entry.Actor,
+		&ipAddress,
+		&status,
+		&message,
+		&entry.CreatedAt,
+		&entry.PrevHash,
+		&entry.Hash,
+	); err != nil {
+		return AuditLog{}, err
+	}
+	entry.FileID = fileID.String
+	entry.IPAddress = ipAddress.String
+	entry.Status = status.String
+	entry.Message = message.String
+	return entry, nil
+}
+
+// AddAuditLog appends an entry to the audit log. It is the only way rows are
+// written, so it is what keeps the hash chain intact.
+func (db *DB) AddAuditLog(ctx context.Context, action, fileID, actor, ipAddress, status, message string) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	entry := AuditLog{
+		Action:    action,
+		FileID:    fileID,
+		Actor:     actor,
+		IPAddress: ipAddress,
+		Status:    status,
+		Message:   message,
+		CreatedAt: NowRFC3339(),
+	}
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_logs ORDER BY id DESC LIMIT 1`).Scan(&entry.PrevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO audit_logs (action, file_id, actor, ip_address, status, message, created_at, prev_hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Action,
+		entry.FileID,
+		entry.Actor,
+		entry.IPAddress,
+		entry.Status,
+		entry.Message,
+		entry.CreatedAt,
+		entry.PrevHash,
+	)
+	if err != nil {
+		return err
+	}
+	// The ID is part of the hash, so it is only known after the insert.
+	if entry.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE audit_logs SET hash = ? WHERE id = ?`, AuditHash(entry.PrevHash, entry), entry.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListAuditLogs returns the entries matching filter, newest first.
+func (db *DB) ListAuditLogs(ctx context.Context, filter AuditFilter) ([]AuditLog, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	for column, value := range map[string]string{
+		"action":     filter.Action,
+		"actor":      filter.Actor,
+		"file_id":    filter.FileID,
+		"ip_address": filter.IPAddress,
+		"status":     filter.Status,
+	} {
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if filter.Since != "" {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if filter.Until != "" {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until)
+	}
+	if filter.Before > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.Before)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := db.sql.QueryContext(ctx, `SELECT `+auditColumns+` FROM audit_logs`+where+` ORDER BY id DESC LIMIT ?`, append(args, filter.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]AuditLog, 0)
+	for rows.Next() {
+		entry, err := scanAuditLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// AuditHead returns the newest audit entry, the head of the chain.
+func (db *DB) AuditHead(ctx context.Context) (AuditLog, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+auditColumns+` FROM audit_logs ORDER BY id DESC LIMIT 1`)
+	return scanAuditLog(row)
+}
+
+// WalkAuditLogs calls fn for every audit entry, oldest first. fn must not
+// use the database: the walk holds the only connection.
+func (db *DB) WalkAuditLogs(ctx context.Context, fn func(entry AuditLog) error) error {
+	rows, err := db.sql.QueryContext(ctx, `SELECT `+auditColumns+` FROM audit_logs ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		entry, err := scanAuditLog(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// AuditAnchor is left behind by a retention purge: LastID and Hash are the
+// last entry it deleted, which the oldest remaining entry chains onto.
+// Signature is computed by the service with audit.checkpoint_key.
+type AuditAnchor struct {
+	ID        int64
+	LastID    int64
+	Hash      string
+	CreatedAt string
+	Signature string
+}
+
+// LastAuditLogBefore returns the newest entry written before before, leaving
+// out the newest entry overall, which a purge always keeps so the chain
+// continues from it.
+func (db *DB) LastAuditLogBefore(ctx context.Context, before string) (AuditLog, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+auditColumns+` FROM audit_logs
+    WHERE created_at < ? AND id < (SELECT MAX(id) FROM audit_logs)
+    ORDER BY id DESC LIMIT 1`, before)
+	return scanAuditLog(row)
+}
+
+// PurgeAuditLogs deletes the entries up to anchor.LastID and stores anchor in
+// the same transaction.
+func (db *DB) PurgeAuditLogs(ctx context.Context, anchor AuditAnchor) (int64, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM audit_logs WHERE id <= ?`, anchor.LastID)
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO audit_anchors (last_id, hash, created_at, signature) VALUES (?, ?, ?, ?)`,
+		anchor.LastID,
+		anchor.Hash,
+		anchor.CreatedAt,
+		anchor.Signature,
+	); err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+// ListAuditAnchors returns every purge anchor, oldest purge first.
+func (db *DB) ListAuditAnchors(ctx context.Context) ([]AuditAnchor, error) {
+	rows, err := db.sql.QueryContext(ctx, `SELECT id, last_id, hash, created_at, signature FROM audit_anchors ORDER BY last_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anchors := make([]AuditAnchor, 0)
+	for rows.Next() {
+		var anchor AuditAnchor
+		if err := rows.Scan(&anchor.ID, &anchor.LastID, &anchor.Hash, &anchor.CreatedAt, &anchor.Signature); err != nil {
+			return nil, err
+		}
+		anchors = append(anchors, anchor)
+	}
+	return anchors, rows.Err()
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// addAuditEntries writes entries with IDs 1 to 5 and fixed timestamps.
+func addAuditEntries(t *testing.T, db *DB) {
+	t.Helper()
+	entries := []struct {
+		action, actor, ip, status, createdAt string
+	}{
+		{"login", "alice", "10.0.0.1", "success", "2026-01-01T00:00:00Z"},
+		{"upload", "alice", "10.0.0.1", "success", "2026-01-02T00:00:00Z"},
+		{"login", "bob", "10.0.0.2", "failure", "2026-01-03T00:00:00Z"},
+		{"download", "bob", "10.0.0.2", "success", "2026-01-04T00:00:00Z"},
+		{"login", "alice", "10.0.0.3", "failure", "2026-01-05T00:00:00Z"},
+	}
+	for _, entry := range entries {
+		if _, err := db.sql.Exec(
+			`INSERT INTO audit_logs (action, file_id, actor, ip_address, status, message, created_at) VALUES (?, '', ?, ?, ?, '', ?)`,
+			entry.action, entry.actor, entry.ip, entry.status, entry.createdAt,
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func auditIDs(entries []AuditLog) []int64 {
+	ids := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func TestListAuditLogs(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	addAuditEntries(t, db)
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   []int64
+	}{
+		{"everything newest first", AuditFilter{}, []int64{5, 4, 3, 2, 1}},
+		{"action", AuditFilter{Action: "login"}, []int64{5, 3, 1}},
+		{"action and status", AuditFilter{Action: "login", Status: "failure"}, []int64{5, 3}},
+		{"actor", AuditFilter{Actor: "bob"}, []int64{4, 3}},
+		{"ip", AuditFilter{IPAddress: "10.0.0.1"}, []int64{2, 1}},
+		{"since is inclusive", AuditFilter{Since: "2026-01-04T00:00:00Z"}, []int64{5, 4}},
+		{"until is exclusive", AuditFilter{Until: "2026-01-02T00:00:00Z"}, []int64{1}},
+		{"time range", AuditFilter{Since: "2026-01-02T00:00:00Z", Until: "2026-01-04T00:00:00Z"}, []int64{3, 2}},
+		{"cursor", AuditFilter{Before: 3}, []int64{2, 1}},
+		{"limit", AuditFilter{Limit: 2}, []int64{5, 4}},
+		{"no match", AuditFilter{Actor: "carol"}, []int64{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter := test.filter
+			if filter.Limit == 0 {
+				filter.Limit = 100
+			}
+			entries, err := db.ListAuditLogs(ctx, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := auditIDs(entries); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPurgeAuditLogs(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	addAuditEntries(t, db)
+
+	for before, want := range map[string]int64{
+		"2000-01-01T00:00:00Z": 0,
+		"2026-01-03T00:00:00Z": 2,
+		// The newest entry is never purged.
+		"2030-01-01T00:00:00Z": 4,
+	} {
+		last, err := db.LastAuditLogBefore(ctx, before)
+		if want == 0 && !errors.Is(err, sql.ErrNoRows) || want != 0 && (err != nil || last.ID != want) {
+			t.Errorf("last entry before %s: %d, %v; want %d", before, last.ID, err, want)
+		}
+	}
+
+	anchor := AuditAnchor{LastID: 2, Hash: "hash-2", CreatedAt: NowRFC3339(), Signature: "signature"}
+	if count, err := db.PurgeAuditLogs(ctx, anchor); err != nil || count != 2 {
+		t.Fatalf("purged %d, %v", count, err)
+	}
+	entries, err := db.ListAuditLogs(ctx, AuditFilter{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := auditIDs(entries); !reflect.DeepEqual(got, []int64{5, 4, 3}) {
+		t.Errorf("left %v", got)
+	}
+	anchors, err := db.ListAuditAnchors(ctx)
+	if err != nil || len(anchors) != 1 || anchors[0].LastID != 2 || anchors[0].Hash != "hash-2" || anchors[0].Signature != "signature" {
+		t.Errorf("anchors: %+v, %v", anchors, err)
+	}
+}
+
+// checkAuditChain checks that the audit log holds count entries, each
+// chained onto the one before.
+func checkAuditChain(t *testing.T, db *DB, count int) {
+	t.Helper()
+	prevHash := ""
+	seen := 0
+	err := db.WalkAuditLogs(context.Background(), func(entry AuditLog) error {
+		if entry.PrevHash != prevHash || entry.Hash != AuditHash(prevHash, entry) {
+			t.Errorf("entry %d is not chained: %+v", entry.ID, entry)
+		}
+		prevHash = entry.Hash
+		seen++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != count {
+		t.Errorf("%d entries, want %d", seen, count)
+	}
+}
+
+func TestAddAuditLogChains(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	for _, action := range []string{"login", "upload", "download"} {
+		if err := db.AddAuditLog(ctx, action, "f1", "alice", "10.0.0.1", "success", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkAuditChain(t, db, 3)
+
+	head, err := db.AuditHead(ctx)
+	if err != nil || head.ID != 3 || head.Action != "download" {
+		t.Fatalf("head: %+v, %v", head, err)
+	}
+	tests := []struct {
+		name   string
+		change func(entry *AuditLog)
+	}{
+		{"actor", func(entry *AuditLog) { entry.Actor = "mallory" }},
+		{"id", func(entry *AuditLog) { entry.ID++ }},
+		{"created_at", func(entry *AuditLog) { entry.CreatedAt = "2000-01-01T00:00:00Z" }},
+		{"field boundary", func(entry *AuditLog) { entry.Action, entry.Actor = entry.Action+"alice", "" }},
+	}
+	for _, test := range tests {
+		entry := head
+		test.change(&entry)
+		if AuditHash(head.PrevHash, entry) == head.Hash {
+			t.Errorf("changing %s keeps the hash", test.name)
+		}
+	}
+}
@@ -4,11 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// driverName is go-sqlite3 with a REGEXP function, which SQLite leaves to
+// the application.
+const driverName = "sqlite3_filehub"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("regexp", matchRegexp, true)
+		},
+	})
+}
+
 type DB struct {
 	sql *sql.DB
 }
@@ -19,156 +32,233 @@ type FileRecord struct {
 	ObjectKey    string
 	Size         int64
 	MimeType     string
-	CreatedBy    string
-	CreatedAt    string
-	UpdatedAt    string
+	SHA256       string
+	MD5          string
+	FolderID     *string
+	// Version is the current version; the content fields above are a
+	// copy of it.
+	Version   int
+	CreatedBy string
+	CreatedAt string
+	UpdatedAt string
+	// DeletedAt is set while the file is in the trash.
+	DeletedAt *string
+	DeletedBy string
 }
 
-type RefreshToken struct {
-	Token     string
-	ExpiresAt string
-	IsRevoked bool
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+const fileColumns = `file_id, original_name, object_key, size, mime_type, sha256, md5, folder_id, version, created_by, created_at, updated_at, deleted_at, deleted_by`
+
+func scanFile(row rowScanner) (FileRecord, error) {
+	var record FileRecord
+	var sha256, md5, folderID, deletedAt sql.NullString
+	if err := row.Scan(
+		&record.FileID,
+		&record.OriginalName,
+		&record.ObjectKey,
+		&record.Size,
+		&record.MimeType,
+		&sha256,
+		&md5,
+		&folderID,
+		&record.Version,
+		&record.CreatedBy,
+		&record.CreatedAt,
+		&record.UpdatedAt,
+		&deletedAt,
+		&record.DeletedBy,
+	); err != nil {
+		return FileRecord{}, err
+	}
+	record.SHA256 = sha256.String
+	record.MD5 = md5.String
+	record.FolderID = nullStringPtr(folderID)
+	record.DeletedAt = nullStringPtr(deletedAt)
+	return record, nil
 }
 
-type ShareLink struct {
+type RefreshToken struct {
 	Token     string
-	FileID    string
+	UserID    string
+	SessionID string
 	ExpiresAt string
-	CreatedAt string
-	CreatedBy string
-	Status    string
+	IsRevoked bool
 }
 
+// Open connects to the database and applies any pending schema migrations.
+// It refuses to start against a database written by a newer binary.
 func Open(path string) (*DB, error) {
-	handle, err := sql.Open("sqlite3", path)
+	db, err := Connect(path)
 	if err != nil {
 		return nil, err
 	}
-	handle.SetMaxOpenConns(1)
-	db := &DB{sql: handle}
-	if err := db.migrate(); err != nil {
+	if _, err := db.MigrateUp(context.Background()); err != nil {
+		db.Close()
 		return nil, err
 	}
 	return db, nil
 }
 
-func (db *DB) migrate() error {
-	statements := []string{
-		`CREATE TABLE IF NOT EXISTS files (
-      id INTEGER PRIMARY KEY AUTOINCREMENT,
-      file_id VARCHAR(12) UNIQUE NOT NULL,
-      original_name VARCHAR(255) NOT NULL,
-      object_key VARCHAR(512) NOT NULL,
-      size BIGINT NOT NULL,
-      mime_type VARCHAR(100),
-      created_by VARCHAR(64) NOT NULL,
-      created_at DATETIME NOT NULL,
-      updated_at DATETIME NOT NULL,
-      metadata JSON
-    );`,
-		`CREATE TABLE IF NOT EXISTS refresh_tokens (
-      id INTEGER PRIMARY KEY AUTOINCREMENT,
-      token VARCHAR(128) UNIQUE NOT NULL,
-      expires_at DATETIME NOT NULL,
-      is_revoked BOOLEAN DEFAULT FALSE,
-      created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-    );`,
-		`CREATE TABLE IF NOT EXISTS audit_logs (
-      id INTEGER PRIMARY KEY AUTOINCREMENT,
-      action VARCHAR(50) NOT NULL,
-      file_id VARCHAR(32),
-      actor VARCHAR(64) NOT NULL,
-      ip_address VARCHAR(45),
-      status VARCHAR(20),
-      message TEXT,
-      created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-    );`,
-		`CREATE TABLE IF NOT EXISTS share_links (
-      id INTEGER PRIMARY KEY AUTOINCREMENT,
-      token VARCHAR(64) UNIQUE NOT NULL,
-      file_id VARCHAR(32) NOT NULL,
-      expires_at DATETIME NOT NULL,
-      created_at DATETIME NOT NULL,
-      created_by VARCHAR(64) NOT NULL,
-      status VARCHAR(20) NOT NULL
-    );`,
-		`CREATE INDEX IF NOT EXISTS idx_share_links_file_id ON share_links(file_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_share_links_token ON share_links(token);`,
-		`CREATE INDEX IF NOT EXISTS idx_files_created_by ON files(created_by);`,
-		`CREATE INDEX IF NOT EXISTS idx_files_created_at ON files(created_at);`,
+// Connect opens the database without touching its schema.
+func Connect(path string) (*DB, error) {
+	handle, err := sql.Open(driverName, path+"?_foreign_keys=on")
+	if err != nil {
+		return nil, err
 	}
+	handle.SetMaxOpenConns(1)
+	return &DB{sql: handle}, nil
+}
 
-	for _, stmt := range statements {
-		if _, err := db.sql.Exec(stmt); err != nil {
-			return err
-		}
-	}
-	return nil
+func (db *DB) Close() error {
+	return db.sql.Close()
 }
 
+// CreateFile inserts a file together with its first version.
 func (db *DB) CreateFile(ctx context.Context, record FileRecord) error {
-	_, err := db.sql.ExecContext(
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
 		ctx,
-		`INSERT INTO files (file_id, original_name, object_key, size, mime_type, created_by, created_at, updated_at)
-     VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		`INSERT INTO files (file_id, original_name, object_key, size, mime_type, sha256, md5, folder_id, version, created_by, created_at, updated_at)
+     VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?)`,
 		record.FileID,
 		record.OriginalName,
 		record.ObjectKey,
 		record.Size,
 		record.MimeType,
+		nullString(record.SHA256),
+		nullString(record.MD5),
+		record.FolderID,
 		record.CreatedBy,
 		record.CreatedAt,
 		record.UpdatedAt,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	version := FileVersion{
+		FileID:       record.FileID,
+		Version:      1,
+		OriginalName: record.OriginalName,
+		ObjectKey:    record.ObjectKey,
+		Size:         record.Size,
+		MimeType:     record.MimeType,
+		SHA256:       record.SHA256,
+		MD5:          record.MD5,
+		CreatedBy:    record.CreatedBy,
+		CreatedAt:    record.CreatedAt,
+	}
+	if err := insertFileVersion(ctx, tx, version); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
+// GetFile looks up a file that is not in the trash.
 func (db *DB) GetFile(ctx context.Context, fileID string) (FileRecord, error) {
-	var record FileRecord
-	row := db.sql.QueryRowContext(ctx, `
-    SELECT file_id, original_name, object_key, size, mime_type, created_by, created_at, updated_at
-    FROM files WHERE file_id = ?`, fileID)
-	if err := row.Scan(
-		&record.FileID,
-		&record.OriginalName,
-		&record.ObjectKey,
-		&record.Size,
-		&record.MimeType,
-		&record.CreatedBy,
-		&record.CreatedAt,
-		&record.UpdatedAt,
-	); err != nil {
-		return FileRecord{}, err
+	row := db.sql.QueryRowContext(ctx, `SELECT `+fileColumns+` FROM files WHERE file_id = ? AND deleted_at IS NULL`, fileID)
+	return scanFile(row)
+}
+
+// GetFileByName looks up a file by name directly inside folderID. A nil
+// folderID searches the root level.
+func (db *DB) GetFileByName(ctx context.Context, name string, folderID *string) (FileRecord, error) {
+	var row *sql.Row
+	if folderID == nil {
+		row = db.sql.QueryRowContext(ctx, `SELECT `+fileColumns+` FROM files WHERE original_name = ? AND folder_id IS NULL AND deleted_at IS NULL LIMIT 1`, name)
+	} else {
+		row = db.sql.QueryRowContext(ctx, `SELECT `+fileColumns+` FROM files WHERE original_name = ? AND folder_id = ? AND deleted_at IS NULL LIMIT 1`, name, *folderID)
 	}
-	return record, nil
+	return scanFile(row)
+}
+
+// Visibility leaves files out of listings: with Root, those at the root
+// level and, with Caller, those in folders Caller cannot read.
+type Visibility struct {
+	Root   bool
+	Caller *ACLCaller
 }
 
-func (db *DB) ListFiles(ctx context.Context, limit, offset int, order, keyword string) ([]FileRecord, int, error) {
+// conditions returns the WHERE clauses that apply the visibility to rows
+// whose folder is given by the SQL expression folder.
+func (v Visibility) conditions(folder string) ([]string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	if v.Root {
+		conditions = append(conditions, folder+" IS NOT NULL")
+	}
+	if v.Caller != nil {
+		if hidden, hiddenArgs := v.Caller.hiddenFolders(); hidden != "" {
+			conditions = append(conditions, "("+folder+" IS NULL OR "+folder+" NOT IN ("+hidden+"))")
+			args = append(args, hiddenArgs...)
+		}
+	}
+	return conditions, args
+}
+
+// ListFiles lists files across all folders, or only the files directly inside
+// folderID when it is set. Files hidden by visibility are left out.
+func (db *DB) ListFiles(ctx context.Context, limit, offset int, order, keyword string, folderID *string, hidden Visibility) ([]FileRecord, int, error) {
 	if order != "asc" {
 		order = "desc"
 	}
-	var total int
-	countQuery := "SELECT COUNT(1) FROM files"
+	conditions := []string{"deleted_at IS NULL"}
 	args := []interface{}{}
 	if keyword != "" {
-		countQuery += " WHERE original_name LIKE ?"
+		conditions = append(conditions, "original_name LIKE ?")
 		args = append(args, "%"+keyword+"%")
 	}
-	if err := db.sql.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
-		return nil, 0, err
+	if folderID != nil {
+		conditions = append(conditions, "folder_id = ?")
+		args = append(args, *folderID)
 	}
+	hiddenConditions, hiddenArgs := hidden.conditions("folder_id")
+	conditions = append(conditions, hiddenConditions...)
+	args = append(args, hiddenArgs...)
+	return db.queryFiles(ctx, conditions, args, order, limit, offset)
+}
 
-	query := `
-    SELECT file_id, original_name, object_key, size, mime_type, created_by, created_at, updated_at
-    FROM files`
-	args = []interface{}{}
+// ListFilesByFolder lists the files directly inside folderID. A nil folderID
+// selects the files at the root level.
+func (db *DB) ListFilesByFolder(ctx context.Context, folderID *string, limit, offset int, order, keyword string) ([]FileRecord, int, error) {
+	if order != "asc" {
+		order = "desc"
+	}
+	conditions := []string{"deleted_at IS NULL"}
+	args := []interface{}{}
+	if folderID == nil {
+		conditions = append(conditions, "folder_id IS NULL")
+	} else {
+		conditions = append(conditions, "folder_id = ?")
+		args = append(args, *folderID)
+	}
 	if keyword != "" {
-		query += " WHERE original_name LIKE ?"
+		conditions = append(conditions, "original_name LIKE ?")
 		args = append(args, "%"+keyword+"%")
 	}
+	return db.queryFiles(ctx, conditions, args, order, limit, offset)
+}
+
+func (db *DB) queryFiles(ctx context.Context, conditions []string, args []interface{}, order string, limit, offset int) ([]FileRecord, int, error) {
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	var total int
+	if err := db.sql.QueryRowContext(ctx, "SELECT COUNT(1) FROM files"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + fileColumns + " FROM files" + where
 	query += fmt.Sprintf(" ORDER BY created_at %s LIMIT ? OFFSET ?", order)
-	args = append(args, limit, offset)
-	rows, err := db.sql.QueryContext(ctx, query, args...)
+	rows, err := db.sql.QueryContext(ctx, query, append(args, limit, offset)...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -176,55 +266,36 @@ func (db *DB) ListFiles(ctx context.Context, limit, offset int, order, keyword s
 
 	records := make([]FileRecord, 0)
 	for rows.Next() {
-		var record FileRecord
-		if err := rows.Scan(
-			&record.FileID,
-			&record.OriginalName,
-			&record.ObjectKey,
-			&record.Size,
-			&record.MimeType,
-			&record.CreatedBy,
-			&record.CreatedAt,
-			&record.UpdatedAt,
-		); err != nil {
+		record, err := scanFile(rows)
+		if err != nil {
 			return nil, 0, err
 		}
 		records = append(records, record)
 	}
-	return records, total, nil
+	return records, total, rows.Err()
 }
 
-func (db *DB) AddAuditLog(ctx context.Context, action, fileID, actor, ipAddress, status, message string) error {
-	_, err := db.sql.ExecContext(
+func (db *DB) UpdateFileFolder(ctx context.Context, fileID string, folderID *string) error {
+	result, err := db.sql.ExecContext(
 		ctx,
-		`INSERT INTO audit_logs (action, file_id, actor, ip_address, status, message) VALUES (?, ?, ?, ?, ?, ?)`,
-		action,
+		`UPDATE files SET folder_id = ?, updated_at = ? WHERE file_id = ? AND deleted_at IS NULL`,
+		folderID,
+		NowRFC3339(),
 		fileID,
-		actor,
-		ipAddress,
-		status,
-		message,
 	)
-	return err
-}
-
-func (db *DB) DeleteFile(ctx context.Context, fileID string) (FileRecord, error) {
-	record, err := db.GetFile(ctx, fileID)
 	if err != nil {
-		return FileRecord{}, err
-	}
-	_, err = db.sql.ExecContext(ctx, `DELETE FROM files WHERE file_id = ?`, fileID)
-	if err != nil {
-		return FileRecord{}, err
+		return err
 	}
-	return record, nil
+	return expectAffected(result)
 }
 
-func (db *DB) CreateRefreshToken(ctx context.Context, token string, expiresAt string) error {
+func (db *DB) CreateRefreshToken(ctx context.Context, token, userID, sessionID, expiresAt string) error {
 	_, err := db.sql.ExecContext(
 		ctx,
-		`INSERT INTO refresh_tokens (token, expires_at, is_revoked) VALUES (?, ?, false)`,
+		`INSERT INTO refresh_tokens (token, user_id, session_id, expires_at, is_revoked) VALUES (?, ?, ?, ?, false)`,
 		token,
+		userID,
+		sessionID,
 		expiresAt,
 	)
 	return err
@@ -232,79 +303,50 @@ func (db *DB) CreateRefreshToken(ctx context.Context, token string, expiresAt st
 
 func (db *DB) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
 	var record RefreshToken
+	var userID, sessionID sql.NullString
 	row := db.sql.QueryRowContext(ctx, `
-    SELECT token, expires_at, is_revoked
+    SELECT token, user_id, session_id, expires_at, is_revoked
     FROM refresh_tokens WHERE token = ?`, token)
-	if err := row.Scan(&record.Token, &record.ExpiresAt, &record.IsRevoked); err != nil {
+	if err := row.Scan(&record.Token, &userID, &sessionID, &record.ExpiresAt, &record.IsRevoked); err != nil {
 		return RefreshToken{}, err
 	}
+	record.UserID = userID.String
+	record.SessionID = sessionID.String
 	return record, nil
 }
 
+// RevokeRefreshToken marks a token as used. It returns sql.ErrNoRows when the
+// token was already revoked, so two refreshes cannot both succeed.
 func (db *DB) RevokeRefreshToken(ctx context.Context, token string) error {
-	_, err := db.sql.ExecContext(ctx, `UPDATE refresh_tokens SET is_revoked = true WHERE token = ?`, token)
-	return err
-}
-
-func (db *DB) RevokeAllRefreshTokens(ctx context.Context) error {
-	_, err := db.sql.ExecContext(ctx, `UPDATE refresh_tokens SET is_revoked = true`)
-	return err
+	result, err := db.sql.ExecContext(ctx, `UPDATE refresh_tokens SET is_revoked = true WHERE token = ? AND is_revoked = false`, token)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
 }
 
-func (db *DB) CreateShareLink(ctx context.Context, link ShareLink) error {
-	_, err := db.sql.ExecContext(
-		ctx,
-		`INSERT INTO share_links (token, file_id, expires_at, created_at, created_by, status)
-	 VALUES (?, ?, ?, ?, ?, ?)`,
-		link.Token,
-		link.FileID,
-		link.ExpiresAt,
-		link.CreatedAt,
-		link.CreatedBy,
-		link.Status,
-	)
-	return err
+func NowRFC3339() string {
+	return time.Now().UTC().Format(time.RFC3339)
 }
 
-func (db *DB) GetShareLink(ctx context.Context, token string) (ShareLink, error) {
-	var link ShareLink
-	row := db.sql.QueryRowContext(ctx, `
-    SELECT token, file_id, expires_at, created_at, created_by, status
-    FROM share_links WHERE token = ?`, token)
-	if err := row.Scan(
-		&link.Token,
-		&link.FileID,
-		&link.ExpiresAt,
-		&link.CreatedAt,
-		&link.CreatedBy,
-		&link.Status,
-	); err != nil {
-		return ShareLink{}, err
+func nullStringPtr(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
 	}
-	return link, nil
+	return &value.String
 }
 
-func (db *DB) GetActiveShareLink(ctx context.Context, fileID, nowRFC3339 string) (ShareLink, error) {
-	var link ShareLink
-	row := db.sql.QueryRowContext(ctx, `
-    SELECT token, file_id, expires_at, created_at, created_by, status
-    FROM share_links
-    WHERE file_id = ? AND status = 'active' AND expires_at > ?
-    ORDER BY created_at DESC
-    LIMIT 1`, fileID, nowRFC3339)
-	if err := row.Scan(
-		&link.Token,
-		&link.FileID,
-		&link.ExpiresAt,
-		&link.CreatedAt,
-		&link.CreatedBy,
-		&link.Status,
-	); err != nil {
-		return ShareLink{}, err
-	}
-	return link, nil
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
 }
 
-func NowRFC3339() string {
-	return time.Now().UTC().Format(time.RFC3339)
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB opens a fresh database in a temporary directory.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "filehub.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func addFolder(t *testing.T, db *DB, folderID, name string, parentID *string) {
+	t.Helper()
+	now := NowRFC3339()
+	record := FolderRecord{FolderID: folderID, Name: name, ParentID: parentID, CreatedBy: "alice", CreatedAt: now, UpdatedAt: now}
+	if err := db.CreateFolder(context.Background(), record); err != nil {
+		t.Fatalf("create folder %s: %v", folderID, err)
+	}
+}
+
+func addFile(t *testing.T, db *DB, fileID, name string, size int64, folderID *string) {
+	t.Helper()
+	now := NowRFC3339()
+	record := FileRecord{FileID: fileID, OriginalName: name, ObjectKey: "objects/" + fileID, Size: size, FolderID: folderID, CreatedBy: "alice", CreatedAt: now, UpdatedAt: now}
+	if err := db.CreateFile(context.Background(), record); err != nil {
+		t.Fatalf("create file %s: %v", fileID, err)
+	}
+}
+
+func ptr(value string) *string {
+	return &value
+}
+
+func TestFileChecksums(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	now := NowRFC3339()
+	tests := []struct {
+		fileID, sha256, md5 string
+	}{
+		{"hashed", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", "900150983cd24fb0d6963f7d28e17f72"},
+		// Files uploaded before checksums were recorded have none.
+		{"legacy", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.fileID, func(t *testing.T) {
+			record := FileRecord{FileID: test.fileID, OriginalName: "a.txt", ObjectKey: "objects/" + test.fileID, Size: 3, SHA256: test.sha256, MD5: test.md5, CreatedBy: "alice", CreatedAt: now, UpdatedAt: now}
+			if err := db.CreateFile(ctx, record); err != nil {
+				t.Fatal(err)
+			}
+			got, err := db.GetFile(ctx, test.fileID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.SHA256 != test.sha256 || got.MD5 != test.md5 {
+				t.Errorf("checksums read back as %q, %q", got.SHA256, got.MD5)
+			}
+		})
+	}
+}
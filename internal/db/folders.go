@@ -0,0 +1,255 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+type FolderRecord struct {
+	FolderID  string
+	Name      string
+	ParentID  *string
+	CreatedBy string
+	CreatedAt string
+	UpdatedAt string
+	// DeletedAt is set while the folder is in the trash.
+	DeletedAt *string
+	DeletedBy string
+}
+
+const folderColumns = `folder_id, name, parent_id, created_by, created_at, updated_at, deleted_at, deleted_by`
+
+func scanFolder(row rowScanner) (FolderRecord, error) {
+	var record FolderRecord
+	var parentID, deletedAt sql.NullString
+	if err := row.Scan(
+		&record.FolderID,
+		&record.Name,
+		&parentID,
+		&record.CreatedBy,
+		&record.CreatedAt,
+		&record.UpdatedAt,
+		&deletedAt,
+		&record.DeletedBy,
+	); err != nil {
+		return FolderRecord{}, err
+	}
+	record.ParentID = nullStringPtr(parentID)
+	record.DeletedAt = nullStringPtr(deletedAt)
+	return record, nil
+}
+
+func (db *DB) CreateFolder(ctx context.Context, record FolderRecord) error {
+	_, err := db.sql.ExecContext(
+		ctx,
+		`INSERT INTO folders (folder_id, name, parent_id, created_by, created_at, updated_at)
+     VALUES (?, ?, ?, ?, ?, ?)`,
+		record.FolderID,
+		record.Name,
+		record.ParentID,
+		record.CreatedBy,
+		record.CreatedAt,
+		record.UpdatedAt,
+	)
+	return err
+}
+
+// GetFolder looks up a folder that is not in the trash.
+func (db *DB) GetFolder(ctx context.Context, folderID string) (FolderRecord, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+folderColumns+` FROM folders WHERE folder_id = ? AND deleted_at IS NULL`, folderID)
+	return scanFolder(row)
+}
+
+// GetFolderByName looks up a folder by name among the children of parentID.
+// A nil parentID searches the root level.
+func (db *DB) GetFolderByName(ctx context.Context, name string, parentID *string) (FolderRecord, error) {
+	var row *sql.Row
+	if parentID == nil {
+		row = db.sql.QueryRowContext(ctx, `SELECT `+folderColumns+` FROM folders WHERE name = ? AND parent_id IS NULL AND deleted_at IS NULL`, name)
+	} else {
+		row = db.sql.QueryRowContext(ctx, `SELECT `+folderColumns+` FROM folders WHERE name = ? AND parent_id = ? AND deleted_at IS NULL`, name, *parentID)
+	}
+	return scanFolder(row)
+}
+
+// ListFolders lists the direct children of parentID, or the root-level
+// folders when parentID is nil.
+func (db *DB) ListFolders(ctx context.Context, parentID *string) ([]FolderRecord, error) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if parentID == nil {
+		rows, err = db.sql.QueryContext(ctx, `SELECT `+folderColumns+` FROM folders WHERE parent_id IS NULL AND deleted_at IS NULL ORDER BY name ASC`)
+	} else {
+		rows, err = db.sql.QueryContext(ctx, `SELECT `+folderColumns+` FROM folders WHERE parent_id = ? AND deleted_at IS NULL ORDER BY name ASC`, *parentID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]FolderRecord, 0)
+	for rows.Next() {
+		record, err := scanFolder(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (db *DB) UpdateFolder(ctx context.Context, folderID, name string) error {
+	result, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE folders SET name = ?, updated_at = ? WHERE folder_id = ? AND deleted_at IS NULL`,
+		name,
+		NowRFC3339(),
+		folderID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (db *DB) MoveFolder(ctx context.Context, folderID string, parentID *string) error {
+	result, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE folders SET parent_id = ?, updated_at = ? WHERE folder_id = ? AND deleted_at IS NULL`,
+		parentID,
+		NowRFC3339(),
+		folderID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// GetFolderDepth returns the number of folders on the path from the root to
+// folderID, so a root-level folder has depth 1.
+func (db *DB) GetFolderDepth(ctx context.Context, folderID string) (int, error) {
+	var depth int
+	err := db.sql.QueryRowContext(ctx, `
+    WITH RECURSIVE ancestors(folder_id, parent_id) AS (
+      SELECT folder_id, parent_id FROM folders WHERE folder_id = ?
+      UNION ALL
+      SELECT f.folder_id, f.parent_id FROM folders f JOIN ancestors a ON f.folder_id = a.parent_id
+    )
+    SELECT COUNT(1) FROM ancestors`, folderID).Scan(&depth)
+	if err != nil {
+		return 0, err
+	}
+	if depth == 0 {
+		return 0, sql.ErrNoRows
+	}
+	return depth, nil
+}
+
+// IsDescendant reports whether candidateID is folderID itself or lies
+// somewhere inside its subtree.
+func (db *DB) IsDescendant(ctx context.Context, folderID, candidateID string) (bool, error) {
+	var count int
+	err := db.sql.QueryRowContext(ctx, `
+    WITH RECURSIVE ancestors(folder_id, parent_id) AS (
+      SELECT folder_id, parent_id FROM folders WHERE folder_id = ?
+      UNION ALL
+      SELECT f.folder_id, f.parent_id FROM folders f JOIN ancestors a ON f.folder_id = a.parent_id
+    )
+    SELECT COUNT(1) FROM ancestors WHERE folder_id = ?`, candidateID, folderID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetFolderItemCount returns the number of subfolders and files directly
+// inside folderID, leaving out those in the trash.
+func (db *DB) GetFolderItemCount(ctx context.Context, folderID string) (int, error) {
+	var count int
+	err := db.sql.QueryRowContext(ctx, `
+    SELECT
+      (SELECT COUNT(1) FROM folders WHERE parent_id = ? AND deleted_at IS NULL) +
+      (SELECT COUNT(1) FROM files WHERE folder_id = ? AND deleted_at IS NULL)`, folderID, folderID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetFolderStats returns the number and total size of the files directly
+// inside folderID. A nil folderID reports on the root level. Files hidden by
+// visibility are not counted, matching ListFiles.
+func (db *DB) GetFolderStats(ctx context.Context, folderID *string, hidden Visibility) (int, int64, error) {
+	conditions := []string{"deleted_at IS NULL"}
+	args := []interface{}{}
+	if folderID == nil {
+		conditions = append(conditions, "folder_id IS NULL")
+	} else {
+		conditions = append(conditions, "folder_id = ?")
+		args = append(args, *folderID)
+	}
+	hiddenConditions, hiddenArgs := hidden.conditions("folder_id")
+	conditions = append(conditions, hiddenConditions...)
+	args = append(args, hiddenArgs...)
+
+	var (
+		count int
+		size  int64
+	)
+	query := "SELECT COUNT(1), COALESCE(SUM(size), 0) FROM files WHERE " + strings.Join(conditions, " AND ")
+	if err := db.sql.QueryRowContext(ctx, query, args...).Scan(&count, &size); err != nil {
+		return 0, 0, err
+	}
+	return count, size, nil
+}
+
+const subtreeCTE = `
+    WITH RECURSIVE subtree(folder_id) AS (
+      SELECT folder_id FROM folders WHERE folder_id = ? AND deleted_at IS NULL
+      UNION ALL
+      SELECT f.folder_id FROM folders f JOIN subtree s ON f.parent_id = s.folder_id WHERE f.deleted_at IS NULL
+    )`
+
+// ListSubtreeFolders returns folderID and every folder beneath it.
+func (db *DB) ListSubtreeFolders(ctx context.Context, folderID string) ([]FolderRecord, error) {
+	rows, err := db.sql.QueryContext(ctx, subtreeCTE+`
+    SELECT `+folderColumns+` FROM folders WHERE folder_id IN (SELECT folder_id FROM subtree) ORDER BY name ASC`, folderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]FolderRecord, 0)
+	for rows.Next() {
+		record, err := scanFolder(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// ListSubtreeFiles returns every file in folderID or any of its subfolders.
+func (db *DB) ListSubtreeFiles(ctx context.Context, folderID string) ([]FileRecord, error) {
+	rows, err := db.sql.QueryContext(ctx, subtreeCTE+`
+    SELECT `+fileColumns+` FROM files WHERE folder_id IN (SELECT folder_id FROM subtree) AND deleted_at IS NULL ORDER BY original_name ASC`, folderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]FileRecord, 0)
+	for rows.Next() {
+		record, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
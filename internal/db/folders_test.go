@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// newFolderTree builds
+//
+//	docs
+//	  reports
+//	    2024
+//	photos
+func newFolderTree(t *testing.T) *DB {
+	t.Helper()
+	db := newTestDB(t)
+	addFolder(t, db, "docs", "docs", nil)
+	addFolder(t, db, "reports", "reports", ptr("docs"))
+	addFolder(t, db, "2024", "2024", ptr("reports"))
+	addFolder(t, db, "photos", "photos", nil)
+	addFile(t, db, "f1", "readme.txt", 10, ptr("docs"))
+	addFile(t, db, "f2", "q1.pdf", 200, ptr("reports"))
+	addFile(t, db, "f3", "notes.txt", 5, nil)
+	return db
+}
+
+func TestGetFolderByName(t *testing.T) {
+	db := newFolderTree(t)
+	tests := []struct {
+		name     string
+		parentID *string
+		want     string
+	}{
+		{"docs", nil, "docs"},
+		{"reports", ptr("docs"), "reports"},
+		{"reports", nil, ""},
+		{"docs", ptr("docs"), ""},
+	}
+	for _, test := range tests {
+		folder, err := db.GetFolderByName(context.Background(), test.name, test.parentID)
+		switch {
+		case test.want == "" && !errors.Is(err, sql.ErrNoRows):
+			t.Errorf("%s in %v: want no rows, got %v", test.name, test.parentID, err)
+		case test.want != "" && (err != nil || folder.FolderID != test.want):
+			t.Errorf("%s in %v: got %q, %v", test.name, test.parentID, folder.FolderID, err)
+		}
+	}
+}
+
+func TestListFolders(t *testing.T) {
+	db := newFolderTree(t)
+	tests := []struct {
+		parentID *string
+		want     []string
+	}{
+		{nil, []string{"docs", "photos"}},
+		{ptr("docs"), []string{"reports"}},
+		{ptr("photos"), nil},
+	}
+	for _, test := range tests {
+		folders, err := db.ListFolders(context.Background(), test.parentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(folders) != len(test.want) {
+			t.Fatalf("children of %v: got %d, want %v", test.parentID, len(folders), test.want)
+		}
+		for i, folder := range folders {
+			if folder.FolderID != test.want[i] {
+				t.Errorf("children of %v: got %s at %d, want %s", test.parentID, folder.FolderID, i, test.want[i])
+			}
+		}
+	}
+}
+
+func TestFolderDepthAndDescendants(t *testing.T) {
+	ctx := context.Background()
+	db := newFolderTree(t)
+	depths := map[string]int{"docs": 1, "reports": 2, "2024": 3, "photos": 1}
+	for folderID, want := range depths {
+		if depth, err := db.GetFolderDepth(ctx, folderID); err != nil || depth != want {
+			t.Errorf("depth of %s: got %d, %v, want %d", folderID, depth, err, want)
+		}
+	}
+	if _, err := db.GetFolderDepth(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("depth of a missing folder: want no rows, got %v", err)
+	}
+
+	tests := []struct {
+		folderID, candidateID string
+		want                  bool
+	}{
+		{"docs", "docs", true},
+		{"docs", "2024", true},
+		{"reports", "2024", true},
+		{"2024", "docs", false},
+		{"docs", "photos", false},
+	}
+	for _, test := range tests {
+		got, err := db.IsDescendant(ctx, test.folderID, test.candidateID)
+		if err != nil || got != test.want {
+			t.Errorf("IsDescendant(%s, %s) = %v, %v, want %v", test.folderID, test.candidateID, got, err, test.want)
+		}
+	}
+}
+
+func TestFolderCounts(t *testing.T) {
+	ctx := context.Background()
+	db := newFolderTree(t)
+	if count, err := db.GetFolderItemCount(ctx, "docs"); err != nil || count != 2 {
+		t.Errorf("items in docs: got %d, %v, want 2", count, err)
+	}
+	tests := []struct {
+		folderID *string
+		hidden   Visibility
+		count    int
+		size     int64
+	}{
+		{nil, Visibility{}, 1, 5},
+		{ptr("docs"), Visibility{}, 1, 10},
+		{ptr("reports"), Visibility{}, 1, 200},
+		{ptr("photos"), Visibility{}, 0, 0},
+		{nil, Visibility{Root: true}, 0, 0},
+		{ptr("docs"), Visibility{Root: true}, 1, 10},
+		{ptr("docs"), Visibility{Caller: &ACLCaller{IgnoreACLs: true, Folder: ptr("reports")}}, 0, 0},
+		{ptr("reports"), Visibility{Caller: &ACLCaller{IgnoreACLs: true, Folder: ptr("reports")}}, 1, 200},
+	}
+	for _, test := range tests {
+		count, size, err := db.GetFolderStats(ctx, test.folderID, test.hidden)
+		if err != nil || count != test.count || size != test.size {
+			t.Errorf("stats of %v: got %d files, %d bytes, %v", test.folderID, count, size, err)
+		}
+	}
+}
+
+func TestFolderUpdates(t *testing.T) {
+	ctx := context.Background()
+	db := newFolderTree(t)
+	if err := db.UpdateFolder(ctx, "photos", "pictures"); err != nil {
+		t.Fatal(err)
+	}
+	if folder, err := db.GetFolder(ctx, "photos"); err != nil || folder.Name != "pictures" {
+		t.Errorf("renamed folder: %+v, %v", folder, err)
+	}
+	if err := db.MoveFolder(ctx, "photos", ptr("docs")); err != nil {
+		t.Fatal(err)
+	}
+	if depth, err := db.GetFolderDepth(ctx, "photos"); err != nil || depth != 2 {
+		t.Errorf("moved folder depth: %d, %v", depth, err)
+	}
+	if err := db.TrashFolder(ctx, "2024", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	for name, err := range map[string]error{
+		"rename": db.UpdateFolder(ctx, "missing", "x"),
+		"move":   db.MoveFolder(ctx, "missing", nil),
+		"trash":  db.TrashFolder(ctx, "2024", "alice"),
+	} {
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("%s a missing folder: want no rows, got %v", name, err)
+		}
+	}
+}
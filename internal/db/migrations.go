@@ -0,0 +1,825 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Migration is a single numbered schema change. Up and Down each run inside
+// their own transaction.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+	Down    func(tx *sql.Tx) error
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt string
+}
+
+// migrations must stay ordered by version. Never edit a released migration;
+// append a new one instead.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS files (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      file_id VARCHAR(12) UNIQUE NOT NULL,
+      original_name VARCHAR(255) NOT NULL,
+      object_key VARCHAR(512) NOT NULL,
+      size BIGINT NOT NULL,
+      mime_type VARCHAR(100),
+      created_by VARCHAR(64) NOT NULL,
+      created_at DATETIME NOT NULL,
+      updated_at DATETIME NOT NULL,
+      metadata JSON
+    );`,
+			`CREATE TABLE IF NOT EXISTS refresh_tokens (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      token VARCHAR(128) UNIQUE NOT NULL,
+      expires_at DATETIME NOT NULL,
+      is_revoked BOOLEAN DEFAULT FALSE,
+      created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );`,
+			`CREATE TABLE IF NOT EXISTS audit_logs (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      action VARCHAR(50) NOT NULL,
+      file_id VARCHAR(32),
+      actor VARCHAR(64) NOT NULL,
+      ip_address VARCHAR(45),
+      status VARCHAR(20),
+      message TEXT,
+      created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );`,
+			`CREATE TABLE IF NOT EXISTS share_links (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      token VARCHAR(64) UNIQUE NOT NULL,
+      file_id VARCHAR(32) NOT NULL,
+      expires_at DATETIME NOT NULL,
+      created_at DATETIME NOT NULL,
+      created_by VARCHAR(64) NOT NULL,
+      status VARCHAR(20) NOT NULL
+    );`,
+			`CREATE INDEX IF NOT EXISTS idx_share_links_file_id ON share_links(file_id);`,
+			`CREATE INDEX IF NOT EXISTS idx_share_links_token ON share_links(token);`,
+			`CREATE INDEX IF NOT EXISTS idx_files_created_by ON files(created_by);`,
+			`CREATE INDEX IF NOT EXISTS idx_files_created_at ON files(created_at);`,
+		),
+		Down: execStatements(
+			`DROP TABLE IF EXISTS share_links;`,
+			`DROP TABLE IF EXISTS audit_logs;`,
+			`DROP TABLE IF EXISTS refresh_tokens;`,
+			`DROP TABLE IF EXISTS files;`,
+		),
+	},
+	{
+		Version: 2,
+		Name:    "folders",
+		Up: func(tx *sql.Tx) error {
+			if err := execStatements(
+				`CREATE TABLE IF NOT EXISTS folders (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      folder_id VARCHAR(32) UNIQUE NOT NULL,
+      name VARCHAR(255) NOT NULL,
+      parent_id VARCHAR(32) REFERENCES folders(folder_id),
+      created_by VARCHAR(64) NOT NULL,
+      created_at DATETIME NOT NULL,
+      updated_at DATETIME NOT NULL
+    );`,
+				`CREATE INDEX IF NOT EXISTS idx_folders_parent_id ON folders(parent_id);`,
+			)(tx); err != nil {
+				return err
+			}
+			if err := addColumnIfMissing(tx, "files", "folder_id", "VARCHAR(32) REFERENCES folders(folder_id)"); err != nil {
+				return err
+			}
+			return execStatements(`CREATE INDEX IF NOT EXISTS idx_files_folder_id ON files(folder_id);`)(tx)
+		},
+		// SQLite cannot drop a column that carries a foreign key, so the
+		// files table is rebuilt without it.
+		Down: execStatements(
+			`CREATE TABLE files_rollback (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      file_id VARCHAR(12) UNIQUE NOT NULL,
+      original_name VARCHAR(255) NOT NULL,
+      object_key VARCHAR(512) NOT NULL,
+      size BIGINT NOT NULL,
+      mime_type VARCHAR(100),
+      created_by VARCHAR(64) NOT NULL,
+      created_at DATETIME NOT NULL,
+      updated_at DATETIME NOT NULL,
+      metadata JSON
+    );`,
+			`INSERT INTO files_rollback (id, file_id, original_name, object_key, size, mime_type, created_by, created_at, updated_at, metadata)
+     SELECT id, file_id, original_name, object_key, size, mime_type, created_by, created_at, updated_at, metadata FROM files;`,
+			`DROP TABLE files;`,
+			`ALTER TABLE files_rollback RENAME TO files;`,
+			`CREATE INDEX IF NOT EXISTS idx_files_created_by ON files(created_by);`,
+			`CREATE INDEX IF NOT EXISTS idx_files_created_at ON files(created_at);`,
+			`DROP TABLE IF EXISTS folders;`,
+		),
+	},
+	{
+		Version: 3,
+		Name:    "file checksums",
+		Up: execStatements(
+			`ALTER TABLE files ADD COLUMN sha256 VARCHAR(64);`,
+			`ALTER TABLE files ADD COLUMN md5 VARCHAR(32);`,
+			`CREATE INDEX IF NOT EXISTS idx_files_sha256 ON files(sha256);`,
+		),
+		Down: execStatements(
+			`DROP INDEX IF EXISTS idx_files_sha256;`,
+			`ALTER TABLE files DROP COLUMN md5;`,
+			`ALTER TABLE files DROP COLUMN sha256;`,
+		),
+	},
+	{
+		Version: 4,
+		Name:    "deduplicated objects",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS objects (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      sha256 VARCHAR(64) UNIQUE NOT NULL,
+      object_key VARCHAR(512) UNIQUE NOT NULL,
+      size BIGINT NOT NULL,
+      ref_count INTEGER NOT NULL,
+      created_at DATETIME NOT NULL
+    );`,
+		),
+		Down: execStatements(
+			`DROP TABLE IF EXISTS objects;`,
+		),
+	},
+	{
+		Version: 5,
+		Name:    "resumable uploads",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS uploads (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      upload_id VARCHAR(32) UNIQUE NOT NULL,
+      file_id VARCHAR(12) NOT NULL,
+      original_name VARCHAR(255) NOT NULL,
+      folder_id VARCHAR(32),
+      length BIGINT NOT NULL,
+      upload_offset BIGINT NOT NULL DEFAULT 0,
+      object_key VARCHAR(512),
+      storage_upload_id VARCHAR(1024),
+      parts TEXT,
+      mime_type VARCHAR(100),
+      sha256_state BLOB,
+      md5_state BLOB,
+      status VARCHAR(20) NOT NULL,
+      created_by VARCHAR(64) NOT NULL,
+      created_at DATETIME NOT NULL,
+      updated_at DATETIME NOT NULL,
+      expires_at DATETIME NOT NULL
+    );`,
+			`CREATE INDEX IF NOT EXISTS idx_uploads_expires_at ON uploads(expires_at);`,
+		),
+		Down: execStatements(
+			`DROP TABLE IF EXISTS uploads;`,
+		),
+	},
+	{
+		Version: 6,
+		Name:    "share link options",
+		Up: execStatements(
+			`ALTER TABLE share_links ADD COLUMN password_hash VARCHAR(255) NOT NULL DEFAULT '';`,
+			`ALTER TABLE share_links ADD COLUMN max_downloads INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE share_links ADD COLUMN download_count INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE share_links ADD COLUMN note TEXT NOT NULL DEFAULT '';`,
+		),
+		Down: execStatements(
+			`ALTER TABLE share_links DROP COLUMN note;`,
+			`ALTER TABLE share_links DROP COLUMN download_count;`,
+			`ALTER TABLE share_links DROP COLUMN max_downloads;`,
+			`ALTER TABLE share_links DROP COLUMN password_hash;`,
+		),
+	},
+	{
+		Version: 7,
+		Name:    "share accesses",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS share_accesses (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      token VARCHAR(64) NOT NULL,
+      file_id VARCHAR(32) NOT NULL,
+      accessed_at DATETIME NOT NULL,
+      ip_address VARCHAR(64),
+      user_agent TEXT,
+      status_code INTEGER NOT NULL,
+      bytes_sent BIGINT NOT NULL DEFAULT 0,
+      completed BOOLEAN NOT NULL DEFAULT false
+    );`,
+			`CREATE INDEX IF NOT EXISTS idx_share_accesses_token ON share_accesses(token);`,
+		),
+		Down: execStatements(
+			`DROP TABLE IF EXISTS share_accesses;`,
+		),
+	},
+	{
+		Version: 8,
+		Name:    "folder shares",
+		// Folder shares leave file_id empty and point folder_id at the
+		// shared subtree.
+		Up: execStatements(
+			`ALTER TABLE share_links ADD COLUMN folder_id VARCHAR(32);`,
+			`CREATE INDEX IF NOT EXISTS idx_share_links_folder_id ON share_links(folder_id);`,
+		),
+		Down: execStatements(
+			`DROP INDEX IF EXISTS idx_share_links_folder_id;`,
+			`DELETE FROM share_links WHERE folder_id IS NOT NULL;`,
+			`ALTER TABLE share_links DROP COLUMN folder_id;`,
+		),
+	},
+	{
+		Version: 9,
+		Name:    "upload request links",
+		Up: execStatements(
+			`ALTER TABLE share_links ADD COLUMN kind VARCHAR(16) NOT NULL DEFAULT 'download';`,
+			`ALTER TABLE share_links ADD COLUMN max_upload_files INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE share_links ADD COLUMN max_upload_bytes BIGINT NOT NULL DEFAULT 0;`,
+			`ALTER TABLE share_links ADD COLUMN uploaded_files INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE share_links ADD COLUMN uploaded_bytes BIGINT NOT NULL DEFAULT 0;`,
+		),
+		Down: execStatements(
+			`DELETE FROM share_links WHERE kind <> 'download';`,
+			`ALTER TABLE share_links DROP COLUMN uploaded_bytes;`,
+			`ALTER TABLE share_links DROP COLUMN uploaded_files;`,
+			`ALTER TABLE share_links DROP COLUMN max_upload_bytes;`,
+			`ALTER TABLE share_links DROP COLUMN max_upload_files;`,
+			`ALTER TABLE share_links DROP COLUMN kind;`,
+		),
+	},
+	{
+		Version: 10,
+		Name:    "users",
+		// Refresh tokens issued before this migration carry no user and
+		// can no longer be exchanged.
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS users (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      user_id VARCHAR(32) UNIQUE NOT NULL,
+      username VARCHAR(64) UNIQUE NOT NULL,
+      password_hash VARCHAR(255) NOT NULL,
+      is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+      disabled BOOLEAN NOT NULL DEFAULT FALSE,
+      created_at DATETIME NOT NULL,
+      updated_at DATETIME NOT NULL
+    );`,
+			`ALTER TABLE refresh_tokens ADD COLUMN user_id VARCHAR(32);`,
+			`UPDATE refresh_tokens SET is_revoked = TRUE;`,
+		),
+		Down: execStatements(
+			`ALTER TABLE refresh_tokens DROP COLUMN user_id;`,
+			`DROP TABLE IF EXISTS users;`,
+		),
+	},
+	{
+		Version: 11,
+		Name:    "user roles",
+		// Existing non-admin users keep full file access as editors.
+		Up: execStatements(
+			`ALTER TABLE users ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'viewer';`,
+			`UPDATE users SET role = CASE WHEN is_admin THEN 'admin' ELSE 'editor' END;`,
+			`ALTER TABLE users DROP COLUMN is_admin;`,
+		),
+		Down: execStatements(
+			`ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;`,
+			`UPDATE users SET is_admin = (role = 'admin');`,
+			`ALTER TABLE users DROP COLUMN role;`,
+		),
+	},
+	{
+		Version: 12,
+		Name:    "folder acls",
+		// principal_type is "user" (principal_id = user_id) or "role"
+		// (principal_id = role name).
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS folder_acls (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      folder_id VARCHAR(32) NOT NULL REFERENCES folders(folder_id) ON DELETE CASCADE,
+      principal_type VARCHAR(16) NOT NULL,
+      principal_id VARCHAR(64) NOT NULL,
+      access VARCHAR(16) NOT NULL,
+      created_by VARCHAR(64) NOT NULL,
+      created_at DATETIME NOT NULL,
+      UNIQUE (folder_id, principal_type, principal_id)
+    );`,
+		),
+		Down: execStatements(
+			`DROP TABLE IF EXISTS folder_acls;`,
+		),
+	},
+	{
+		Version: 13,
+		Name:    "api keys",
+		// Only the SHA-256 of a key is stored; prefix identifies it in
+		// listings. scopes is a comma-separated list. Keys die with their
+		// owner or folder rather than losing their restriction.
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS api_keys (
+      key_id VARCHAR(32) PRIMARY KEY,
+      name VARCHAR(64) NOT NULL UNIQUE,
+      key_hash CHAR(64) NOT NULL UNIQUE,
+      prefix VARCHAR(16) NOT NULL,
+      owner_id VARCHAR(32) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+      scopes VARCHAR(64) NOT NULL,
+      folder_id VARCHAR(32) REFERENCES folders(folder_id) ON DELETE CASCADE,
+      expires_at DATETIME,
+      last_used_at DATETIME,
+      revoked_at DATETIME,
+      created_by VARCHAR(64) NOT NULL,
+      created_at DATETIME NOT NULL
+    );`,
+			`CREATE INDEX IF NOT EXISTS idx_api_keys_owner ON api_keys(owner_id);`,
+		),
+		Down: execStatements(
+			`DROP TABLE IF EXISTS api_keys;`,
+		),
+	},
+	{
+		Version: 14,
+		Name:    "oidc subjects",
+		// oidc_subject is "<issuer> <sub>" for users that signed in through
+		// OpenID Connect; their password_hash stays empty until an admin
+		// sets one.
+		Up: execStatements(
+			`ALTER TABLE users ADD COLUMN oidc_subject VARCHAR(512);`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_subject ON users(oidc_subject);`,
+		),
+		Down: execStatements(
+			`DROP INDEX IF EXISTS idx_users_oidc_subject;`,
+			`ALTER TABLE users DROP COLUMN oidc_subject;`,
+		),
+	},
+	{
+		Version: 15,
+		Name:    "totp",
+		// totp_secret is set at enrollment and totp_enabled once the user
+		// confirmed a code. totp_last_step is the last accepted time step,
+		// so a code cannot be used twice. Recovery codes are stored as
+		// SHA-256 hashes and used at most once.
+		Up: execStatements(
+			`ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64) NOT NULL DEFAULT '';`,
+			`ALTER TABLE users ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;`,
+			`ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;`,
+			`CREATE TABLE IF NOT EXISTS recovery_codes (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      user_id VARCHAR(32) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+      code_hash CHAR(64) NOT NULL,
+      used_at DATETIME
+    );`,
+			`CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id);`,
+		),
+		Down: execStatements(
+			`DROP TABLE IF EXISTS recovery_codes;`,
+			`ALTER TABLE users DROP COLUMN totp_last_step;`,
+			`ALTER TABLE users DROP COLUMN totp_enabled;`,
+			`ALTER TABLE users DROP COLUMN totp_secret;`,
+		),
+	},
+	{
+		Version: 16,
+		Name:    "sessions",
+		// A session is one login; its refresh tokens form a rotation
+		// family. Refresh tokens issued before this migration have no
+		// session and can no longer be exchanged.
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS sessions (
+      session_id VARCHAR(32) PRIMARY KEY,
+      user_id VARCHAR(32) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+      user_agent VARCHAR(512) NOT NULL DEFAULT '',
+      ip_address VARCHAR(45) NOT NULL DEFAULT '',
+      created_at DATETIME NOT NULL,
+      last_used_at DATETIME NOT NULL,
+      expires_at DATETIME NOT NULL,
+      revoked_at DATETIME
+    );`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);`,
+			`ALTER TABLE refresh_tokens ADD COLUMN session_id VARCHAR(32);`,
+			`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session ON refresh_tokens(session_id);`,
+			`UPDATE refresh_tokens SET is_revoked = TRUE;`,
+		),
+		Down: execStatements(
+			`DROP INDEX IF EXISTS idx_refresh_tokens_session;`,
+			`ALTER TABLE refresh_tokens DROP COLUMN session_id;`,
+			`DROP TABLE IF EXISTS sessions;`,
+		),
+	},
+	{
+		Version: 17,
+		Name:    "trash",
+		// Deleted files and folders keep their rows with deleted_at set
+		// until the trash is emptied. Rolling back brings them back.
+		Up: execStatements(
+			`ALTER TABLE files ADD COLUMN deleted_at DATETIME;`,
+			`ALTER TABLE files ADD COLUMN deleted_by VARCHAR(64) NOT NULL DEFAULT '';`,
+			`ALTER TABLE folders ADD COLUMN deleted_at DATETIME;`,
+			`ALTER TABLE folders ADD COLUMN deleted_by VARCHAR(64) NOT NULL DEFAULT '';`,
+			`CREATE INDEX IF NOT EXISTS idx_files_deleted_at ON files(deleted_at);`,
+			`CREATE INDEX IF NOT EXISTS idx_folders_deleted_at ON folders(deleted_at);`,
+		),
+		Down: execStatements(
+			`DROP INDEX IF EXISTS idx_folders_deleted_at;`,
+			`DROP INDEX IF EXISTS idx_files_deleted_at;`,
+			`ALTER TABLE folders DROP COLUMN deleted_by;`,
+			`ALTER TABLE folders DROP COLUMN deleted_at;`,
+			`ALTER TABLE files DROP COLUMN deleted_by;`,
+			`ALTER TABLE files DROP COLUMN deleted_at;`,
+		),
+	},
+	{
+		Version: 18,
+		Name:    "file versions",
+		// files keeps mirroring the current version so listings and
+		// shares are unchanged. Every existing file becomes version 1.
+		// Rolling back forgets the other versions; their objects stay in
+		// storage.
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS file_versions (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      file_id VARCHAR(12) NOT NULL REFERENCES files(file_id) ON DELETE CASCADE,
+      version INTEGER NOT NULL,
+      original_name VARCHAR(255) NOT NULL,
+      object_key VARCHAR(512) NOT NULL,
+      size BIGINT NOT NULL,
+      mime_type VARCHAR(100),
+      sha256 VARCHAR(64),
+      md5 VARCHAR(32),
+      created_by VARCHAR(64) NOT NULL,
+      created_at DATETIME NOT NULL,
+      UNIQUE (file_id, version)
+    );`,
+			`ALTER TABLE files ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+			`INSERT INTO file_versions (file_id, version, original_name, object_key, size, mime_type, sha256, md5, created_by, created_at)
+      SELECT file_id, 1, original_name, object_key, size, mime_type, sha256, md5, created_by, created_at FROM files;`,
+		),
+		Down: execStatements(
+			`ALTER TABLE files DROP COLUMN version;`,
+			`DROP TABLE IF EXISTS file_versions;`,
+		),
+	},
+	{
+		Version: 19,
+		Name:    "audit log query",
+		// created_at was filled by CURRENT_TIMESTAMP ("YYYY-MM-DD HH:MM:SS");
+		// it becomes RFC3339 like every other timestamp so time filters
+		// compare as strings.
+		Up: execStatements(
+			`UPDATE audit_logs SET created_at = strftime('%Y-%m-%dT%H:%M:%SZ', created_at) WHERE created_at NOT LIKE '%T%';`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at);`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs(action);`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_logs_actor ON audit_logs(actor);`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_logs_file_id ON audit_logs(file_id);`,
+		),
+		Down: execStatements(
+			`DROP INDEX IF EXISTS idx_audit_logs_file_id;`,
+			`DROP INDEX IF EXISTS idx_audit_logs_actor;`,
+			`DROP INDEX IF EXISTS idx_audit_logs_action;`,
+			`DROP INDEX IF EXISTS idx_audit_logs_created_at;`,
+			`UPDATE audit_logs SET created_at = strftime('%Y-%m-%d %H:%M:%S', created_at);`,
+		),
+	},
+	{
+		Version: 20,
+		Name:    "audit hash chain",
+		// Existing entries are chained in ID order, starting from an empty
+		// hash.
+		Up: func(tx *sql.Tx) error {
+			if err := execStatements(
+				`ALTER TABLE audit_logs ADD COLUMN prev_hash VARCHAR(64) NOT NULL DEFAULT '';`,
+				`ALTER TABLE audit_logs ADD COLUMN hash VARCHAR(64) NOT NULL DEFAULT '';`,
+			)(tx); err != nil {
+				return err
+			}
+			return chainAuditLogs(tx)
+		},
+		Down: execStatements(
+			`ALTER TABLE audit_logs DROP COLUMN hash;`,
+			`ALTER TABLE audit_logs DROP COLUMN prev_hash;`,
+		),
+	},
+	{
+		Version: 21,
+		Name:    "share access ranges",
+		// range_start is the first byte served, so a resumed download can be
+		// matched to the transfer it continues.
+		Up: execStatements(
+			`ALTER TABLE share_accesses ADD COLUMN range_start BIGINT NOT NULL DEFAULT 0;`,
+			`CREATE INDEX IF NOT EXISTS idx_share_accesses_token_ip ON share_accesses(token, ip_address);`,
+		),
+		Down: execStatements(
+			`DROP INDEX IF EXISTS idx_share_accesses_token_ip;`,
+			`ALTER TABLE share_accesses DROP COLUMN range_start;`,
+		),
+	},
+	{
+		Version: 22,
+		Name:    "audit anchors",
+		// Each retention purge leaves a signed anchor naming the last entry
+		// it deleted, so the oldest remaining entry must chain onto it.
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS audit_anchors (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      last_id INTEGER NOT NULL,
+      hash VARCHAR(64) NOT NULL,
+      created_at DATETIME NOT NULL,
+      signature VARCHAR(64) NOT NULL
+    );`,
+		),
+		Down: execStatements(
+			`DROP TABLE IF EXISTS audit_anchors;`,
+		),
+	},
+	{
+		Version: 23,
+		Name:    "pending object deletes",
+		// Objects whose storage delete failed after their rows were purged,
+		// retried by the trash worker.
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS pending_deletes (
+      object_key VARCHAR(512) PRIMARY KEY,
+      attempts INTEGER NOT NULL DEFAULT 1,
+      last_error TEXT,
+      created_at DATETIME NOT NULL,
+      updated_at DATETIME NOT NULL
+    );`,
+		),
+		Down: execStatements(
+			`DROP TABLE IF EXISTS pending_deletes;`,
+		),
+	},
+	{
+		Version: 24,
+		Name:    "mfa challenges",
+		// One row per password login awaiting its second factor. attempts
+		// counts submitted codes and used marks the challenge spent, so the
+		// limits hold across restarts and processes.
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS mfa_challenges (
+      challenge_id VARCHAR(64) PRIMARY KEY,
+      user_id VARCHAR(32) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+      attempts INTEGER NOT NULL DEFAULT 0,
+      used INTEGER NOT NULL DEFAULT 0,
+      expires_at DATETIME NOT NULL,
+      created_at DATETIME NOT NULL
+    );`,
+		),
+		Down: execStatements(
+			`DROP TABLE IF EXISTS mfa_challenges;`,
+		),
+	},
+}
+
+// LatestSchemaVersion is the schema version this binary was built for.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the highest applied migration, or 0 for a database
+// that has never been migrated.
+func (db *DB) SchemaVersion(ctx context.Context) (int, error) {
+	if err := db.ensureMigrationsTable(ctx); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.sql.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+func (db *DB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	if err := db.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := db.sql.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]MigrationStatus{}
+	for rows.Next() {
+		var status MigrationStatus
+		if err := rows.Scan(&status.Version, &status.Name, &status.AppliedAt); err != nil {
+			return nil, err
+		}
+		status.Applied = true
+		applied[status.Version] = status
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		if status, ok := applied[migration.Version]; ok {
+			result = append(result, status)
+			delete(applied, migration.Version)
+			continue
+		}
+		result = append(result, MigrationStatus{Version: migration.Version, Name: migration.Name})
+	}
+	// Versions recorded by a newer binary are reported as applied so the
+	// operator can see why startup is refused.
+	for _, status := range applied {
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// MigrateUp applies all pending migrations in order and returns the versions
+// it applied.
+func (db *DB) MigrateUp(ctx context.Context) ([]int, error) {
+	current, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return nil, fmt.Errorf("database schema version %d is newer than this binary supports (%d)", current, latest)
+	}
+
+	applied := []int{}
+	for _, migration := range migrations {
+		if migration.Version <= current {
+			continue
+		}
+		if err := db.runMigration(ctx, migration, true); err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+		applied = append(applied, migration.Version)
+	}
+	return applied, nil
+}
+
+// MigrateDownTo rolls back every applied migration above target, newest
+// first, and returns the versions it reverted.
+func (db *DB) MigrateDownTo(ctx context.Context, target int) ([]int, error) {
+	if target < 0 {
+		return nil, fmt.Errorf("invalid target version %d", target)
+	}
+	current, err := db.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return nil, fmt.Errorf("database schema version %d is newer than this binary supports (%d)", current, latest)
+	}
+
+	reverted := []int{}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version <= target || migration.Version > current {
+			continue
+		}
+		if err := db.runMigration(ctx, migration, false); err != nil {
+			return reverted, fmt.Errorf("rollback %d (%s): %w", migration.Version, migration.Name, err)
+		}
+		reverted = append(reverted, migration.Version)
+	}
+	return reverted, nil
+}
+
+func (db *DB) runMigration(ctx context.Context, migration Migration, up bool) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		if err := migration.Up(tx); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			migration.Version,
+			migration.Name,
+			NowRFC3339(),
+		); err != nil {
+			return err
+		}
+	} else {
+		if migration.Down == nil {
+			return fmt.Errorf("migration %d is irreversible", migration.Version)
+		}
+		if err := migration.Down(tx); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, migration.Version); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *DB) ensureMigrationsTable(ctx context.Context) error {
+	_, err := db.sql.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+      version INTEGER PRIMARY KEY,
+      name VARCHAR(100) NOT NULL,
+      applied_at DATETIME NOT NULL
+    );`)
+	return err
+}
+
+func execStatements(statements ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// chainAuditLogs fills prev_hash and hash for every audit entry. The query
+// and the hash are frozen copies of the version 20 format, so later changes
+// to AuditLog or AuditHash do not change what this migration writes.
+func chainAuditLogs(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, created_at, action, COALESCE(actor, ''), COALESCE(file_id, ''), COALESCE(ip_address, ''), COALESCE(status, ''), COALESCE(message, '')
+    FROM audit_logs ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	type chainEntry struct {
+		id     int64
+		fields []interface{}
+	}
+	entries := make([]chainEntry, 0)
+	for rows.Next() {
+		var id int64
+		var createdAt, action, actor, fileID, ipAddress, status, message string
+		if err := rows.Scan(&id, &createdAt, &action, &actor, &fileID, &ipAddress, &status, &message); err != nil {
+			rows.Close()
+			return err
+		}
+		entries = append(entries, chainEntry{id: id, fields: []interface{}{id, createdAt, action, actor, fileID, ipAddress, status, message}})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	prevHash := ""
+	for _, entry := range entries {
+		data, err := json.Marshal(append([]interface{}{prevHash}, entry.fields...))
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		if _, err := tx.Exec(`UPDATE audit_logs SET prev_hash = ?, hash = ? WHERE id = ?`, prevHash, hash, entry.id); err != nil {
+			return err
+		}
+		prevHash = hash
+	}
+	return nil
+}
+
+// addColumnIfMissing adds a column unless an earlier, unversioned build
+// already created it.
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	exists, err := columnExists(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
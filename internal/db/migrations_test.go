@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// connectTestDB opens a fresh database without migrating it.
+func connectTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := Connect(filepath.Join(t.TempDir(), "filehub.db"))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// schema lists every table, index and trigger with the SQL that creates it.
+func schema(t *testing.T, db *DB) map[string]string {
+	t.Helper()
+	rows, err := db.sql.Query(`SELECT type, name, COALESCE(sql, '') FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	result := map[string]string{}
+	for rows.Next() {
+		var kind, name, sql string
+		if err := rows.Scan(&kind, &name, &sql); err != nil {
+			t.Fatal(err)
+		}
+		// A table rebuilt by a rollback and renamed into place keeps its
+		// name quoted.
+		result[kind+" "+name] = strings.Replace(sql, `TABLE "`+name+`"`, "TABLE "+name, 1)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestMigrationsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db := connectTestDB(t)
+
+	applied, err := db.MigrateUp(ctx)
+	if err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("applied %d of %d migrations", len(applied), len(migrations))
+	}
+	latest := schema(t, db)
+	if again, err := db.MigrateUp(ctx); err != nil || len(again) != 0 {
+		t.Fatalf("second migrate up applied %v, %v", again, err)
+	}
+
+	reverted, err := db.MigrateDownTo(ctx, 0)
+	if err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if len(reverted) != len(migrations) {
+		t.Fatalf("reverted %d of %d migrations", len(reverted), len(migrations))
+	}
+	if left := schema(t, db); len(left) != 1 || left["table schema_migrations"] == "" {
+		t.Fatalf("objects left after rolling back everything: %v", left)
+	}
+	if version, err := db.SchemaVersion(ctx); err != nil || version != 0 {
+		t.Fatalf("schema version after rollback: %d, %v", version, err)
+	}
+
+	if _, err := db.MigrateUp(ctx); err != nil {
+		t.Fatalf("migrate up again: %v", err)
+	}
+	if again := schema(t, db); !reflect.DeepEqual(again, latest) {
+		t.Fatalf("schema differs after a round trip:\n%v\nwant\n%v", again, latest)
+	}
+}
+
+// TestMigrationsStepDown rolls back and reapplies each migration on its own,
+// with data in the tables, so a Down that does not undo exactly its Up shows
+// up at the version that has it. The initial schema is left to the round
+// trip, since rolling it back drops every table.
+func TestMigrationsStepDown(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	addFolder(t, db, "docs", "docs", nil)
+	addFile(t, db, "f1", "a.txt", 3, ptr("docs"))
+	latest := schema(t, db)
+
+	for i := len(migrations) - 1; i >= 1; i-- {
+		version := migrations[i].Version
+		if _, err := db.MigrateDownTo(ctx, version-1); err != nil {
+			t.Fatalf("roll back to %d: %v", version-1, err)
+		}
+		if _, err := db.MigrateUp(ctx); err != nil {
+			t.Fatalf("reapply from %d: %v", version-1, err)
+		}
+		if again := schema(t, db); !reflect.DeepEqual(again, latest) {
+			t.Fatalf("schema differs after reapplying %d (%s)", version, migrations[i].Name)
+		}
+		if _, err := db.GetFile(ctx, "f1"); err != nil {
+			t.Fatalf("file lost after reapplying %d (%s): %v", version, migrations[i].Name, err)
+		}
+	}
+}
+
+// TestMigrateLegacyDatabase upgrades a database created before migrations
+// were versioned, which already has the tables of the first migrations.
+func TestMigrateLegacyDatabase(t *testing.T) {
+	ctx := context.Background()
+	db := connectTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE files (id INTEGER PRIMARY KEY AUTOINCREMENT, file_id VARCHAR(12) UNIQUE NOT NULL, original_name VARCHAR(255) NOT NULL,
+      object_key VARCHAR(512) NOT NULL, size BIGINT NOT NULL, mime_type VARCHAR(100), created_by VARCHAR(64) NOT NULL,
+      created_at DATETIME NOT NULL, updated_at DATETIME NOT NULL, metadata JSON)`,
+		`INSERT INTO files (file_id, original_name, object_key, size, mime_type, created_by, created_at, updated_at)
+      VALUES ('f1', 'a.txt', 'objects/f1', 3, 'text/plain', 'local', '2024-01-01T00:00:00Z', '2024-01-01T00:00:00Z')`,
+	} {
+		if _, err := db.sql.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.MigrateUp(ctx); err != nil {
+		t.Fatalf("migrate legacy database: %v", err)
+	}
+	file, err := db.GetFile(ctx, "f1")
+	if err != nil || file.FolderID != nil {
+		t.Fatalf("legacy file after migrating: %+v, %v", file, err)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	next := LatestSchemaVersion() + 1
+	if _, err := db.sql.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'from the future', ?)`, next, NowRFC3339()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MigrateUp(ctx); err == nil {
+		t.Error("migrate up accepted a newer schema")
+	}
+	if _, err := db.MigrateDownTo(ctx, 0); err == nil {
+		t.Error("migrate down accepted a newer schema")
+	}
+	status, err := db.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := status[len(status)-1]
+	if last.Version != next || !last.Applied {
+		t.Errorf("newer version not reported: %+v", last)
+	}
+	if _, err := db.MigrateDownTo(ctx, -1); err == nil {
+		t.Error("negative target accepted")
+	}
+}
+
+// TestMigrateUserRoles checks that accounts created before roles keep their
+// access: admins stay admins and everyone else becomes an editor.
+func TestMigrateUserRoles(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	if _, err := db.MigrateDownTo(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	now := NowRFC3339()
+	for _, user := range []struct {
+		name    string
+		isAdmin bool
+	}{{"alice", true}, {"bob", false}} {
+		if _, err := db.sql.Exec(`INSERT INTO users (user_id, username, password_hash, is_admin, created_at, updated_at) VALUES (?, ?, 'x', ?, ?, ?)`,
+			"u_"+user.name, user.name, user.isAdmin, now, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for name, role := range map[string]string{"alice": "admin", "bob": "editor"} {
+		if user, err := db.GetUserByUsername(ctx, name); err != nil || user.Role != role {
+			t.Errorf("%s after migrating: %+v, %v", name, user, err)
+		}
+	}
+}
+
+func TestMigrateChainsAuditLogs(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	if _, err := db.MigrateDownTo(ctx, 19); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{"login", "upload", "download"} {
+		// Entries written before the chain may have NULL columns.
+		if _, err := db.sql.Exec(`INSERT INTO audit_logs (action, file_id, actor, ip_address, status, message, created_at) VALUES (?, NULL, 'alice', NULL, 'success', NULL, ?)`,
+			action, NowRFC3339()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddAuditLog(ctx, "logout", "", "alice", "", "success", ""); err != nil {
+		t.Fatal(err)
+	}
+	checkAuditChain(t, db, 4)
+}
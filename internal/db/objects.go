@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type DedupStats struct {
+	Objects      int
+	References   int
+	StoredBytes  int64
+	LogicalBytes int64
+}
+
+// AcquireObject registers a reference to the object holding content sha256.
+// When the content is already stored it returns the existing object key and
+// created=false, and the caller should discard the object it just wrote.
+func (db *DB) AcquireObject(ctx context.Context, sha256, objectKey string, size int64) (string, bool, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback()
+
+	var existingKey string
+	err = tx.QueryRowContext(ctx, `SELECT object_key FROM objects WHERE sha256 = ?`, sha256).Scan(&existingKey)
+	switch {
+	case err == nil:
+		if _, err := tx.ExecContext(ctx, `UPDATE objects SET ref_count = ref_count + 1 WHERE sha256 = ?`, sha256); err != nil {
+			return "", false, err
+		}
+		return existingKey, false, tx.Commit()
+	case errors.Is(err, sql.ErrNoRows):
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO objects (sha256, object_key, size, ref_count, created_at) VALUES (?, ?, ?, 1, ?)`,
+			sha256,
+			objectKey,
+			size,
+			NowRFC3339(),
+		); err != nil {
+			return "", false, err
+		}
+		return objectKey, true, tx.Commit()
+	default:
+		return "", false, err
+	}
+}
+
+// ReleaseObject drops one reference to objectKey. tracked is false for
+// objects stored before deduplication was enabled; those belong to a single
+// file and can be deleted right away.
+func (db *DB) ReleaseObject(ctx context.Context, objectKey string) (int, bool, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	var refCount int
+	err = tx.QueryRowContext(ctx, `SELECT ref_count FROM objects WHERE object_key = ?`, objectKey).Scan(&refCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	refCount--
+	if refCount <= 0 {
+		refCount = 0
+		_, err = tx.ExecContext(ctx, `DELETE FROM objects WHERE object_key = ?`, objectKey)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE objects SET ref_count = ? WHERE object_key = ?`, refCount, objectKey)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return refCount, true, tx.Commit()
+}
+
+func (db *DB) GetDedupStats(ctx context.Context) (DedupStats, error) {
+	var stats DedupStats
+	err := db.sql.QueryRowContext(ctx, `
+    SELECT COUNT(1), COALESCE(SUM(ref_count), 0), COALESCE(SUM(size), 0), COALESCE(SUM(size * ref_count), 0)
+    FROM objects`).Scan(&stats.Objects, &stats.References, &stats.StoredBytes, &stats.LogicalBytes)
+	if err != nil {
+		return DedupStats{}, err
+	}
+	return stats, nil
+}
+
+// PendingDelete is an object whose storage delete failed and is retried.
+type PendingDelete struct {
+	ObjectKey string
+	Attempts  int
+	LastError string
+	CreatedAt string
+	UpdatedAt string
+}
+
+// AddPendingDelete queues objectKey for another delete attempt, or counts
+// one more failed attempt when it is already queued.
+func (db *DB) AddPendingDelete(ctx context.Context, objectKey, lastError string) error {
+	now := NowRFC3339()
+	_, err := db.sql.ExecContext(ctx, `
+    INSERT INTO pending_deletes (object_key, attempts, last_error, created_at, updated_at) VALUES (?, 1, ?, ?, ?)
+    ON CONFLICT(object_key) DO UPDATE SET attempts = attempts + 1, last_error = excluded.last_error, updated_at = excluded.updated_at`,
+		objectKey, lastError, now, now)
+	return err
+}
+
+// ListPendingDeletes returns up to limit queued objects, least recently tried
+// first.
+func (db *DB) ListPendingDeletes(ctx context.Context, limit int) ([]PendingDelete, error) {
+	rows, err := db.sql.QueryContext(ctx, `
+    SELECT object_key, attempts, COALESCE(last_error, ''), created_at, updated_at
+    FROM pending_deletes ORDER BY updated_at LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := make([]PendingDelete, 0)
+	for rows.Next() {
+		var item PendingDelete
+		if err := rows.Scan(&item.ObjectKey, &item.Attempts, &item.LastError, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			return nil, err
+		}
+		pending = append(pending, item)
+	}
+	return pending, rows.Err()
+}
+
+func (db *DB) RemovePendingDelete(ctx context.Context, objectKey string) error {
+	_, err := db.sql.ExecContext(ctx, `DELETE FROM pending_deletes WHERE object_key = ?`, objectKey)
+	return err
+}
+
+// ObjectInUse reports whether any file, version or dedup entry still points
+// at objectKey, so a queued delete must not run.
+func (db *DB) ObjectInUse(ctx context.Context, objectKey string) (bool, error) {
+	var inUse bool
+	err := db.sql.QueryRowContext(ctx, `
+    SELECT EXISTS (SELECT 1 FROM objects WHERE object_key = ?)
+      OR EXISTS (SELECT 1 FROM files WHERE object_key = ?)
+      OR EXISTS (SELECT 1 FROM file_versions WHERE object_key = ?)`,
+		objectKey, objectKey, objectKey).Scan(&inUse)
+	return inUse, err
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Name match modes for FileQuery.Match.
+const (
+	MatchSubstring = "substring"
+	MatchGlob      = "glob"
+	MatchRegex     = "regex"
+)
+
+// FileQuery selects files for SearchFiles. Zero values do not filter.
+// MimeTypes entries ending in "/" or "/*" match a whole type ("image/*");
+// Extensions are compared without the dot and case-insensitively. Dates
+// are RFC3339, the After bounds inclusive and the Before bounds exclusive.
+// FolderID limits the search to a folder, and to everything below it with
+// Recursive; RootOnly limits it to files outside any folder.
+type FileQuery struct {
+	Name          string
+	Match         string
+	MimeTypes     []string
+	Extensions    []string
+	MinSize       *int64
+	MaxSize       *int64
+	CreatedAfter  string
+	CreatedBefore string
+	UpdatedAfter  string
+	UpdatedBefore string
+	CreatedBy     string
+	FolderID      string
+	Recursive     bool
+	RootOnly      bool
+	Sort          string
+	Order         string
+	Limit         int
+	Offset        int
+	Hidden        Visibility
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+var fileSortColumns = map[string]string{
+	"name":    "original_name COLLATE NOCASE",
+	"size":    "size",
+	"created": "created_at",
+	"updated": "updated_at",
+}
+
+// SearchFiles returns one page of the files matching query and the total
+// number of matches. Unknown Sort values sort by creation time.
+func (db *DB) SearchFiles(ctx context.Context, query FileQuery) ([]FileRecord, int, error) {
+	conditions := []string{"deleted_at IS NULL"}
+	args := []interface{}{}
+	if query.Name != "" {
+		switch query.Match {
+		case MatchGlob:
+			conditions = append(conditions, "lower(original_name) GLOB lower(?)")
+		case MatchRegex:
+			conditions = append(conditions, "original_name REGEXP ?")
+		default:
+			// Wildcards are what MatchGlob is for; here % and _ are literal.
+			conditions = append(conditions, `original_name LIKE ? ESCAPE '\'`)
+			query.Name = "%" + likeEscaper.Replace(query.Name) + "%"
+		}
+		args = append(args, query.Name)
+	}
+	if len(query.MimeTypes) > 0 {
+		alternatives := make([]string, 0, len(query.MimeTypes))
+		for _, mimeType := range query.MimeTypes {
+			mimeType = strings.ToLower(strings.TrimSuffix(mimeType, "*"))
+			if strings.HasSuffix(mimeType, "/") {
+				alternatives = append(alternatives, "lower(mime_type) LIKE ?")
+				args = append(args, mimeType+"%")
+				continue
+			}
+			// Stored types may carry parameters such as "; charset=utf-8".
+			alternatives = append(alternatives, "(lower(mime_type) = ? OR lower(mime_type) LIKE ?)")
+			args = append(args, mimeType, mimeType+";%")
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	if len(query.Extensions) > 0 {
+		alternatives := make([]string, 0, len(query.Extensions))
+		for _, extension := range query.Extensions {
+			alternatives = append(alternatives, `lower(original_name) LIKE ? ESCAPE '\'`)
+			args = append(args, "%."+likeEscaper.Replace(strings.ToLower(strings.TrimPrefix(extension, "."))))
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	if query.MinSize != nil {
+		conditions = append(conditions, "size >= ?")
+		args = append(args, *query.MinSize)
+	}
+	if query.MaxSize != nil {
+		conditions = append(conditions, "size <= ?")
+		args = append(args, *query.MaxSize)
+	}
+	for _, bound := range []struct {
+		condition string
+		value     string
+	}{
+		{"created_at >= ?", query.CreatedAfter},
+		{"created_at < ?", query.CreatedBefore},
+		{"updated_at >= ?", query.UpdatedAfter},
+		{"updated_at < ?", query.UpdatedBefore},
+	} {
+		if bound.value != "" {
+			conditions = append(conditions, bound.condition)
+			args = append(args, bound.value)
+		}
+	}
+	if query.CreatedBy != "" {
+		conditions = append(conditions, "created_by = ?")
+		args = append(args, query.CreatedBy)
+	}
+	switch {
+	case query.FolderID != "" && query.Recursive:
+		conditions = append(conditions, `folder_id IN (
+    WITH RECURSIVE subtree(folder_id) AS (
+      SELECT folder_id FROM folders WHERE folder_id = ? AND deleted_at IS NULL
+      UNION ALL
+      SELECT f.folder_id FROM folders f JOIN subtree s ON f.parent_id = s.folder_id WHERE f.deleted_at IS NULL
+    )
+    SELECT folder_id FROM subtree)`)
+		args = append(args, query.FolderID)
+	case query.FolderID != "":
+		conditions = append(conditions, "folder_id = ?")
+		args = append(args, query.FolderID)
+	case query.RootOnly:
+		conditions = append(conditions, "folder_id IS NULL")
+	}
+	hiddenConditions, hiddenArgs := query.Hidden.conditions("folder_id")
+	conditions = append(conditions, hiddenConditions...)
+	args = append(args, hiddenArgs...)
+
+	order := "DESC"
+	if query.Order == "asc" {
+		order = "ASC"
+	}
+	column, ok := fileSortColumns[query.Sort]
+	if !ok {
+		column = fileSortColumns["created"]
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	if err := db.sql.QueryRowContext(ctx, "SELECT COUNT(1) FROM files"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.sql.QueryContext(ctx, "SELECT "+fileColumns+" FROM files"+where+" ORDER BY "+column+" "+order+", id "+order+" LIMIT ? OFFSET ?", append(args, query.Limit, query.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	records := make([]FileRecord, 0)
+	for rows.Next() {
+		record, err := scanFile(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, record)
+	}
+	return records, total, rows.Err()
+}
+
+// regexpCache keeps compiled search patterns; it is cleared when it grows
+// past regexpCacheSize, since the patterns come from users.
+var regexpCache = struct {
+	sync.Mutex
+	patterns map[string]*regexp.Regexp
+}{patterns: map[string]*regexp.Regexp{}}
+
+const regexpCacheSize = 64
+
+// matchRegexp implements SQLite's "value REGEXP pattern", which calls
+// regexp(pattern, value).
+func matchRegexp(pattern, value string) (bool, error) {
+	regexpCache.Lock()
+	compiled, ok := regexpCache.patterns[pattern]
+	regexpCache.Unlock()
+	if !ok {
+		var err error
+		if compiled, err = regexp.Compile(pattern); err != nil {
+			return false, err
+		}
+		regexpCache.Lock()
+		if len(regexpCache.patterns) >= regexpCacheSize {
+			regexpCache.patterns = map[string]*regexp.Regexp{}
+		}
+		regexpCache.patterns[pattern] = compiled
+		regexpCache.Unlock()
+	}
+	return compiled.MatchString(value), nil
+}
@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// newSearchTree holds docs/2024 and these files:
+//
+//	a  "Report.PDF"    application/pdf           300  alice  docs       2026-01-01
+//	b  "photo_1.jpg"   image/jpeg                2000 bob    docs/2024  2026-02-01
+//	c  "photo11.png"   image/png                 5000 alice  docs/2024  2026-03-01
+//	d  "notes.txt"     text/plain; charset=utf-8 10   bob    root       2026-04-01
+//	e  "50% off.txt"   text/plain                20   alice  root       2026-05-01
+func newSearchTree(t *testing.T) *DB {
+	t.Helper()
+	db := newTestDB(t)
+	addFolder(t, db, "docs", "docs", nil)
+	addFolder(t, db, "2024", "2024", ptr("docs"))
+	for _, file := range []struct {
+		id, name, mimeType string
+		size               int64
+		createdBy          string
+		folderID           *string
+		createdAt          string
+	}{
+		{"a", "Report.PDF", "application/pdf", 300, "alice", ptr("docs"), "2026-01-01T00:00:00Z"},
+		{"b", "photo_1.jpg", "image/jpeg", 2000, "bob", ptr("2024"), "2026-02-01T00:00:00Z"},
+		{"c", "photo11.png", "image/png", 5000, "alice", ptr("2024"), "2026-03-01T00:00:00Z"},
+		{"d", "notes.txt", "text/plain; charset=utf-8", 10, "bob", nil, "2026-04-01T00:00:00Z"},
+		{"e", "50% off.txt", "text/plain", 20, "alice", nil, "2026-05-01T00:00:00Z"},
+	} {
+		record := FileRecord{
+			FileID:       file.id,
+			OriginalName: file.name,
+			ObjectKey:    "objects/" + file.id,
+			Size:         file.size,
+			MimeType:     file.mimeType,
+			FolderID:     file.folderID,
+			CreatedBy:    file.createdBy,
+			CreatedAt:    file.createdAt,
+			UpdatedAt:    file.createdAt,
+		}
+		if err := db.CreateFile(context.Background(), record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func int64Ptr(value int64) *int64 {
+	return &value
+}
+
+func TestSearchFilesFilters(t *testing.T) {
+	ctx := context.Background()
+	db := newSearchTree(t)
+	// 2024 is open to editors only.
+	setACL(t, db, "2024", [3]string{"role", "editor", "read"})
+	tests := []struct {
+		name  string
+		query FileQuery
+		want  []string
+	}{
+		{"everything", FileQuery{}, []string{"a", "b", "c", "d", "e"}},
+		{"substring ignores case", FileQuery{Name: "report"}, []string{"a"}},
+		{"substring underscore is literal", FileQuery{Name: "o_1"}, []string{"b"}},
+		{"substring percent is literal", FileQuery{Name: "50%"}, []string{"e"}},
+		{"glob matches the whole name", FileQuery{Name: "photo*", Match: MatchGlob}, []string{"b", "c"}},
+		{"glob ignores case", FileQuery{Name: "*.pdf", Match: MatchGlob}, []string{"a"}},
+		{"glob single character", FileQuery{Name: "photo?1.*", Match: MatchGlob}, []string{"b", "c"}},
+		{"glob character class", FileQuery{Name: "photo[_]*", Match: MatchGlob}, []string{"b"}},
+		{"glob without wildcards", FileQuery{Name: "notes", Match: MatchGlob}, []string{}},
+		{"regex", FileQuery{Name: `^photo\d+\.png$`, Match: MatchRegex}, []string{"c"}},
+		{"regex is case-sensitive", FileQuery{Name: `\.pdf$`, Match: MatchRegex}, []string{}},
+		{"regex flags", FileQuery{Name: `(?i)\.pdf$`, Match: MatchRegex}, []string{"a"}},
+		{"mime type", FileQuery{MimeTypes: []string{"application/pdf"}}, []string{"a"}},
+		{"mime type with parameters", FileQuery{MimeTypes: []string{"text/plain"}}, []string{"d", "e"}},
+		{"mime wildcard", FileQuery{MimeTypes: []string{"image/*"}}, []string{"b", "c"}},
+		{"mime type prefix", FileQuery{MimeTypes: []string{"image/"}}, []string{"b", "c"}},
+		{"several mime types", FileQuery{MimeTypes: []string{"IMAGE/PNG", "application/pdf"}}, []string{"a", "c"}},
+		{"extension", FileQuery{Extensions: []string{".PDF", "jpg"}}, []string{"a", "b"}},
+		{"size range", FileQuery{MinSize: int64Ptr(20), MaxSize: int64Ptr(2000)}, []string{"a", "b", "e"}},
+		{"created range", FileQuery{CreatedAfter: "2026-02-01T00:00:00Z", CreatedBefore: "2026-04-01T00:00:00Z"}, []string{"b", "c"}},
+		{"updated after", FileQuery{UpdatedAfter: "2026-04-01T00:00:00Z"}, []string{"d", "e"}},
+		{"creator", FileQuery{CreatedBy: "bob"}, []string{"b", "d"}},
+		{"folder", FileQuery{FolderID: "docs"}, []string{"a"}},
+		{"folder and below", FileQuery{FolderID: "docs", Recursive: true}, []string{"a", "b", "c"}},
+		{"root only", FileQuery{RootOnly: true}, []string{"d", "e"}},
+		{"hidden folders", FileQuery{Hidden: Visibility{Caller: &ACLCaller{Role: "viewer"}}}, []string{"a", "d", "e"}},
+		{"hidden root", FileQuery{Hidden: Visibility{Root: true}}, []string{"a", "b", "c"}},
+		{"combined", FileQuery{Name: "photo", MimeTypes: []string{"image/*"}, CreatedBy: "alice"}, []string{"c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := test.query
+			query.Limit = 100
+			records, total, err := db.SearchFiles(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(records))
+			for _, record := range records {
+				got = append(got, record.FileID)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) || total != len(test.want) {
+				t.Errorf("got %v (total %d), want %v", got, total, test.want)
+			}
+		})
+	}
+}
+
+func TestSearchFilesSortAndPage(t *testing.T) {
+	ctx := context.Background()
+	db := newSearchTree(t)
+	tests := []struct {
+		sort, order   string
+		limit, offset int
+		want          []string
+	}{
+		{"created", "desc", 100, 0, []string{"e", "d", "c", "b", "a"}},
+		{"created", "asc", 100, 0, []string{"a", "b", "c", "d", "e"}},
+		{"name", "asc", 100, 0, []string{"e", "d", "c", "b", "a"}},
+		{"size", "desc", 100, 0, []string{"c", "b", "a", "e", "d"}},
+		{"updated", "asc", 2, 2, []string{"c", "d"}},
+		{"unknown", "asc", 2, 0, []string{"a", "b"}},
+	}
+	for _, test := range tests {
+		records, total, err := db.SearchFiles(ctx, FileQuery{Sort: test.sort, Order: test.order, Limit: test.limit, Offset: test.offset})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(records))
+		for _, record := range records {
+			got = append(got, record.FileID)
+		}
+		if !reflect.DeepEqual(got, test.want) || total != 5 {
+			t.Errorf("sort %s %s: got %v (total %d), want %v", test.sort, test.order, got, total, test.want)
+		}
+	}
+}
+
+func TestSearchFilesSkipsTrash(t *testing.T) {
+	ctx := context.Background()
+	db := newSearchTree(t)
+	if _, err := db.TrashFile(ctx, "a", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, err := db.SearchFiles(ctx, FileQuery{Name: "report", Limit: 10}); err != nil || total != 0 {
+		t.Errorf("trashed file found: %d, %v", total, err)
+	}
+}
+
+func TestMatchRegexp(t *testing.T) {
+	if ok, err := matchRegexp(`^a.c$`, "abc"); err != nil || !ok {
+		t.Errorf("match: %v, %v", ok, err)
+	}
+	if ok, err := matchRegexp(`^a.c$`, "abd"); err != nil || ok {
+		t.Errorf("mismatch: %v, %v", ok, err)
+	}
+	if _, err := matchRegexp(`(`, "abc"); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+	for i := 0; i < regexpCacheSize*2; i++ {
+		if _, err := matchRegexp(`^x{`+strconv.Itoa(i)+`}`, "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	regexpCache.Lock()
+	size := len(regexpCache.patterns)
+	regexpCache.Unlock()
+	if size > regexpCacheSize {
+		t.Errorf("cache grew to %d patterns", size)
+	}
+}
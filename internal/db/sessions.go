@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Session is one login of a user on one device. Each refresh rotates its
+// refresh token and moves ExpiresAt forward.
+type Session struct {
+	SessionID  string
+	UserID     string
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  string
+	LastUsedAt string
+	ExpiresAt  string
+	RevokedAt  *string
+}
+
+const sessionColumns = `session_id, user_id, user_agent, ip_address, created_at, last_used_at, expires_at, revoked_at`
+
+func scanSession(row rowScanner) (Session, error) {
+	var session Session
+	var revokedAt sql.NullString
+	if err := row.Scan(
+		&session.SessionID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&revokedAt,
+	); err != nil {
+		return Session{}, err
+	}
+	session.RevokedAt = nullStringPtr(revokedAt)
+	return session, nil
+}
+
+func (db *DB) CreateSession(ctx context.Context, session Session) error {
+	_, err := db.sql.ExecContext(
+		ctx,
+		`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, NULL)`,
+		session.SessionID,
+		session.UserID,
+		session.UserAgent,
+		session.IPAddress,
+		session.CreatedAt,
+		session.LastUsedAt,
+		session.ExpiresAt,
+	)
+	return err
+}
+
+func (db *DB) GetSession(ctx context.Context, sessionID string) (Session, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE session_id = ?`, sessionID)
+	return scanSession(row)
+}
+
+// ListUserSessions returns the sessions that are neither revoked nor
+// expired at now, most recently used first.
+func (db *DB) ListUserSessions(ctx context.Context, userID, now string) ([]Session, error) {
+	rows, err := db.sql.QueryContext(
+		ctx,
+		`SELECT `+sessionColumns+` FROM sessions
+    WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+    ORDER BY last_used_at DESC`,
+		userID,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession records a refresh from userAgent and ipAddress.
+func (db *DB) TouchSession(ctx context.Context, sessionID, userAgent, ipAddress, expiresAt string) error {
+	result, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE sessions SET user_agent = ?, ip_address = ?, last_used_at = ?, expires_at = ?
+    WHERE session_id = ? AND revoked_at IS NULL`,
+		userAgent,
+		ipAddress,
+		NowRFC3339(),
+		expiresAt,
+		sessionID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// RevokeSession ends a session and its whole refresh token family. It
+// returns sql.ErrNoRows when the session is unknown or already revoked.
+func (db *DB) RevokeSession(ctx context.Context, sessionID string) error {
+	count, err := db.revokeSessions(ctx, `session_id = ?`, sessionID)
+	if err == nil && count == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// RevokeUserSessions ends every session of a user, including refresh tokens
+// issued before sessions existed. It returns the number of sessions ended.
+func (db *DB) RevokeUserSessions(ctx context.Context, userID string) (int64, error) {
+	return db.revokeSessions(ctx, `user_id = ?`, userID)
+}
+
+func (db *DB) revokeSessions(ctx context.Context, condition, value string) (int64, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = ? WHERE revoked_at IS NULL AND `+condition, NowRFC3339(), value)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET is_revoked = true WHERE is_revoked = false AND `+condition, value); err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+// PurgeSessions deletes sessions that expired before now or were revoked
+// before revokedBefore, together with their refresh tokens, and every
+// expired refresh token. It returns the number of sessions deleted.
+func (db *DB) PurgeSessions(ctx context.Context, now, revokedBefore string) (int64, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	const stale = `expires_at <= ? OR revoked_at <= ?`
+	if _, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM refresh_tokens WHERE expires_at <= ? OR session_id IN (SELECT session_id FROM sessions WHERE `+stale+`)`,
+		now,
+		now,
+		revokedBefore,
+	); err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE `+stale, now, revokedBefore)
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
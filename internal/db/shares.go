@@ -0,0 +1,393 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+type ShareLink struct {
+	Token  string
+	FileID string
+	// FolderID is set for folder shares, whose FileID is empty.
+	FolderID *string
+	// Kind is "download", or "upload" for file drop links into FolderID.
+	Kind         string
+	ExpiresAt    string
+	CreatedAt    string
+	CreatedBy    string
+	Status       string
+	PasswordHash string
+	// MaxDownloads of 0 means unlimited.
+	MaxDownloads  int64
+	DownloadCount int64
+	Note          string
+	// Upload limits of 0 mean unlimited.
+	MaxUploadFiles int64
+	MaxUploadBytes int64
+	UploadedFiles  int64
+	UploadedBytes  int64
+}
+
+const shareLinkColumns = `token, file_id, folder_id, kind, expires_at, created_at, created_by, status, password_hash, max_downloads, download_count, note,
+      max_upload_files, max_upload_bytes, uploaded_files, uploaded_bytes`
+
+// scanTargets returns the Scan destinations matching shareLinkColumns.
+func (link *ShareLink) scanTargets(folderID *sql.NullString) []interface{} {
+	return []interface{}{
+		&link.Token,
+		&link.FileID,
+		folderID,
+		&link.Kind,
+		&link.ExpiresAt,
+		&link.CreatedAt,
+		&link.CreatedBy,
+		&link.Status,
+		&link.PasswordHash,
+		&link.MaxDownloads,
+		&link.DownloadCount,
+		&link.Note,
+		&link.MaxUploadFiles,
+		&link.MaxUploadBytes,
+		&link.UploadedFiles,
+		&link.UploadedBytes,
+	}
+}
+
+func scanShareLink(row rowScanner) (ShareLink, error) {
+	var link ShareLink
+	var folderID sql.NullString
+	if err := row.Scan(link.scanTargets(&folderID)...); err != nil {
+		return ShareLink{}, err
+	}
+	link.FolderID = nullStringPtr(folderID)
+	return link, nil
+}
+
+func (db *DB) CreateShareLink(ctx context.Context, link ShareLink) error {
+	_, err := db.sql.ExecContext(
+		ctx,
+		`INSERT INTO share_links (token, file_id, folder_id, kind, expires_at, created_at, created_by, status, password_hash, max_downloads, download_count, note, max_upload_files, max_upload_bytes)
+	 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		link.Token,
+		link.FileID,
+		link.FolderID,
+		link.Kind,
+		link.ExpiresAt,
+		link.CreatedAt,
+		link.CreatedBy,
+		link.Status,
+		link.PasswordHash,
+		link.MaxDownloads,
+		link.DownloadCount,
+		link.Note,
+		link.MaxUploadFiles,
+		link.MaxUploadBytes,
+	)
+	return err
+}
+
+func (db *DB) GetShareLink(ctx context.Context, token string) (ShareLink, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+shareLinkColumns+` FROM share_links WHERE token = ?`, token)
+	return scanShareLink(row)
+}
+
+// GetActiveShareLink returns the newest unexpired link for a file that was
+// created without a password or download limit, so it can be handed out again.
+func (db *DB) GetActiveShareLink(ctx context.Context, fileID, nowRFC3339 string) (ShareLink, error) {
+	row := db.sql.QueryRowContext(ctx, `
+    SELECT `+shareLinkColumns+`
+    FROM share_links
+    WHERE file_id = ? AND status = 'active' AND expires_at > ?
+      AND kind = 'download' AND password_hash = '' AND max_downloads = 0
+    ORDER BY created_at DESC
+    LIMIT 1`, fileID, nowRFC3339)
+	return scanShareLink(row)
+}
+
+// UpdateShareLink stores the mutable settings of a link.
+func (db *DB) UpdateShareLink(ctx context.Context, link ShareLink) error {
+	result, err := db.sql.ExecContext(ctx, `
+    UPDATE share_links
+    SET expires_at = ?, status = ?, password_hash = ?, max_downloads = ?, note = ?, max_upload_files = ?, max_upload_bytes = ?
+    WHERE token = ?`,
+		link.ExpiresAt,
+		link.Status,
+		link.PasswordHash,
+		link.MaxDownloads,
+		link.Note,
+		link.MaxUploadFiles,
+		link.MaxUploadBytes,
+		link.Token,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// ReserveShareUpload counts one upload of size bytes against an upload
+// link's limits. It returns sql.ErrNoRows when the upload would exceed them.
+func (db *DB) ReserveShareUpload(ctx context.Context, token string, size int64) error {
+	result, err := db.sql.ExecContext(ctx, `
+    UPDATE share_links
+    SET uploaded_files = uploaded_files + 1, uploaded_bytes = uploaded_bytes + ?
+    WHERE token = ? AND kind = 'upload'
+      AND (max_upload_files = 0 OR uploaded_files < max_upload_files)
+      AND (max_upload_bytes = 0 OR uploaded_bytes + ? <= max_upload_bytes)`, size, token, size)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// ReleaseShareUpload undoes a reservation whose upload failed.
+func (db *DB) ReleaseShareUpload(ctx context.Context, token string, size int64) error {
+	_, err := db.sql.ExecContext(ctx, `
+    UPDATE share_links
+    SET uploaded_files = uploaded_files - 1, uploaded_bytes = uploaded_bytes - ?
+    WHERE token = ?`, size, token)
+	return err
+}
+
+// IncrementShareDownloads counts one download against the link's limit. It
+// returns sql.ErrNoRows once the limit has been reached.
+func (db *DB) IncrementShareDownloads(ctx context.Context, token string) error {
+	result, err := db.sql.ExecContext(ctx, `
+    UPDATE share_links
+    SET download_count = download_count + 1
+    WHERE token = ? AND (max_downloads = 0 OR download_count < max_downloads)`, token)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// ShareLinkStats is a share link together with its access counters.
+type ShareLinkStats struct {
+	ShareLink
+	Accesses       int64
+	Completed      int64
+	BytesSent      int64
+	LastAccessedAt *string
+}
+
+// ShareFilter narrows ListShareLinks. Status is one of active, expired,
+// exhausted or revoked; Now is the reference time for the first three.
+type ShareFilter struct {
+	FileID        string
+	FolderID      string
+	Kind          string
+	Status        string
+	ExpiresBefore string
+	ExpiresAfter  string
+	Now           string
+	Limit         int
+	Offset        int
+	// Hidden leaves out links whose file or folder the caller cannot read.
+	Hidden Visibility
+}
+
+// shareTargetFolder is the folder that decides who may see a link: the
+// shared folder itself, or the folder of the shared file (NULL at the root).
+const shareTargetFolder = `COALESCE(share_links.folder_id, (SELECT files.folder_id FROM files WHERE files.file_id = share_links.file_id))`
+
+type ShareAccess struct {
+	ID         int64
+	Token      string
+	FileID     string
+	AccessedAt string
+	IPAddress  string
+	UserAgent  string
+	StatusCode int
+	// RangeStart is the offset of the first byte served.
+	RangeStart int64
+	BytesSent  int64
+	Completed  bool
+}
+
+const shareStatsQuery = `SELECT ` + shareLinkColumns + `,
+      COALESCE(a.accesses, 0), COALESCE(a.completed, 0), COALESCE(a.bytes_sent, 0), a.last_accessed_at
+    FROM share_links
+    LEFT JOIN (
+      SELECT token AS access_token, COUNT(1) AS accesses, SUM(completed) AS completed,
+        SUM(bytes_sent) AS bytes_sent, MAX(accessed_at) AS last_accessed_at
+      FROM share_accesses GROUP BY token
+    ) a ON a.access_token = share_links.token`
+
+func scanShareLinkStats(row rowScanner) (ShareLinkStats, error) {
+	var stats ShareLinkStats
+	var folderID, lastAccessedAt sql.NullString
+	targets := append(stats.ShareLink.scanTargets(&folderID),
+		&stats.Accesses,
+		&stats.Completed,
+		&stats.BytesSent,
+		&lastAccessedAt,
+	)
+	if err := row.Scan(targets...); err != nil {
+		return ShareLinkStats{}, err
+	}
+	stats.FolderID = nullStringPtr(folderID)
+	stats.LastAccessedAt = nullStringPtr(lastAccessedAt)
+	return stats, nil
+}
+
+func (db *DB) GetShareLinkStats(ctx context.Context, token string) (ShareLinkStats, error) {
+	row := db.sql.QueryRowContext(ctx, shareStatsQuery+` WHERE share_links.token = ?`, token)
+	return scanShareLinkStats(row)
+}
+
+// ShareTargetFolder returns the folder a link's visibility follows, nil for
+// a file at the root.
+func (db *DB) ShareTargetFolder(ctx context.Context, token string) (*string, error) {
+	var folderID sql.NullString
+	err := db.sql.QueryRowContext(ctx, `SELECT `+shareTargetFolder+` FROM share_links WHERE token = ?`, token).Scan(&folderID)
+	return nullStringPtr(folderID), err
+}
+
+const shareExhaustedCondition = `(
+      (max_downloads > 0 AND download_count >= max_downloads)
+      OR (max_upload_files > 0 AND uploaded_files >= max_upload_files)
+      OR (max_upload_bytes > 0 AND uploaded_bytes >= max_upload_bytes))`
+
+func (db *DB) ListShareLinks(ctx context.Context, filter ShareFilter) ([]ShareLinkStats, int, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.FileID != "" {
+		conditions = append(conditions, "file_id = ?")
+		args = append(args, filter.FileID)
+	}
+	if filter.FolderID != "" {
+		conditions = append(conditions, "folder_id = ?")
+		args = append(args, filter.FolderID)
+	}
+	if filter.Kind != "" {
+		conditions = append(conditions, "kind = ?")
+		args = append(args, filter.Kind)
+	}
+	switch filter.Status {
+	case "active":
+		conditions = append(conditions, "status = 'active' AND expires_at > ? AND NOT "+shareExhaustedCondition)
+		args = append(args, filter.Now)
+	case "expired":
+		conditions = append(conditions, "status = 'active' AND expires_at <= ?")
+		args = append(args, filter.Now)
+	case "exhausted":
+		conditions = append(conditions, "status = 'active' AND expires_at > ? AND "+shareExhaustedCondition)
+		args = append(args, filter.Now)
+	case "revoked":
+		conditions = append(conditions, "status = 'revoked'")
+	}
+	if filter.ExpiresBefore != "" {
+		conditions = append(conditions, "expires_at < ?")
+		args = append(args, filter.ExpiresBefore)
+	}
+	if filter.ExpiresAfter != "" {
+		conditions = append(conditions, "expires_at > ?")
+		args = append(args, filter.ExpiresAfter)
+	}
+	hiddenConditions, hiddenArgs := filter.Hidden.conditions(shareTargetFolder)
+	conditions = append(conditions, hiddenConditions...)
+	args = append(args, hiddenArgs...)
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := db.sql.QueryRowContext(ctx, "SELECT COUNT(1) FROM share_links"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.sql.QueryContext(ctx, shareStatsQuery+where+" ORDER BY share_links.created_at DESC LIMIT ? OFFSET ?", append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	links := make([]ShareLinkStats, 0)
+	for rows.Next() {
+		stats, err := scanShareLinkStats(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		links = append(links, stats)
+	}
+	return links, total, rows.Err()
+}
+
+func (db *DB) AddShareAccess(ctx context.Context, access ShareAccess) error {
+	_, err := db.sql.ExecContext(
+		ctx,
+		`INSERT INTO share_accesses (token, file_id, accessed_at, ip_address, user_agent, status_code, range_start, bytes_sent, completed)
+	 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		access.Token,
+		access.FileID,
+		access.AccessedAt,
+		access.IPAddress,
+		access.UserAgent,
+		access.StatusCode,
+		access.RangeStart,
+		access.BytesSent,
+		access.Completed,
+	)
+	return err
+}
+
+// LastShareDownload returns the newest successful download of fileID through
+// token from ipAddress.
+func (db *DB) LastShareDownload(ctx context.Context, token, fileID, ipAddress string) (ShareAccess, error) {
+	var access ShareAccess
+	err := db.sql.QueryRowContext(ctx, `
+    SELECT id, token, file_id, accessed_at, COALESCE(ip_address, ''), COALESCE(user_agent, ''), status_code, range_start, bytes_sent, completed
+    FROM share_accesses
+    WHERE token = ? AND file_id = ? AND ip_address = ? AND status_code IN (200, 206)
+    ORDER BY id DESC LIMIT 1`, token, fileID, ipAddress).Scan(
+		&access.ID,
+		&access.Token,
+		&access.FileID,
+		&access.AccessedAt,
+		&access.IPAddress,
+		&access.UserAgent,
+		&access.StatusCode,
+		&access.RangeStart,
+		&access.BytesSent,
+		&access.Completed,
+	)
+	return access, err
+}
+
+func (db *DB) ListShareAccesses(ctx context.Context, token string, limit, offset int) ([]ShareAccess, int, error) {
+	var total int
+	if err := db.sql.QueryRowContext(ctx, `SELECT COUNT(1) FROM share_accesses WHERE token = ?`, token).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.sql.QueryContext(ctx, `
+    SELECT id, token, file_id, accessed_at, COALESCE(ip_address, ''), COALESCE(user_agent, ''), status_code, range_start, bytes_sent, completed
+    FROM share_accesses WHERE token = ?
+    ORDER BY id DESC LIMIT ? OFFSET ?`, token, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	accesses := make([]ShareAccess, 0)
+	for rows.Next() {
+		var access ShareAccess
+		if err := rows.Scan(
+			&access.ID,
+			&access.Token,
+			&access.FileID,
+			&access.AccessedAt,
+			&access.IPAddress,
+			&access.UserAgent,
+			&access.StatusCode,
+			&access.RangeStart,
+			&access.BytesSent,
+			&access.Completed,
+		); err != nil {
+			return nil, 0, err
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses, total, rows.Err()
+}
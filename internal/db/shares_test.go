@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func addShare(t *testing.T, db *DB, link ShareLink) {
+	t.Helper()
+	if link.CreatedAt == "" {
+		link.CreatedAt = "2024-01-01T00:00:00Z"
+	}
+	link.CreatedBy = "alice"
+	if link.Status == "" {
+		link.Status = "active"
+	}
+	if err := db.CreateShareLink(context.Background(), link); err != nil {
+		t.Fatalf("create share %s: %v", link.Token, err)
+	}
+}
+
+func TestListShareLinks(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	addFile(t, db, "f1", "a.txt", 3, nil)
+	addFile(t, db, "f2", "b.txt", 3, nil)
+	const now = "2024-06-01T00:00:00Z"
+	addShare(t, db, ShareLink{Token: "active", FileID: "f1", ExpiresAt: "2024-07-01T00:00:00Z"})
+	addShare(t, db, ShareLink{Token: "limited", FileID: "f1", ExpiresAt: "2024-08-01T00:00:00Z", MaxDownloads: 2, DownloadCount: 1})
+	addShare(t, db, ShareLink{Token: "exhausted", FileID: "f2", ExpiresAt: "2024-07-01T00:00:00Z", MaxDownloads: 2, DownloadCount: 2})
+	addShare(t, db, ShareLink{Token: "expired", FileID: "f2", ExpiresAt: "2024-05-01T00:00:00Z"})
+	addShare(t, db, ShareLink{Token: "revoked", FileID: "f1", ExpiresAt: "2024-07-01T00:00:00Z", Status: "revoked"})
+
+	tests := []struct {
+		name   string
+		filter ShareFilter
+		want   []string
+	}{
+		{"all", ShareFilter{}, []string{"active", "limited", "exhausted", "expired", "revoked"}},
+		{"by file", ShareFilter{FileID: "f2"}, []string{"exhausted", "expired"}},
+		{"active", ShareFilter{Status: "active"}, []string{"active", "limited"}},
+		{"expired", ShareFilter{Status: "expired"}, []string{"expired"}},
+		{"exhausted", ShareFilter{Status: "exhausted"}, []string{"exhausted"}},
+		{"revoked", ShareFilter{Status: "revoked"}, []string{"revoked"}},
+		{"expiring before", ShareFilter{ExpiresBefore: "2024-07-15T00:00:00Z"}, []string{"active", "exhausted", "expired", "revoked"}},
+		{"expiring after", ShareFilter{ExpiresAfter: "2024-07-15T00:00:00Z"}, []string{"limited"}},
+		{"active for a file", ShareFilter{FileID: "f1", Status: "active", ExpiresBefore: "2024-07-15T00:00:00Z"}, []string{"active"}},
+		{"paged", ShareFilter{Limit: 2, Offset: 1}, []string{"limited", "exhausted"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter := test.filter
+			filter.Now = now
+			if filter.Limit == 0 {
+				filter.Limit = 100
+			}
+			links, total, err := db.ListShareLinks(ctx, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]bool{}
+			for _, link := range links {
+				got[link.Token] = true
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			for _, token := range test.want {
+				if !got[token] {
+					t.Errorf("missing %s in %v", token, got)
+				}
+			}
+			if filter.Offset == 0 && total != len(test.want) {
+				t.Errorf("total %d, want %d", total, len(test.want))
+			}
+		})
+	}
+}
+
+func TestShareLinkStats(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	addFile(t, db, "f1", "a.txt", 10, nil)
+	addShare(t, db, ShareLink{Token: "tok", FileID: "f1", ExpiresAt: "2099-01-01T00:00:00Z"})
+	addShare(t, db, ShareLink{Token: "quiet", FileID: "f1", ExpiresAt: "2099-01-01T00:00:00Z"})
+	for _, access := range []ShareAccess{
+		{AccessedAt: "2024-01-01T00:00:00Z", StatusCode: 200, BytesSent: 10, Completed: true},
+		{AccessedAt: "2024-01-02T00:00:00Z", StatusCode: 206, BytesSent: 4},
+		{AccessedAt: "2024-01-03T00:00:00Z", StatusCode: 401},
+	} {
+		access.Token, access.FileID, access.IPAddress = "tok", "f1", "192.0.2.1"
+		if err := db.AddShareAccess(ctx, access); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := db.GetShareLinkStats(ctx, "tok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Accesses != 3 || stats.Completed != 1 || stats.BytesSent != 14 || stats.LastAccessedAt == nil || *stats.LastAccessedAt != "2024-01-03T00:00:00Z" {
+		t.Errorf("stats %+v", stats)
+	}
+	quiet, err := db.GetShareLinkStats(ctx, "quiet")
+	if err != nil || quiet.Accesses != 0 || quiet.LastAccessedAt != nil {
+		t.Errorf("stats without accesses: %+v, %v", quiet, err)
+	}
+
+	accesses, total, err := db.ListShareAccesses(ctx, "tok", 2, 0)
+	if err != nil || total != 3 || len(accesses) != 2 || accesses[0].StatusCode != 401 {
+		t.Errorf("accesses %+v (total %d), %v", accesses, total, err)
+	}
+}
+
+func TestReserveShareUpload(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	addFolder(t, db, "inbox", "inbox", nil)
+	addShare(t, db, ShareLink{Token: "drop", FolderID: ptr("inbox"), Kind: "upload", ExpiresAt: "2099-01-01T00:00:00Z", MaxUploadFiles: 3, MaxUploadBytes: 100})
+	addShare(t, db, ShareLink{Token: "download", FolderID: ptr("inbox"), Kind: "download", ExpiresAt: "2099-01-01T00:00:00Z"})
+
+	steps := []struct {
+		name  string
+		token string
+		size  int64
+		ok    bool
+	}{
+		{"first file", "drop", 60, true},
+		{"over the byte limit", "drop", 41, false},
+		{"exactly the byte limit", "drop", 40, true},
+		{"empty file", "drop", 0, true},
+		{"over the file limit", "drop", 0, false},
+		{"download link", "download", 1, false},
+	}
+	for _, step := range steps {
+		err := db.ReserveShareUpload(ctx, step.token, step.size)
+		if (err == nil) != step.ok {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+	}
+
+	if err := db.ReleaseShareUpload(ctx, "drop", 40); err != nil {
+		t.Fatal(err)
+	}
+	link, err := db.GetShareLink(ctx, "drop")
+	if err != nil || link.UploadedFiles != 2 || link.UploadedBytes != 60 {
+		t.Fatalf("after release: %+v, %v", link, err)
+	}
+	if err := db.ReserveShareUpload(ctx, "drop", 40); err != nil {
+		t.Errorf("reserve the released quota: %v", err)
+	}
+}
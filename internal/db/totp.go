@@ -0,0 +1,127 @@
+package db
+
+import "context"
+
+// SetUserTOTP stores a pending or confirmed TOTP secret and forgets the last
+// used time step. An empty secret removes the enrollment.
+func (db *DB) SetUserTOTP(ctx context.Context, userID, secret string, enabled bool) error {
+	result, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE users SET totp_secret = ?, totp_enabled = ?, totp_last_step = 0, updated_at = ? WHERE user_id = ?`,
+		secret,
+		enabled,
+		NowRFC3339(),
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// UseTOTPStep records step as used. It returns sql.ErrNoRows when step is
+// not newer than the last accepted one, which rejects replayed codes.
+func (db *DB) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	result, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE users SET totp_last_step = ? WHERE user_id = ? AND totp_last_step < ?`,
+		step,
+		userID,
+		step,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// ReplaceRecoveryCodes swaps all recovery codes of a user for hashes.
+func (db *DB) ReplaceRecoveryCodes(ctx context.Context, userID string, hashes []string) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused code as used, or returns sql.ErrNoRows.
+func (db *DB) UseRecoveryCode(ctx context.Context, userID, hash string) error {
+	result, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		NowRFC3339(),
+		userID,
+		hash,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (db *DB) CountRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := db.sql.QueryRowContext(ctx, `SELECT COUNT(1) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+// CreateMFAChallenge records a challenge for userID that expires at
+// expiresAt.
+func (db *DB) CreateMFAChallenge(ctx context.Context, challengeID, userID, expiresAt string) error {
+	_, err := db.sql.ExecContext(
+		ctx,
+		`INSERT INTO mfa_challenges (challenge_id, user_id, expires_at, created_at) VALUES (?, ?, ?, ?)`,
+		challengeID,
+		userID,
+		expiresAt,
+		NowRFC3339(),
+	)
+	return err
+}
+
+// AttemptMFAChallenge counts one submitted code against a challenge. It
+// returns sql.ErrNoRows when the challenge is unknown, used, expired at now
+// or already has maxAttempts attempts.
+func (db *DB) AttemptMFAChallenge(ctx context.Context, challengeID, now string, maxAttempts int) error {
+	result, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE mfa_challenges SET attempts = attempts + 1
+    WHERE challenge_id = ? AND used = 0 AND attempts < ? AND expires_at > ?`,
+		challengeID,
+		maxAttempts,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// UseMFAChallenge marks a challenge spent. It returns sql.ErrNoRows when it
+// was spent already, so only one login can complete per challenge.
+func (db *DB) UseMFAChallenge(ctx context.Context, challengeID string) error {
+	result, err := db.sql.ExecContext(ctx, `UPDATE mfa_challenges SET used = 1 WHERE challenge_id = ? AND used = 0`, challengeID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// PurgeMFAChallenges deletes challenges that expired before now.
+func (db *DB) PurgeMFAChallenges(ctx context.Context, now string) (int64, error) {
+	result, err := db.sql.ExecContext(ctx, `DELETE FROM mfa_challenges WHERE expires_at <= ?`, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,319 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Files and folders in the trash keep their rows with deleted_at set. A live
+// item never sits inside a trashed folder: only empty folders can be
+// trashed, and restoring an item restores its trashed ancestors too.
+
+const ancestorsCTE = `
+    WITH RECURSIVE ancestors(folder_id, parent_id) AS (
+      SELECT folder_id, parent_id FROM folders WHERE folder_id = ?
+      UNION ALL
+      SELECT f.folder_id, f.parent_id FROM folders f JOIN ancestors a ON f.folder_id = a.parent_id
+    )`
+
+// TrashFile moves a file to the trash and returns it.
+func (db *DB) TrashFile(ctx context.Context, fileID, deletedBy string) (FileRecord, error) {
+	record, err := db.GetFile(ctx, fileID)
+	if err != nil {
+		return FileRecord{}, err
+	}
+	now := NowRFC3339()
+	result, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE files SET deleted_at = ?, deleted_by = ? WHERE file_id = ? AND deleted_at IS NULL`,
+		now,
+		deletedBy,
+		fileID,
+	)
+	if err != nil {
+		return FileRecord{}, err
+	}
+	if err := expectAffected(result); err != nil {
+		return FileRecord{}, err
+	}
+	record.DeletedAt = &now
+	record.DeletedBy = deletedBy
+	return record, nil
+}
+
+// TrashFolder moves a folder to the trash. Callers check that it is empty.
+func (db *DB) TrashFolder(ctx context.Context, folderID, deletedBy string) error {
+	result, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE folders SET deleted_at = ?, deleted_by = ? WHERE folder_id = ? AND deleted_at IS NULL`,
+		NowRFC3339(),
+		deletedBy,
+		folderID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// GetTrashedFile looks up a file that is in the trash.
+func (db *DB) GetTrashedFile(ctx context.Context, fileID string) (FileRecord, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+fileColumns+` FROM files WHERE file_id = ? AND deleted_at IS NOT NULL`, fileID)
+	return scanFile(row)
+}
+
+// GetTrashedFolder looks up a folder that is in the trash.
+func (db *DB) GetTrashedFolder(ctx context.Context, folderID string) (FolderRecord, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+folderColumns+` FROM folders WHERE folder_id = ? AND deleted_at IS NOT NULL`, folderID)
+	return scanFolder(row)
+}
+
+// ListTrashedFiles returns the files in the trash, most recently deleted first.
+func (db *DB) ListTrashedFiles(ctx context.Context) ([]FileRecord, error) {
+	rows, err := db.sql.QueryContext(ctx, `SELECT `+fileColumns+` FROM files WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]FileRecord, 0)
+	for rows.Next() {
+		record, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// ListTrashedFolders returns the folders in the trash, most recently deleted
+// first.
+func (db *DB) ListTrashedFolders(ctx context.Context) ([]FolderRecord, error) {
+	rows, err := db.sql.QueryContext(ctx, `SELECT `+folderColumns+` FROM folders WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]FolderRecord, 0)
+	for rows.Next() {
+		record, err := scanFolder(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// ListTrashedAncestors returns folderID and its ancestors that are in the
+// trash. Restoring an item inside folderID restores them.
+func (db *DB) ListTrashedAncestors(ctx context.Context, folderID string) ([]FolderRecord, error) {
+	rows, err := db.sql.QueryContext(ctx, ancestorsCTE+`
+    SELECT `+folderColumns+` FROM folders
+    WHERE deleted_at IS NOT NULL AND folder_id IN (SELECT folder_id FROM ancestors)`, folderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]FolderRecord, 0)
+	for rows.Next() {
+		record, err := scanFolder(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// RestoreFile takes a file out of the trash together with the trashed
+// folders above it.
+func (db *DB) RestoreFile(ctx context.Context, fileID string) error {
+	record, err := db.GetTrashedFile(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if record.FolderID != nil {
+		if _, err := restoreAncestors(ctx, tx, *record.FolderID); err != nil {
+			return err
+		}
+	}
+	result, err := tx.ExecContext(ctx, `UPDATE files SET deleted_at = NULL, deleted_by = '' WHERE file_id = ? AND deleted_at IS NOT NULL`, fileID)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RestoreFolder takes a folder out of the trash together with the trashed
+// folders above it. Its trashed contents stay in the trash.
+func (db *DB) RestoreFolder(ctx context.Context, folderID string) error {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := restoreAncestors(ctx, tx, folderID)
+	if err != nil {
+		return err
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// restoreAncestors takes folderID and its ancestors out of the trash. None
+// of them may be trashed when a file in a live folder is restored.
+func restoreAncestors(ctx context.Context, tx *sql.Tx, folderID string) (sql.Result, error) {
+	return tx.ExecContext(ctx, ancestorsCTE+`
+    UPDATE folders SET deleted_at = NULL, deleted_by = ''
+    WHERE deleted_at IS NOT NULL AND folder_id IN (SELECT folder_id FROM ancestors)`, folderID)
+}
+
+// Purged is what a purge deleted for good. ObjectKeys lists the objects of
+// every version of those files, for the caller to release.
+type Purged struct {
+	Files      []FileRecord
+	ObjectKeys []string
+}
+
+// PurgeFile deletes a trashed file and its versions for good.
+func (db *DB) PurgeFile(ctx context.Context, fileID string) (Purged, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return Purged{}, err
+	}
+	defer tx.Rollback()
+
+	purged, err := purgeFiles(ctx, tx, ` AND file_id = ?`, fileID)
+	if err != nil {
+		return Purged{}, err
+	}
+	if len(purged.Files) == 0 {
+		return Purged{}, sql.ErrNoRows
+	}
+	return purged, tx.Commit()
+}
+
+// PurgeFolder deletes a trashed folder and everything trashed inside it for
+// good.
+func (db *DB) PurgeFolder(ctx context.Context, folderID string) (Purged, error) {
+	if _, err := db.GetTrashedFolder(ctx, folderID); err != nil {
+		return Purged{}, err
+	}
+	inSubtree := `folder_id IN (
+    WITH RECURSIVE subtree(folder_id) AS (
+      SELECT folder_id FROM folders WHERE folder_id = ?
+      UNION ALL
+      SELECT f.folder_id FROM folders f JOIN subtree s ON f.parent_id = s.folder_id
+    )
+    SELECT folder_id FROM subtree)`
+	return db.purge(ctx, inSubtree, folderID)
+}
+
+// PurgeTrash deletes for good everything that went to the trash before
+// before, or the whole trash when before is empty.
+func (db *DB) PurgeTrash(ctx context.Context, before string) (Purged, error) {
+	if before == "" {
+		return db.purge(ctx, "")
+	}
+	return db.purge(ctx, `deleted_at < ?`, before)
+}
+
+// purge deletes the trashed files matching condition, then the trashed
+// folders matching it that are left empty, innermost first. An empty
+// condition matches the whole trash.
+func (db *DB) purge(ctx context.Context, condition string, args ...interface{}) (Purged, error) {
+	if condition != "" {
+		condition = " AND " + condition
+	}
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return Purged{}, err
+	}
+	defer tx.Rollback()
+
+	purged, err := purgeFiles(ctx, tx, condition, args...)
+	if err != nil {
+		return Purged{}, err
+	}
+	for {
+		result, err := tx.ExecContext(ctx, `
+    DELETE FROM folders
+    WHERE deleted_at IS NOT NULL`+condition+`
+      AND NOT EXISTS (SELECT 1 FROM folders c WHERE c.parent_id = folders.folder_id)
+      AND NOT EXISTS (SELECT 1 FROM files f WHERE f.folder_id = folders.folder_id)`, args...)
+		if err != nil {
+			return Purged{}, err
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return Purged{}, err
+		}
+		if count == 0 {
+			break
+		}
+	}
+	return purged, tx.Commit()
+}
+
+// purgeFiles deletes the trashed files matching condition, which starts
+// with " AND ", along with their versions.
+func purgeFiles(ctx context.Context, tx *sql.Tx, condition string, args ...interface{}) (Purged, error) {
+	purged := Purged{Files: []FileRecord{}, ObjectKeys: []string{}}
+	selected := `SELECT file_id FROM files WHERE deleted_at IS NOT NULL` + condition
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+fileColumns+` FROM files WHERE deleted_at IS NOT NULL`+condition, args...)
+	if err != nil {
+		return Purged{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		record, err := scanFile(rows)
+		if err != nil {
+			return Purged{}, err
+		}
+		purged.Files = append(purged.Files, record)
+	}
+	if err := rows.Err(); err != nil {
+		return Purged{}, err
+	}
+
+	keys, err := tx.QueryContext(ctx, `SELECT object_key FROM file_versions WHERE file_id IN (`+selected+`)`, args...)
+	if err != nil {
+		return Purged{}, err
+	}
+	defer keys.Close()
+	for keys.Next() {
+		var objectKey string
+		if err := keys.Scan(&objectKey); err != nil {
+			return Purged{}, err
+		}
+		purged.ObjectKeys = append(purged.ObjectKeys, objectKey)
+	}
+	if err := keys.Err(); err != nil {
+		return Purged{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM file_versions WHERE file_id IN (`+selected+`)`, args...); err != nil {
+		return Purged{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM files WHERE deleted_at IS NOT NULL`+condition, args...); err != nil {
+		return Purged{}, err
+	}
+	return purged, nil
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Upload is the server-side state of a resumable (tus) upload.
+type Upload struct {
+	UploadID        string
+	FileID          string
+	OriginalName    string
+	FolderID        *string
+	Length          int64
+	Offset          int64
+	ObjectKey       string
+	StorageUploadID string
+	Parts           string
+	MimeType        string
+	SHA256State     []byte
+	MD5State        []byte
+	Status          string
+	CreatedBy       string
+	CreatedAt       string
+	UpdatedAt       string
+	ExpiresAt       string
+}
+
+const uploadColumns = `upload_id, file_id, original_name, folder_id, length, upload_offset, object_key, storage_upload_id,
+      parts, mime_type, sha256_state, md5_state, status, created_by, created_at, updated_at, expires_at`
+
+func scanUpload(row rowScanner) (Upload, error) {
+	var upload Upload
+	var folderID, objectKey, storageUploadID, parts, mimeType sql.NullString
+	if err := row.Scan(
+		&upload.UploadID,
+		&upload.FileID,
+		&upload.OriginalName,
+		&folderID,
+		&upload.Length,
+		&upload.Offset,
+		&objectKey,
+		&storageUploadID,
+		&parts,
+		&mimeType,
+		&upload.SHA256State,
+		&upload.MD5State,
+		&upload.Status,
+		&upload.CreatedBy,
+		&upload.CreatedAt,
+		&upload.UpdatedAt,
+		&upload.ExpiresAt,
+	); err != nil {
+		return Upload{}, err
+	}
+	upload.FolderID = nullStringPtr(folderID)
+	upload.ObjectKey = objectKey.String
+	upload.StorageUploadID = storageUploadID.String
+	upload.Parts = parts.String
+	upload.MimeType = mimeType.String
+	return upload, nil
+}
+
+func (db *DB) CreateUpload(ctx context.Context, upload Upload) error {
+	_, err := db.sql.ExecContext(
+		ctx,
+		`INSERT INTO uploads (upload_id, file_id, original_name, folder_id, length, upload_offset, status, created_by, created_at, updated_at, expires_at)
+     VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		upload.UploadID,
+		upload.FileID,
+		upload.OriginalName,
+		upload.FolderID,
+		upload.Length,
+		upload.Offset,
+		upload.Status,
+		upload.CreatedBy,
+		upload.CreatedAt,
+		upload.UpdatedAt,
+		upload.ExpiresAt,
+	)
+	return err
+}
+
+func (db *DB) GetUpload(ctx context.Context, uploadID string) (Upload, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+uploadColumns+` FROM uploads WHERE upload_id = ?`, uploadID)
+	return scanUpload(row)
+}
+
+// UpdateUpload persists the progress of an upload after a chunk is stored.
+func (db *DB) UpdateUpload(ctx context.Context, upload Upload) error {
+	result, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE uploads SET upload_offset = ?, object_key = ?, storage_upload_id = ?, parts = ?, mime_type = ?,
+       sha256_state = ?, md5_state = ?, status = ?, updated_at = ?
+     WHERE upload_id = ?`,
+		upload.Offset,
+		nullString(upload.ObjectKey),
+		nullString(upload.StorageUploadID),
+		nullString(upload.Parts),
+		nullString(upload.MimeType),
+		upload.SHA256State,
+		upload.MD5State,
+		upload.Status,
+		NowRFC3339(),
+		upload.UploadID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (db *DB) DeleteUpload(ctx context.Context, uploadID string) error {
+	_, err := db.sql.ExecContext(ctx, `DELETE FROM uploads WHERE upload_id = ?`, uploadID)
+	return err
+}
+
+func (db *DB) ListExpiredUploads(ctx context.Context, nowRFC3339 string) ([]Upload, error) {
+	rows, err := db.sql.QueryContext(ctx, `SELECT `+uploadColumns+` FROM uploads WHERE expires_at <= ?`, nowRFC3339)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := make([]Upload, 0)
+	for rows.Next() {
+		upload, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
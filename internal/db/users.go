@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// User is an account that can log in with a password or, when OIDCSubject
+// is set, through the configured OpenID Connect issuer.
+type User struct {
+	UserID       string
+	Username     string
+	PasswordHash string
+	Role         string
+	Disabled     bool
+	OIDCSubject  string
+	TOTPSecret   string
+	TOTPEnabled  bool
+	CreatedAt    string
+	UpdatedAt    string
+}
+
+const userColumns = `user_id, username, password_hash, role, disabled, oidc_subject, totp_secret, totp_enabled, created_at, updated_at`
+
+func scanUser(row rowScanner) (User, error) {
+	var user User
+	var oidcSubject sql.NullString
+	if err := row.Scan(
+		&user.UserID,
+		&user.Username,
+		&user.PasswordHash,
+		&user.Role,
+		&user.Disabled,
+		&oidcSubject,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	); err != nil {
+		return User{}, err
+	}
+	user.OIDCSubject = oidcSubject.String
+	return user, nil
+}
+
+func (db *DB) CreateUser(ctx context.Context, user User) error {
+	_, err := db.sql.ExecContext(
+		ctx,
+		`INSERT INTO users (user_id, username, password_hash, role, disabled, oidc_subject, created_at, updated_at)
+     VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.UserID,
+		user.Username,
+		user.PasswordHash,
+		user.Role,
+		user.Disabled,
+		nullString(user.OIDCSubject),
+		user.CreatedAt,
+		user.UpdatedAt,
+	)
+	return err
+}
+
+func (db *DB) GetUser(ctx context.Context, userID string) (User, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE user_id = ?`, userID)
+	return scanUser(row)
+}
+
+func (db *DB) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE username = ?`, username)
+	return scanUser(row)
+}
+
+func (db *DB) GetUserByOIDCSubject(ctx context.Context, subject string) (User, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE oidc_subject = ?`, subject)
+	return scanUser(row)
+}
+
+func (db *DB) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := db.sql.QueryContext(ctx, `SELECT `+userColumns+` FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (db *DB) CountUsers(ctx context.Context) (int, error) {
+	var count int
+	err := db.sql.QueryRowContext(ctx, `SELECT COUNT(1) FROM users`).Scan(&count)
+	return count, err
+}
+
+// UpdateUser saves the mutable fields of an existing user.
+func (db *DB) UpdateUser(ctx context.Context, user User) error {
+	result, err := db.sql.ExecContext(
+		ctx,
+		`UPDATE users SET password_hash = ?, role = ?, disabled = ?, oidc_subject = ?, updated_at = ? WHERE user_id = ?`,
+		user.PasswordHash,
+		user.Role,
+		user.Disabled,
+		nullString(user.OIDCSubject),
+		NowRFC3339(),
+		user.UserID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// CountActiveAdmins counts enabled admins other than excludeUserID, so the
+// last one cannot be disabled or demoted.
+func (db *DB) CountActiveAdmins(ctx context.Context, excludeUserID string) (int, error) {
+	var count int
+	err := db.sql.QueryRowContext(
+		ctx,
+		`SELECT COUNT(1) FROM users WHERE role = 'admin' AND disabled = FALSE AND user_id <> ?`,
+		excludeUserID,
+	).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// FileVersion is one uploaded revision of a file. Each version owns its own
+// object; the files row mirrors whichever version is current.
+type FileVersion struct {
+	FileID       string
+	Version      int
+	OriginalName string
+	ObjectKey    string
+	Size         int64
+	MimeType     string
+	SHA256       string
+	MD5          string
+	CreatedBy    string
+	CreatedAt    string
+}
+
+const fileVersionColumns = `file_id, version, original_name, object_key, size, mime_type, sha256, md5, created_by, created_at`
+
+func scanFileVersion(row rowScanner) (FileVersion, error) {
+	var version FileVersion
+	var mimeType, sha256, md5 sql.NullString
+	if err := row.Scan(
+		&version.FileID,
+		&version.Version,
+		&version.OriginalName,
+		&version.ObjectKey,
+		&version.Size,
+		&mimeType,
+		&sha256,
+		&md5,
+		&version.CreatedBy,
+		&version.CreatedAt,
+	); err != nil {
+		return FileVersion{}, err
+	}
+	version.MimeType = mimeType.String
+	version.SHA256 = sha256.String
+	version.MD5 = md5.String
+	return version, nil
+}
+
+func insertFileVersion(ctx context.Context, tx *sql.Tx, version FileVersion) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO file_versions (`+fileVersionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		version.FileID,
+		version.Version,
+		version.OriginalName,
+		version.ObjectKey,
+		version.Size,
+		version.MimeType,
+		nullString(version.SHA256),
+		nullString(version.MD5),
+		version.CreatedBy,
+		version.CreatedAt,
+	)
+	return err
+}
+
+// makeCurrent copies version into the files row.
+func makeCurrent(ctx context.Context, tx *sql.Tx, version FileVersion) error {
+	result, err := tx.ExecContext(
+		ctx,
+		`UPDATE files SET original_name = ?, object_key = ?, size = ?, mime_type = ?, sha256 = ?, md5 = ?, version = ?, updated_at = ?
+    WHERE file_id = ? AND deleted_at IS NULL`,
+		version.OriginalName,
+		version.ObjectKey,
+		version.Size,
+		version.MimeType,
+		nullString(version.SHA256),
+		nullString(version.MD5),
+		version.Version,
+		NowRFC3339(),
+		version.FileID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// AddFileVersion stores version as the next version of its file and makes it
+// current. Version and CreatedAt are filled in.
+func (db *DB) AddFileVersion(ctx context.Context, version FileVersion) (FileVersion, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return FileVersion{}, err
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) + 1 FROM file_versions WHERE file_id = ?`, version.FileID).Scan(&version.Version); err != nil {
+		return FileVersion{}, err
+	}
+	version.CreatedAt = NowRFC3339()
+	if err := insertFileVersion(ctx, tx, version); err != nil {
+		return FileVersion{}, err
+	}
+	if err := makeCurrent(ctx, tx, version); err != nil {
+		return FileVersion{}, err
+	}
+	return version, tx.Commit()
+}
+
+func (db *DB) GetFileVersion(ctx context.Context, fileID string, version int) (FileVersion, error) {
+	row := db.sql.QueryRowContext(ctx, `SELECT `+fileVersionColumns+` FROM file_versions WHERE file_id = ? AND version = ?`, fileID, version)
+	return scanFileVersion(row)
+}
+
+// ListFileVersions returns the versions of a file, newest first.
+func (db *DB) ListFileVersions(ctx context.Context, fileID string) ([]FileVersion, error) {
+	rows, err := db.sql.QueryContext(ctx, `SELECT `+fileVersionColumns+` FROM file_versions WHERE file_id = ? ORDER BY version DESC`, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]FileVersion, 0)
+	for rows.Next() {
+		version, err := scanFileVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// SetCurrentVersion makes an existing version current again.
+func (db *DB) SetCurrentVersion(ctx context.Context, fileID string, version int) (FileVersion, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return FileVersion{}, err
+	}
+	defer tx.Rollback()
+
+	target, err := scanFileVersion(tx.QueryRowContext(ctx, `SELECT `+fileVersionColumns+` FROM file_versions WHERE file_id = ? AND version = ?`, fileID, version))
+	if err != nil {
+		return FileVersion{}, err
+	}
+	if err := makeCurrent(ctx, tx, target); err != nil {
+		return FileVersion{}, err
+	}
+	return target, tx.Commit()
+}
+
+// DeleteFileVersions deletes the given versions of a file, except the
+// current one, and returns those deleted so the caller can release their
+// objects.
+func (db *DB) DeleteFileVersions(ctx context.Context, fileID string, versions []int) ([]FileVersion, error) {
+	tx, err := db.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleted := make([]FileVersion, 0, len(versions))
+	for _, number := range versions {
+		version, err := scanFileVersion(tx.QueryRowContext(ctx, `
+    SELECT `+fileVersionColumns+` FROM file_versions
+    WHERE file_id = ? AND version = ?
+      AND version <> (SELECT version FROM files WHERE file_id = ?)`, fileID, number, fileID))
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM file_versions WHERE file_id = ? AND version = ?`, fileID, number); err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, version)
+	}
+	return deleted, tx.Commit()
+}
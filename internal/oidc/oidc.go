@@ -0,0 +1,303 @@
+// Package oidc implements the parts of OpenID Connect FileHub needs: the
+// authorization code flow with PKCE against one issuer, and verification of
+// the returned ID token.
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Provider talks to one issuer. Discovery and the signing keys are fetched
+// on first use, so the server starts even while the issuer is down.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	HTTP         *http.Client
+
+	mu        sync.Mutex
+	metadata  *metadata
+	keys      map[string]interface{}
+	keysFetch time.Time
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the verified ID token claims; Raw keeps every claim for
+// configurable lookups such as groups.
+type Claims struct {
+	Subject string
+	Raw     map[string]interface{}
+}
+
+var ErrInvalidToken = errors.New("invalid id token")
+
+// AuthCodeURL returns the issuer's login URL for a new flow. state and nonce
+// must be checked on the callback; verifier is passed to Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURL, state, nonce, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return meta.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of
+// the ID token, which must carry nonce.
+func (p *Provider) Exchange(ctx context.Context, redirectURL, code, verifier, nonce string) (Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.doJSON(req, &token); err != nil {
+		if token.Error != "" {
+			return Claims{}, fmt.Errorf("token endpoint: %s %s", token.Error, token.ErrorDescription)
+		}
+		return Claims{}, err
+	}
+	if token.IDToken == "" {
+		return Claims{}, errors.New("token response has no id_token")
+	}
+	return p.Verify(ctx, token.IDToken, nonce)
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of an ID
+// token.
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+	raw := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(idToken, raw, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if got, _ := raw["nonce"].(string); got != nonce {
+		return Claims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	subject, _ := raw["sub"].(string)
+	if subject == "" {
+		return Claims{}, fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+	return Claims{Subject: subject, Raw: raw}, nil
+}
+
+// String returns a string claim, or "" when it is missing.
+func (c Claims) String(name string) string {
+	value, _ := c.Raw[name].(string)
+	return value
+}
+
+// Strings returns a claim that may be a single string or a list of strings.
+func (c Claims) Strings(name string) []string {
+	switch value := c.Raw[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta metadata
+	if err := p.doJSON(req, &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != strings.TrimRight(p.Issuer, "/") {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", meta.Issuer, p.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+	p.metadata = &meta
+	return p.metadata, nil
+}
+
+// key returns the signing key with kid, refetching the key set at most once
+// a minute so rotated keys are picked up.
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetch) < time.Minute {
+		return nil, errors.New("unknown signing key")
+	}
+	p.keysFetch = time.Now()
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// lookupKey accepts a missing kid when the issuer publishes a single key.
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := p.doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			curve := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[jwk.Crv]
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if curve == nil || errX != nil || errY != nil {
+				continue
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
+
+// doJSON decodes the response body into out, also for error statuses so
+// callers can read OAuth error fields.
+func (p *Provider) doJSON(req *http.Request, out interface{}) error {
+	client := p.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	decodeErr := json.Unmarshal(body, out)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL.Redacted(), resp.Status)
+	}
+	return decodeErr
+}
@@ -0,0 +1,107 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kiry163/filehub/internal/oidc"
+	"github.com/kiry163/filehub/internal/oidc/oidctest"
+)
+
+const callbackURL = "http://filehub.test/api/v1/auth/oidc/callback"
+
+func newProvider(issuer *oidctest.Issuer) *oidc.Provider {
+	return &oidc.Provider{Issuer: issuer.URL, ClientID: issuer.ClientID, Scopes: []string{"openid", "email"}}
+}
+
+func TestExchangePKCE(t *testing.T) {
+	ctx := context.Background()
+	issuer := oidctest.NewIssuer(t, "filehub")
+	issuer.Claims["groups"] = []string{"staff", "filehub-editors"}
+	provider := newProvider(issuer)
+
+	authURL, err := provider.AuthCodeURL(ctx, callbackURL, "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := url.Parse(authURL)
+	if query := parsed.Query(); query.Get("code_challenge") == "" || query.Get("code_challenge") == "verifier-1" || query.Get("scope") != "openid email" {
+		t.Fatalf("authorization URL %s", authURL)
+	}
+
+	tests := []struct {
+		name     string
+		redirect string
+		verifier string
+		nonce    string
+		ok       bool
+	}{
+		{"wrong verifier", callbackURL, "verifier-2", "nonce-1", false},
+		{"wrong redirect", "http://evil.test/callback", "verifier-1", "nonce-1", false},
+		{"wrong nonce", callbackURL, "verifier-1", "nonce-2", false},
+		{"ok", callbackURL, "verifier-1", "nonce-1", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, state := issuer.Authorize(t, authURL)
+			if state != "state-1" {
+				t.Fatalf("state %q", state)
+			}
+			claims, err := provider.Exchange(ctx, test.redirect, code, test.verifier, test.nonce)
+			if ok := err == nil; ok != test.ok {
+				t.Fatalf("exchange: %v", err)
+			}
+			if !test.ok {
+				return
+			}
+			if claims.Subject != "subject-1" || claims.String("email") != "alice@example.com" || len(claims.Strings("groups")) != 2 {
+				t.Errorf("claims %+v", claims)
+			}
+			// Codes are single use.
+			if _, err := provider.Exchange(ctx, test.redirect, code, test.verifier, test.nonce); err == nil {
+				t.Error("code redeemed twice")
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		nonce    string
+		otherKey bool
+	}{
+		{"bad nonce", nil, "other-nonce", false},
+		{"other audience", map[string]interface{}{"aud": "someone-else"}, "nonce", false},
+		{"expired", map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}, "nonce", false},
+		{"no expiry", map[string]interface{}{"exp": nil}, "nonce", false},
+		{"other issuer", map[string]interface{}{"iss": "http://evil.test"}, "nonce", false},
+		{"no subject", map[string]interface{}{"sub": nil}, "nonce", false},
+		{"signed by another key", nil, "nonce", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issuer := oidctest.NewIssuer(t, "filehub")
+			signer := issuer
+			if test.otherKey {
+				signer = oidctest.NewIssuer(t, "filehub")
+				signer.Claims["iss"] = issuer.URL
+			}
+			for name, value := range test.claims {
+				signer.Claims[name] = value
+			}
+			idToken, err := signer.IDToken("nonce")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := newProvider(issuer).Verify(ctx, idToken, test.nonce); !errors.Is(err, oidc.ErrInvalidToken) {
+				t.Errorf("got %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
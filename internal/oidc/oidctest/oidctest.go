@@ -0,0 +1,158 @@
+// Package oidctest runs a minimal OpenID Connect issuer for tests: discovery,
+// a JWKS endpoint and a token endpoint that checks PKCE.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "test-key"
+
+// Issuer is a running mock issuer. Claims are merged over the standard ID
+// token claims (iss, aud, sub, nonce, iat, exp) of every token it issues, so
+// tests can add claims or override standard ones; a nil value removes one.
+type Issuer struct {
+	*httptest.Server
+	ClientID string
+	Claims   map[string]interface{}
+
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	issued int
+	codes  map[string]authRequest
+}
+
+type authRequest struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+}
+
+// NewIssuer starts an issuer for clientID that is shut down with the test.
+func NewIssuer(t testing.TB, clientID string) *Issuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &Issuer{
+		ClientID: clientID,
+		Claims:   map[string]interface{}{"sub": "subject-1", "email": "alice@example.com", "email_verified": true},
+		key:      key,
+		codes:    map[string]authRequest{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/keys", issuer.jwks)
+	mux.HandleFunc("/token", issuer.token)
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// Authorize plays the user logging in at authURL, as returned by
+// Provider.AuthCodeURL, and returns the code and state the issuer sends back
+// to the callback.
+func (i *Issuer) Authorize(t testing.TB, authURL string) (code, state string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != i.ClientID || query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+	i.mu.Lock()
+	i.issued++
+	code = fmt.Sprintf("code-%d", i.issued)
+	i.codes[code] = authRequest{redirectURI: query.Get("redirect_uri"), challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	i.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 i.URL,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/keys",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	public := i.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+		"kid": keyID,
+		"kty": "RSA",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+	}}})
+}
+
+// token redeems a code once, and only with the verifier matching its
+// challenge.
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	i.mu.Lock()
+	request, ok := i.codes[r.Form.Get("code")]
+	delete(i.codes, r.Form.Get("code"))
+	i.mu.Unlock()
+	challenge := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || request.redirectURI != r.Form.Get("redirect_uri") || request.challenge != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	idToken, err := i.IDToken(request.nonce)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": "unused", "token_type": "Bearer", "id_token": idToken})
+}
+
+// IDToken signs an ID token for nonce with the issuer's key.
+func (i *Issuer) IDToken(nonce string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   i.URL,
+		"aud":   i.ClientID,
+		"nonce": nonce,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	for name, value := range i.Claims {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	return token.SignedString(i.key)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,128 @@
+// Package ratelimit throttles requests with token buckets and locks out
+// keys, such as an IP or a username, after repeated failures.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Rule refills Rate tokens per second up to Burst. After MaxFailures
+// failures, each within Lockout of the previous one, the key is locked out
+// for Lockout. MaxFailures 0 disables lockouts.
+type Rule struct {
+	Rate        float64
+	Burst       int
+	MaxFailures int
+	Lockout     time.Duration
+}
+
+// Limiter keeps the state of every key. Implementations must be safe for
+// concurrent use; Memory is the default, a shared store lets several
+// servers enforce one limit.
+type Limiter interface {
+	// Allow takes a token for key. It returns 0 when the request may
+	// proceed, or how long to wait when the bucket is empty or the key is
+	// locked out.
+	Allow(key string, rule Rule) time.Duration
+	// Fail records a failed attempt and returns the lockout it started, or
+	// 0 while the key is still below MaxFailures.
+	Fail(key string, rule Rule) time.Duration
+	// Reset forgets the failures of key after a success.
+	Reset(key string)
+}
+
+// idleTTL is how long Memory keeps a key without requests.
+const idleTTL = time.Hour
+
+type bucket struct {
+	tokens      float64
+	updated     time.Time
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Memory is an in-process Limiter. Idle keys are dropped after an hour.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (m *Memory) Allow(key string, rule Rule) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+	b := m.bucket(key, rule, now)
+	if now.Before(b.lockedUntil) {
+		return b.lockedUntil.Sub(now)
+	}
+	if rule.Rate <= 0 {
+		return 0
+	}
+	b.tokens = min(float64(rule.Burst), b.tokens+now.Sub(b.updated).Seconds()*rule.Rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rule.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+func (m *Memory) Fail(key string, rule Rule) time.Duration {
+	if rule.MaxFailures <= 0 {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	b := m.bucket(key, rule, now)
+	if now.Sub(b.lastFailure) > rule.Lockout {
+		b.failures = 0
+	}
+	b.failures++
+	b.lastFailure = now
+	if b.failures < rule.MaxFailures {
+		return 0
+	}
+	b.failures = 0
+	b.lockedUntil = now.Add(rule.Lockout)
+	return rule.Lockout
+}
+
+func (m *Memory) Reset(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if b, ok := m.buckets[key]; ok {
+		b.failures = 0
+	}
+}
+
+func (m *Memory) bucket(key string, rule Rule, now time.Time) *bucket {
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	return b
+}
+
+// sweep drops idle keys at most once a minute.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if now.After(b.lockedUntil) && now.Sub(b.updated) > idleTTL && now.Sub(b.lastFailure) > idleTTL {
+			delete(m.buckets, key)
+		}
+	}
+}
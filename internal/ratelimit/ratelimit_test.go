@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestMemory returns a Memory on a clock that only moves when the
+// returned function is called.
+func newTestMemory() (*Memory, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryAllow(t *testing.T) {
+	rule := Rule{Rate: 1, Burst: 3}
+	m, advance := newTestMemory()
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		key     string
+		wait    time.Duration
+	}{
+		{"burst 1", 0, "a", 0},
+		{"burst 2", 0, "a", 0},
+		{"burst 3", 0, "a", 0},
+		{"bucket empty", 0, "a", time.Second},
+		{"other keys have their own bucket", 0, "b", 0},
+		{"half a token refilled", 500 * time.Millisecond, "a", 500 * time.Millisecond},
+		{"one token refilled", 500 * time.Millisecond, "a", 0},
+		{"refill stops at the burst", time.Hour, "a", 0},
+		{"burst 2 after refill", 0, "a", 0},
+		{"burst 3 after refill", 0, "a", 0},
+		{"empty again", 0, "a", time.Second},
+	}
+	for _, step := range steps {
+		advance(step.advance)
+		if wait := m.Allow(step.key, rule); wait != step.wait {
+			t.Fatalf("%s: wait %s, want %s", step.name, wait, step.wait)
+		}
+	}
+
+	if wait := m.Allow("c", Rule{}); wait != 0 {
+		t.Errorf("rule without a rate: wait %s", wait)
+	}
+}
+
+func TestMemoryLockout(t *testing.T) {
+	rule := Rule{Rate: 100, Burst: 100, MaxFailures: 3, Lockout: time.Minute}
+	m, advance := newTestMemory()
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		fail    bool
+		reset   bool
+		lockout time.Duration
+		wait    time.Duration
+	}{
+		{"first failure", 0, true, false, 0, 0},
+		{"second failure", 0, true, false, 0, 0},
+		{"success resets the count", 0, false, true, 0, 0},
+		{"failure after reset", 0, true, false, 0, 0},
+		{"second again", 0, true, false, 0, 0},
+		{"old failures expire", 2 * time.Minute, true, false, 0, 0},
+		{"second after expiry", 0, true, false, 0, 0},
+		{"third locks out", 0, true, false, time.Minute, time.Minute},
+		{"still locked", 30 * time.Second, false, false, 0, 30 * time.Second},
+		{"lockout over", 30 * time.Second, false, false, 0, 0},
+		{"count starts over", 0, true, false, 0, 0},
+	}
+	for _, step := range steps {
+		advance(step.advance)
+		if step.fail {
+			if lockout := m.Fail("a", rule); lockout != step.lockout {
+				t.Fatalf("%s: lockout %s, want %s", step.name, lockout, step.lockout)
+			}
+		}
+		if step.reset {
+			m.Reset("a")
+		}
+		if wait := m.Allow("a", rule); wait != step.wait {
+			t.Fatalf("%s: wait %s, want %s", step.name, wait, step.wait)
+		}
+	}
+
+	if lockout := m.Fail("b", Rule{Rate: 1, Burst: 1}); lockout != 0 {
+		t.Errorf("rule without lockouts locked out for %s", lockout)
+	}
+}
+
+func TestMemorySweepsIdleKeys(t *testing.T) {
+	rule := Rule{Rate: 1, Burst: 1, MaxFailures: 1, Lockout: 2 * time.Hour}
+	m, advance := newTestMemory()
+	m.Allow("idle", rule)
+	m.Fail("locked", rule)
+	advance(idleTTL + time.Minute)
+	m.Allow("fresh", rule)
+
+	if _, ok := m.buckets["idle"]; ok {
+		t.Error("idle key kept")
+	}
+	if _, ok := m.buckets["locked"]; !ok {
+		t.Error("locked out key dropped before its lockout ended")
+	}
+}
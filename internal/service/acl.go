@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/kiry163/filehub/internal/db"
+)
+
+// Folder access levels, from none to manage. manage also allows editing the
+// folder's ACL.
+const (
+	AccessNone   = "none"
+	AccessRead   = "read"
+	AccessWrite  = "write"
+	AccessManage = "manage"
+)
+
+const (
+	PrincipalUser = "user"
+	PrincipalRole = "role"
+)
+
+var ErrACLInvalid = errors.New("invalid acl entry")
+
+var accessLevels = []string{AccessNone, AccessRead, AccessWrite, AccessManage}
+
+var accessRank = map[string]int{
+	AccessNone:   0,
+	AccessRead:   1,
+	AccessWrite:  2,
+	AccessManage: 3,
+}
+
+// Caller is the identity ACLs are evaluated against. Local key callers have
+// no user ID and only match role entries. API keys restricted to a folder
+// set Folder and see nothing outside its tree.
+type Caller struct {
+	UserID string
+	Role   string
+	Folder *string
+}
+
+// ACLEntry is one requested grant: a username or role and an access level.
+type ACLEntry struct {
+	User   string
+	Role   string
+	Access string
+}
+
+// FolderAccess answers ACL questions for one caller. Folders without entries
+// on their path are unrestricted and only the caller's role applies. Below a
+// folder with entries, the nearest entry matching the caller wins (a user
+// entry before a role entry on the same folder); callers matching none get
+// no access. Admins bypass ACLs but not an API key's folder restriction.
+//
+// It is built for one request and resolves folders lazily in the database
+// under that request's context; a failed lookup denies access.
+type FolderAccess struct {
+	ctx    context.Context
+	db     *db.DB
+	caller Caller
+	// acls is false for admins and while no folder has entries.
+	acls bool
+	memo map[string]string
+}
+
+func (s *Service) FolderAccess(ctx context.Context, caller Caller) (*FolderAccess, error) {
+	access := &FolderAccess{ctx: ctx, db: s.DB, caller: caller, memo: map[string]string{}}
+	if caller.Role != RoleAdmin {
+		var err error
+		if access.acls, err = s.DB.HasFolderACLs(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return access, nil
+}
+
+// Level returns the caller's access level on folderID; nil is the root,
+// which only a folder restriction can close.
+func (a *FolderAccess) Level(folderID *string) string {
+	if folderID == nil {
+		if a.caller.Folder != nil {
+			return AccessNone
+		}
+		return AccessManage
+	}
+	if level, ok := a.memo[*folderID]; ok {
+		return level
+	}
+	level, err := a.level(*folderID)
+	if err != nil {
+		log.Printf("acl: failed to resolve folder %s: %v", *folderID, err)
+		return AccessNone
+	}
+	a.memo[*folderID] = level
+	return level
+}
+
+func (a *FolderAccess) level(folderID string) (string, error) {
+	if a.caller.Folder != nil {
+		inside, err := a.db.IsDescendant(a.ctx, *a.caller.Folder, folderID)
+		if err != nil || !inside {
+			return AccessNone, err
+		}
+	}
+	if !a.acls {
+		return AccessManage, nil
+	}
+	rank, err := a.db.FolderACLRank(a.ctx, folderID, a.caller.UserID, a.caller.Role)
+	if err != nil {
+		return AccessNone, err
+	}
+	return accessLevels[rank], nil
+}
+
+// Allows reports whether the caller has at least level on folderID.
+func (a *FolderAccess) Allows(folderID *string, level string) bool {
+	return accessRank[a.Level(folderID)] >= accessRank[level]
+}
+
+// Hidden describes what the caller cannot read, for filtering queries.
+func (a *FolderAccess) Hidden() db.Visibility {
+	hidden := db.Visibility{Root: !a.Allows(nil, AccessRead)}
+	if a.acls || a.caller.Folder != nil {
+		hidden.Caller = &db.ACLCaller{
+			UserID:     a.caller.UserID,
+			Role:       a.caller.Role,
+			IgnoreACLs: !a.acls,
+			Folder:     a.caller.Folder,
+		}
+	}
+	return hidden
+}
+
+// FolderACL returns the explicit entries of a folder and of each ancestor
+// that has any, nearest first.
+func (s *Service) FolderACL(ctx context.Context, folderID string) ([]db.FolderACL, [][]db.FolderACL, error) {
+	explicit, err := s.DB.ListFolderACLs(ctx, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	inherited := [][]db.FolderACL{}
+	folder, err := s.DB.GetFolder(ctx, folderID)
+	for depth := 0; err == nil && folder.ParentID != nil && depth < 64; depth++ {
+		if folder, err = s.DB.GetFolder(ctx, *folder.ParentID); err != nil {
+			break
+		}
+		entries, listErr := s.DB.ListFolderACLs(ctx, folder.FolderID)
+		if listErr != nil {
+			return nil, nil, listErr
+		}
+		if len(entries) > 0 {
+			inherited = append(inherited, entries)
+		}
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, err
+	}
+	return explicit, inherited, nil
+}
+
+// SetFolderACL replaces a folder's explicit entries. An empty list makes the
+// folder inherit from its parent again.
+func (s *Service) SetFolderACL(ctx context.Context, folderID, createdBy string, requested []ACLEntry) ([]db.FolderACL, error) {
+	now := db.NowRFC3339()
+	entries := make([]db.FolderACL, 0, len(requested))
+	seen := map[string]bool{}
+	for _, item := range requested {
+		if _, ok := accessRank[item.Access]; !ok {
+			return nil, ErrACLInvalid
+		}
+		entry := db.FolderACL{FolderID: folderID, Access: item.Access, CreatedBy: createdBy, CreatedAt: now}
+		switch {
+		case item.User != "" && item.Role == "":
+			user, err := s.DB.GetUserByUsername(ctx, item.User)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return nil, ErrACLInvalid
+				}
+				return nil, err
+			}
+			entry.PrincipalType, entry.PrincipalID = PrincipalUser, user.UserID
+		case item.Role != "" && item.User == "" && ValidRole(item.Role):
+			entry.PrincipalType, entry.PrincipalID = PrincipalRole, item.Role
+		default:
+			return nil, ErrACLInvalid
+		}
+		key := entry.PrincipalType + ":" + entry.PrincipalID
+		if seen[key] {
+			return nil, ErrACLInvalid
+		}
+		seen[key] = true
+		entries = append(entries, entry)
+	}
+	if err := s.DB.ReplaceFolderACL(ctx, folderID, entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
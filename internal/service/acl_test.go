@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newACLTree builds
+//
+//	projects  editor: write, bob: read
+//	  secret  alice: manage, editor: none
+//	  shared
+//	public
+//
+// and returns a caller for each user, by name.
+func newACLTree(t *testing.T) (*Service, map[string]Caller) {
+	t.Helper()
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	callers := map[string]Caller{}
+	for _, user := range []struct{ name, role string }{{"alice", RoleEditor}, {"bob", RoleEditor}, {"carol", RoleViewer}, {"root", RoleAdmin}} {
+		created, err := svc.CreateUser(ctx, user.name, "password123", user.role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		callers[user.name] = Caller{UserID: created.UserID, Role: created.Role}
+	}
+	projects, public := "projects", "public"
+	createTestFolder(t, svc, projects, "projects", nil)
+	createTestFolder(t, svc, "secret", "secret", &projects)
+	createTestFolder(t, svc, "shared", "shared", &projects)
+	createTestFolder(t, svc, public, "public", nil)
+
+	if _, err := svc.SetFolderACL(ctx, projects, "root", []ACLEntry{{Role: RoleEditor, Access: AccessWrite}, {User: "bob", Access: AccessRead}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetFolderACL(ctx, "secret", "root", []ACLEntry{{User: "alice", Access: AccessManage}, {Role: RoleEditor, Access: AccessNone}}); err != nil {
+		t.Fatal(err)
+	}
+	return svc, callers
+}
+
+func TestFolderAccessLevels(t *testing.T) {
+	svc, callers := newACLTree(t)
+	public := "public"
+	restricted := callers["alice"]
+	restricted.Folder = &public
+	callers["alice in public"] = restricted
+
+	// Expected levels on root, projects, secret, shared and public.
+	want := map[string]string{
+		// The role entry grants write below projects; on secret the user
+		// entry wins over the role entry beside it.
+		"alice": "manage write manage write manage",
+		// A user entry wins over a role entry on the same folder, and
+		// the nearer role entry on secret overrides bob's inherited read.
+		"bob": "manage read none read manage",
+		// Nothing on the path matches viewers; unrestricted folders still
+		// follow the role.
+		"carol": "manage none none none manage",
+		"root":  "manage manage manage manage manage",
+		// A folder restriction closes everything outside its tree.
+		"alice in public": "none none none none manage",
+	}
+	for name, levels := range want {
+		access, err := svc.FolderAccess(context.Background(), callers[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{access.Level(nil)}
+		for _, folderID := range []string{"projects", "secret", "shared", "public"} {
+			folderID := folderID
+			got = append(got, access.Level(&folderID))
+		}
+		if strings.Join(got, " ") != levels {
+			t.Errorf("%s: got %s, want %s", name, strings.Join(got, " "), levels)
+		}
+	}
+}
+
+func TestFolderAccessHidden(t *testing.T) {
+	svc, callers := newACLTree(t)
+	public := "public"
+	restricted := callers["bob"]
+	restricted.Folder = &public
+	callers["bob in public"] = restricted
+
+	want := map[string]string{
+		"alice":         "",
+		"bob":           "secret",
+		"carol":         "projects secret shared",
+		"root":          "",
+		"bob in public": "root projects secret shared",
+	}
+	// One file per folder and at the root; a folder is hidden when its file
+	// is missing from the filtered listing.
+	uploadTestFile(t, svc, "root", "x")
+	for _, folderID := range []string{"projects", "secret", "shared", "public"} {
+		uploadTestFileTo(t, svc, ptr(folderID), folderID, "x")
+	}
+	for name, folders := range want {
+		access, err := svc.FolderAccess(context.Background(), callers[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, _, err := svc.ListFiles(context.Background(), 100, 0, "asc", "", nil, access.Hidden())
+		if err != nil {
+			t.Fatal(err)
+		}
+		visible := map[string]bool{}
+		for _, record := range records {
+			visible[record.OriginalName] = true
+		}
+		got := []string{}
+		for _, folderID := range []string{"root", "projects", "secret", "shared", "public"} {
+			if !visible[folderID] {
+				got = append(got, folderID)
+			}
+		}
+		if strings.Join(got, " ") != folders {
+			t.Errorf("%s: hidden %q, want %q", name, strings.Join(got, " "), folders)
+		}
+	}
+}
+
+func TestSetFolderACLValidation(t *testing.T) {
+	svc, _ := newACLTree(t)
+	tests := []struct {
+		name    string
+		entries []ACLEntry
+		err     error
+	}{
+		{"clear", nil, nil},
+		{"user and role", []ACLEntry{{User: "alice", Access: AccessRead}, {Role: RoleViewer, Access: AccessNone}}, nil},
+		{"unknown access", []ACLEntry{{User: "alice", Access: "owner"}}, ErrACLInvalid},
+		{"unknown user", []ACLEntry{{User: "mallory", Access: AccessRead}}, ErrACLInvalid},
+		{"unknown role", []ACLEntry{{Role: "owner", Access: AccessRead}}, ErrACLInvalid},
+		{"user and role in one entry", []ACLEntry{{User: "alice", Role: RoleViewer, Access: AccessRead}}, ErrACLInvalid},
+		{"no principal", []ACLEntry{{Access: AccessRead}}, ErrACLInvalid},
+		{"duplicate principal", []ACLEntry{{User: "alice", Access: AccessRead}, {User: "alice", Access: AccessWrite}}, ErrACLInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := svc.SetFolderACL(context.Background(), "public", "root", test.entries)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+			if err == nil && len(entries) != len(test.entries) {
+				t.Errorf("entries %+v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kiry163/filehub/internal/db"
+)
+
+// APIKeyPrefix starts every key, so keys are recognizable in configs and
+// can be told apart from access tokens.
+const APIKeyPrefix = "fhk_"
+
+// API key scopes. delete covers every change to existing files and folders,
+// the same as the write permission of roles.
+const (
+	ScopeRead   = "read"
+	ScopeUpload = "upload"
+	ScopeDelete = "delete"
+	ScopeShare  = "share"
+	ScopeAdmin  = "admin"
+)
+
+const (
+	APIKeyStatusActive  = "active"
+	APIKeyStatusExpired = "expired"
+	APIKeyStatusRevoked = "revoked"
+)
+
+var (
+	ErrAPIKeyInvalid     = errors.New("api key invalid")
+	ErrAPIKeyExists      = errors.New("api key name already taken")
+	ErrAPIKeyNameInvalid = errors.New("key name must be 1-64 letters, digits or . _ @ -")
+	ErrAPIKeyScope       = errors.New("scopes must be read, upload, delete, share or admin and allowed for the owner")
+	ErrAPIKeyFolder      = errors.New("folder not found")
+)
+
+var scopePermissions = map[string]string{
+	ScopeRead:   PermRead,
+	ScopeUpload: PermUpload,
+	ScopeDelete: PermWrite,
+	ScopeShare:  PermShare,
+	ScopeAdmin:  PermAdmin,
+}
+
+// APIKeyOptions describes a new key. A nil FolderID allows every folder and
+// a zero ExpiresIn never expires.
+type APIKeyOptions struct {
+	Name      string
+	Scopes    []string
+	FolderID  *string
+	ExpiresIn time.Duration
+}
+
+// ScopeAllows reports whether any of scopes grants permission.
+func ScopeAllows(scopes []string, permission string) bool {
+	for _, scope := range scopes {
+		if scopePermissions[scope] == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKey creates a key for owner and returns it with the plaintext
+// key, which is not stored and cannot be shown again.
+func (s *Service) CreateAPIKey(ctx context.Context, owner db.User, createdBy string, opts APIKeyOptions) (db.APIKey, string, error) {
+	name := strings.TrimSpace(opts.Name)
+	if !usernamePattern.MatchString(name) {
+		return db.APIKey{}, "", ErrAPIKeyNameInvalid
+	}
+	scopes := []string{}
+	for _, scope := range opts.Scopes {
+		permission, ok := scopePermissions[scope]
+		if !ok || !RoleAllows(owner.Role, permission) {
+			return db.APIKey{}, "", ErrAPIKeyScope
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return db.APIKey{}, "", ErrAPIKeyScope
+	}
+	if opts.FolderID != nil {
+		if _, err := s.DB.GetFolder(ctx, *opts.FolderID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return db.APIKey{}, "", ErrAPIKeyFolder
+			}
+			return db.APIKey{}, "", err
+		}
+	}
+	if _, err := s.DB.GetAPIKeyByName(ctx, name); err == nil {
+		return db.APIKey{}, "", ErrAPIKeyExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return db.APIKey{}, "", err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return db.APIKey{}, "", err
+	}
+	plaintext := APIKeyPrefix + secret
+	now := time.Now().UTC()
+	key := db.APIKey{
+		KeyID:     "ak_" + generateFileID(12),
+		Name:      name,
+		KeyHash:   hashAPIKey(plaintext),
+		Prefix:    plaintext[:len(APIKeyPrefix)+6],
+		OwnerID:   owner.UserID,
+		Scopes:    scopes,
+		FolderID:  opts.FolderID,
+		CreatedBy: createdBy,
+		CreatedAt: now.Format(time.RFC3339),
+	}
+	if opts.ExpiresIn > 0 {
+		expiresAt := now.Add(opts.ExpiresIn).Format(time.RFC3339)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := s.DB.CreateAPIKey(ctx, key); err != nil {
+		return db.APIKey{}, "", err
+	}
+	return key, plaintext, nil
+}
+
+// AuthenticateAPIKey resolves a plaintext key to the key and its owner. Keys
+// of disabled owners stop working with them.
+func (s *Service) AuthenticateAPIKey(ctx context.Context, plaintext string) (db.APIKey, db.User, error) {
+	if !strings.HasPrefix(plaintext, APIKeyPrefix) {
+		return db.APIKey{}, db.User{}, ErrAPIKeyInvalid
+	}
+	key, err := s.DB.GetAPIKeyByHash(ctx, hashAPIKey(plaintext))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return db.APIKey{}, db.User{}, ErrAPIKeyInvalid
+		}
+		return db.APIKey{}, db.User{}, err
+	}
+	now := time.Now().UTC()
+	if APIKeyState(key, now) != APIKeyStatusActive {
+		return db.APIKey{}, db.User{}, ErrAPIKeyInvalid
+	}
+	owner, err := s.ActiveUser(ctx, key.OwnerID)
+	if err != nil {
+		return db.APIKey{}, db.User{}, ErrAPIKeyInvalid
+	}
+	_ = s.DB.TouchAPIKey(ctx, key.KeyID, now.Format(time.RFC3339), now.Add(-time.Minute).Format(time.RFC3339))
+	return key, owner, nil
+}
+
+func (s *Service) ListAPIKeys(ctx context.Context, ownerID string) ([]db.APIKey, error) {
+	return s.DB.ListAPIKeys(ctx, ownerID)
+}
+
+func (s *Service) RevokeAPIKey(ctx context.Context, keyID string) error {
+	return s.DB.RevokeAPIKey(ctx, keyID)
+}
+
+// APIKeyState is active, expired or revoked.
+func APIKeyState(key db.APIKey, now time.Time) string {
+	switch {
+	case key.RevokedAt != nil:
+		return APIKeyStatusRevoked
+	case key.ExpiresAt != nil && !now.Before(parseRFC3339(*key.ExpiresAt)):
+		return APIKeyStatusExpired
+	default:
+		return APIKeyStatusActive
+	}
+}
+
+// hashAPIKey needs no salt or stretching: keys are 32 random bytes.
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScopeAllows(t *testing.T) {
+	tests := []struct {
+		scopes     []string
+		permission string
+		allowed    bool
+	}{
+		{[]string{ScopeRead}, PermRead, true},
+		{[]string{ScopeRead}, PermUpload, false},
+		{[]string{ScopeUpload}, PermRead, false},
+		{[]string{ScopeDelete}, PermWrite, true},
+		{[]string{ScopeRead, ScopeShare}, PermShare, true},
+		{[]string{ScopeRead, ScopeUpload, ScopeDelete, ScopeShare}, PermAdmin, false},
+		{[]string{ScopeAdmin}, PermAdmin, true},
+		{[]string{"write"}, PermWrite, false},
+		{nil, PermRead, false},
+	}
+	for _, test := range tests {
+		if got := ScopeAllows(test.scopes, test.permission); got != test.allowed {
+			t.Errorf("ScopeAllows(%v, %q) = %v", test.scopes, test.permission, got)
+		}
+	}
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	editor, err := svc.CreateUser(ctx, "alice", "password1", RoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTestFolder(t, svc, "docs", "docs", nil)
+	if _, _, err := svc.CreateAPIKey(ctx, editor, "alice", APIKeyOptions{Name: "laptop", Scopes: []string{ScopeRead}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts APIKeyOptions
+		err  error
+	}{
+		{"ok", APIKeyOptions{Name: "ci", Scopes: []string{ScopeRead, ScopeUpload, ScopeRead}}, nil},
+		{"folder", APIKeyOptions{Name: "docs-bot", Scopes: []string{ScopeRead}, FolderID: ptr("docs")}, nil},
+		{"name taken", APIKeyOptions{Name: "laptop", Scopes: []string{ScopeRead}}, ErrAPIKeyExists},
+		{"bad name", APIKeyOptions{Name: "my key", Scopes: []string{ScopeRead}}, ErrAPIKeyNameInvalid},
+		{"no scopes", APIKeyOptions{Name: "empty"}, ErrAPIKeyScope},
+		{"unknown scope", APIKeyOptions{Name: "odd", Scopes: []string{"write"}}, ErrAPIKeyScope},
+		{"scope beyond the owner's role", APIKeyOptions{Name: "root", Scopes: []string{ScopeAdmin}}, ErrAPIKeyScope},
+		{"unknown folder", APIKeyOptions{Name: "lost", Scopes: []string{ScopeRead}, FolderID: ptr("nope")}, ErrAPIKeyFolder},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, plaintext, err := svc.CreateAPIKey(ctx, editor, "alice", test.opts)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if key.KeyHash == plaintext || key.Prefix != plaintext[:len(key.Prefix)] {
+				t.Errorf("key %+v stored with plaintext %q", key, plaintext)
+			}
+			if test.name == "ok" && len(key.Scopes) != 2 {
+				t.Errorf("duplicate scopes kept: %v", key.Scopes)
+			}
+		})
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	yes := true
+	tests := []struct {
+		name   string
+		opts   APIKeyOptions
+		change func(svc *Service, keyID, ownerID string) error
+		valid  bool
+	}{
+		{"active", APIKeyOptions{}, nil, true},
+		{"revoked", APIKeyOptions{}, func(svc *Service, keyID, ownerID string) error {
+			return svc.RevokeAPIKey(ctx, keyID)
+		}, false},
+		// Expiry is stored to the second, so this key is already expired.
+		{"expired", APIKeyOptions{ExpiresIn: time.Nanosecond}, nil, false},
+		{"owner disabled", APIKeyOptions{}, func(svc *Service, keyID, ownerID string) error {
+			_, err := svc.UpdateUser(ctx, ownerID, UserUpdate{Disabled: &yes})
+			return err
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc, _ := newTestService(t)
+			owner, err := svc.CreateUser(ctx, "alice", "password1", RoleViewer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.opts.Name, test.opts.Scopes = "laptop", []string{ScopeRead}
+			key, plaintext, err := svc.CreateAPIKey(ctx, owner, "alice", test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.change != nil {
+				if err := test.change(svc, key.KeyID, owner.UserID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, user, err := svc.AuthenticateAPIKey(ctx, plaintext)
+			if valid := err == nil; valid != test.valid {
+				t.Fatalf("authenticate: %v", err)
+			}
+			if test.valid && (got.KeyID != key.KeyID || user.UserID != owner.UserID) {
+				t.Errorf("key %+v, owner %+v", got, user)
+			}
+		})
+	}
+
+	svc, _ := newTestService(t)
+	for _, plaintext := range []string{"", "fhk_nope", "not-a-key"} {
+		if _, _, err := svc.AuthenticateAPIKey(ctx, plaintext); !errors.Is(err, ErrAPIKeyInvalid) {
+			t.Errorf("%q: got %v", plaintext, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kiry163/filehub/internal/db"
+)
+
+// WriteFolderZip streams folderID and everything beneath it into w as a zip
+// archive. Objects are copied straight from storage, one at a time, so
+// nothing is staged on disk or held in memory.
+func (s *Service) WriteFolderZip(ctx context.Context, w io.Writer, folderID string) error {
+	folders, err := s.DB.ListSubtreeFolders(ctx, folderID)
+	if err != nil {
+		return err
+	}
+	files, err := s.DB.ListSubtreeFiles(ctx, folderID)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]db.FolderRecord, len(folders))
+	for _, folder := range folders {
+		byID[folder.FolderID] = folder
+	}
+	// folderPath is the folder's path inside the archive; the shared folder
+	// itself is the archive root.
+	var folderPath func(id string) string
+	folderPath = func(id string) string {
+		folder, ok := byID[id]
+		if !ok || id == folderID || folder.ParentID == nil {
+			return ""
+		}
+		return path.Join(folderPath(*folder.ParentID), sanitizeZipName(folder.Name))
+	}
+
+	archive := zip.NewWriter(w)
+	used := map[string]bool{}
+	for _, folder := range folders {
+		if folder.FolderID == folderID {
+			continue
+		}
+		name := folderPath(folder.FolderID) + "/"
+		used[name] = true
+		if _, err := archive.CreateHeader(&zip.FileHeader{Name: name, Modified: parseRFC3339(folder.CreatedAt)}); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dir := ""
+		if file.FolderID != nil {
+			dir = folderPath(*file.FolderID)
+		}
+		name := uniqueZipName(used, path.Join(dir, sanitizeZipName(file.OriginalName)))
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: parseRFC3339(file.CreatedAt),
+		})
+		if err != nil {
+			return err
+		}
+		reader, _, err := s.Storage.Get(ctx, file.ObjectKey, nil, nil)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func sanitizeZipName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// uniqueZipName appends " (n)" before the extension when name is taken.
+func uniqueZipName(used map[string]bool, name string) string {
+	candidate := name
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+func parseRFC3339(value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Now()
+	}
+	return parsed
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+func TestSanitizeZipName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"a/b.txt", "a_b.txt"},
+		{`..\..\evil.exe`, ".._.._evil.exe"},
+		{"../x", ".._x"},
+		{"", "_"},
+		{".", "_"},
+		{"..", "_"},
+	}
+	for _, test := range tests {
+		if got := sanitizeZipName(test.name); got != test.want {
+			t.Errorf("sanitizeZipName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUniqueZipName(t *testing.T) {
+	used := map[string]bool{}
+	for _, want := range []string{"a.txt", "a (2).txt", "a (3).txt"} {
+		if got := uniqueZipName(used, "a.txt"); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if got := uniqueZipName(used, "docs/a.txt"); got != "docs/a.txt" {
+		t.Errorf("same name in another folder renamed to %q", got)
+	}
+	if got := uniqueZipName(used, "README"); got != "README" {
+		t.Errorf("got %q", got)
+	}
+	if got := uniqueZipName(used, "README"); got != "README (2)" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestWriteFolderZip(t *testing.T) {
+	svc, raw := newTestService(t)
+	createTestFolder(t, svc, "shared", "shared", nil)
+	createTestFolder(t, svc, "docs", "docs", ptr("shared"))
+	createTestFolder(t, svc, "empty", "empty", ptr("docs"))
+	createTestFolder(t, svc, "outside", "outside", nil)
+	uploadTestFileTo(t, svc, ptr("shared"), "top.txt", "top")
+	uploadTestFileTo(t, svc, ptr("docs"), "a.txt", "first")
+	uploadTestFileTo(t, svc, ptr("docs"), "a.txt", "second")
+	// Multipart uploads strip directories from the name, but other paths
+	// into the files table may not.
+	sneaky := uploadTestFileTo(t, svc, ptr("docs"), "up.txt", "sneaky")
+	mustExec(t, raw, `UPDATE files SET original_name = '../up.txt' WHERE file_id = ?`, sneaky.FileID)
+	uploadTestFileTo(t, svc, ptr("outside"), "secret.txt", "not shared")
+
+	tests := []struct {
+		name   string
+		folder string
+		want   map[string]string
+	}{
+		{"whole share", "shared", map[string]string{
+			"docs/":          "",
+			"docs/empty/":    "",
+			"top.txt":        "top",
+			"docs/a.txt":     "",
+			"docs/a (2).txt": "",
+			"docs/.._up.txt": "sneaky",
+		}},
+		{"subfolder is the archive root", "docs", map[string]string{
+			"empty/":    "",
+			"a.txt":     "",
+			"a (2).txt": "",
+			".._up.txt": "sneaky",
+		}},
+		{"empty folder", "empty", map[string]string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := svc.WriteFolderZip(context.Background(), &buf, test.folder); err != nil {
+				t.Fatal(err)
+			}
+			archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatalf("read archive: %v", err)
+			}
+			got := map[string]string{}
+			for _, entry := range archive.File {
+				reader, err := entry.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, _ := io.ReadAll(reader)
+				reader.Close()
+				got[entry.Name] = string(data)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("entries %v, want %v", got, test.want)
+			}
+			for name, content := range test.want {
+				data, ok := got[name]
+				if !ok {
+					t.Errorf("missing %s in %v", name, got)
+				}
+				if content != "" && data != content {
+					t.Errorf("%s holds %q, want %q", name, data, content)
+				}
+			}
+		})
+	}
+}
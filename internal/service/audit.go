@@ -0,0 +1,266 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/kiry163/filehub/internal/db"
+)
+
+// AuditCheckpoint records the head of the audit hash chain at some point in
+// time. Signature is an HMAC-SHA256 over the other fields with
+// audit.checkpoint_key, so a checkpoint kept outside the database proves
+// what the log looked like even to someone who can rewrite the database.
+type AuditCheckpoint struct {
+	LastID    int64  `json:"last_id"`
+	Hash      string `json:"hash"`
+	CreatedAt string `json:"created_at"`
+	Signature string `json:"signature"`
+}
+
+// AuditVerification is the result of walking the audit hash chain. BrokenAt
+// is the first entry that fails, 0 when the chain is intact.
+type AuditVerification struct {
+	Entries     int64
+	FirstID     int64
+	LastID      int64
+	HeadHash    string
+	BrokenAt    int64
+	Reason      string
+	Checkpoints int
+	// PurgedThrough is the last entry deleted by retention, 0 when nothing
+	// was ever purged.
+	PurgedThrough int64
+	// CheckpointErrors lists checkpoints and purge anchors that are forged
+	// or no longer match the log.
+	CheckpointErrors []string
+}
+
+func (v AuditVerification) OK() bool {
+	return v.BrokenAt == 0 && len(v.CheckpointErrors) == 0
+}
+
+func (s *Service) ListAuditLogs(ctx context.Context, filter db.AuditFilter) ([]db.AuditLog, error) {
+	return s.DB.ListAuditLogs(ctx, filter)
+}
+
+// PurgeExpiredAuditLogs deletes the entries older than audit.retention_days.
+// Zero keeps the audit log forever. The purge leaves a signed anchor naming
+// the last deleted entry, and is itself logged, so the chain shows where its
+// start was cut off and nobody else can cut it.
+func (s *Service) PurgeExpiredAuditLogs(ctx context.Context) (int64, error) {
+	days := s.Config.Audit.RetentionDays
+	if days <= 0 {
+		return 0, nil
+	}
+	before := time.Now().UTC().Add(-time.Duration(days) * 24 * time.Hour).Format(time.RFC3339)
+	last, err := s.DB.LastAuditLogBefore(ctx, before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	anchor := db.AuditAnchor{LastID: last.ID, Hash: last.Hash, CreatedAt: db.NowRFC3339()}
+	anchor.Signature = s.signAnchor(anchor)
+	count, err := s.DB.PurgeAuditLogs(ctx, anchor)
+	if err != nil || count == 0 {
+		return count, err
+	}
+	message := fmt.Sprintf("deleted %d entries before %s", count, before)
+	return count, s.DB.AddAuditLog(ctx, "audit_purge", "", "system", "", "success", message)
+}
+
+// AuditCheckpoint signs the current head of the audit chain.
+func (s *Service) AuditCheckpoint(ctx context.Context) (AuditCheckpoint, error) {
+	head, err := s.DB.AuditHead(ctx)
+	if err != nil {
+		return AuditCheckpoint{}, err
+	}
+	checkpoint := AuditCheckpoint{
+		LastID:    head.ID,
+		Hash:      head.Hash,
+		CreatedAt: db.NowRFC3339(),
+	}
+	checkpoint.Signature = s.signCheckpoint(checkpoint)
+	return checkpoint, nil
+}
+
+// WriteAuditCheckpoint appends a signed checkpoint to audit.checkpoint_path
+// unless the chain has not moved since the last one. It reports whether a
+// checkpoint was written.
+func (s *Service) WriteAuditCheckpoint(ctx context.Context) (bool, error) {
+	checkpoint, err := s.AuditCheckpoint(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	path := s.Config.Audit.CheckpointPath
+	existing, err := ReadAuditCheckpoints(path)
+	if err != nil {
+		return false, err
+	}
+	if len(existing) > 0 && existing[len(existing)-1].LastID == checkpoint.LastID {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return false, err
+	}
+	if err := json.NewEncoder(file).Encode(checkpoint); err != nil {
+		file.Close()
+		return false, err
+	}
+	return true, file.Close()
+}
+
+// ReadAuditCheckpoints reads a checkpoint file written by
+// WriteAuditCheckpoint. A missing file holds no checkpoints.
+func ReadAuditCheckpoints(path string) ([]AuditCheckpoint, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	checkpoints := make([]AuditCheckpoint, 0)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var checkpoint AuditCheckpoint
+		if err := json.Unmarshal(scanner.Bytes(), &checkpoint); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	return checkpoints, scanner.Err()
+}
+
+// VerifyAuditChain recomputes every hash in the audit log and checks the
+// log against checkpoints. The oldest remaining entry must chain onto the
+// anchor of the latest retention purge, or start the chain when nothing was
+// ever purged.
+func (s *Service) VerifyAuditChain(ctx context.Context, checkpoints []AuditCheckpoint) (AuditVerification, error) {
+	var result AuditVerification
+	anchors, err := s.DB.ListAuditAnchors(ctx)
+	if err != nil {
+		return AuditVerification{}, err
+	}
+	var anchor *db.AuditAnchor
+	for i := range anchors {
+		if !hmac.Equal([]byte(anchors[i].Signature), []byte(s.signAnchor(anchors[i]))) {
+			result.CheckpointErrors = append(result.CheckpointErrors, "purge anchor at entry "+strconv.FormatInt(anchors[i].LastID, 10)+": invalid signature")
+			continue
+		}
+		anchor = &anchors[i]
+	}
+	if anchor != nil {
+		result.PurgedThrough = anchor.LastID
+	}
+
+	// Hashes of the entries the checkpoints point at, compared after the walk.
+	checkpointHashes := make(map[int64]string, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		checkpointHashes[checkpoint.LastID] = ""
+	}
+
+	prevHash := ""
+	if anchor != nil {
+		prevHash = anchor.Hash
+	}
+	err = s.DB.WalkAuditLogs(ctx, func(entry db.AuditLog) error {
+		if _, ok := checkpointHashes[entry.ID]; ok {
+			checkpointHashes[entry.ID] = entry.Hash
+		}
+		if result.BrokenAt != 0 {
+			return nil
+		}
+		if result.Entries == 0 {
+			result.FirstID = entry.ID
+		}
+		switch {
+		case result.Entries == 0 && anchor == nil && entry.PrevHash != "":
+			result.BrokenAt = entry.ID
+			result.Reason = "oldest entry is not the start of the chain and no purge is recorded (entries removed)"
+			return nil
+		case result.Entries == 0 && anchor != nil && (entry.PrevHash != prevHash || entry.ID <= anchor.LastID):
+			result.BrokenAt = entry.ID
+			result.Reason = "oldest entry does not continue from the last retention purge (entries removed)"
+			return nil
+		case entry.PrevHash != prevHash:
+			result.BrokenAt = entry.ID
+			result.Reason = "prev_hash does not match the entry before it (entries removed or reordered)"
+			return nil
+		}
+		if db.AuditHash(entry.PrevHash, entry) != entry.Hash {
+			result.BrokenAt = entry.ID
+			result.Reason = "hash does not match the entry's contents (entry modified)"
+			return nil
+		}
+		result.Entries++
+		result.LastID = entry.ID
+		result.HeadHash = entry.Hash
+		prevHash = entry.Hash
+		return nil
+	})
+	if err != nil {
+		return AuditVerification{}, err
+	}
+
+	result.Checkpoints = len(checkpoints)
+	for _, checkpoint := range checkpoints {
+		label := "checkpoint " + checkpoint.CreatedAt + " at entry " + strconv.FormatInt(checkpoint.LastID, 10)
+		switch {
+		case !hmac.Equal([]byte(checkpoint.Signature), []byte(s.signCheckpoint(checkpoint))):
+			result.CheckpointErrors = append(result.CheckpointErrors, label+": invalid signature")
+		case anchor != nil && checkpoint.LastID == anchor.LastID:
+			if checkpoint.Hash != anchor.Hash {
+				result.CheckpointErrors = append(result.CheckpointErrors, label+": purged entry hash differs from the checkpoint")
+			}
+		case anchor != nil && checkpoint.LastID < anchor.LastID:
+			// The entry was deleted by the retention policy.
+		case checkpointHashes[checkpoint.LastID] == "":
+			result.CheckpointErrors = append(result.CheckpointErrors, label+": entry missing from the log")
+		case checkpointHashes[checkpoint.LastID] != checkpoint.Hash:
+			result.CheckpointErrors = append(result.CheckpointErrors, label+": entry hash differs from the checkpoint")
+		}
+	}
+	return result, nil
+}
+
+func (s *Service) signCheckpoint(checkpoint AuditCheckpoint) string {
+	mac := hmac.New(sha256.New, []byte(s.Config.Audit.CheckpointKey))
+	fmt.Fprintf(mac, "%d\n%s\n%s", checkpoint.LastID, checkpoint.Hash, checkpoint.CreatedAt)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signAnchor signs a purge anchor. The "anchor" prefix keeps a checkpoint
+// signature from passing as an anchor, which would let a checkpoint be
+// replayed to excuse deleted entries.
+func (s *Service) signAnchor(anchor db.AuditAnchor) string {
+	mac := hmac.New(sha256.New, []byte(s.Config.Audit.CheckpointKey))
+	fmt.Fprintf(mac, "anchor\n%d\n%s\n%s", anchor.LastID, anchor.Hash, anchor.CreatedAt)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/kiry163/filehub/internal/db"
+)
+
+func addAuditEntries(t *testing.T, svc *Service, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := svc.DB.AddAuditLog(context.Background(), "download", "f1", "alice", "127.0.0.1", "success", ""); err != nil {
+			t.Fatalf("add audit log: %v", err)
+		}
+	}
+}
+
+// rehashAuditLogs recomputes the chain over the remaining rows starting from
+// prevHash, the way someone with write access to the database could.
+func rehashAuditLogs(t *testing.T, raw *sql.DB, prevHash string) {
+	t.Helper()
+	rows, err := raw.Query(`SELECT id, action, file_id, actor, ip_address, status, message, created_at FROM audit_logs ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make([]db.AuditLog, 0)
+	for rows.Next() {
+		var entry db.AuditLog
+		if err := rows.Scan(&entry.ID, &entry.Action, &entry.FileID, &entry.Actor, &entry.IPAddress, &entry.Status, &entry.Message, &entry.CreatedAt); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	for _, entry := range entries {
+		hash := db.AuditHash(prevHash, entry)
+		mustExec(t, raw, `UPDATE audit_logs SET prev_hash = ?, hash = ? WHERE id = ?`, prevHash, hash, entry.ID)
+		prevHash = hash
+	}
+}
+
+func verifyAudit(t *testing.T, svc *Service, checkpoints ...AuditCheckpoint) AuditVerification {
+	t.Helper()
+	result, err := svc.VerifyAuditChain(context.Background(), checkpoints)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	return result
+}
+
+func checkpointNow(t *testing.T, svc *Service) AuditCheckpoint {
+	t.Helper()
+	checkpoint, err := svc.AuditCheckpoint(context.Background())
+	if err != nil {
+		t.Fatalf("checkpoint: %v", err)
+	}
+	return checkpoint
+}
+
+func TestVerifyAuditChainIntact(t *testing.T) {
+	svc, _ := newTestService(t)
+	addAuditEntries(t, svc, 5)
+	checkpoint := checkpointNow(t, svc)
+	addAuditEntries(t, svc, 2)
+
+	result := verifyAudit(t, svc, checkpoint)
+	if !result.OK() || result.Entries != 7 || result.FirstID != 1 || result.LastID != 7 {
+		t.Fatalf("intact chain: %+v", result)
+	}
+}
+
+func TestVerifyAuditChainTampering(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   func(t *testing.T, raw *sql.DB)
+		brokenAt int64
+	}{
+		{
+			name: "modified entry",
+			tamper: func(t *testing.T, raw *sql.DB) {
+				mustExec(t, raw, `UPDATE audit_logs SET actor = 'mallory' WHERE id = 3`)
+			},
+			brokenAt: 3,
+		},
+		{
+			name: "deleted middle entry",
+			tamper: func(t *testing.T, raw *sql.DB) {
+				mustExec(t, raw, `DELETE FROM audit_logs WHERE id = 3`)
+			},
+			brokenAt: 4,
+		},
+		{
+			name: "deleted oldest entries",
+			tamper: func(t *testing.T, raw *sql.DB) {
+				mustExec(t, raw, `DELETE FROM audit_logs WHERE id <= 2`)
+			},
+			brokenAt: 3,
+		},
+		{
+			name: "reordered entries",
+			tamper: func(t *testing.T, raw *sql.DB) {
+				mustExec(t, raw, `UPDATE audit_logs SET id = 100 WHERE id = 2`)
+			},
+			brokenAt: 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc, raw := newTestService(t)
+			addAuditEntries(t, svc, 5)
+			test.tamper(t, raw)
+			result := verifyAudit(t, svc)
+			if result.OK() || result.BrokenAt != test.brokenAt {
+				t.Fatalf("want broken at %d, got %+v", test.brokenAt, result)
+			}
+		})
+	}
+}
+
+func TestVerifyAuditChainCheckpoints(t *testing.T) {
+	t.Run("truncated tail", func(t *testing.T) {
+		svc, raw := newTestService(t)
+		addAuditEntries(t, svc, 5)
+		checkpoint := checkpointNow(t, svc)
+		mustExec(t, raw, `DELETE FROM audit_logs WHERE id >= 4`)
+
+		result := verifyAudit(t, svc, checkpoint)
+		if result.BrokenAt != 0 || !hasError(result, "entry missing") {
+			t.Fatalf("truncation not reported: %+v", result)
+		}
+	})
+	t.Run("rewritten chain", func(t *testing.T) {
+		svc, raw := newTestService(t)
+		addAuditEntries(t, svc, 5)
+		checkpoint := checkpointNow(t, svc)
+		mustExec(t, raw, `UPDATE audit_logs SET actor = 'mallory' WHERE id = 2`)
+		rehashAuditLogs(t, raw, "")
+
+		result := verifyAudit(t, svc, checkpoint)
+		if result.BrokenAt != 0 || !hasError(result, "hash differs") {
+			t.Fatalf("rewrite not reported: %+v", result)
+		}
+	})
+	t.Run("forged signature", func(t *testing.T) {
+		svc, _ := newTestService(t)
+		addAuditEntries(t, svc, 3)
+		checkpoint := checkpointNow(t, svc)
+		checkpoint.Signature = strings.Repeat("0", 64)
+
+		result := verifyAudit(t, svc, checkpoint)
+		if !hasError(result, "invalid signature") {
+			t.Fatalf("forged checkpoint accepted: %+v", result)
+		}
+	})
+}
+
+func TestVerifyAuditChainAfterPurge(t *testing.T) {
+	svc, raw := newTestService(t)
+	addAuditEntries(t, svc, 6)
+	// Backdate the first four entries past the retention period.
+	mustExec(t, raw, `UPDATE audit_logs SET created_at = '2000-01-01T00:00:00Z' WHERE id <= 4`)
+	rehashAuditLogs(t, raw, "")
+	before := checkpointNow(t, svc)
+
+	count, err := svc.PurgeExpiredAuditLogs(context.Background())
+	if err != nil || count != 4 {
+		t.Fatalf("purge: %d, %v", count, err)
+	}
+	result := verifyAudit(t, svc, before)
+	if !result.OK() || result.PurgedThrough != 4 || result.FirstID != 5 {
+		t.Fatalf("purged chain: %+v", result)
+	}
+
+	t.Run("entries removed past the anchor", func(t *testing.T) {
+		svc, raw := newTestService(t)
+		addAuditEntries(t, svc, 6)
+		mustExec(t, raw, `UPDATE audit_logs SET created_at = '2000-01-01T00:00:00Z' WHERE id <= 2`)
+		rehashAuditLogs(t, raw, "")
+		if _, err := svc.PurgeExpiredAuditLogs(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		anchors, err := svc.DB.ListAuditAnchors(context.Background())
+		if err != nil || len(anchors) != 1 {
+			t.Fatalf("anchors: %v, %v", anchors, err)
+		}
+		checkpoint := checkpointNow(t, svc)
+
+		// Cut everything up to the checkpoint and re-chain the rest onto
+		// the anchor, so only the checkpoint can tell.
+		mustExec(t, raw, `DELETE FROM audit_logs WHERE id <= ?`, checkpoint.LastID)
+		addAuditEntries(t, svc, 2)
+		rehashAuditLogs(t, raw, anchors[0].Hash)
+		result := verifyAudit(t, svc, checkpoint)
+		if result.OK() || !hasError(result, "entry missing") {
+			t.Fatalf("cut past the anchor accepted: %+v", result)
+		}
+
+		// Without an anchor the cut shows in the chain itself.
+		mustExec(t, raw, `DELETE FROM audit_anchors`)
+		result = verifyAudit(t, svc)
+		if result.BrokenAt == 0 {
+			t.Fatalf("missing anchor accepted: %+v", result)
+		}
+	})
+
+	t.Run("forged anchor", func(t *testing.T) {
+		svc, raw := newTestService(t)
+		addAuditEntries(t, svc, 5)
+		var hash string
+		if err := raw.QueryRow(`SELECT hash FROM audit_logs WHERE id = 2`).Scan(&hash); err != nil {
+			t.Fatal(err)
+		}
+		mustExec(t, raw, `DELETE FROM audit_logs WHERE id <= 2`)
+		mustExec(t, raw, `INSERT INTO audit_anchors (last_id, hash, created_at, signature) VALUES (2, ?, '2026-01-01T00:00:00Z', ?)`, hash, strings.Repeat("0", 64))
+
+		result := verifyAudit(t, svc)
+		if result.OK() || result.BrokenAt != 3 || !hasError(result, "invalid signature") {
+			t.Fatalf("forged anchor accepted: %+v", result)
+		}
+	})
+
+	t.Run("checkpoint replayed as anchor", func(t *testing.T) {
+		svc, raw := newTestService(t)
+		addAuditEntries(t, svc, 2)
+		checkpoint := checkpointNow(t, svc)
+		addAuditEntries(t, svc, 3)
+		mustExec(t, raw, `DELETE FROM audit_logs WHERE id <= ?`, checkpoint.LastID)
+		mustExec(t, raw, `INSERT INTO audit_anchors (last_id, hash, created_at, signature) VALUES (?, ?, ?, ?)`,
+			checkpoint.LastID, checkpoint.Hash, checkpoint.CreatedAt, checkpoint.Signature)
+
+		result := verifyAudit(t, svc)
+		if result.OK() {
+			t.Fatalf("replayed checkpoint accepted as anchor: %+v", result)
+		}
+	})
+}
+
+func TestWriteAuditCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	if written, err := svc.WriteAuditCheckpoint(ctx); err != nil || written {
+		t.Fatalf("checkpoint of an empty log: %v, %v", written, err)
+	}
+
+	steps := []struct {
+		entries int
+		written bool
+		total   int
+	}{
+		{3, true, 1},
+		{0, false, 1},
+		{2, true, 2},
+	}
+	for i, step := range steps {
+		addAuditEntries(t, svc, step.entries)
+		written, err := svc.WriteAuditCheckpoint(ctx)
+		if err != nil || written != step.written {
+			t.Fatalf("step %d: written %v, %v", i, written, err)
+		}
+		checkpoints, err := ReadAuditCheckpoints(svc.Config.Audit.CheckpointPath)
+		if err != nil || len(checkpoints) != step.total {
+			t.Fatalf("step %d: %d checkpoints, %v", i, len(checkpoints), err)
+		}
+	}
+
+	checkpoints, err := ReadAuditCheckpoints(svc.Config.Audit.CheckpointPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := verifyAudit(t, svc, checkpoints...); !result.OK() || result.Checkpoints != 2 || checkpoints[1].LastID != 5 {
+		t.Errorf("written checkpoints: %+v, %+v", checkpoints, result)
+	}
+	svc.Config.Audit.CheckpointKey = "another-key"
+	if result := verifyAudit(t, svc, checkpoints...); len(result.CheckpointErrors) != 2 {
+		t.Errorf("checkpoints signed with another key: %+v", result)
+	}
+}
+
+func TestPurgeExpiredAuditLogs(t *testing.T) {
+	tests := []struct {
+		name      string
+		days      int
+		backdated int64
+		purged    int64
+		left      int
+	}{
+		{"kept forever", 0, 2, 0, 3},
+		{"older than retention", 30, 2, 2, 2},
+		{"newest entry is kept", 30, 3, 2, 2},
+		{"nothing expired", 30, 0, 0, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc, raw := newTestService(t)
+			svc.Config.Audit.RetentionDays = test.days
+			addAuditEntries(t, svc, 3)
+			mustExec(t, raw, `UPDATE audit_logs SET created_at = '2000-01-01T00:00:00Z' WHERE id <= ?`, test.backdated)
+
+			purged, err := svc.PurgeExpiredAuditLogs(context.Background())
+			if err != nil || purged != test.purged {
+				t.Fatalf("purged %d, %v; want %d", purged, err, test.purged)
+			}
+			if got := countRows(t, raw, `SELECT COUNT(1) FROM audit_logs`); got != test.left {
+				t.Errorf("%d entries left, want %d", got, test.left)
+			}
+			if purged > 0 {
+				head, err := svc.DB.AuditHead(context.Background())
+				if err != nil || head.Action != "audit_purge" {
+					t.Errorf("purge not logged: %+v, %v", head, err)
+				}
+			}
+		})
+	}
+}
+
+func hasError(result AuditVerification, substring string) bool {
+	for _, message := range result.CheckpointErrors {
+		if strings.Contains(message, substring) {
+			return true
+		}
+	}
+	return false
+}
@@ -7,13 +7,16 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func (s *Service) newAccessToken(username string) (string, int64, error) {
+// newAccessToken issues a JWT whose subject is the user ID and whose ID is
+// the session, so revoking the session also ends the access token.
+func (s *Service) newAccessToken(userID, sessionID string) (string, int64, error) {
 	if s.Config.Auth.JWTSecret == "" {
 		return "", 0, errors.New("missing jwt secret")
 	}
 	expiresIn := s.Config.Auth.JWTExpireHours * 3600
 	claims := jwt.RegisteredClaims{
-		Subject:   username,
+		ID:        sessionID,
+		Subject:   userID,
 		Issuer:    "filehub",
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Duration(s.Config.Auth.JWTExpireHours) * time.Hour)),
@@ -30,9 +33,11 @@ func (s *Service) ParseAccessToken(tokenString string) (*jwt.RegisteredClaims, e
 	if tokenString == "" {
 		return nil, errors.New("missing token")
 	}
+	// The issuer keeps preview tokens and MFA challenges, which are signed
+	// with the same secret, from passing as access tokens.
 	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(s.Config.Auth.JWTSecret), nil
-	})
+	}, jwt.WithIssuer("filehub"), jwt.WithValidMethods([]string{"HS256"}))
 	if err != nil {
 		return nil, err
 	}
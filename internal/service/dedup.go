@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/kiry163/filehub/internal/storage"
+)
+
+// pendingDeleteBatch is how many queued deletes one worker run retries.
+const pendingDeleteBatch = 100
+
+type DedupStats struct {
+	Enabled      bool  `json:"enabled"`
+	Objects      int   `json:"objects"`
+	References   int   `json:"references"`
+	StoredBytes  int64 `json:"stored_bytes"`
+	LogicalBytes int64 `json:"logical_bytes"`
+	SavedBytes   int64 `json:"saved_bytes"`
+}
+
+// dedupObject points a freshly saved object at an existing copy of the same
+// content when deduplication is enabled, and removes the redundant copy.
+func (s *Service) dedupObject(ctx context.Context, result storage.SaveResult) (storage.SaveResult, error) {
+	if !s.Config.Storage.Dedup || result.SHA256 == "" {
+		return result, nil
+	}
+	objectKey, created, err := s.DB.AcquireObject(ctx, result.SHA256, result.ObjectKey, result.Size)
+	if err != nil {
+		_ = s.Storage.Delete(ctx, result.ObjectKey)
+		return storage.SaveResult{}, err
+	}
+	if !created {
+		if err := s.Storage.Delete(ctx, result.ObjectKey); err != nil {
+			log.Printf("dedup: failed to remove duplicate object %s: %v", result.ObjectKey, err)
+		}
+		result.ObjectKey = objectKey
+	}
+	return result, nil
+}
+
+// releaseObject drops a file's reference to its object and deletes the object
+// once nothing refers to it any more.
+func (s *Service) releaseObject(ctx context.Context, objectKey string) {
+	remaining, tracked, err := s.DB.ReleaseObject(ctx, objectKey)
+	if err != nil {
+		log.Printf("dedup: failed to release object %s: %v", objectKey, err)
+		return
+	}
+	if tracked && remaining > 0 {
+		return
+	}
+	if err := s.Storage.Delete(ctx, objectKey); err != nil {
+		s.queueObjectDelete(ctx, objectKey, err)
+	}
+}
+
+// queueObjectDelete records an object whose rows are gone but whose delete
+// failed, so DeletePendingObjects frees the storage later.
+func (s *Service) queueObjectDelete(ctx context.Context, objectKey string, cause error) {
+	log.Printf("storage: failed to delete object %s, queued for retry: %v", objectKey, cause)
+	if err := s.DB.AddPendingDelete(context.WithoutCancel(ctx), objectKey, cause.Error()); err != nil {
+		log.Printf("storage: failed to queue object %s for deletion, it is orphaned: %v", objectKey, err)
+	}
+}
+
+// DeletePendingObjects retries the queued object deletes. Objects that are
+// referenced again are dropped from the queue without being deleted. It
+// returns the number of objects deleted.
+func (s *Service) DeletePendingObjects(ctx context.Context) (int, error) {
+	pending, err := s.DB.ListPendingDeletes(ctx, pendingDeleteBatch)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, item := range pending {
+		inUse, err := s.DB.ObjectInUse(ctx, item.ObjectKey)
+		if err != nil {
+			return deleted, err
+		}
+		if !inUse {
+			if err := s.Storage.Delete(ctx, item.ObjectKey); err != nil {
+				s.queueObjectDelete(ctx, item.ObjectKey, err)
+				continue
+			}
+			deleted++
+		}
+		if err := s.DB.RemovePendingDelete(ctx, item.ObjectKey); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Service) DedupStats(ctx context.Context) (DedupStats, error) {
+	stats, err := s.DB.GetDedupStats(ctx)
+	if err != nil {
+		return DedupStats{}, err
+	}
+	return DedupStats{
+		Enabled:      s.Config.Storage.Dedup,
+		Objects:      stats.Objects,
+		References:   stats.References,
+		StoredBytes:  stats.StoredBytes,
+		LogicalBytes: stats.LogicalBytes,
+		SavedBytes:   stats.LogicalBytes - stats.StoredBytes,
+	}, nil
+}
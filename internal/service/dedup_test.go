@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kiry163/filehub/internal/storage"
+)
+
+func TestDedupReferenceCounts(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		dedup    bool
+		contents []string
+		// objects stored after every upload, then after each file is
+		// purged in upload order.
+		objects []int
+		deleted []int
+	}{
+		{"disabled stores every copy", false, []string{"same", "same"}, []int{1, 2}, []int{1, 0}},
+		{"identical content shares one object", true, []string{"same", "same", "same"}, []int{1, 1, 1}, []int{1, 1, 0}},
+		{"different content is kept apart", true, []string{"one", "two", "one"}, []int{1, 2, 2}, []int{2, 1, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc, _ := newTestService(t)
+			svc.Config.Storage.Dedup = test.dedup
+
+			var fileIDs []string
+			for i, content := range test.contents {
+				record := uploadTestFile(t, svc, "file.txt", content)
+				fileIDs = append(fileIDs, record.FileID)
+				if got := storedObjects(t, svc); got != test.objects[i] {
+					t.Fatalf("after upload %d: %d objects stored, want %d", i, got, test.objects[i])
+				}
+				if _, reader, err := svc.GetObject(ctx, record.ObjectKey, nil, nil); err != nil {
+					t.Fatalf("upload %d unreadable: %v", i, err)
+				} else {
+					reader.Close()
+				}
+			}
+			for i, fileID := range fileIDs {
+				purgeTestFile(t, svc, fileID)
+				if got := storedObjects(t, svc); got != test.deleted[i] {
+					t.Fatalf("after delete %d: %d objects stored, want %d", i, got, test.deleted[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDedupStats(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	svc.Config.Storage.Dedup = true
+	uploadTestFile(t, svc, "a.txt", "0123456789")
+	uploadTestFile(t, svc, "b.txt", "0123456789")
+	uploadTestFile(t, svc, "c.txt", "abc")
+
+	stats, err := svc.DedupStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DedupStats{Enabled: true, Objects: 2, References: 3, StoredBytes: 13, LogicalBytes: 23, SavedBytes: 10}
+	if stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+}
+
+// TestDedupReleasesUntrackedObjects covers files stored before
+// deduplication was turned on, which have no objects row.
+func TestDedupReleasesUntrackedObjects(t *testing.T) {
+	svc, raw := newTestService(t)
+	legacy := uploadTestFile(t, svc, "old.txt", "same")
+	svc.Config.Storage.Dedup = true
+	uploadTestFile(t, svc, "new.txt", "same")
+	if got := countRows(t, raw, `SELECT COUNT(1) FROM objects`); got != 1 {
+		t.Fatalf("%d objects rows", got)
+	}
+
+	purgeTestFile(t, svc, legacy.FileID)
+	if got := storedObjects(t, svc); got != 1 {
+		t.Errorf("%d objects stored after deleting the untracked file", got)
+	}
+}
+
+// failingDeletes is storage whose deletes fail while fail is set.
+type failingDeletes struct {
+	storage.Storage
+	fail bool
+}
+
+func (s *failingDeletes) Delete(ctx context.Context, objectKey string) error {
+	if s.fail {
+		return errors.New("storage unavailable")
+	}
+	return s.Storage.Delete(ctx, objectKey)
+}
+
+func TestPendingObjectDeletes(t *testing.T) {
+	ctx := context.Background()
+	svc, raw := newTestService(t)
+	store := &failingDeletes{Storage: svc.Storage, fail: true}
+	svc.Storage = store
+	orphan := uploadTestFile(t, svc, "orphan.txt", "orphan")
+	reused := uploadTestFile(t, svc, "reused.txt", "reused")
+	purgeTestFile(t, svc, orphan.FileID)
+	if err := svc.DB.AddPendingDelete(ctx, reused.ObjectKey, "queued before it was reused"); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name     string
+		fail     bool
+		deleted  int
+		attempts int
+		stored   int
+	}{
+		{"storage still failing", true, 0, 2, 2},
+		{"storage back", false, 1, 0, 1},
+		{"queue empty", false, 0, 0, 1},
+	}
+	for _, step := range steps {
+		store.fail = step.fail
+		deleted, err := svc.DeletePendingObjects(ctx)
+		if err != nil || deleted != step.deleted {
+			t.Fatalf("%s: deleted %d, %v; want %d", step.name, deleted, err, step.deleted)
+		}
+		attempts := countRows(t, raw, `SELECT COALESCE(SUM(attempts), 0) FROM pending_deletes WHERE object_key = ?`, orphan.ObjectKey)
+		if attempts != step.attempts {
+			t.Errorf("%s: %d attempts recorded, want %d", step.name, attempts, step.attempts)
+		}
+		if got := countRows(t, raw, `SELECT COUNT(1) FROM pending_deletes WHERE object_key = ?`, reused.ObjectKey); got != 0 {
+			t.Errorf("%s: object in use still queued", step.name)
+		}
+		if got := storedObjects(t, svc); got != step.stored {
+			t.Errorf("%s: %d objects stored, want %d", step.name, got, step.stored)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/oidc"
+)
+
+// OIDCFlowTTL bounds how long a user may take at the issuer's login page.
+const OIDCFlowTTL = 10 * time.Minute
+
+var (
+	ErrOIDCDisabled = errors.New("oidc is not configured")
+	ErrOIDCState    = errors.New("oidc state mismatch or expired")
+	ErrOIDCUsername = errors.New("oidc username claim is missing or not a valid username")
+	ErrOIDCLinked   = errors.New("username is linked to another oidc account")
+	ErrOIDCNoRole   = errors.New("no role mapped for oidc user")
+)
+
+// oidcFlowClaims travel in a signed cookie between the login redirect and
+// the callback, so no server-side state is needed.
+type oidcFlowClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (s *Service) OIDCEnabled() bool {
+	return s.Config.Auth.OIDC.Issuer != ""
+}
+
+func (s *Service) oidcProvider() *oidc.Provider {
+	s.oidcOnce.Do(func() {
+		cfg := s.Config.Auth.OIDC
+		s.oidc = &oidc.Provider{
+			Issuer:       cfg.Issuer,
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Scopes:       cfg.Scopes,
+		}
+	})
+	return s.oidc
+}
+
+// OIDCBegin starts a login at the issuer. It returns the URL to send the
+// browser to and the flow cookie the callback must present. redirect is the
+// local path to return to after login.
+func (s *Service) OIDCBegin(ctx context.Context, callbackURL, redirect string) (string, string, error) {
+	if !s.OIDCEnabled() {
+		return "", "", ErrOIDCDisabled
+	}
+	flow := oidcFlowClaims{Redirect: redirect}
+	for _, value := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		token, err := randomToken(32)
+		if err != nil {
+			return "", "", err
+		}
+		*value = token
+	}
+	authURL, err := s.oidcProvider().AuthCodeURL(ctx, callbackURL, flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now().UTC()
+	flow.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    "filehub-oidc",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(OIDCFlowTTL)),
+	}
+	cookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, flow).SignedString([]byte(s.Config.Auth.JWTSecret))
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, cookie, nil
+}
+
+// OIDCLogin finishes a login started by OIDCBegin: it redeems the code,
+// maps the ID token to a user and issues the usual token pair. The
+// redirect given to OIDCBegin is returned as well.
+func (s *Service) OIDCLogin(ctx context.Context, callbackURL, cookie, state, code string, client Client) (Tokens, db.User, string, error) {
+	if !s.OIDCEnabled() {
+		return Tokens{}, db.User{}, "", ErrOIDCDisabled
+	}
+	var flow oidcFlowClaims
+	_, err := jwt.ParseWithClaims(cookie, &flow, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.Config.Auth.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithIssuer("filehub-oidc"))
+	if err != nil || state == "" || flow.State != state {
+		return Tokens{}, db.User{}, "", ErrOIDCState
+	}
+	claims, err := s.oidcProvider().Exchange(ctx, callbackURL, code, flow.Verifier, flow.Nonce)
+	if err != nil {
+		return Tokens{}, db.User{}, flow.Redirect, err
+	}
+	user, err := s.oidcUser(ctx, claims)
+	if err != nil {
+		return Tokens{}, db.User{}, flow.Redirect, err
+	}
+	tokens, err := s.issueTokens(ctx, user, client)
+	return tokens, user, flow.Redirect, err
+}
+
+// oidcUser finds the account for an ID token, linking an existing account
+// with the same username on its first OIDC login and creating one
+// otherwise. With a role mapping configured, the role follows the groups
+// claim on every login.
+func (s *Service) oidcUser(ctx context.Context, claims oidc.Claims) (db.User, error) {
+	cfg := s.Config.Auth.OIDC
+	subject := cfg.Issuer + " " + claims.Subject
+	role := s.oidcRole(claims.Strings(cfg.GroupsClaim))
+
+	user, err := s.DB.GetUserByOIDCSubject(ctx, subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		username := strings.TrimSpace(claims.String(cfg.UsernameClaim))
+		if !usernamePattern.MatchString(username) || username == LocalActor {
+			return db.User{}, ErrOIDCUsername
+		}
+		if cfg.UsernameClaim == "email" {
+			if verified, ok := claims.Raw["email_verified"].(bool); ok && !verified {
+				return db.User{}, ErrOIDCUsername
+			}
+		}
+		user, err = s.DB.GetUserByUsername(ctx, username)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if role == "" {
+				return db.User{}, ErrOIDCNoRole
+			}
+			now := db.NowRFC3339()
+			user = db.User{
+				UserID:      "u_" + generateFileID(12),
+				Username:    username,
+				Role:        role,
+				OIDCSubject: subject,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			if err := s.DB.CreateUser(ctx, user); err != nil {
+				return db.User{}, err
+			}
+		case err != nil:
+			return db.User{}, err
+		case user.OIDCSubject != "":
+			return db.User{}, ErrOIDCLinked
+		default:
+			user.OIDCSubject = subject
+			if err := s.DB.UpdateUser(ctx, user); err != nil {
+				return db.User{}, err
+			}
+		}
+	} else if err != nil {
+		return db.User{}, err
+	}
+
+	if user.Disabled {
+		return db.User{}, ErrUserDisabled
+	}
+	if len(cfg.RoleMapping) > 0 && role != user.Role {
+		if role == "" {
+			return db.User{}, ErrOIDCNoRole
+		}
+		updated, err := s.UpdateUser(ctx, user.UserID, UserUpdate{Role: &role})
+		if err != nil && !errors.Is(err, ErrLastAdmin) {
+			return db.User{}, err
+		}
+		if err == nil {
+			user = updated
+		}
+	}
+	return user, nil
+}
+
+// oidcRole returns the highest role mapped from groups, or DefaultRole when
+// none of them is mapped.
+func (s *Service) oidcRole(groups []string) string {
+	best := -1
+	for _, group := range groups {
+		if role, ok := s.Config.Auth.OIDC.RoleMapping[group]; ok {
+			best = max(best, slices.Index(roleOrder, role))
+		}
+	}
+	if best < 0 {
+		return s.Config.Auth.OIDC.DefaultRole
+	}
+	return roleOrder[best]
+}
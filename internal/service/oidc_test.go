@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/oidc/oidctest"
+)
+
+const testCallbackURL = "http://filehub.test/api/v1/auth/oidc/callback"
+
+// newOIDCService returns a service that signs in through a mock issuer.
+func newOIDCService(t *testing.T) (*Service, *oidctest.Issuer) {
+	t.Helper()
+	svc, _ := newTestService(t)
+	issuer := oidctest.NewIssuer(t, "filehub")
+	svc.Config.Auth.OIDC.Issuer = issuer.URL
+	svc.Config.Auth.OIDC.ClientID = issuer.ClientID
+	svc.Config.Auth.OIDC.Scopes = []string{"openid", "email"}
+	svc.Config.Auth.OIDC.UsernameClaim = "email"
+	svc.Config.Auth.OIDC.GroupsClaim = "groups"
+	svc.Config.Auth.OIDC.DefaultRole = RoleViewer
+	return svc, issuer
+}
+
+// oidcLogin runs a whole login: the redirect to the issuer, the user signing
+// in there and the callback.
+func oidcLogin(t *testing.T, svc *Service, issuer *oidctest.Issuer) (db.User, error) {
+	t.Helper()
+	authURL, cookie, err := svc.OIDCBegin(context.Background(), testCallbackURL, "/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := issuer.Authorize(t, authURL)
+	tokens, user, redirect, err := svc.OIDCLogin(context.Background(), testCallbackURL, cookie, state, code, Client{})
+	if err == nil && (tokens.AccessToken == "" || redirect != "/files") {
+		t.Errorf("tokens %+v, redirect %q", tokens, redirect)
+	}
+	return user, err
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ctx := context.Background()
+	mapping := map[string]string{"filehub-admins": RoleAdmin, "filehub-editors": RoleEditor}
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, svc *Service, issuer *oidctest.Issuer)
+		role  string
+		err   error
+	}{
+		{"first login creates a user with the default role", nil, RoleViewer, nil},
+		{"existing username is linked and keeps its role", func(t *testing.T, svc *Service, issuer *oidctest.Issuer) {
+			if _, err := svc.CreateUser(ctx, "alice@example.com", "password1", RoleEditor); err != nil {
+				t.Fatal(err)
+			}
+		}, RoleEditor, nil},
+		{"role mapped from groups", func(t *testing.T, svc *Service, issuer *oidctest.Issuer) {
+			svc.Config.Auth.OIDC.RoleMapping = mapping
+			issuer.Claims["groups"] = []string{"staff", "filehub-editors"}
+		}, RoleEditor, nil},
+		{"highest mapped role wins", func(t *testing.T, svc *Service, issuer *oidctest.Issuer) {
+			svc.Config.Auth.OIDC.RoleMapping = mapping
+			issuer.Claims["groups"] = []string{"filehub-editors", "filehub-admins"}
+		}, RoleAdmin, nil},
+		{"single group as a string", func(t *testing.T, svc *Service, issuer *oidctest.Issuer) {
+			svc.Config.Auth.OIDC.RoleMapping = mapping
+			issuer.Claims["groups"] = "filehub-admins"
+		}, RoleAdmin, nil},
+		{"mapping overrides the role of a linked user", func(t *testing.T, svc *Service, issuer *oidctest.Issuer) {
+			if _, err := svc.CreateUser(ctx, "alice@example.com", "password1", RoleViewer); err != nil {
+				t.Fatal(err)
+			}
+			svc.Config.Auth.OIDC.RoleMapping = mapping
+			issuer.Claims["groups"] = []string{"filehub-editors"}
+		}, RoleEditor, nil},
+		{"no mapped group and no default role", func(t *testing.T, svc *Service, issuer *oidctest.Issuer) {
+			svc.Config.Auth.OIDC.RoleMapping = mapping
+			svc.Config.Auth.OIDC.DefaultRole = ""
+			issuer.Claims["groups"] = []string{"staff"}
+		}, "", ErrOIDCNoRole},
+		{"unverified email", func(t *testing.T, svc *Service, issuer *oidctest.Issuer) {
+			issuer.Claims["email_verified"] = false
+		}, "", ErrOIDCUsername},
+		{"unverified email of an existing user", func(t *testing.T, svc *Service, issuer *oidctest.Issuer) {
+			if _, err := svc.CreateUser(ctx, "alice@example.com", "password1", RoleAdmin); err != nil {
+				t.Fatal(err)
+			}
+			issuer.Claims["email_verified"] = false
+		}, "", ErrOIDCUsername},
+		{"username claim missing", func(t *testing.T, svc *Service, issuer *oidctest.Issuer) {
+			issuer.Claims["email"] = nil
+		}, "", ErrOIDCUsername},
+		{"username claim not a valid username", func(t *testing.T, svc *Service, issuer *oidctest.Issuer) {
+			issuer.Claims["email"] = "alice smith@example.com"
+		}, "", ErrOIDCUsername},
+		{"username linked to another subject", func(t *testing.T, svc *Service, issuer *oidctest.Issuer) {
+			if _, err := oidcLogin(t, svc, issuer); err != nil {
+				t.Fatal(err)
+			}
+			issuer.Claims["sub"] = "subject-2"
+		}, "", ErrOIDCLinked},
+		{"disabled user", func(t *testing.T, svc *Service, issuer *oidctest.Issuer) {
+			user, err := svc.CreateUser(ctx, "alice@example.com", "password1", RoleEditor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			yes := true
+			if _, err := svc.UpdateUser(ctx, user.UserID, UserUpdate{Disabled: &yes}); err != nil {
+				t.Fatal(err)
+			}
+		}, "", ErrUserDisabled},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc, issuer := newOIDCService(t)
+			if test.setup != nil {
+				test.setup(t, svc, issuer)
+			}
+			user, err := oidcLogin(t, svc, issuer)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if user.Username != "alice@example.com" || user.Role != test.role || user.OIDCSubject != issuer.URL+" subject-1" {
+				t.Errorf("user %+v", user)
+			}
+			users, err := svc.ListUsers(ctx)
+			if err != nil || len(users) != 1 {
+				t.Errorf("users %+v, %v", users, err)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginFollowsSubject(t *testing.T) {
+	svc, issuer := newOIDCService(t)
+	first, err := oidcLogin(t, svc, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The account stays tied to the subject when the email changes.
+	issuer.Claims["email"] = "alice@new.example.com"
+	again, err := oidcLogin(t, svc, issuer)
+	if err != nil || again.UserID != first.UserID || again.Username != first.Username {
+		t.Errorf("second login %+v, %v", again, err)
+	}
+}
+
+func TestOIDCLoginChecksState(t *testing.T) {
+	ctx := context.Background()
+	svc, issuer := newOIDCService(t)
+	authURL, cookie, err := svc.OIDCBegin(ctx, testCallbackURL, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherCookie, err := svc.OIDCBegin(ctx, testCallbackURL, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := issuer.Authorize(t, authURL)
+
+	tests := []struct {
+		name   string
+		cookie string
+		state  string
+	}{
+		{"no cookie", "", state},
+		{"no state", cookie, ""},
+		{"state of another flow", otherCookie, state},
+		{"tampered cookie", cookie + "x", state},
+	}
+	for _, test := range tests {
+		if _, _, _, err := svc.OIDCLogin(ctx, testCallbackURL, test.cookie, test.state, code, Client{}); !errors.Is(err, ErrOIDCState) {
+			t.Errorf("%s: got %v, want ErrOIDCState", test.name, err)
+		}
+	}
+	if _, _, _, err := svc.OIDCLogin(ctx, testCallbackURL, cookie, state, code, Client{}); err != nil {
+		t.Errorf("valid callback after rejected ones: %v", err)
+	}
+
+	svc.Config.Auth.OIDC.Issuer = ""
+	if _, _, err := svc.OIDCBegin(ctx, testCallbackURL, "/"); !errors.Is(err, ErrOIDCDisabled) {
+		t.Errorf("begin without an issuer: %v", err)
+	}
+}
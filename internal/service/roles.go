@@ -0,0 +1,45 @@
+package service
+
+import (
+	"errors"
+	"slices"
+)
+
+// Roles, from least to most privileged.
+const (
+	RoleViewer   = "viewer"
+	RoleUploader = "uploader"
+	RoleEditor   = "editor"
+	RoleAdmin    = "admin"
+)
+
+// Permissions required by API routes.
+const (
+	PermRead   = "read"   // list, inspect and download
+	PermUpload = "upload" // add new files
+	PermWrite  = "write"  // create, rename, move and delete files and folders
+	PermShare  = "share"  // create and manage share links
+	PermAdmin  = "admin"  // users and server maintenance
+)
+
+var ErrRoleInvalid = errors.New("role must be admin, editor, uploader or viewer")
+
+var roleOrder = []string{RoleViewer, RoleUploader, RoleEditor, RoleAdmin}
+
+var rolePermissions = map[string][]string{
+	RoleViewer:   {PermRead},
+	RoleUploader: {PermRead, PermUpload},
+	RoleEditor:   {PermRead, PermUpload, PermWrite, PermShare},
+	RoleAdmin:    {PermRead, PermUpload, PermWrite, PermShare, PermAdmin},
+}
+
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleAllows reports whether role grants permission. Unknown roles grant
+// nothing.
+func RoleAllows(role, permission string) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
@@ -0,0 +1,28 @@
+package service
+
+import "testing"
+
+func TestRoleAllows(t *testing.T) {
+	permissions := []string{PermRead, PermUpload, PermWrite, PermShare, PermAdmin}
+	tests := []struct {
+		role    string
+		granted []bool // in the order of permissions
+	}{
+		{RoleViewer, []bool{true, false, false, false, false}},
+		{RoleUploader, []bool{true, true, false, false, false}},
+		{RoleEditor, []bool{true, true, true, true, false}},
+		{RoleAdmin, []bool{true, true, true, true, true}},
+		{"owner", []bool{false, false, false, false, false}},
+		{"", []bool{false, false, false, false, false}},
+	}
+	for _, test := range tests {
+		if valid := test.granted[0]; ValidRole(test.role) != valid {
+			t.Errorf("ValidRole(%q) = %v", test.role, !valid)
+		}
+		for i, permission := range permissions {
+			if got := RoleAllows(test.role, permission); got != test.granted[i] {
+				t.Errorf("RoleAllows(%q, %q) = %v, want %v", test.role, permission, got, test.granted[i])
+			}
+		}
+	}
+}
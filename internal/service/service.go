@@ -7,10 +7,12 @@ import (
 	"errors"
 	"io"
 	"mime/multipart"
+	"sync"
 	"time"
 
 	"github.com/kiry163/filehub/internal/config"
 	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/oidc"
 	"github.com/kiry163/filehub/internal/storage"
 )
 
@@ -18,53 +20,102 @@ type Service struct {
 	DB      *db.DB
 	Storage storage.Storage
 	Config  config.Config
+
+	oidcOnce sync.Once
+	oidc     *oidc.Provider
 }
 
+// ErrFileTooLarge is returned when an upload exceeds Upload.MaxSizeMB.
+var ErrFileTooLarge = errors.New("file too large")
+
 type Tokens struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 	ExpiresIn    int64  `json:"expires_in"`
 }
 
-func (s *Service) Login(ctx context.Context, username, password string) (Tokens, error) {
-	if username != s.Config.Auth.AdminUsername || password != s.Config.Auth.AdminPassword {
-		return Tokens{}, errors.New("invalid credentials")
+// Login checks a password and starts a session for client. Users with
+// two-factor authentication get a challenge instead of tokens, to be
+// completed with LoginMFA.
+func (s *Service) Login(ctx context.Context, username, password string, client Client) (Tokens, *MFAChallenge, error) {
+	user, err := s.Authenticate(ctx, username, password)
+	if err != nil {
+		return Tokens{}, nil, err
 	}
-	return s.issueTokens(ctx, username)
+	if user.TOTPEnabled {
+		challenge, err := s.newMFAChallenge(ctx, user.UserID)
+		return Tokens{}, &challenge, err
+	}
+	tokens, err := s.issueTokens(ctx, user, client)
+	return tokens, nil, err
 }
 
-func (s *Service) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
-	record, err := s.DB.GetRefreshToken(ctx, refreshToken)
+func (s *Service) Upload(ctx context.Context, header *multipart.FileHeader, createdBy string, folderID *string) (db.FileRecord, error) {
+	reader, err := header.Open()
 	if err != nil {
-		return Tokens{}, err
-	}
-	if record.IsRevoked {
-		return Tokens{}, errors.New("refresh token revoked")
+		return db.FileRecord{}, err
 	}
-	expiresAt, err := time.Parse(time.RFC3339, record.ExpiresAt)
+	defer reader.Close()
+
+	fileID := generateFileID(12)
+	saveResult, err := s.Storage.Save(ctx, reader, header.Size, fileID, header.Filename)
 	if err != nil {
-		return Tokens{}, err
-	}
-	if time.Now().UTC().After(expiresAt) {
-		return Tokens{}, errors.New("refresh token expired")
+		return db.FileRecord{}, err
 	}
-	_ = s.DB.RevokeRefreshToken(ctx, refreshToken)
-	return s.issueTokens(ctx, s.Config.Auth.AdminUsername)
+	return s.createFile(ctx, fileID, header.Filename, saveResult, createdBy, folderID)
 }
 
-func (s *Service) Logout(ctx context.Context) error {
-	return s.DB.RevokeAllRefreshTokens(ctx)
-}
+// UploadStream stores a raw request body as a new file. size is -1 when the
+// length is not known up front; the body is cut off with ErrFileTooLarge as
+// soon as it passes Upload.MaxSizeMB.
+func (s *Service) UploadStream(ctx context.Context, reader io.Reader, size int64, originalName, createdBy string, folderID *string) (db.FileRecord, error) {
+	maxBytes := s.Config.Upload.MaxSizeMB * 1024 * 1024
+	if maxBytes > 0 && size > maxBytes {
+		return db.FileRecord{}, ErrFileTooLarge
+	}
+	limited := &limitedReader{reader: reader, remaining: maxBytes}
+	if maxBytes > 0 {
+		reader = limited
+	}
 
-func (s *Service) Upload(ctx context.Context, header *multipart.FileHeader, createdBy string) (db.FileRecord, error) {
-	reader, err := header.Open()
+	fileID := generateFileID(12)
+	saveResult, err := s.Storage.Save(ctx, reader, size, fileID, originalName)
+	if limited.exceeded {
+		if err == nil {
+			s.releaseObject(ctx, saveResult.ObjectKey)
+		}
+		return db.FileRecord{}, ErrFileTooLarge
+	}
 	if err != nil {
 		return db.FileRecord{}, err
 	}
-	defer reader.Close()
+	return s.createFile(ctx, fileID, originalName, saveResult, createdBy, folderID)
+}
 
-	fileID := generateFileID(12)
-	saveResult, err := s.Storage.Save(ctx, reader, header.Size, fileID, header.Filename)
+// limitedReader fails once more than remaining bytes have been read.
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (l *limitedReader) Read(buf []byte) (int, error) {
+	if int64(len(buf)) > l.remaining+1 {
+		buf = buf[:l.remaining+1]
+	}
+	n, err := l.reader.Read(buf)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		l.exceeded = true
+		return 0, ErrFileTooLarge
+	}
+	return n, err
+}
+
+// createFile records a stored object as a new file, sharing the object with
+// identical content when deduplication is enabled.
+func (s *Service) createFile(ctx context.Context, fileID, originalName string, saveResult storage.SaveResult, createdBy string, folderID *string) (db.FileRecord, error) {
+	saveResult, err := s.dedupObject(ctx, saveResult)
 	if err != nil {
 		return db.FileRecord{}, err
 	}
@@ -72,16 +123,21 @@ func (s *Service) Upload(ctx context.Context, header *multipart.FileHeader, crea
 	now := db.NowRFC3339()
 	record := db.FileRecord{
 		FileID:       fileID,
-		OriginalName: header.Filename,
+		OriginalName: originalName,
 		ObjectKey:    saveResult.ObjectKey,
 		Size:         saveResult.Size,
 		MimeType:     saveResult.MimeType,
+		SHA256:       saveResult.SHA256,
+		MD5:          saveResult.MD5,
+		FolderID:     folderID,
+		Version:      1,
 		CreatedBy:    createdBy,
 		CreatedAt:    now,
 		UpdatedAt:    now,
 	}
 
 	if err := s.DB.CreateFile(ctx, record); err != nil {
+		s.releaseObject(ctx, record.ObjectKey)
 		return db.FileRecord{}, err
 	}
 	return record, nil
@@ -91,17 +147,16 @@ func (s *Service) GetFile(ctx context.Context, fileID string) (db.FileRecord, er
 	return s.DB.GetFile(ctx, fileID)
 }
 
-func (s *Service) ListFiles(ctx context.Context, limit, offset int, order, keyword string) ([]db.FileRecord, int, error) {
-	return s.DB.ListFiles(ctx, limit, offset, order, keyword)
+// ListFiles leaves out the files hidden from the caller, see
+// FolderAccess.Hidden.
+func (s *Service) ListFiles(ctx context.Context, limit, offset int, order, keyword string, folderID *string, hidden db.Visibility) ([]db.FileRecord, int, error) {
+	return s.DB.ListFiles(ctx, limit, offset, order, keyword, folderID, hidden)
 }
 
-func (s *Service) DeleteFile(ctx context.Context, fileID string) (db.FileRecord, error) {
-	record, err := s.DB.DeleteFile(ctx, fileID)
-	if err != nil {
-		return db.FileRecord{}, err
-	}
-	_ = s.Storage.Delete(ctx, record.ObjectKey)
-	return record, nil
+// SearchFiles runs an advanced file search; query.Hidden should come from
+// FolderAccess.Hidden.
+func (s *Service) SearchFiles(ctx context.Context, query db.FileQuery) ([]db.FileRecord, int, error) {
+	return s.DB.SearchFiles(ctx, query)
 }
 
 func (s *Service) GetObject(ctx context.Context, objectKey string, rangeStart, rangeEnd *int64) (storage.ObjectInfo, io.ReadCloser, error) {
@@ -123,8 +178,28 @@ func generateFileID(length int) string {
 	return string(buf)
 }
 
-func (s *Service) issueTokens(ctx context.Context, username string) (Tokens, error) {
-	accessToken, expiresIn, err := s.newAccessToken(username)
+// issueTokens starts a new session for user on client.
+func (s *Service) issueTokens(ctx context.Context, user db.User, client Client) (Tokens, error) {
+	now := db.NowRFC3339()
+	session := db.Session{
+		SessionID:  "s_" + generateFileID(16),
+		UserID:     user.UserID,
+		UserAgent:  client.userAgent(),
+		IPAddress:  client.IP,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  s.refreshExpiresAt(),
+	}
+	if err := s.DB.CreateSession(ctx, session); err != nil {
+		return Tokens{}, err
+	}
+	return s.sessionTokens(ctx, user, session)
+}
+
+// sessionTokens issues an access token and the next refresh token of a
+// session.
+func (s *Service) sessionTokens(ctx context.Context, user db.User, session db.Session) (Tokens, error) {
+	accessToken, expiresIn, err := s.newAccessToken(user.UserID, session.SessionID)
 	if err != nil {
 		return Tokens{}, err
 	}
@@ -133,8 +208,7 @@ func (s *Service) issueTokens(ctx context.Context, username string) (Tokens, err
 	if err != nil {
 		return Tokens{}, err
 	}
-	refreshExpiresAt := time.Now().UTC().Add(time.Hour * 24 * time.Duration(s.Config.Auth.RefreshExpireDays)).Format(time.RFC3339)
-	if err := s.DB.CreateRefreshToken(ctx, refreshToken, refreshExpiresAt); err != nil {
+	if err := s.DB.CreateRefreshToken(ctx, refreshToken, user.UserID, session.SessionID, session.ExpiresAt); err != nil {
 		return Tokens{}, err
 	}
 
@@ -145,6 +219,10 @@ func (s *Service) issueTokens(ctx context.Context, username string) (Tokens, err
 	}, nil
 }
 
+func (s *Service) refreshExpiresAt() string {
+	return time.Now().UTC().Add(time.Hour * 24 * time.Duration(s.Config.Auth.RefreshExpireDays)).Format(time.RFC3339)
+}
+
 func randomToken(length int) (string, error) {
 	buf := make([]byte, length)
 	if _, err := rand.Read(buf); err != nil {
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kiry163/filehub/internal/config"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/storage"
+)
+
+// newTestService returns a service on a fresh, fully migrated database and
+// filesystem storage, and a second connection to the same database file for
+// inspecting and tampering with rows behind the service's back.
+func newTestService(t *testing.T) (*Service, *sql.DB) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "filehub.db")
+	database, err := db.Open(path)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	raw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open raw connection: %v", err)
+	}
+	t.Cleanup(func() { raw.Close() })
+	store, err := storage.NewFilesystemStorage(filepath.Join(dir, "objects"))
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+
+	var cfg config.Config
+	cfg.Auth.JWTSecret = "test-secret"
+	cfg.Auth.JWTExpireHours = 24
+	cfg.Auth.RefreshExpireDays = 7
+	cfg.Audit.CheckpointKey = "test-checkpoint-key"
+	cfg.Audit.CheckpointPath = filepath.Join(dir, "audit-checkpoints.ndjson")
+	cfg.Audit.RetentionDays = 30
+	cfg.Storage.Driver = config.StorageDriverFilesystem
+	cfg.Storage.Path = filepath.Join(dir, "objects")
+	return &Service{DB: database, Storage: store, Config: cfg}, raw
+}
+
+func mustExec(t *testing.T, raw *sql.DB, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := raw.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+func countRows(t *testing.T, raw *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	var count int
+	if err := raw.QueryRow(query, args...).Scan(&count); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return count
+}
+
+// multipartFile builds the multipart header an upload handler would pass to
+// the service.
+func multipartFile(t *testing.T, name, content string) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	return req.MultipartForm.File["file"][0]
+}
+
+func uploadTestFile(t *testing.T, svc *Service, name, content string) db.FileRecord {
+	t.Helper()
+	return uploadTestFileTo(t, svc, nil, name, content)
+}
+
+func uploadTestFileTo(t *testing.T, svc *Service, folderID *string, name, content string) db.FileRecord {
+	t.Helper()
+	record, err := svc.Upload(context.Background(), multipartFile(t, name, content), "alice", folderID)
+	if err != nil {
+		t.Fatalf("upload %s: %v", name, err)
+	}
+	return record
+}
+
+func createTestFolder(t *testing.T, svc *Service, folderID, name string, parentID *string) {
+	t.Helper()
+	now := db.NowRFC3339()
+	record := db.FolderRecord{FolderID: folderID, Name: name, ParentID: parentID, CreatedBy: "alice", CreatedAt: now, UpdatedAt: now}
+	if err := svc.DB.CreateFolder(context.Background(), record); err != nil {
+		t.Fatalf("create folder %s: %v", folderID, err)
+	}
+}
+
+func ptr(value string) *string {
+	return &value
+}
+
+// storedObjects counts the objects in the filesystem storage.
+func storedObjects(t *testing.T, svc *Service) int {
+	t.Helper()
+	count := 0
+	err := filepath.Walk(svc.Config.Storage.Path, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			count++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
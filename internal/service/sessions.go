@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kiry163/filehub/internal/db"
+)
+
+// maxUserAgentLength bounds the User-Agent stored with a session.
+const maxUserAgentLength = 512
+
+var (
+	ErrRefreshInvalid = errors.New("refresh token invalid")
+	// ErrRefreshReused means a rotated refresh token was presented again,
+	// so it may have been stolen; the whole session has been revoked.
+	ErrRefreshReused = errors.New("refresh token reused")
+)
+
+// Client identifies the device behind a login or refresh.
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+func (c Client) userAgent() string {
+	if len(c.UserAgent) > maxUserAgentLength {
+		return c.UserAgent[:maxUserAgentLength]
+	}
+	return c.UserAgent
+}
+
+// Refresh rotates a refresh token: the presented token is spent and the
+// session gets a new pair. Presenting a spent token again revokes the
+// session, which also ends the tokens issued in its place.
+func (s *Service) Refresh(ctx context.Context, refreshToken string, client Client) (Tokens, error) {
+	record, err := s.DB.GetRefreshToken(ctx, refreshToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tokens{}, ErrRefreshInvalid
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	if record.SessionID == "" {
+		return Tokens{}, ErrRefreshInvalid
+	}
+	session, err := s.DB.GetSession(ctx, record.SessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tokens{}, ErrRefreshInvalid
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	if session.RevokedAt != nil {
+		return Tokens{}, ErrRefreshInvalid
+	}
+	if record.IsRevoked {
+		return Tokens{}, s.revokeReusedSession(ctx, session.SessionID)
+	}
+	if db.NowRFC3339() >= record.ExpiresAt {
+		return Tokens{}, ErrRefreshInvalid
+	}
+	user, err := s.ActiveUser(ctx, record.UserID)
+	if err != nil {
+		return Tokens{}, err
+	}
+	// Two concurrent refreshes with the same token: only one spends it.
+	if err := s.DB.RevokeRefreshToken(ctx, refreshToken); errors.Is(err, sql.ErrNoRows) {
+		return Tokens{}, s.revokeReusedSession(ctx, session.SessionID)
+	} else if err != nil {
+		return Tokens{}, err
+	}
+
+	session.UserAgent = client.userAgent()
+	session.IPAddress = client.IP
+	session.ExpiresAt = s.refreshExpiresAt()
+	if err := s.DB.TouchSession(ctx, session.SessionID, session.UserAgent, session.IPAddress, session.ExpiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Tokens{}, ErrRefreshInvalid
+		}
+		return Tokens{}, err
+	}
+	return s.sessionTokens(ctx, user, session)
+}
+
+func (s *Service) revokeReusedSession(ctx context.Context, sessionID string) error {
+	if err := s.DB.RevokeSession(ctx, sessionID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return ErrRefreshReused
+}
+
+// Logout ends the session behind the caller's access token. API keys and
+// the local key carry no session, so there is nothing to end for them.
+func (s *Service) Logout(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	err := s.DB.RevokeSession(ctx, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// ListSessions returns the active sessions of a user.
+func (s *Service) ListSessions(ctx context.Context, userID string) ([]db.Session, error) {
+	return s.DB.ListUserSessions(ctx, userID, db.NowRFC3339())
+}
+
+// RevokeSession ends one session of a user. Sessions of other users look
+// like unknown ones.
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	session, err := s.DB.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return sql.ErrNoRows
+	}
+	return s.DB.RevokeSession(ctx, sessionID)
+}
+
+// RevokeAllSessions ends every session of a user and returns how many were
+// active.
+func (s *Service) RevokeAllSessions(ctx context.Context, userID string) (int64, error) {
+	return s.DB.RevokeUserSessions(ctx, userID)
+}
+
+// SessionActive reports whether an access token's session may still be used.
+func (s *Service) SessionActive(ctx context.Context, sessionID string) bool {
+	session, err := s.DB.GetSession(ctx, sessionID)
+	return err == nil && session.RevokedAt == nil && db.NowRFC3339() < session.ExpiresAt
+}
+
+// PurgeSessions deletes expired sessions and those revoked more than a day
+// ago, along with their refresh tokens, and expired MFA challenges.
+func (s *Service) PurgeSessions(ctx context.Context) (int64, error) {
+	now := time.Now().UTC()
+	if _, err := s.DB.PurgeMFAChallenges(ctx, now.Format(time.RFC3339)); err != nil {
+		return 0, err
+	}
+	return s.DB.PurgeSessions(ctx, now.Format(time.RFC3339), now.Add(-24*time.Hour).Format(time.RFC3339))
+}
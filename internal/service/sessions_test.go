@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func loginTestUser(t *testing.T, svc *Service) Tokens {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := svc.CreateUser(ctx, "alice", "password123", RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	tokens, challenge, err := svc.Login(ctx, "alice", "password123", Client{UserAgent: "test", IP: "127.0.0.1"})
+	if err != nil || challenge != nil {
+		t.Fatalf("login: %v", err)
+	}
+	return tokens
+}
+
+func sessionOf(t *testing.T, svc *Service, tokens Tokens) string {
+	t.Helper()
+	claims, err := svc.ParseAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("parse access token: %v", err)
+	}
+	return claims.ID
+}
+
+func TestRefreshRotates(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	first := loginTestUser(t, svc)
+
+	second, err := svc.Refresh(ctx, first.RefreshToken, Client{})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token not rotated")
+	}
+	if sessionOf(t, svc, second) != sessionOf(t, svc, first) {
+		t.Fatal("refresh started a new session")
+	}
+	if _, err := svc.Refresh(ctx, second.RefreshToken, Client{}); err != nil {
+		t.Fatalf("refresh with the rotated token: %v", err)
+	}
+	if _, err := svc.Refresh(ctx, "unknown", Client{}); !errors.Is(err, ErrRefreshInvalid) {
+		t.Fatalf("unknown token: want ErrRefreshInvalid, got %v", err)
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	first := loginTestUser(t, svc)
+	other, _, err := svc.Login(ctx, "alice", "password123", Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := svc.Refresh(ctx, first.RefreshToken, Client{})
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	sessionID := sessionOf(t, svc, second)
+
+	// Replaying the spent token ends the session, including the pair
+	// issued in its place.
+	if _, err := svc.Refresh(ctx, first.RefreshToken, Client{}); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("reused token: want ErrRefreshReused, got %v", err)
+	}
+	if svc.SessionActive(ctx, sessionID) {
+		t.Fatal("session still active after reuse")
+	}
+	if _, err := svc.Refresh(ctx, second.RefreshToken, Client{}); !errors.Is(err, ErrRefreshInvalid) {
+		t.Fatalf("token issued before the reuse: want ErrRefreshInvalid, got %v", err)
+	}
+
+	// Other sessions of the user are left alone.
+	if !svc.SessionActive(ctx, sessionOf(t, svc, other)) {
+		t.Fatal("other session revoked")
+	}
+	if _, err := svc.Refresh(ctx, other.RefreshToken, Client{}); err != nil {
+		t.Fatalf("refresh other session: %v", err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	first := loginTestUser(t, svc)
+	second, _, err := svc.Login(ctx, "alice", "password123", Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		sessionID string
+		// sessions still active afterwards
+		first, second bool
+	}{
+		// API keys and the local key have no session; their logout must not
+		// end the owner's browser sessions.
+		{"no session", "", true, true},
+		{"unknown session", "nope", true, true},
+		{"current session", sessionOf(t, svc, first), false, true},
+		{"already ended", sessionOf(t, svc, first), false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := svc.Logout(ctx, test.sessionID); err != nil {
+				t.Fatal(err)
+			}
+			if active := svc.SessionActive(ctx, sessionOf(t, svc, first)); active != test.first {
+				t.Errorf("first session active = %v, want %v", active, test.first)
+			}
+			if active := svc.SessionActive(ctx, sessionOf(t, svc, second)); active != test.second {
+				t.Errorf("second session active = %v, want %v", active, test.second)
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/kiry163/filehub/internal/db"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	ShareStatusActive  = "active"
+	ShareStatusRevoked = "revoked"
+	// Derived states of links whose stored status is still active.
+	ShareStatusExpired   = "expired"
+	ShareStatusExhausted = "exhausted"
+
+	ShareKindDownload = "download"
+	// ShareKindUpload links only accept uploads into their folder.
+	ShareKindUpload = "upload"
+
+	DefaultShareExpiry = 7 * 24 * time.Hour
+	MaxShareExpiry     = 365 * 24 * time.Hour
+)
+
+var (
+	ErrShareOptionsInvalid   = errors.New("invalid share options")
+	ErrShareUnavailable      = errors.New("share link is revoked, expired or used up")
+	ErrSharePasswordRequired = errors.New("share password required")
+	ErrSharePasswordInvalid  = errors.New("share password invalid")
+	ErrShareUploadLimit      = errors.New("upload limit reached")
+)
+
+// ShareOptions configures a new share link. Zero values mean the default
+// expiry, no password, no download limit and no note.
+type ShareOptions struct {
+	ExpiresIn    time.Duration
+	Password     string
+	MaxDownloads int64
+	Note         string
+	// MaxFiles and MaxBytes limit upload links.
+	MaxFiles int64
+	MaxBytes int64
+}
+
+// ShareUpdate changes selected settings of an existing link. ExpiresIn is
+// measured from now, and an empty Password removes the password.
+type ShareUpdate struct {
+	ExpiresIn    *time.Duration
+	Password     *string
+	MaxDownloads *int64
+	Note         *string
+	MaxFiles     *int64
+	MaxBytes     *int64
+}
+
+// ShareFile returns the file's current plain share link, creating one with
+// the default expiry when there is none.
+func (s *Service) ShareFile(ctx context.Context, fileID, createdBy string) (db.ShareLink, bool, error) {
+	link, err := s.DB.GetActiveShareLink(ctx, fileID, db.NowRFC3339())
+	if err == nil {
+		return link, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return db.ShareLink{}, false, err
+	}
+	link, err = s.CreateShare(ctx, fileID, createdBy, ShareOptions{})
+	return link, false, err
+}
+
+// CreateShare always creates a new link for the file.
+func (s *Service) CreateShare(ctx context.Context, fileID, createdBy string, opts ShareOptions) (db.ShareLink, error) {
+	return s.createShare(ctx, fileID, nil, ShareKindDownload, createdBy, opts)
+}
+
+// CreateFolderShare creates a read-only link to a folder and its subtree.
+func (s *Service) CreateFolderShare(ctx context.Context, folderID, createdBy string, opts ShareOptions) (db.ShareLink, error) {
+	return s.createShare(ctx, "", &folderID, ShareKindDownload, createdBy, opts)
+}
+
+// CreateUploadLink creates a file drop link that lets anyone holding it
+// upload into folderID without being able to list or download anything.
+func (s *Service) CreateUploadLink(ctx context.Context, folderID, createdBy string, opts ShareOptions) (db.ShareLink, error) {
+	return s.createShare(ctx, "", &folderID, ShareKindUpload, createdBy, opts)
+}
+
+func (s *Service) createShare(ctx context.Context, fileID string, folderID *string, kind, createdBy string, opts ShareOptions) (db.ShareLink, error) {
+	if opts.ExpiresIn == 0 {
+		opts.ExpiresIn = DefaultShareExpiry
+	}
+	if opts.ExpiresIn < 0 || opts.ExpiresIn > MaxShareExpiry || opts.MaxDownloads < 0 || opts.MaxFiles < 0 || opts.MaxBytes < 0 {
+		return db.ShareLink{}, ErrShareOptionsInvalid
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return db.ShareLink{}, err
+	}
+	now := time.Now().UTC()
+	link := db.ShareLink{
+		Token:        token,
+		FileID:       fileID,
+		FolderID:     folderID,
+		Kind:         kind,
+		ExpiresAt:    now.Add(opts.ExpiresIn).Format(time.RFC3339),
+		CreatedAt:    now.Format(time.RFC3339),
+		CreatedBy:    createdBy,
+		Status:       ShareStatusActive,
+		MaxDownloads: opts.MaxDownloads,
+		Note:         opts.Note,
+	}
+	if kind == ShareKindUpload {
+		link.MaxDownloads = 0
+		link.MaxUploadFiles = opts.MaxFiles
+		link.MaxUploadBytes = opts.MaxBytes
+	}
+	if opts.Password != "" {
+		if link.PasswordHash, err = hashPassword(opts.Password); err != nil {
+			return db.ShareLink{}, err
+		}
+	}
+	if err := s.DB.CreateShareLink(ctx, link); err != nil {
+		return db.ShareLink{}, err
+	}
+	return link, nil
+}
+
+func (s *Service) UpdateShare(ctx context.Context, token string, update ShareUpdate) (db.ShareLink, error) {
+	link, err := s.DB.GetShareLink(ctx, token)
+	if err != nil {
+		return db.ShareLink{}, err
+	}
+	if link.Status != ShareStatusActive {
+		return link, ErrShareUnavailable
+	}
+	if update.ExpiresIn != nil {
+		if *update.ExpiresIn <= 0 || *update.ExpiresIn > MaxShareExpiry {
+			return link, ErrShareOptionsInvalid
+		}
+		link.ExpiresAt = time.Now().UTC().Add(*update.ExpiresIn).Format(time.RFC3339)
+	}
+	if update.MaxDownloads != nil {
+		if *update.MaxDownloads < 0 {
+			return link, ErrShareOptionsInvalid
+		}
+		link.MaxDownloads = *update.MaxDownloads
+	}
+	if update.Note != nil {
+		link.Note = *update.Note
+	}
+	if update.MaxFiles != nil || update.MaxBytes != nil {
+		if link.Kind != ShareKindUpload {
+			return link, ErrShareOptionsInvalid
+		}
+		if update.MaxFiles != nil {
+			if *update.MaxFiles < 0 {
+				return link, ErrShareOptionsInvalid
+			}
+			link.MaxUploadFiles = *update.MaxFiles
+		}
+		if update.MaxBytes != nil {
+			if *update.MaxBytes < 0 {
+				return link, ErrShareOptionsInvalid
+			}
+			link.MaxUploadBytes = *update.MaxBytes
+		}
+	}
+	if update.Password != nil {
+		link.PasswordHash = ""
+		if *update.Password != "" {
+			if link.PasswordHash, err = hashPassword(*update.Password); err != nil {
+				return link, err
+			}
+		}
+	}
+	return link, s.DB.UpdateShareLink(ctx, link)
+}
+
+func (s *Service) RevokeShare(ctx context.Context, token string) (db.ShareLink, error) {
+	link, err := s.DB.GetShareLink(ctx, token)
+	if err != nil {
+		return db.ShareLink{}, err
+	}
+	link.Status = ShareStatusRevoked
+	return link, s.DB.UpdateShareLink(ctx, link)
+}
+
+// OpenShare resolves a public share token, refusing links that are revoked,
+// expired or out of downloads, or whose target no longer exists.
+func (s *Service) OpenShare(ctx context.Context, token string) (db.ShareLink, error) {
+	link, err := s.DB.GetShareLink(ctx, token)
+	if err != nil {
+		return db.ShareLink{}, err
+	}
+	if !ShareUsable(link, time.Now()) {
+		return link, ErrShareUnavailable
+	}
+	if link.FolderID != nil {
+		_, err = s.DB.GetFolder(ctx, *link.FolderID)
+	} else {
+		_, err = s.DB.GetFile(ctx, link.FileID)
+	}
+	return link, err
+}
+
+// ShareIncludesFolder reports whether folderID lies inside a folder share.
+// Upload links never expose their folder.
+func (s *Service) ShareIncludesFolder(ctx context.Context, link db.ShareLink, folderID string) (bool, error) {
+	if link.FolderID == nil || link.Kind != ShareKindDownload {
+		return false, nil
+	}
+	return s.DB.IsDescendant(ctx, *link.FolderID, folderID)
+}
+
+// GetSharedFile returns a file reachable through a folder share.
+func (s *Service) GetSharedFile(ctx context.Context, link db.ShareLink, fileID string) (db.FileRecord, error) {
+	record, err := s.DB.GetFile(ctx, fileID)
+	if err != nil {
+		return db.FileRecord{}, err
+	}
+	if record.FolderID == nil {
+		return db.FileRecord{}, sql.ErrNoRows
+	}
+	included, err := s.ShareIncludesFolder(ctx, link, *record.FolderID)
+	if err != nil {
+		return db.FileRecord{}, err
+	}
+	if !included {
+		return db.FileRecord{}, sql.ErrNoRows
+	}
+	return record, nil
+}
+
+// ShareUploadLimit returns how many bytes the next upload through link may
+// stream before it is cut off, together with the error to report when it
+// is: ErrShareUploadLimit when the link's remaining quota is the tighter
+// bound, ErrFileTooLarge when Upload.MaxSizeMB is. A limit of 0 means
+// unlimited.
+func (s *Service) ShareUploadLimit(link db.ShareLink) (int64, error) {
+	limit, limitErr := s.Config.Upload.MaxSizeMB*1024*1024, ErrFileTooLarge
+	if link.MaxUploadBytes > 0 {
+		remaining := max(link.MaxUploadBytes-link.UploadedBytes, 0)
+		if limit <= 0 || remaining < limit {
+			limit, limitErr = remaining, ErrShareUploadLimit
+		}
+	}
+	return limit, limitErr
+}
+
+// UploadToShare streams a file sent through an upload link into storage,
+// cutting it off as soon as it passes ShareUploadLimit. The stored size is
+// then reserved against the link atomically, so concurrent uploads cannot
+// overrun its limits. The file is created by the link's actor so its origin
+// shows in listings and the audit log.
+func (s *Service) UploadToShare(ctx context.Context, link db.ShareLink, reader io.Reader, originalName string) (db.FileRecord, error) {
+	if link.Kind != ShareKindUpload || link.FolderID == nil {
+		return db.FileRecord{}, ErrShareUnavailable
+	}
+	if link.MaxUploadFiles > 0 && link.UploadedFiles >= link.MaxUploadFiles {
+		return db.FileRecord{}, ErrShareUploadLimit
+	}
+	limit, limitErr := s.ShareUploadLimit(link)
+	if link.MaxUploadBytes > 0 && limit == 0 {
+		return db.FileRecord{}, ErrShareUploadLimit
+	}
+	limited := &limitedReader{reader: reader, remaining: limit}
+	if limit > 0 {
+		reader = limited
+	}
+
+	fileID := generateFileID(12)
+	saveResult, err := s.Storage.Save(ctx, reader, -1, fileID, originalName)
+	if limited.exceeded {
+		if err == nil {
+			s.releaseObject(ctx, saveResult.ObjectKey)
+		}
+		return db.FileRecord{}, limitErr
+	}
+	if err != nil {
+		return db.FileRecord{}, err
+	}
+	if err := s.DB.ReserveShareUpload(ctx, link.Token, saveResult.Size); err != nil {
+		s.releaseObject(ctx, saveResult.ObjectKey)
+		if errors.Is(err, sql.ErrNoRows) {
+			return db.FileRecord{}, ErrShareUploadLimit
+		}
+		return db.FileRecord{}, err
+	}
+	record, err := s.createFile(ctx, fileID, originalName, saveResult, ShareActor(link), link.FolderID)
+	if err != nil {
+		if releaseErr := s.DB.ReleaseShareUpload(context.WithoutCancel(ctx), link.Token, saveResult.Size); releaseErr != nil {
+			log.Printf("shares: failed to release upload quota: %v", releaseErr)
+		}
+		return db.FileRecord{}, err
+	}
+	return record, nil
+}
+
+// ShareActor identifies a share link in created_by and the audit log
+// without revealing the full token.
+func ShareActor(link db.ShareLink) string {
+	return "share:" + link.Token[:8]
+}
+
+// ShareUsable reports whether a link can still be downloaded at now.
+func ShareUsable(link db.ShareLink, now time.Time) bool {
+	return ShareState(link, now) == ShareStatusActive
+}
+
+// ShareState returns active, revoked, expired or exhausted.
+func ShareState(link db.ShareLink, now time.Time) string {
+	if link.Status != ShareStatusActive {
+		return link.Status
+	}
+	expiresAt, err := time.Parse(time.RFC3339, link.ExpiresAt)
+	if err != nil || now.After(expiresAt) {
+		return ShareStatusExpired
+	}
+	if link.MaxDownloads > 0 && link.DownloadCount >= link.MaxDownloads {
+		return ShareStatusExhausted
+	}
+	if link.MaxUploadFiles > 0 && link.UploadedFiles >= link.MaxUploadFiles {
+		return ShareStatusExhausted
+	}
+	if link.MaxUploadBytes > 0 && link.UploadedBytes >= link.MaxUploadBytes {
+		return ShareStatusExhausted
+	}
+	return ShareStatusActive
+}
+
+func (s *Service) ListShares(ctx context.Context, filter db.ShareFilter) ([]db.ShareLinkStats, int, error) {
+	switch filter.Status {
+	case "", ShareStatusActive, ShareStatusRevoked, ShareStatusExpired, ShareStatusExhausted:
+	default:
+		return nil, 0, ErrShareOptionsInvalid
+	}
+	filter.Now = db.NowRFC3339()
+	return s.DB.ListShareLinks(ctx, filter)
+}
+
+func (s *Service) GetShareStats(ctx context.Context, token string) (db.ShareLinkStats, error) {
+	return s.DB.GetShareLinkStats(ctx, token)
+}
+
+func (s *Service) ListShareAccesses(ctx context.Context, token string, limit, offset int) ([]db.ShareAccess, int, error) {
+	return s.DB.ListShareAccesses(ctx, token, limit, offset)
+}
+
+// RecordShareAccess stores one request against a public share link. Failures
+// are logged rather than returned so they never break the download itself.
+func (s *Service) RecordShareAccess(ctx context.Context, access db.ShareAccess) {
+	access.AccessedAt = db.NowRFC3339()
+	if err := s.DB.AddShareAccess(context.WithoutCancel(ctx), access); err != nil {
+		log.Printf("shares: failed to record access to %s: %v", access.FileID, err)
+	}
+}
+
+// CountShareDownload records a download against the link's limit.
+func (s *Service) CountShareDownload(ctx context.Context, token string) error {
+	err := s.DB.IncrementShareDownloads(ctx, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrShareUnavailable
+	}
+	return err
+}
+
+// ResumesShareDownload reports whether a request from ipAddress starting at
+// offset continues the previous transfer of fileID through token exactly
+// where it stopped. Such a request finishes a download that was already
+// counted; any other request is a new download.
+func (s *Service) ResumesShareDownload(ctx context.Context, token, fileID, ipAddress string, offset int64) bool {
+	if offset <= 0 {
+		return false
+	}
+	last, err := s.DB.LastShareDownload(ctx, token, fileID, ipAddress)
+	if err != nil {
+		return false
+	}
+	return last.RangeStart+last.BytesSent == offset
+}
+
+func (s *Service) CheckSharePassword(link db.ShareLink, password string) error {
+	if link.PasswordHash == "" {
+		return nil
+	}
+	if password == "" {
+		return ErrSharePasswordRequired
+	}
+	if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+		return ErrSharePasswordInvalid
+	}
+	return nil
+}
+
+// ShareUnlockKey is stored in a cookie once the password has been entered.
+// It changes whenever the link's password does.
+func (s *Service) ShareUnlockKey(link db.ShareLink) string {
+	mac := hmac.New(sha256.New, []byte(s.Config.Auth.JWTSecret))
+	mac.Write([]byte(link.Token + ":" + link.PasswordHash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
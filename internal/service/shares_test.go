@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kiry163/filehub/internal/db"
+)
+
+func TestShareState(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	future := now.Add(time.Hour).Format(time.RFC3339)
+	past := now.Add(-time.Hour).Format(time.RFC3339)
+	tests := []struct {
+		name string
+		link db.ShareLink
+		want string
+	}{
+		{"active", db.ShareLink{Status: ShareStatusActive, ExpiresAt: future}, ShareStatusActive},
+		{"revoked", db.ShareLink{Status: ShareStatusRevoked, ExpiresAt: future}, ShareStatusRevoked},
+		{"revoked after expiry", db.ShareLink{Status: ShareStatusRevoked, ExpiresAt: past}, ShareStatusRevoked},
+		{"expired", db.ShareLink{Status: ShareStatusActive, ExpiresAt: past}, ShareStatusExpired},
+		{"bad expiry", db.ShareLink{Status: ShareStatusActive, ExpiresAt: "soon"}, ShareStatusExpired},
+		{"unlimited downloads", db.ShareLink{Status: ShareStatusActive, ExpiresAt: future, DownloadCount: 1000}, ShareStatusActive},
+		{"downloads left", db.ShareLink{Status: ShareStatusActive, ExpiresAt: future, MaxDownloads: 3, DownloadCount: 2}, ShareStatusActive},
+		{"downloads used up", db.ShareLink{Status: ShareStatusActive, ExpiresAt: future, MaxDownloads: 3, DownloadCount: 3}, ShareStatusExhausted},
+		{"expired and used up", db.ShareLink{Status: ShareStatusActive, ExpiresAt: past, MaxDownloads: 3, DownloadCount: 3}, ShareStatusExpired},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ShareState(test.link, now); got != test.want {
+				t.Errorf("state %s, want %s", got, test.want)
+			}
+			if got := ShareUsable(test.link, now); got != (test.want == ShareStatusActive) {
+				t.Errorf("usable %v", got)
+			}
+		})
+	}
+}
+
+func TestListSharesRejectsUnknownStatus(t *testing.T) {
+	svc, _ := newTestService(t)
+	if _, _, err := svc.ListShares(context.Background(), db.ShareFilter{Status: "pending", Limit: 10}); !errors.Is(err, ErrShareOptionsInvalid) {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestCreateShareOptions(t *testing.T) {
+	svc, _ := newTestService(t)
+	file := uploadTestFile(t, svc, "a.txt", "abc")
+	tests := []struct {
+		name string
+		opts ShareOptions
+		err  error
+	}{
+		{"defaults", ShareOptions{}, nil},
+		{"full", ShareOptions{ExpiresIn: time.Hour, Password: "pw", MaxDownloads: 5, Note: "for bob"}, nil},
+		{"longest expiry", ShareOptions{ExpiresIn: MaxShareExpiry}, nil},
+		{"expiry too long", ShareOptions{ExpiresIn: MaxShareExpiry + time.Second}, ErrShareOptionsInvalid},
+		{"negative expiry", ShareOptions{ExpiresIn: -time.Hour}, ErrShareOptionsInvalid},
+		{"negative downloads", ShareOptions{MaxDownloads: -1}, ErrShareOptionsInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			link, err := svc.CreateShare(context.Background(), file.FileID, "alice", test.opts)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if (link.PasswordHash != "") != (test.opts.Password != "") || (test.opts.Password != "" && link.PasswordHash == test.opts.Password) {
+				t.Errorf("password stored as %q", link.PasswordHash)
+			}
+			if link.MaxDownloads != test.opts.MaxDownloads || link.Note != test.opts.Note {
+				t.Errorf("link %+v", link)
+			}
+		})
+	}
+}
+
+func TestCheckSharePassword(t *testing.T) {
+	svc, _ := newTestService(t)
+	file := uploadTestFile(t, svc, "a.txt", "abc")
+	open, err := svc.CreateShare(context.Background(), file.FileID, "alice", ShareOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked, err := svc.CreateShare(context.Background(), file.FileID, "alice", ShareOptions{Password: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		link     db.ShareLink
+		password string
+		err      error
+	}{
+		{"no password set", open, "", nil},
+		{"no password set ignores one given", open, "anything", nil},
+		{"missing", locked, "", ErrSharePasswordRequired},
+		{"wrong", locked, "secret", ErrSharePasswordInvalid},
+		{"right", locked, "s3cret", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := svc.CheckSharePassword(test.link, test.password); !errors.Is(err, test.err) {
+				t.Errorf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestUpdateSharePassword(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	file := uploadTestFile(t, svc, "a.txt", "abc")
+	link, err := svc.CreateShare(ctx, file.FileID, "alice", ShareOptions{Password: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey := svc.ShareUnlockKey(link)
+
+	changed := "new"
+	link, err = svc.UpdateShare(ctx, link.Token, ShareUpdate{Password: &changed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.CheckSharePassword(link, "old") == nil || svc.CheckSharePassword(link, "new") != nil {
+		t.Error("password not changed")
+	}
+	if svc.ShareUnlockKey(link) == oldKey {
+		t.Error("unlock cookie from the old password still valid")
+	}
+
+	removed := ""
+	link, err = svc.UpdateShare(ctx, link.Token, ShareUpdate{Password: &removed})
+	if err != nil || link.PasswordHash != "" {
+		t.Fatalf("remove password: %+v, %v", link, err)
+	}
+}
+
+func TestCountShareDownloadLimit(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	file := uploadTestFile(t, svc, "a.txt", "abc")
+	tests := []struct {
+		name         string
+		maxDownloads int64
+		downloads    int
+	}{
+		{"limited", 2, 2},
+		{"single use", 1, 1},
+		{"unlimited", 0, 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			link, err := svc.CreateShare(ctx, file.FileID, "alice", ShareOptions{MaxDownloads: test.maxDownloads})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < test.downloads; i++ {
+				if _, err := svc.OpenShare(ctx, link.Token); err != nil {
+					t.Fatalf("open %d: %v", i, err)
+				}
+				if err := svc.CountShareDownload(ctx, link.Token); err != nil {
+					t.Fatalf("count %d: %v", i, err)
+				}
+			}
+			if test.maxDownloads == 0 {
+				return
+			}
+			if _, err := svc.OpenShare(ctx, link.Token); !errors.Is(err, ErrShareUnavailable) {
+				t.Errorf("open past the limit: %v", err)
+			}
+			if err := svc.CountShareDownload(ctx, link.Token); !errors.Is(err, ErrShareUnavailable) {
+				t.Errorf("count past the limit: %v", err)
+			}
+		})
+	}
+}
+
+func TestRevokedShareCannotBeUpdated(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	file := uploadTestFile(t, svc, "a.txt", "abc")
+	link, err := svc.CreateShare(ctx, file.FileID, "alice", ShareOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.RevokeShare(ctx, link.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.OpenShare(ctx, link.Token); !errors.Is(err, ErrShareUnavailable) {
+		t.Errorf("open revoked link: %v", err)
+	}
+	extend := time.Hour
+	if _, err := svc.UpdateShare(ctx, link.Token, ShareUpdate{ExpiresIn: &extend}); !errors.Is(err, ErrShareUnavailable) {
+		t.Errorf("extend revoked link: %v", err)
+	}
+}
+
+func TestResumesShareDownload(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	record := uploadTestFile(t, svc, "a.txt", "0123456789")
+	link, err := svc.CreateShare(ctx, record.FileID, "alice", ShareOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, access := range []db.ShareAccess{
+		{IPAddress: "10.0.0.1", StatusCode: 206, RangeStart: 0, BytesSent: 4},
+		{IPAddress: "10.0.0.2", StatusCode: 206, RangeStart: 2, BytesSent: 3},
+		{IPAddress: "10.0.0.2", StatusCode: 416},
+	} {
+		access.Token, access.FileID, access.AccessedAt = link.Token, record.FileID, db.NowRFC3339()
+		if err := svc.DB.AddShareAccess(ctx, access); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		ip     string
+		fileID string
+		offset int64
+		want   bool
+	}{
+		{"continues where it stopped", "10.0.0.1", record.FileID, 4, true},
+		{"starts over", "10.0.0.1", record.FileID, 0, false},
+		{"skips ahead", "10.0.0.1", record.FileID, 6, false},
+		{"goes back", "10.0.0.1", record.FileID, 2, false},
+		{"another client", "10.0.0.3", record.FileID, 4, false},
+		{"failed attempts are ignored", "10.0.0.2", record.FileID, 5, true},
+		{"another file", "10.0.0.1", "other", 4, false},
+	}
+	for _, test := range tests {
+		if got := svc.ResumesShareDownload(ctx, link.Token, test.fileID, test.ip, test.offset); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUploadToShare(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxSizeMB int64
+		opts      ShareOptions
+		uploads   []string
+		errs      []error
+	}{
+		{"file limit", 0, ShareOptions{MaxFiles: 1}, []string{"a", "b"}, []error{nil, ErrShareUploadLimit}},
+		{"byte limit", 0, ShareOptions{MaxBytes: 6}, []string{"aaaa", "bbbb", "cc", "d"}, []error{nil, ErrShareUploadLimit, nil, ErrShareUploadLimit}},
+		{"max size", 1, ShareOptions{}, []string{strings.Repeat("x", 1<<20+1), "small"}, []error{ErrFileTooLarge, nil}},
+		{"max size below remaining quota", 1, ShareOptions{MaxBytes: 4 << 20}, []string{strings.Repeat("x", 2<<20)}, []error{ErrFileTooLarge}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc, _ := newTestService(t)
+			svc.Config.Upload.MaxSizeMB = test.maxSizeMB
+			createTestFolder(t, svc, "inbox", "inbox", nil)
+			ctx := context.Background()
+			link, err := svc.CreateUploadLink(ctx, "inbox", "alice", test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored := 0
+			for i, content := range test.uploads {
+				// Reload the link as the handler would see it on a new request.
+				if link, err = svc.DB.GetShareLink(ctx, link.Token); err != nil {
+					t.Fatal(err)
+				}
+				_, err := svc.UploadToShare(ctx, link, strings.NewReader(content), "upload.txt")
+				if !errors.Is(err, test.errs[i]) {
+					t.Fatalf("upload %d: %v, want %v", i, err, test.errs[i])
+				}
+				if err == nil {
+					stored++
+				}
+			}
+			if objects := storedObjects(t, svc); objects != stored {
+				t.Errorf("%d objects in storage, want %d", objects, stored)
+			}
+		})
+	}
+}
+
+func TestUploadToShareReservesAtomically(t *testing.T) {
+	svc, _ := newTestService(t)
+	createTestFolder(t, svc, "inbox", "inbox", nil)
+	ctx := context.Background()
+	link, err := svc.CreateUploadLink(ctx, "inbox", "alice", ShareOptions{MaxBytes: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both uploads start from the same snapshot of the link, as two
+	// concurrent requests would; only one fits the quota.
+	if _, err := svc.UploadToShare(ctx, link, strings.NewReader("aaaa"), "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.UploadToShare(ctx, link, strings.NewReader("bbbb"), "b.txt"); !errors.Is(err, ErrShareUploadLimit) {
+		t.Fatalf("second upload: %v", err)
+	}
+	if objects := storedObjects(t, svc); objects != 1 {
+		t.Errorf("%d objects in storage, want 1", objects)
+	}
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/skip2/go-qrcode"
+)
+
+// TOTP follows RFC 6238 with the defaults every authenticator app supports.
+const (
+	totpIssuer = "FileHub"
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew accepts codes from one step before or after now to allow
+	// for clock drift.
+	totpSkew = 1
+
+	recoveryCodeCount    = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	// MFAChallengeTTL bounds the time between the password and the code.
+	MFAChallengeTTL = 5 * time.Minute
+	// maxMFAAttempts is how many wrong codes one challenge accepts.
+	maxMFAAttempts = 5
+)
+
+var (
+	ErrTOTPEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled = errors.New("two-factor authentication is not enrolled")
+	ErrTOTPCode        = errors.New("invalid two-factor code")
+	ErrMFAChallenge    = errors.New("mfa challenge invalid or expired")
+)
+
+// TOTPEnrollment is shown to the user once, when enrollment starts.
+// QRCode is a PNG of URI.
+type TOTPEnrollment struct {
+	Secret        string
+	URI           string
+	QRCode        []byte
+	RecoveryCodes []string
+}
+
+// TOTPStatus describes a user's enrollment. Pending means a secret was
+// issued but not yet confirmed with a code.
+type TOTPStatus struct {
+	Enabled                bool `json:"enabled"`
+	Pending                bool `json:"pending"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// MFAChallenge is returned by Login instead of tokens when the user has a
+// second factor; LoginMFA exchanges it together with a code.
+type MFAChallenge struct {
+	Token     string `json:"mfa_token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+func (s *Service) TOTPStatus(ctx context.Context, userID string) (TOTPStatus, error) {
+	user, err := s.DB.GetUser(ctx, userID)
+	if err != nil {
+		return TOTPStatus{}, err
+	}
+	status := TOTPStatus{Enabled: user.TOTPEnabled, Pending: user.TOTPSecret != "" && !user.TOTPEnabled}
+	if user.TOTPEnabled {
+		if status.RecoveryCodesRemaining, err = s.DB.CountRecoveryCodes(ctx, userID); err != nil {
+			return TOTPStatus{}, err
+		}
+	}
+	return status, nil
+}
+
+// EnrollTOTP issues a new secret and recovery codes. Both take effect once
+// ConfirmTOTP accepts a code; starting again replaces a pending enrollment.
+func (s *Service) EnrollTOTP(ctx context.Context, userID string) (TOTPEnrollment, error) {
+	user, err := s.DB.GetUser(ctx, userID)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	if user.TOTPEnabled {
+		return TOTPEnrollment{}, ErrTOTPEnabled
+	}
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return TOTPEnrollment{}, err
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+	codes, err := s.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	if err := s.DB.SetUserTOTP(ctx, userID, secret, false); err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	label := url.PathEscape(totpIssuer + ":" + user.Username)
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	uri := "otpauth://totp/" + label + "?" + query.Encode()
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	return TOTPEnrollment{Secret: secret, URI: uri, QRCode: png, RecoveryCodes: codes}, nil
+}
+
+// ConfirmTOTP enables a pending enrollment after checking a code from the
+// authenticator app.
+func (s *Service) ConfirmTOTP(ctx context.Context, userID, code string) error {
+	user, err := s.DB.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabled {
+		return ErrTOTPEnabled
+	}
+	if user.TOTPSecret == "" {
+		return ErrTOTPNotEnrolled
+	}
+	step, ok := matchTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return ErrTOTPCode
+	}
+	if err := s.DB.SetUserTOTP(ctx, userID, user.TOTPSecret, true); err != nil {
+		return err
+	}
+	return s.DB.UseTOTPStep(ctx, userID, step)
+}
+
+// DisableTOTP turns off the second factor; the user proves possession with a
+// code or a recovery code.
+func (s *Service) DisableTOTP(ctx context.Context, userID, code string) error {
+	user, err := s.DB.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTOTPNotEnrolled
+	}
+	if _, err := s.checkSecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+	return s.ResetTOTP(ctx, userID)
+}
+
+// ResetTOTP removes any enrollment and recovery codes without a code, for
+// admins helping users who lost their device.
+func (s *Service) ResetTOTP(ctx context.Context, userID string) error {
+	if err := s.DB.SetUserTOTP(ctx, userID, "", false); err != nil {
+		return err
+	}
+	return s.DB.ReplaceRecoveryCodes(ctx, userID, nil)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a code.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	user, err := s.DB.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrTOTPNotEnrolled
+	}
+	if _, err := s.checkSecondFactor(ctx, user, code); err != nil {
+		return nil, err
+	}
+	return s.replaceRecoveryCodes(ctx, userID)
+}
+
+// LoginMFA finishes a login that Login answered with a challenge. The
+// returned method is "totp" or "recovery_code".
+func (s *Service) LoginMFA(ctx context.Context, challenge, code string, client Client) (Tokens, db.User, string, error) {
+	claims, err := s.parseMFAChallenge(challenge)
+	if err != nil {
+		return Tokens{}, db.User{}, "", ErrMFAChallenge
+	}
+	// Each submitted code uses up one attempt before it is checked, so
+	// concurrent guesses cannot exceed the limit.
+	if err := s.DB.AttemptMFAChallenge(ctx, claims.ID, time.Now().UTC().Format(time.RFC3339), maxMFAAttempts); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Tokens{}, db.User{}, "", ErrMFAChallenge
+		}
+		return Tokens{}, db.User{}, "", err
+	}
+	user, err := s.ActiveUser(ctx, claims.Subject)
+	if err != nil {
+		return Tokens{}, db.User{}, "", err
+	}
+	if !user.TOTPEnabled {
+		return Tokens{}, db.User{}, "", ErrMFAChallenge
+	}
+	method, err := s.checkSecondFactor(ctx, user, code)
+	if err != nil {
+		return Tokens{}, user, "", err
+	}
+	// A challenge completes one login only.
+	if err := s.DB.UseMFAChallenge(ctx, claims.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Tokens{}, user, "", ErrMFAChallenge
+		}
+		return Tokens{}, user, "", err
+	}
+	tokens, err := s.issueTokens(ctx, user, client)
+	return tokens, user, method, err
+}
+
+func (s *Service) newMFAChallenge(ctx context.Context, userID string) (MFAChallenge, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return MFAChallenge{}, err
+	}
+	now := time.Now().UTC()
+	claims := jwt.RegisteredClaims{
+		ID:        id,
+		Subject:   userID,
+		Issuer:    "filehub-mfa",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(MFAChallengeTTL)),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.Config.Auth.JWTSecret))
+	if err != nil {
+		return MFAChallenge{}, err
+	}
+	if err := s.DB.CreateMFAChallenge(ctx, id, userID, claims.ExpiresAt.Time.Format(time.RFC3339)); err != nil {
+		return MFAChallenge{}, err
+	}
+	return MFAChallenge{Token: token, ExpiresIn: int64(MFAChallengeTTL.Seconds())}, nil
+}
+
+// MFAChallengeUser returns the user a valid challenge belongs to, or "".
+func (s *Service) MFAChallengeUser(challenge string) string {
+	claims, err := s.parseMFAChallenge(challenge)
+	if err != nil {
+		return ""
+	}
+	return claims.Subject
+}
+
+func (s *Service) parseMFAChallenge(tokenString string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.Config.Auth.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithIssuer("filehub-mfa"), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkSecondFactor accepts a current TOTP code or an unused recovery code.
+func (s *Service) checkSecondFactor(ctx context.Context, user db.User, code string) (string, error) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) == totpDigits {
+		step, ok := matchTOTP(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return "", ErrTOTPCode
+		}
+		if err := s.DB.UseTOTPStep(ctx, user.UserID, step); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return "", ErrTOTPCode
+			}
+			return "", err
+		}
+		return "totp", nil
+	}
+	if err := s.DB.UseRecoveryCode(ctx, user.UserID, hashRecoveryCode(code)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrTOTPCode
+		}
+		return "", err
+	}
+	return "recovery_code", nil
+}
+
+func (s *Service) replaceRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	random := make([]byte, 10)
+	for i := range codes {
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, len(random))
+		for j, b := range random {
+			buf[j] = recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)]
+		}
+		codes[i] = string(buf[:5]) + "-" + string(buf[5:])
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	if err := s.DB.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode ignores case and the dash so codes can be typed loosely.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// matchTOTP returns the time step code belongs to, within totpSkew steps of
+// now.
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
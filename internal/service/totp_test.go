@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rfc6238Key is the SHA-1 seed of the RFC 6238 test vectors.
+var rfc6238Key = []byte("12345678901234567890")
+
+func TestTOTPCodeVectors(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits.
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		if got := totpCode(rfc6238Key, unix/totpPeriod); got != want {
+			t.Errorf("T=%d: got %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestMatchTOTPWindow(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(rfc6238Key)
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+
+	for offset := int64(-2); offset <= 2; offset++ {
+		step, ok := matchTOTP(secret, totpCode(rfc6238Key, current+offset), now)
+		inWindow := offset >= -totpSkew && offset <= totpSkew
+		if ok != inWindow {
+			t.Errorf("offset %d: accepted %v, want %v", offset, ok, inWindow)
+		}
+		if ok && step != current+offset {
+			t.Errorf("offset %d: matched step %d, want %d", offset, step, current+offset)
+		}
+	}
+	if _, ok := matchTOTP(secret, "12345", now); ok {
+		t.Error("short code accepted")
+	}
+	if _, ok := matchTOTP("not base32!", totpCode(rfc6238Key, current), now); ok {
+		t.Error("code accepted for an invalid secret")
+	}
+}
+
+func TestTOTPReplay(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	user, err := svc.CreateUser(ctx, "alice", "password123", RoleViewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollment, err := svc.EnrollTOTP(ctx, user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := time.Now().Unix() / totpPeriod
+	code := totpCode(key, current)
+	if err := svc.ConfirmTOTP(ctx, user.UserID, code); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if user, err = svc.DB.GetUser(ctx, user.UserID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.checkSecondFactor(ctx, user, code); !errors.Is(err, ErrTOTPCode) {
+		t.Fatalf("replayed code: want ErrTOTPCode, got %v", err)
+	}
+	if _, err := svc.checkSecondFactor(ctx, user, totpCode(key, current-1)); !errors.Is(err, ErrTOTPCode) {
+		t.Fatalf("code older than the last used one: want ErrTOTPCode, got %v", err)
+	}
+	if method, err := svc.checkSecondFactor(ctx, user, totpCode(key, current+1)); err != nil || method != "totp" {
+		t.Fatalf("next code: %q, %v", method, err)
+	}
+
+	recovery := enrollment.RecoveryCodes[0]
+	if method, err := svc.checkSecondFactor(ctx, user, recovery); err != nil || method != "recovery_code" {
+		t.Fatalf("recovery code: %q, %v", method, err)
+	}
+	if _, err := svc.checkSecondFactor(ctx, user, recovery); !errors.Is(err, ErrTOTPCode) {
+		t.Fatalf("reused recovery code: want ErrTOTPCode, got %v", err)
+	}
+}
+
+// enableTOTP enrolls and confirms a second factor for userID and returns
+// its key.
+func enableTOTP(t *testing.T, svc *Service, userID string) []byte {
+	t.Helper()
+	ctx := context.Background()
+	enrollment, err := svc.EnrollTOTP(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ConfirmTOTP(ctx, userID, totpCode(key, time.Now().Unix()/totpPeriod-1)); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	return key
+}
+
+func TestLoginMFA(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		wrongCodes int
+		challenge  func(token string) string
+		// restart checks the code with a fresh Service on the same database
+		restart bool
+		// expire moves the challenge's expiry into the past
+		expire bool
+		err    error
+	}{
+		{"right code", 0, nil, false, false, nil},
+		{"right code after some wrong ones", maxMFAAttempts - 1, nil, false, false, nil},
+		{"too many wrong codes", maxMFAAttempts, nil, false, false, ErrMFAChallenge},
+		{"wrong codes survive a restart", maxMFAAttempts, nil, true, false, ErrMFAChallenge},
+		{"challenge survives a restart", 1, nil, true, false, nil},
+		{"expired challenge", 0, nil, false, true, ErrMFAChallenge},
+		{"tampered challenge", 0, func(token string) string { return token + "x" }, false, false, ErrMFAChallenge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc, raw := newTestService(t)
+			user, err := svc.CreateUser(ctx, "alice", "password123", RoleViewer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key := enableTOTP(t, svc, user.UserID)
+			tokens, challenge, err := svc.Login(ctx, "alice", "password123", Client{})
+			if err != nil || challenge == nil || tokens.AccessToken != "" {
+				t.Fatalf("login with a second factor: %+v, %+v, %v", tokens, challenge, err)
+			}
+			token := challenge.Token
+			if test.challenge != nil {
+				token = test.challenge(token)
+			}
+			for i := 0; i < test.wrongCodes; i++ {
+				if _, _, _, err := svc.LoginMFA(ctx, token, "000000", Client{}); !errors.Is(err, ErrTOTPCode) {
+					t.Fatalf("wrong code %d: %v", i+1, err)
+				}
+			}
+			if test.restart {
+				svc = &Service{DB: svc.DB, Storage: svc.Storage, Config: svc.Config}
+			}
+			if test.expire {
+				mustExec(t, raw, `UPDATE mfa_challenges SET expires_at = ?`, time.Now().UTC().Add(-time.Minute).Format(time.RFC3339))
+			}
+			code := totpCode(key, time.Now().Unix()/totpPeriod)
+			tokens, _, method, err := svc.LoginMFA(ctx, token, code, Client{})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if tokens.AccessToken == "" || method != "totp" {
+				t.Errorf("tokens %+v, method %q", tokens, method)
+			}
+			// A challenge completes one login only.
+			if _, _, _, err := svc.LoginMFA(ctx, token, totpCode(key, time.Now().Unix()/totpPeriod+1), Client{}); !errors.Is(err, ErrMFAChallenge) {
+				t.Errorf("reused challenge: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoginMFAConcurrentAttempts(t *testing.T) {
+	ctx := context.Background()
+	svc, raw := newTestService(t)
+	user, err := svc.CreateUser(ctx, "alice", "password123", RoleViewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enableTOTP(t, svc, user.UserID)
+	_, challenge, err := svc.Login(ctx, "alice", "password123", Client{})
+	if err != nil || challenge == nil {
+		t.Fatalf("login: %+v, %v", challenge, err)
+	}
+
+	// Guesses sent all at once still get only maxMFAAttempts tries.
+	var wg sync.WaitGroup
+	var checked atomic.Int32
+	for i := 0; i < 4*maxMFAAttempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, _, err := svc.LoginMFA(ctx, challenge.Token, "000000", Client{}); errors.Is(err, ErrTOTPCode) {
+				checked.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := checked.Load(); got != maxMFAAttempts {
+		t.Errorf("%d codes checked, want %d", got, maxMFAAttempts)
+	}
+
+	// Expired challenges are purged with the sessions.
+	mustExec(t, raw, `UPDATE mfa_challenges SET expires_at = ?`, time.Now().UTC().Add(-time.Minute).Format(time.RFC3339))
+	if _, err := svc.PurgeSessions(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if count := countRows(t, raw, `SELECT COUNT(1) FROM mfa_challenges`); count != 0 {
+		t.Errorf("%d challenges left after purge", count)
+	}
+}
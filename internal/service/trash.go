@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/kiry163/filehub/internal/db"
+)
+
+const (
+	TrashFile   = "file"
+	TrashFolder = "folder"
+)
+
+// ErrTrashConflict means a restored file or folder would sit next to a live
+// one of the same name.
+var ErrTrashConflict = errors.New("an item with the same name already exists")
+
+// TrashItem is a file or folder in the trash. ParentID is where it lived and
+// where a restore puts it back.
+type TrashItem struct {
+	Type      string
+	ID        string
+	Name      string
+	ParentID  *string
+	Size      int64
+	DeletedAt string
+	DeletedBy string
+}
+
+// AccessFolder is the folder whose ACL governs the item: a file's folder,
+// or the folder itself.
+func (i TrashItem) AccessFolder() *string {
+	if i.Type == TrashFolder {
+		return &i.ID
+	}
+	return i.ParentID
+}
+
+func fileTrashItem(record db.FileRecord) TrashItem {
+	return TrashItem{
+		Type:      TrashFile,
+		ID:        record.FileID,
+		Name:      record.OriginalName,
+		ParentID:  record.FolderID,
+		Size:      record.Size,
+		DeletedAt: derefString(record.DeletedAt),
+		DeletedBy: record.DeletedBy,
+	}
+}
+
+func folderTrashItem(record db.FolderRecord) TrashItem {
+	return TrashItem{
+		Type:      TrashFolder,
+		ID:        record.FolderID,
+		Name:      record.Name,
+		ParentID:  record.ParentID,
+		DeletedAt: derefString(record.DeletedAt),
+		DeletedBy: record.DeletedBy,
+	}
+}
+
+func derefString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// DeleteFile moves a file to the trash. Its object is kept until the trash
+// is emptied.
+func (s *Service) DeleteFile(ctx context.Context, fileID, deletedBy string) (db.FileRecord, error) {
+	return s.DB.TrashFile(ctx, fileID, deletedBy)
+}
+
+// ListTrash returns everything in the trash, most recently deleted first.
+func (s *Service) ListTrash(ctx context.Context) ([]TrashItem, error) {
+	files, err := s.DB.ListTrashedFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := s.DB.ListTrashedFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]TrashItem, 0, len(files)+len(folders))
+	for _, record := range files {
+		items = append(items, fileTrashItem(record))
+	}
+	for _, record := range folders {
+		items = append(items, folderTrashItem(record))
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt > items[j].DeletedAt
+	})
+	return items, nil
+}
+
+// GetTrashItem looks up a trashed file or folder by ID.
+func (s *Service) GetTrashItem(ctx context.Context, id string) (TrashItem, error) {
+	file, err := s.DB.GetTrashedFile(ctx, id)
+	if err == nil {
+		return fileTrashItem(file), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return TrashItem{}, err
+	}
+	folder, err := s.DB.GetTrashedFolder(ctx, id)
+	if err != nil {
+		return TrashItem{}, err
+	}
+	return folderTrashItem(folder), nil
+}
+
+// RestoreTrashItem puts an item back where it was, restoring the trashed
+// folders above it as well.
+func (s *Service) RestoreTrashItem(ctx context.Context, item TrashItem) error {
+	if item.Type == TrashFile {
+		if _, err := s.DB.GetFileByName(ctx, item.Name, item.ParentID); err == nil {
+			return ErrTrashConflict
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+	// For a folder the trashed ancestors include the folder itself.
+	folderID := item.AccessFolder()
+	if folderID != nil {
+		folders, err := s.DB.ListTrashedAncestors(ctx, *folderID)
+		if err != nil {
+			return err
+		}
+		for _, folder := range folders {
+			if _, err := s.DB.GetFolderByName(ctx, folder.Name, folder.ParentID); err == nil {
+				return ErrTrashConflict
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+	}
+	if item.Type == TrashFolder {
+		return s.DB.RestoreFolder(ctx, item.ID)
+	}
+	return s.DB.RestoreFile(ctx, item.ID)
+}
+
+// PurgeTrashItem deletes an item for good. A folder takes everything
+// trashed inside it along. It returns the number of files deleted.
+func (s *Service) PurgeTrashItem(ctx context.Context, item TrashItem) (int, error) {
+	var (
+		purged db.Purged
+		err    error
+	)
+	if item.Type == TrashFolder {
+		purged, err = s.DB.PurgeFolder(ctx, item.ID)
+	} else {
+		purged, err = s.DB.PurgeFile(ctx, item.ID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	s.releaseObjects(ctx, purged.ObjectKeys)
+	return len(purged.Files), nil
+}
+
+// PurgeExpiredTrash deletes what has been in the trash longer than
+// trash.retention_days. Zero keeps the trash until it is emptied.
+func (s *Service) PurgeExpiredTrash(ctx context.Context) (int, error) {
+	days := s.Config.Trash.RetentionDays
+	if days <= 0 {
+		return 0, nil
+	}
+	before := time.Now().UTC().Add(-time.Duration(days) * 24 * time.Hour).Format(time.RFC3339)
+	purged, err := s.DB.PurgeTrash(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	s.releaseObjects(ctx, purged.ObjectKeys)
+	return len(purged.Files), nil
+}
+
+// TrashPurgeAt returns when the retention worker will delete an item, or
+// "" when the trash is kept until emptied.
+func (s *Service) TrashPurgeAt(item TrashItem) string {
+	days := s.Config.Trash.RetentionDays
+	deletedAt, err := time.Parse(time.RFC3339, item.DeletedAt)
+	if days <= 0 || err != nil {
+		return ""
+	}
+	return deletedAt.Add(time.Duration(days) * 24 * time.Hour).UTC().Format(time.RFC3339)
+}
+
+func (s *Service) releaseObjects(ctx context.Context, objectKeys []string) {
+	for _, objectKey := range objectKeys {
+		s.releaseObject(ctx, objectKey)
+	}
+}
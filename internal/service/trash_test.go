@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kiry163/filehub/internal/db"
+)
+
+// purgeTestFile deletes a file and empties it out of the trash.
+func purgeTestFile(t *testing.T, svc *Service, fileID string) {
+	t.Helper()
+	ctx := context.Background()
+	record, err := svc.DeleteFile(ctx, fileID, "alice")
+	if err != nil {
+		t.Fatalf("delete %s: %v", fileID, err)
+	}
+	if _, err := svc.PurgeTrashItem(ctx, fileTrashItem(record)); err != nil {
+		t.Fatalf("purge %s: %v", fileID, err)
+	}
+}
+
+func createTestFile(t *testing.T, svc *Service, fileID, name string, folderID *string) {
+	t.Helper()
+	now := db.NowRFC3339()
+	record := db.FileRecord{FileID: fileID, OriginalName: name, ObjectKey: "objects/" + fileID, FolderID: folderID, CreatedBy: "alice", CreatedAt: now, UpdatedAt: now}
+	if err := svc.DB.CreateFile(context.Background(), record); err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+}
+
+func restore(t *testing.T, svc *Service, id string) error {
+	t.Helper()
+	item, err := svc.GetTrashItem(context.Background(), id)
+	if err != nil {
+		t.Fatalf("get trash item %s: %v", id, err)
+	}
+	return svc.RestoreTrashItem(context.Background(), item)
+}
+
+func TestDeleteKeepsObjectUntilPurged(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	record := uploadTestFile(t, svc, "a.txt", "hello")
+
+	if _, err := svc.DeleteFile(ctx, record.FileID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.DB.GetFile(ctx, record.FileID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("trashed file still live: %v", err)
+	}
+	if got := storedObjects(t, svc); got != 1 {
+		t.Fatalf("%d objects stored after delete, want 1", got)
+	}
+	if _, err := svc.DeleteFile(ctx, record.FileID, "alice"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleting twice: want no rows, got %v", err)
+	}
+
+	item, err := svc.GetTrashItem(ctx, record.FileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Type != TrashFile || item.Name != "a.txt" || item.DeletedBy != "alice" || item.DeletedAt == "" {
+		t.Errorf("trash item %+v", item)
+	}
+	if count, err := svc.PurgeTrashItem(ctx, item); err != nil || count != 1 {
+		t.Fatalf("purge: %d, %v", count, err)
+	}
+	if got := storedObjects(t, svc); got != 0 {
+		t.Errorf("%d objects stored after purge, want 0", got)
+	}
+	if _, err := svc.GetTrashItem(ctx, record.FileID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("purged item still in the trash: %v", err)
+	}
+}
+
+func TestRestoreTrashItem(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	createTestFolder(t, svc, "docs", "docs", nil)
+	createTestFolder(t, svc, "2024", "2024", ptr("docs"))
+	record := uploadTestFileTo(t, svc, ptr("2024"), "report.pdf", "pdf")
+	if _, err := svc.DeleteFile(ctx, record.FileID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	for _, folderID := range []string{"2024", "docs"} {
+		if err := svc.DB.TrashFolder(ctx, folderID, "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := svc.ListTrash(ctx)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("trash: %+v, %v", items, err)
+	}
+
+	item, err := svc.GetTrashItem(ctx, record.FileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.RestoreTrashItem(ctx, item); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.DB.GetFile(ctx, record.FileID); err != nil {
+		t.Errorf("restored file: %v", err)
+	}
+	for _, folderID := range []string{"2024", "docs"} {
+		if _, err := svc.DB.GetFolder(ctx, folderID); err != nil {
+			t.Errorf("folder %s not restored with the file: %v", folderID, err)
+		}
+	}
+	if items, err := svc.ListTrash(ctx); err != nil || len(items) != 0 {
+		t.Errorf("trash after restore: %+v, %v", items, err)
+	}
+}
+
+func TestPurgeTrashFolder(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	createTestFolder(t, svc, "docs", "docs", nil)
+	createTestFolder(t, svc, "2024", "2024", ptr("docs"))
+	inner := uploadTestFileTo(t, svc, ptr("2024"), "a.txt", "one")
+	outer := uploadTestFileTo(t, svc, ptr("docs"), "b.txt", "two")
+	kept := uploadTestFile(t, svc, "c.txt", "three")
+	for _, fileID := range []string{inner.FileID, outer.FileID, kept.FileID} {
+		if _, err := svc.DeleteFile(ctx, fileID, "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, folderID := range []string{"2024", "docs"} {
+		if err := svc.DB.TrashFolder(ctx, folderID, "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	item, err := svc.GetTrashItem(ctx, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := svc.PurgeTrashItem(ctx, item); err != nil || count != 2 {
+		t.Fatalf("purge folder: %d, %v", count, err)
+	}
+	items, err := svc.ListTrash(ctx)
+	if err != nil || len(items) != 1 || items[0].ID != kept.FileID {
+		t.Errorf("trash after purging the folder: %+v, %v", items, err)
+	}
+	if got := storedObjects(t, svc); got != 1 {
+		t.Errorf("%d objects stored, want 1", got)
+	}
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	ctx := context.Background()
+	old := time.Now().UTC().Add(-40 * 24 * time.Hour).Format(time.RFC3339)
+	recent := time.Now().UTC().Add(-10 * 24 * time.Hour).Format(time.RFC3339)
+	tests := []struct {
+		name   string
+		days   int
+		purged int
+		left   int
+	}{
+		{"kept until emptied", 0, 0, 2},
+		{"older than retention", 30, 1, 1},
+		{"everything expired", 7, 2, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc, raw := newTestService(t)
+			svc.Config.Trash.RetentionDays = test.days
+			for name, deletedAt := range map[string]string{"old.txt": old, "recent.txt": recent} {
+				record := uploadTestFile(t, svc, name, name)
+				if _, err := svc.DeleteFile(ctx, record.FileID, "alice"); err != nil {
+					t.Fatal(err)
+				}
+				mustExec(t, raw, `UPDATE files SET deleted_at = ? WHERE file_id = ?`, deletedAt, record.FileID)
+			}
+
+			if purged, err := svc.PurgeExpiredTrash(ctx); err != nil || purged != test.purged {
+				t.Fatalf("purged %d, %v; want %d", purged, err, test.purged)
+			}
+			if items, err := svc.ListTrash(ctx); err != nil || len(items) != test.left {
+				t.Errorf("trash: %+v, %v; want %d items", items, err, test.left)
+			}
+			if got := storedObjects(t, svc); got != test.left {
+				t.Errorf("%d objects stored, want %d", got, test.left)
+			}
+		})
+	}
+}
+
+func TestTrashPurgeAt(t *testing.T) {
+	tests := []struct {
+		days      int
+		deletedAt string
+		want      string
+	}{
+		{0, "2026-01-01T10:00:00Z", ""},
+		{30, "2026-01-01T10:00:00Z", "2026-01-31T10:00:00Z"},
+		{30, "", ""},
+	}
+	for _, test := range tests {
+		svc := &Service{}
+		svc.Config.Trash.RetentionDays = test.days
+		if got := svc.TrashPurgeAt(TrashItem{DeletedAt: test.deletedAt}); got != test.want {
+			t.Errorf("%d days from %q: got %q, want %q", test.days, test.deletedAt, got, test.want)
+		}
+	}
+}
+
+func TestRestoreTrashItemConflicts(t *testing.T) {
+	ctx := context.Background()
+	docs := "docs"
+
+	t.Run("file", func(t *testing.T) {
+		svc, _ := newTestService(t)
+		createTestFolder(t, svc, docs, "docs", nil)
+		createTestFile(t, svc, "f1", "report.pdf", &docs)
+		if _, err := svc.DeleteFile(ctx, "f1", "alice"); err != nil {
+			t.Fatal(err)
+		}
+		createTestFile(t, svc, "f2", "report.pdf", &docs)
+
+		if err := restore(t, svc, "f1"); !errors.Is(err, ErrTrashConflict) {
+			t.Fatalf("want conflict, got %v", err)
+		}
+		if _, err := svc.DeleteFile(ctx, "f2", "alice"); err != nil {
+			t.Fatal(err)
+		}
+		if err := restore(t, svc, "f1"); err != nil {
+			t.Fatalf("restore after the clash was removed: %v", err)
+		}
+	})
+
+	t.Run("root file", func(t *testing.T) {
+		svc, _ := newTestService(t)
+		createTestFolder(t, svc, docs, "docs", nil)
+		createTestFile(t, svc, "f1", "notes.txt", nil)
+		if _, err := svc.DeleteFile(ctx, "f1", "alice"); err != nil {
+			t.Fatal(err)
+		}
+		createTestFile(t, svc, "f2", "notes.txt", &docs)
+		if err := restore(t, svc, "f1"); err != nil {
+			t.Fatalf("same name in another folder: %v", err)
+		}
+	})
+
+	t.Run("folder", func(t *testing.T) {
+		svc, _ := newTestService(t)
+		createTestFolder(t, svc, "old", "docs", nil)
+		if err := svc.DB.TrashFolder(ctx, "old", "alice"); err != nil {
+			t.Fatal(err)
+		}
+		createTestFolder(t, svc, "new", "docs", nil)
+		if err := restore(t, svc, "old"); !errors.Is(err, ErrTrashConflict) {
+			t.Fatalf("want conflict, got %v", err)
+		}
+	})
+
+	t.Run("trashed parent folder", func(t *testing.T) {
+		svc, _ := newTestService(t)
+		createTestFolder(t, svc, "old", "docs", nil)
+		old := "old"
+		createTestFile(t, svc, "f1", "report.pdf", &old)
+		if _, err := svc.DeleteFile(ctx, "f1", "alice"); err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.DB.TrashFolder(ctx, "old", "alice"); err != nil {
+			t.Fatal(err)
+		}
+		createTestFolder(t, svc, "new", "docs", nil)
+		if err := restore(t, svc, "f1"); !errors.Is(err, ErrTrashConflict) {
+			t.Fatalf("want conflict, got %v", err)
+		}
+	})
+}
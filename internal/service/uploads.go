@@ -0,0 +1,262 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kiry163/filehub/internal/db"
+	"github.com/kiry163/filehub/internal/storage"
+)
+
+const (
+	UploadStatusPending   = "pending"
+	UploadStatusCompleted = "completed"
+
+	// uploadTTL is how long an unfinished resumable upload can be resumed.
+	uploadTTL = 24 * time.Hour
+)
+
+var (
+	ErrResumableUnsupported = errors.New("storage backend does not support resumable uploads")
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrUploadTooLarge       = errors.New("upload exceeds declared length")
+	ErrUploadChunkTooSmall  = errors.New("upload chunk too small")
+	ErrUploadLengthRequired = errors.New("chunk length required")
+	ErrUploadCompleted      = errors.New("upload already completed")
+)
+
+var uploadLocks sync.Map
+
+// CreateResumableUpload registers a tus upload of length bytes. An empty
+// upload is finalized immediately.
+func (s *Service) CreateResumableUpload(ctx context.Context, originalName string, length int64, folderID *string, createdBy string) (db.Upload, error) {
+	if _, ok := s.Storage.(storage.ResumableStorage); !ok {
+		return db.Upload{}, ErrResumableUnsupported
+	}
+	uploadID, err := randomToken(16)
+	if err != nil {
+		return db.Upload{}, err
+	}
+	now := time.Now().UTC()
+	upload := db.Upload{
+		UploadID:     uploadID,
+		FileID:       generateFileID(12),
+		OriginalName: originalName,
+		FolderID:     folderID,
+		Length:       length,
+		Status:       UploadStatusPending,
+		CreatedBy:    createdBy,
+		CreatedAt:    now.Format(time.RFC3339),
+		UpdatedAt:    now.Format(time.RFC3339),
+		ExpiresAt:    now.Add(uploadTTL).Format(time.RFC3339),
+	}
+	if err := s.DB.CreateUpload(ctx, upload); err != nil {
+		return db.Upload{}, err
+	}
+	if length == 0 {
+		saveResult, err := s.Storage.Save(ctx, strings.NewReader(""), 0, upload.FileID, originalName)
+		if err != nil {
+			return db.Upload{}, err
+		}
+		if _, err := s.createFile(ctx, upload.FileID, originalName, saveResult, createdBy, folderID); err != nil {
+			return db.Upload{}, err
+		}
+		upload.Status = UploadStatusCompleted
+		if err := s.DB.UpdateUpload(ctx, upload); err != nil {
+			return db.Upload{}, err
+		}
+	}
+	return upload, nil
+}
+
+func (s *Service) GetResumableUpload(ctx context.Context, uploadID string) (db.Upload, error) {
+	return s.DB.GetUpload(ctx, uploadID)
+}
+
+// WriteResumableChunk appends a chunk at offset. size is -1 when the request
+// did not declare a length. Once the last byte arrives the object is
+// assembled and a regular file record is created under the upload's file ID.
+func (s *Service) WriteResumableChunk(ctx context.Context, uploadID string, offset int64, reader io.Reader, size int64) (db.Upload, error) {
+	backend, ok := s.Storage.(storage.ResumableStorage)
+	if !ok {
+		return db.Upload{}, ErrResumableUnsupported
+	}
+	lock, _ := uploadLocks.LoadOrStore(uploadID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	upload, err := s.DB.GetUpload(ctx, uploadID)
+	if err != nil {
+		return db.Upload{}, err
+	}
+	if upload.Status == UploadStatusCompleted {
+		return upload, ErrUploadCompleted
+	}
+	if offset != upload.Offset {
+		return upload, ErrUploadOffsetMismatch
+	}
+	remaining := upload.Length - upload.Offset
+	if size > remaining {
+		return upload, ErrUploadTooLarge
+	}
+	minChunk := backend.MinChunkSize()
+	if minChunk > 0 {
+		if size < 0 {
+			return upload, ErrUploadLengthRequired
+		}
+		if size < minChunk && size < remaining {
+			return upload, ErrUploadChunkTooSmall
+		}
+	}
+	if size < 0 {
+		// Read one byte past the remaining length so overruns are detected.
+		reader = io.LimitReader(reader, remaining+1)
+	}
+
+	if upload.StorageUploadID == "" {
+		buffered := bufio.NewReaderSize(reader, 512)
+		head, _ := buffered.Peek(512)
+		upload.MimeType = "application/octet-stream"
+		if len(head) > 0 {
+			upload.MimeType = http.DetectContentType(head)
+		}
+		upload.ObjectKey, upload.StorageUploadID, err = backend.BeginChunked(ctx, upload.FileID, upload.OriginalName, upload.MimeType)
+		if err != nil {
+			return upload, err
+		}
+		if err := s.DB.UpdateUpload(ctx, upload); err != nil {
+			return upload, err
+		}
+		reader = buffered
+	}
+
+	sha256Hash, md5Hash, err := restoreUploadHashes(upload)
+	if err != nil {
+		return upload, err
+	}
+	parts := []storage.ChunkPart{}
+	if upload.Parts != "" {
+		if err := json.Unmarshal([]byte(upload.Parts), &parts); err != nil {
+			return upload, err
+		}
+	}
+
+	part, err := backend.WriteChunk(ctx, upload.ObjectKey, upload.StorageUploadID, len(parts)+1, upload.Offset, io.TeeReader(reader, io.MultiWriter(sha256Hash, md5Hash)), size)
+	if err != nil {
+		return upload, err
+	}
+	if part.Size > remaining {
+		_, _ = backend.WriteChunk(ctx, upload.ObjectKey, upload.StorageUploadID, len(parts)+1, upload.Offset, strings.NewReader(""), 0)
+		return upload, ErrUploadTooLarge
+	}
+	if part.Size == 0 {
+		return upload, nil
+	}
+
+	parts = append(parts, part)
+	encodedParts, err := json.Marshal(parts)
+	if err != nil {
+		return upload, err
+	}
+	upload.Parts = string(encodedParts)
+	upload.Offset += part.Size
+	if upload.SHA256State, err = marshalHash(sha256Hash); err != nil {
+		return upload, err
+	}
+	if upload.MD5State, err = marshalHash(md5Hash); err != nil {
+		return upload, err
+	}
+
+	if upload.Offset < upload.Length {
+		return upload, s.DB.UpdateUpload(ctx, upload)
+	}
+
+	if err := backend.CompleteChunked(ctx, upload.ObjectKey, upload.StorageUploadID, parts); err != nil {
+		return upload, err
+	}
+	saveResult := storage.SaveResult{
+		ObjectKey: upload.ObjectKey,
+		Size:      upload.Length,
+		MimeType:  upload.MimeType,
+		SHA256:    hex.EncodeToString(sha256Hash.Sum(nil)),
+		MD5:       hex.EncodeToString(md5Hash.Sum(nil)),
+	}
+	if _, err := s.createFile(ctx, upload.FileID, upload.OriginalName, saveResult, upload.CreatedBy, upload.FolderID); err != nil {
+		return upload, err
+	}
+	upload.Status = UploadStatusCompleted
+	return upload, s.DB.UpdateUpload(ctx, upload)
+}
+
+// TerminateResumableUpload discards an upload and any chunks already stored.
+func (s *Service) TerminateResumableUpload(ctx context.Context, uploadID string) error {
+	upload, err := s.DB.GetUpload(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+	s.abortUpload(ctx, upload)
+	return s.DB.DeleteUpload(ctx, uploadID)
+}
+
+// PurgeExpiredUploads removes uploads past their expiry together with any
+// partially stored data.
+func (s *Service) PurgeExpiredUploads(ctx context.Context) (int, error) {
+	uploads, err := s.DB.ListExpiredUploads(ctx, db.NowRFC3339())
+	if err != nil {
+		return 0, err
+	}
+	for _, upload := range uploads {
+		s.abortUpload(ctx, upload)
+		if err := s.DB.DeleteUpload(ctx, upload.UploadID); err != nil {
+			return 0, err
+		}
+		uploadLocks.Delete(upload.UploadID)
+	}
+	return len(uploads), nil
+}
+
+func (s *Service) abortUpload(ctx context.Context, upload db.Upload) {
+	if upload.Status == UploadStatusCompleted || upload.StorageUploadID == "" {
+		return
+	}
+	backend, ok := s.Storage.(storage.ResumableStorage)
+	if !ok {
+		return
+	}
+	if err := backend.AbortChunked(ctx, upload.ObjectKey, upload.StorageUploadID); err != nil {
+		log.Printf("uploads: failed to abort %s: %v", upload.UploadID, err)
+	}
+}
+
+func restoreUploadHashes(upload db.Upload) (hash.Hash, hash.Hash, error) {
+	sha256Hash := sha256.New()
+	md5Hash := md5.New()
+	if len(upload.SHA256State) > 0 {
+		if err := sha256Hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.SHA256State); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(upload.MD5State) > 0 {
+		if err := md5Hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.MD5State); err != nil {
+			return nil, nil, err
+		}
+	}
+	return sha256Hash, md5Hash, nil
+}
+
+func marshalHash(h hash.Hash) ([]byte, error) {
+	return h.(encoding.BinaryMarshaler).MarshalBinary()
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/kiry163/filehub/internal/db"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength applies to passwords set through the API or CLI. The
+// bootstrap admin password from config is accepted as is.
+const MinPasswordLength = 8
+
+// LocalActor is the identity of requests authenticated with auth.local_key.
+const LocalActor = "local"
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUserExists         = errors.New("username already taken")
+	ErrUsernameInvalid    = errors.New("username must be 1-64 letters, digits or . _ @ + -")
+	ErrPasswordInvalid    = errors.New("password must be 8-72 bytes")
+	ErrUserDisabled       = errors.New("user disabled")
+	ErrLastAdmin          = errors.New("cannot disable or demote the last admin")
+)
+
+// usernamePattern keeps usernames apart from built-in actors such as
+// "local" and "share:<token>".
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._@+-]{1,64}$`)
+
+// UserUpdate changes a user's role or disabled flag; nil fields are left
+// unchanged.
+type UserUpdate struct {
+	Role     *string
+	Disabled *bool
+}
+
+func (s *Service) CreateUser(ctx context.Context, username, password, role string) (db.User, error) {
+	username = strings.TrimSpace(username)
+	if !usernamePattern.MatchString(username) || username == LocalActor {
+		return db.User{}, ErrUsernameInvalid
+	}
+	if !validPassword(password) {
+		return db.User{}, ErrPasswordInvalid
+	}
+	if !ValidRole(role) {
+		return db.User{}, ErrRoleInvalid
+	}
+	return s.createUser(ctx, username, password, role)
+}
+
+func (s *Service) createUser(ctx context.Context, username, password, role string) (db.User, error) {
+	if _, err := s.DB.GetUserByUsername(ctx, username); err == nil {
+		return db.User{}, ErrUserExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return db.User{}, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return db.User{}, err
+	}
+	now := db.NowRFC3339()
+	user := db.User{
+		UserID:       "u_" + generateFileID(12),
+		Username:     username,
+		PasswordHash: hash,
+		Role:         role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := s.DB.CreateUser(ctx, user); err != nil {
+		return db.User{}, err
+	}
+	return user, nil
+}
+
+// BootstrapAdmin creates the configured admin account when the users table
+// is still empty, so existing installs keep their login after upgrading.
+func (s *Service) BootstrapAdmin(ctx context.Context) error {
+	count, err := s.DB.CountUsers(ctx)
+	if err != nil || count > 0 {
+		return err
+	}
+	if s.Config.Auth.AdminPassword == "" {
+		log.Printf("no users exist; create one with `filehub user add <name> -role admin`")
+		return nil
+	}
+	user, err := s.createUser(ctx, s.Config.Auth.AdminUsername, s.Config.Auth.AdminPassword, RoleAdmin)
+	if err != nil {
+		return err
+	}
+	log.Printf("created admin user %q from config", user.Username)
+	return nil
+}
+
+func (s *Service) ListUsers(ctx context.Context) ([]db.User, error) {
+	return s.DB.ListUsers(ctx)
+}
+
+// SetPassword replaces a user's password and ends their sessions.
+func (s *Service) SetPassword(ctx context.Context, userID, password string) (db.User, error) {
+	if !validPassword(password) {
+		return db.User{}, ErrPasswordInvalid
+	}
+	user, err := s.DB.GetUser(ctx, userID)
+	if err != nil {
+		return db.User{}, err
+	}
+	if user.PasswordHash, err = hashPassword(password); err != nil {
+		return db.User{}, err
+	}
+	if err := s.DB.UpdateUser(ctx, user); err != nil {
+		return db.User{}, err
+	}
+	_, err = s.DB.RevokeUserSessions(ctx, userID)
+	return user, err
+}
+
+// UpdateUser changes the role and disabled flag. Disabling a user ends their
+// sessions; access tokens stop working on the next request.
+func (s *Service) UpdateUser(ctx context.Context, userID string, update UserUpdate) (db.User, error) {
+	user, err := s.DB.GetUser(ctx, userID)
+	if err != nil {
+		return db.User{}, err
+	}
+	wasActiveAdmin := user.Role == RoleAdmin && !user.Disabled
+	if update.Role != nil {
+		if !ValidRole(*update.Role) {
+			return db.User{}, ErrRoleInvalid
+		}
+		user.Role = *update.Role
+	}
+	if update.Disabled != nil {
+		user.Disabled = *update.Disabled
+	}
+	if wasActiveAdmin && (user.Role != RoleAdmin || user.Disabled) {
+		others, err := s.DB.CountActiveAdmins(ctx, userID)
+		if err != nil {
+			return db.User{}, err
+		}
+		if others == 0 {
+			return db.User{}, ErrLastAdmin
+		}
+	}
+	if err := s.DB.UpdateUser(ctx, user); err != nil {
+		return db.User{}, err
+	}
+	if user.Disabled {
+		_, err = s.DB.RevokeUserSessions(ctx, userID)
+		return user, err
+	}
+	return user, nil
+}
+
+// Authenticate checks a username and password. Unknown users cost the same
+// bcrypt comparison as known ones.
+func (s *Service) Authenticate(ctx context.Context, username, password string) (db.User, error) {
+	user, err := s.DB.GetUserByUsername(ctx, username)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return db.User{}, err
+		}
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return db.User{}, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return db.User{}, ErrInvalidCredentials
+	}
+	if user.Disabled {
+		return db.User{}, ErrUserDisabled
+	}
+	return user, nil
+}
+
+// ActiveUser loads the user named by a token subject and rejects disabled
+// or deleted accounts.
+func (s *Service) ActiveUser(ctx context.Context, userID string) (db.User, error) {
+	user, err := s.DB.GetUser(ctx, userID)
+	if err != nil {
+		return db.User{}, err
+	}
+	if user.Disabled {
+		return db.User{}, ErrUserDisabled
+	}
+	return user, nil
+}
+
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("filehub"), bcrypt.DefaultCost)
+	return hash
+})
+
+// validPassword enforces the minimum length and bcrypt's 72-byte limit.
+func validPassword(password string) bool {
+	return len(password) >= MinPasswordLength && len(password) <= 72
+}
+
+func hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCreateUserValidation(t *testing.T) {
+	svc, _ := newTestService(t)
+	if _, err := svc.CreateUser(context.Background(), "alice", "password1", RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		username string
+		password string
+		role     string
+		err      error
+	}{
+		{"ok", "bob", "password1", RoleViewer, nil},
+		{"email-like username", "carol@example.com", "password1", RoleViewer, nil},
+		{"surrounding spaces trimmed", "  dave ", "password1", RoleViewer, nil},
+		{"taken", "alice", "password1", RoleViewer, ErrUserExists},
+		{"empty username", "", "password1", RoleViewer, ErrUsernameInvalid},
+		{"reserved local actor", "local", "password1", RoleViewer, ErrUsernameInvalid},
+		{"share actor shape", "share:abc", "password1", RoleViewer, ErrUsernameInvalid},
+		{"slash", "a/b", "password1", RoleViewer, ErrUsernameInvalid},
+		{"too long", strings.Repeat("a", 65), "password1", RoleViewer, ErrUsernameInvalid},
+		{"short password", "erin", "short", RoleViewer, ErrPasswordInvalid},
+		{"password past bcrypt's limit", "frank", strings.Repeat("p", 73), RoleViewer, ErrPasswordInvalid},
+		{"longest password", "grace", strings.Repeat("p", 72), RoleViewer, nil},
+		{"admin", "heidi", "password1", RoleAdmin, nil},
+		{"unknown role", "ivan", "password1", "owner", ErrRoleInvalid},
+		{"missing role", "judy", "password1", "", ErrRoleInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user, err := svc.CreateUser(context.Background(), test.username, test.password, test.role)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+			if err == nil && (user.PasswordHash == test.password || user.Username != strings.TrimSpace(test.username) || user.Role != test.role) {
+				t.Errorf("user %+v", user)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	if _, err := svc.CreateUser(ctx, "alice", "password1", RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	disabled, err := svc.CreateUser(ctx, "bob", "password1", RoleViewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yes := true
+	if _, err := svc.UpdateUser(ctx, disabled.UserID, UserUpdate{Disabled: &yes}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		err      error
+	}{
+		{"right password", "alice", "password1", nil},
+		{"wrong password", "alice", "password2", ErrInvalidCredentials},
+		{"unknown user", "nobody", "password1", ErrInvalidCredentials},
+		{"disabled user", "bob", "password1", ErrUserDisabled},
+		// A disabled account does not reveal itself to wrong passwords.
+		{"disabled user with wrong password", "bob", "password2", ErrInvalidCredentials},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := svc.Authenticate(ctx, test.username, test.password); !errors.Is(err, test.err) {
+				t.Errorf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestUpdateUserKeepsAnAdmin(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	alice, err := svc.CreateUser(ctx, "alice", "password1", RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := svc.CreateUser(ctx, "bob", "password1", RoleViewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yes := true
+	admin, editor := RoleAdmin, RoleEditor
+
+	steps := []struct {
+		name   string
+		userID string
+		update UserUpdate
+		err    error
+	}{
+		{"demote the only admin", alice.UserID, UserUpdate{Role: &editor}, ErrLastAdmin},
+		{"disable the only admin", alice.UserID, UserUpdate{Disabled: &yes}, ErrLastAdmin},
+		{"promote another admin", bob.UserID, UserUpdate{Role: &admin}, nil},
+		{"demote one of two admins", alice.UserID, UserUpdate{Role: &editor}, nil},
+		{"disable the remaining admin", bob.UserID, UserUpdate{Disabled: &yes}, ErrLastAdmin},
+		{"disable a regular user", alice.UserID, UserUpdate{Disabled: &yes}, nil},
+	}
+	for _, step := range steps {
+		if _, err := svc.UpdateUser(ctx, step.userID, step.update); !errors.Is(err, step.err) {
+			t.Fatalf("%s: got %v, want %v", step.name, err, step.err)
+		}
+	}
+}
+
+func TestSessionsEndWithTheAccount(t *testing.T) {
+	ctx := context.Background()
+	yes := true
+	tests := []struct {
+		name   string
+		change func(svc *Service, userID, sessionID string) error
+	}{
+		{"password reset", func(svc *Service, userID, sessionID string) error {
+			_, err := svc.SetPassword(ctx, userID, "password2")
+			return err
+		}},
+		{"disabled", func(svc *Service, userID, sessionID string) error {
+			_, err := svc.UpdateUser(ctx, userID, UserUpdate{Disabled: &yes})
+			return err
+		}},
+		{"logout", func(svc *Service, userID, sessionID string) error {
+			return svc.Logout(ctx, sessionID)
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc, _ := newTestService(t)
+			user, err := svc.CreateUser(ctx, "alice", "password1", RoleViewer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens, _, err := svc.Login(ctx, "alice", "password1", Client{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := test.change(svc, user.UserID, sessionOf(t, svc, tokens)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := svc.Refresh(ctx, tokens.RefreshToken, Client{}); err == nil {
+				t.Error("refresh token still works")
+			}
+		})
+	}
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		existing bool
+		password string
+		users    int
+	}{
+		{"empty install with a configured admin", false, "bootstrap-pw", 1},
+		{"empty install without a password", false, "", 0},
+		{"users already exist", true, "bootstrap-pw", 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc, _ := newTestService(t)
+			svc.Config.Auth.AdminUsername = "admin"
+			svc.Config.Auth.AdminPassword = test.password
+			if test.existing {
+				if _, err := svc.CreateUser(ctx, "alice", "password1", RoleAdmin); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := svc.BootstrapAdmin(ctx); err != nil {
+				t.Fatal(err)
+			}
+			users, err := svc.ListUsers(ctx)
+			if err != nil || len(users) != test.users {
+				t.Fatalf("users %+v, %v", users, err)
+			}
+			_, err = svc.Authenticate(ctx, "admin", "bootstrap-pw")
+			if created := err == nil; created != (!test.existing && test.password != "") {
+				t.Errorf("admin login: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"mime/multipart"
+
+	"github.com/kiry163/filehub/internal/db"
+)
+
+// ErrCurrentVersion means the version to delete is the one the file serves.
+var ErrCurrentVersion = errors.New("cannot delete the current version")
+
+// UploadVersion stores a new version of an existing file and makes it
+// current. Earlier versions keep their own objects.
+func (s *Service) UploadVersion(ctx context.Context, fileID string, header *multipart.FileHeader, createdBy string) (db.FileVersion, error) {
+	if _, err := s.DB.GetFile(ctx, fileID); err != nil {
+		return db.FileVersion{}, err
+	}
+	reader, err := header.Open()
+	if err != nil {
+		return db.FileVersion{}, err
+	}
+	defer reader.Close()
+
+	// Versions uploaded on the same day would otherwise share an object key.
+	saveResult, err := s.Storage.Save(ctx, reader, header.Size, fileID+"-"+generateFileID(8), header.Filename)
+	if err != nil {
+		return db.FileVersion{}, err
+	}
+	saveResult, err = s.dedupObject(ctx, saveResult)
+	if err != nil {
+		return db.FileVersion{}, err
+	}
+	version, err := s.DB.AddFileVersion(ctx, db.FileVersion{
+		FileID:       fileID,
+		OriginalName: header.Filename,
+		ObjectKey:    saveResult.ObjectKey,
+		Size:         saveResult.Size,
+		MimeType:     saveResult.MimeType,
+		SHA256:       saveResult.SHA256,
+		MD5:          saveResult.MD5,
+		CreatedBy:    createdBy,
+	})
+	if err != nil {
+		s.releaseObject(ctx, saveResult.ObjectKey)
+		return db.FileVersion{}, err
+	}
+	return version, nil
+}
+
+func (s *Service) ListVersions(ctx context.Context, fileID string) ([]db.FileVersion, error) {
+	return s.DB.ListFileVersions(ctx, fileID)
+}
+
+// FileAtVersion returns record as it was at version, for downloading an
+// earlier version.
+func (s *Service) FileAtVersion(ctx context.Context, record db.FileRecord, version int) (db.FileRecord, error) {
+	if version == record.Version {
+		return record, nil
+	}
+	stored, err := s.DB.GetFileVersion(ctx, record.FileID, version)
+	if err != nil {
+		return db.FileRecord{}, err
+	}
+	record.Version = stored.Version
+	record.OriginalName = stored.OriginalName
+	record.ObjectKey = stored.ObjectKey
+	record.Size = stored.Size
+	record.MimeType = stored.MimeType
+	record.SHA256 = stored.SHA256
+	record.MD5 = stored.MD5
+	return record, nil
+}
+
+// PromoteVersion makes an earlier version current again. No new version is
+// created.
+func (s *Service) PromoteVersion(ctx context.Context, fileID string, version int) (db.FileVersion, error) {
+	return s.DB.SetCurrentVersion(ctx, fileID, version)
+}
+
+// DeleteVersion deletes one version that is not current.
+func (s *Service) DeleteVersion(ctx context.Context, fileID string, version int) error {
+	record, err := s.DB.GetFile(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if record.Version == version {
+		return ErrCurrentVersion
+	}
+	deleted, err := s.DB.DeleteFileVersions(ctx, fileID, []int{version})
+	if err != nil {
+		return err
+	}
+	if len(deleted) == 0 {
+		return sql.ErrNoRows
+	}
+	s.releaseObject(ctx, deleted[0].ObjectKey)
+	return nil
+}
+
+// PruneVersions keeps the keep newest versions of a file plus the current
+// one, deletes the rest and returns them.
+func (s *Service) PruneVersions(ctx context.Context, fileID string, keep int) ([]db.FileVersion, error) {
+	if _, err := s.DB.GetFile(ctx, fileID); err != nil {
+		return nil, err
+	}
+	versions, err := s.DB.ListFileVersions(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if keep < 0 {
+		keep = 0
+	}
+	if keep >= len(versions) {
+		return []db.FileVersion{}, nil
+	}
+	numbers := make([]int, 0, len(versions)-keep)
+	for _, version := range versions[keep:] {
+		numbers = append(numbers, version.Version)
+	}
+	deleted, err := s.DB.DeleteFileVersions(ctx, fileID, numbers)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range deleted {
+		s.releaseObject(ctx, version.ObjectKey)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/kiry163/filehub/internal/db"
+)
+
+// uploadVersions uploads a file and then one new version per extra content.
+func uploadVersions(t *testing.T, svc *Service, contents ...string) db.FileRecord {
+	t.Helper()
+	ctx := context.Background()
+	record := uploadTestFile(t, svc, "report.txt", contents[0])
+	for _, content := range contents[1:] {
+		if _, err := svc.UploadVersion(ctx, record.FileID, multipartFile(t, "report.txt", content), "alice"); err != nil {
+			t.Fatalf("upload version: %v", err)
+		}
+	}
+	record, err := svc.DB.GetFile(ctx, record.FileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func versionNumbers(t *testing.T, svc *Service, fileID string) []int {
+	t.Helper()
+	versions, err := svc.ListVersions(context.Background(), fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numbers := make([]int, 0, len(versions))
+	for _, version := range versions {
+		numbers = append(numbers, version.Version)
+	}
+	return numbers
+}
+
+func TestUploadVersion(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	record := uploadVersions(t, svc, "one", "two!", "three")
+	if record.Version != 3 || record.Size != 5 {
+		t.Fatalf("current file: version %d, size %d", record.Version, record.Size)
+	}
+	if got := versionNumbers(t, svc, record.FileID); !reflect.DeepEqual(got, []int{3, 2, 1}) {
+		t.Errorf("versions %v", got)
+	}
+	if got := storedObjects(t, svc); got != 3 {
+		t.Errorf("%d objects stored, want one per version", got)
+	}
+
+	for version, size := range map[int]int64{1: 3, 2: 4, 3: 5} {
+		old, err := svc.FileAtVersion(ctx, record, version)
+		if err != nil || old.Version != version || old.Size != size {
+			t.Errorf("version %d: %+v, %v", version, old, err)
+		}
+	}
+	if _, err := svc.FileAtVersion(ctx, record, 4); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing version: want no rows, got %v", err)
+	}
+	if _, err := svc.UploadVersion(ctx, "missing", multipartFile(t, "x.txt", "x"), "alice"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("version of a missing file: want no rows, got %v", err)
+	}
+}
+
+func TestPromoteAndDeleteVersion(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	record := uploadVersions(t, svc, "one", "two!", "three")
+
+	if _, err := svc.PromoteVersion(ctx, record.FileID, 1); err != nil {
+		t.Fatal(err)
+	}
+	current, err := svc.DB.GetFile(ctx, record.FileID)
+	if err != nil || current.Version != 1 || current.Size != 3 {
+		t.Fatalf("after promote: %+v, %v", current, err)
+	}
+	if got := versionNumbers(t, svc, record.FileID); !reflect.DeepEqual(got, []int{3, 2, 1}) {
+		t.Errorf("promote created a version: %v", got)
+	}
+
+	tests := []struct {
+		version int
+		err     error
+	}{
+		{1, ErrCurrentVersion},
+		{9, sql.ErrNoRows},
+		{3, nil},
+		{3, sql.ErrNoRows},
+	}
+	for _, test := range tests {
+		if err := svc.DeleteVersion(ctx, record.FileID, test.version); !errors.Is(err, test.err) {
+			t.Errorf("delete version %d: got %v, want %v", test.version, err, test.err)
+		}
+	}
+	if got := versionNumbers(t, svc, record.FileID); !reflect.DeepEqual(got, []int{2, 1}) {
+		t.Errorf("versions after delete %v", got)
+	}
+	if got := storedObjects(t, svc); got != 2 {
+		t.Errorf("%d objects stored, want 2", got)
+	}
+}
+
+func TestPruneVersions(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		current int
+		keep    int
+		deleted []int
+		left    []int
+	}{
+		{"keep newest", 4, 2, []int{2, 1}, []int{4, 3}},
+		{"keep more than exist", 4, 9, []int{}, []int{4, 3, 2, 1}},
+		{"current is kept", 1, 2, []int{2}, []int{4, 3, 1}},
+		{"keep none but current", 2, 0, []int{4, 3, 1}, []int{2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc, _ := newTestService(t)
+			record := uploadVersions(t, svc, "a", "bb", "ccc", "dddd")
+			if _, err := svc.PromoteVersion(ctx, record.FileID, test.current); err != nil {
+				t.Fatal(err)
+			}
+			deleted, err := svc.PruneVersions(ctx, record.FileID, test.keep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			numbers := make([]int, 0, len(deleted))
+			for _, version := range deleted {
+				numbers = append(numbers, version.Version)
+			}
+			if !reflect.DeepEqual(numbers, test.deleted) {
+				t.Errorf("deleted %v, want %v", numbers, test.deleted)
+			}
+			if got := versionNumbers(t, svc, record.FileID); !reflect.DeepEqual(got, test.left) {
+				t.Errorf("left %v, want %v", got, test.left)
+			}
+			if got := storedObjects(t, svc); got != len(test.left) {
+				t.Errorf("%d objects stored, want %d", got, len(test.left))
+			}
+		})
+	}
+}
+
+func TestPurgeReleasesEveryVersion(t *testing.T) {
+	svc, _ := newTestService(t)
+	record := uploadVersions(t, svc, "one", "two", "three")
+	purgeTestFile(t, svc, record.FileID)
+	if got := storedObjects(t, svc); got != 0 {
+		t.Errorf("%d objects stored after purge, want 0", got)
+	}
+}
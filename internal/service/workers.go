@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// StartWorkers launches the periodic maintenance jobs. They stop when ctx is
+// cancelled.
+func (s *Service) StartWorkers(ctx context.Context) {
+	go runPeriodically(ctx, "purge expired uploads", time.Hour, func(ctx context.Context) error {
+		count, err := s.PurgeExpiredUploads(ctx)
+		if count > 0 {
+			log.Printf("purged %d expired uploads", count)
+		}
+		return err
+	})
+	go runPeriodically(ctx, "purge expired trash", time.Hour, func(ctx context.Context) error {
+		count, err := s.PurgeExpiredTrash(ctx)
+		if count > 0 {
+			log.Printf("purged %d files from the trash", count)
+		}
+		if err != nil {
+			return err
+		}
+		deleted, err := s.DeletePendingObjects(ctx)
+		if deleted > 0 {
+			log.Printf("deleted %d objects left over from failed deletes", deleted)
+		}
+		return err
+	})
+	go runPeriodically(ctx, "purge expired audit logs", time.Hour, func(ctx context.Context) error {
+		count, err := s.PurgeExpiredAuditLogs(ctx)
+		if count > 0 {
+			log.Printf("purged %d audit log entries", count)
+		}
+		return err
+	})
+	go runPeriodically(ctx, "checkpoint audit log", time.Hour, func(ctx context.Context) error {
+		_, err := s.WriteAuditCheckpoint(ctx)
+		return err
+	})
+	go runPeriodically(ctx, "purge expired sessions", time.Hour, func(ctx context.Context) error {
+		count, err := s.PurgeSessions(ctx)
+		if count > 0 {
+			log.Printf("purged %d expired sessions", count)
+		}
+		return err
+	})
+}
+
+func runPeriodically(ctx context.Context, name string, interval time.Duration, job func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := job(ctx); err != nil {
+			log.Printf("%s: %v", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
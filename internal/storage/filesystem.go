@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+type FilesystemStorage struct {
+	root string
+}
+
+func NewFilesystemStorage(root string) (*FilesystemStorage, error) {
+	if root == "" {
+		return nil, errors.New("missing storage path")
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(absRoot, 0o755); err != nil {
+		return nil, err
+	}
+	return &FilesystemStorage{root: absRoot}, nil
+}
+
+func (s *FilesystemStorage) Save(ctx context.Context, reader io.Reader, size int64, fileID, originalName string) (SaveResult, error) {
+	objectKey := newObjectKey(fileID, originalName)
+	path, err := s.objectPath(objectKey)
+	if err != nil {
+		return SaveResult{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return SaveResult{}, err
+	}
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(reader, buf)
+	mimeType := "application/octet-stream"
+	if n > 0 {
+		mimeType = http.DetectContentType(buf[:n])
+	}
+	contentReader := newChecksumReader(io.MultiReader(bytes.NewReader(buf[:n]), reader))
+
+	// Write to a temp file in the target directory and rename it into place,
+	// so readers never observe a partially written object.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return SaveResult{}, err
+	}
+	tmpName := tmp.Name()
+	written, err := io.Copy(tmp, contextReader{ctx: ctx, reader: contentReader})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("size mismatch: expected %d bytes, got %d", size, written)
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return SaveResult{}, err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		_ = os.Remove(tmpName)
+		return SaveResult{}, err
+	}
+	return SaveResult{
+		ObjectKey: objectKey,
+		Size:      written,
+		MimeType:  mimeType,
+		SHA256:    contentReader.SHA256(),
+		MD5:       contentReader.MD5(),
+	}, nil
+}
+
+func (s *FilesystemStorage) Get(ctx context.Context, objectKey string, rangeStart, rangeEnd *int64) (io.ReadCloser, ObjectInfo, error) {
+	info, err := s.Stat(ctx, objectKey)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	path, err := s.objectPath(objectKey)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	if rangeStart == nil || rangeEnd == nil {
+		return file, info, nil
+	}
+	if _, err := file.Seek(*rangeStart, io.SeekStart); err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, err
+	}
+	return rangeReadCloser{Reader: io.LimitReader(file, *rangeEnd-*rangeStart+1), Closer: file}, info, nil
+}
+
+func (s *FilesystemStorage) Stat(ctx context.Context, objectKey string) (ObjectInfo, error) {
+	path, err := s.objectPath(objectKey)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if stat.IsDir() {
+		return ObjectInfo{}, os.ErrNotExist
+	}
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(file, buf)
+	contentType := "application/octet-stream"
+	if n > 0 {
+		contentType = http.DetectContentType(buf[:n])
+	}
+	return ObjectInfo{Size: stat.Size(), ContentType: contentType}, nil
+}
+
+func (s *FilesystemStorage) Delete(ctx context.Context, objectKey string) error {
+	path, err := s.objectPath(objectKey)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// objectPath maps an object key to a path under the storage root and rejects
+// keys that would escape it.
+func (s *FilesystemStorage) objectPath(objectKey string) (string, error) {
+	cleaned := filepath.Clean("/" + filepath.FromSlash(objectKey))
+	if cleaned == string(filepath.Separator) {
+		return "", errors.New("invalid object key")
+	}
+	return filepath.Join(s.root, cleaned), nil
+}
+
+type rangeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// contextReader stops a copy once the request context is cancelled.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(buf []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(buf)
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestFilesystem(t *testing.T) *FilesystemStorage {
+	t.Helper()
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("new filesystem storage: %v", err)
+	}
+	return fs
+}
+
+func readObject(t *testing.T, fs *FilesystemStorage, objectKey string, start, end *int64) string {
+	t.Helper()
+	reader, _, err := fs.Get(context.Background(), objectKey, start, end)
+	if err != nil {
+		t.Fatalf("get %s: %v", objectKey, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// leftovers lists the files under the storage root, so a failed save can be
+// checked for partial objects and stray temp files.
+func leftovers(t *testing.T, fs *FilesystemStorage) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(fs.root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func int64Ptr(value int64) *int64 {
+	return &value
+}
+
+func TestFilesystemSaveAndRangeGet(t *testing.T) {
+	fs := newTestFilesystem(t)
+	content := "hello, filesystem storage"
+	result, err := fs.Save(context.Background(), strings.NewReader(content), int64(len(content)), "abc123", "Greeting.TXT")
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if result.Size != int64(len(content)) || !strings.HasSuffix(result.ObjectKey, "/abc123.txt") {
+		t.Fatalf("save result: %+v", result)
+	}
+	if !strings.HasPrefix(result.MimeType, "text/plain") {
+		t.Errorf("mime type: %s", result.MimeType)
+	}
+	if result.SHA256 != "fc2bb1602b401625248e3f346190de870908feed805d9bbe932a8ef0542b5e91" || result.MD5 != "bc9d3aee04895155d02a1505d6e8ea64" {
+		t.Errorf("checksums: sha256 %s, md5 %s", result.SHA256, result.MD5)
+	}
+
+	tests := []struct {
+		name       string
+		start, end *int64
+		want       string
+	}{
+		{"whole object", nil, nil, content},
+		{"first byte", int64Ptr(0), int64Ptr(0), "h"},
+		{"middle", int64Ptr(7), int64Ptr(16), "filesystem"},
+		{"tail", int64Ptr(18), int64Ptr(int64(len(content) - 1)), "storage"},
+		{"end past the object", int64Ptr(18), int64Ptr(1000), "storage"},
+		{"open start is the whole object", nil, int64Ptr(3), content},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := readObject(t, fs, result.ObjectKey, test.start, test.end); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	info, err := fs.Stat(context.Background(), result.ObjectKey)
+	if err != nil || info.Size != int64(len(content)) {
+		t.Errorf("stat: %+v, %v", info, err)
+	}
+}
+
+func TestFilesystemSaveFailureLeavesNothing(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		reader io.Reader
+		size   int64
+	}{
+		{"short body", context.Background(), strings.NewReader("short"), 100},
+		{"long body", context.Background(), strings.NewReader(strings.Repeat("x", 2000)), 100},
+		{"read error", context.Background(), io.MultiReader(strings.NewReader(strings.Repeat("x", 1000)), errorReader{}), -1},
+		{"cancelled request", cancelled, strings.NewReader(strings.Repeat("x", 1000)), 1000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := newTestFilesystem(t)
+			if _, err := fs.Save(test.ctx, test.reader, test.size, "abc123", "a.bin"); err == nil {
+				t.Fatal("save succeeded")
+			}
+			if files := leftovers(t, fs); len(files) > 0 {
+				t.Fatalf("failed save left %v", files)
+			}
+		})
+	}
+}
+
+func TestFilesystemObjectPath(t *testing.T) {
+	fs := newTestFilesystem(t)
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"2024-01-01/abc.txt", "2024-01-01/abc.txt"},
+		{"../../etc/passwd", "etc/passwd"},
+		{"/etc/passwd", "etc/passwd"},
+		{"a/../../b", "b"},
+		{"a/./b/../c", "a/c"},
+		{"", ""},
+		{"/", ""},
+		{"..", ""},
+		{"../..", ""},
+	}
+	for _, test := range tests {
+		path, err := fs.objectPath(test.key)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%q: want an error, got %s", test.key, path)
+			}
+			continue
+		}
+		if err != nil || path != filepath.Join(fs.root, filepath.FromSlash(test.want)) {
+			t.Errorf("%q: got %s, %v, want %s under the root", test.key, path, err, test.want)
+		}
+	}
+
+	// Keys outside the root never reach files there.
+	outside := filepath.Join(filepath.Dir(fs.root), "outside.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fs.Get(context.Background(), "../outside.txt", nil, nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("get outside the root: want not exist, got %v", err)
+	}
+	if err := fs.Delete(context.Background(), "../outside.txt"); err != nil {
+		t.Errorf("delete outside the root: %v", err)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside the root removed: %v", err)
+	}
+}
+
+type errorReader struct{}
+
+func (errorReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
@@ -7,8 +7,6 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/kiry163/filehub/internal/config"
@@ -60,12 +58,21 @@ func NewMinioStorage(ctx context.Context, cfg config.MinioConfig) (*MinioStorage
 	return &MinioStorage{client: client, bucket: cfg.Bucket}, nil
 }
 
-func (s *MinioStorage) Save(ctx context.Context, reader io.Reader, size int64, fileID, originalName string) (SaveResult, error) {
-	ext := strings.ToLower(filepath.Ext(originalName))
-	if ext == "" {
-		ext = ".bin"
+// Streams of unknown length (size < 0) would otherwise be buffered in
+// minio-go's default 512 MiB parts; 16 MiB keeps memory bounded while still
+// allowing objects up to 10000 parts.
+const unknownSizePartSize = 16 << 20
+
+func putObjectOptions(size int64, mimeType string) minio.PutObjectOptions {
+	opts := minio.PutObjectOptions{ContentType: mimeType}
+	if size < 0 {
+		opts.PartSize = unknownSizePartSize
 	}
-	objectKey := time.Now().UTC().Format("2006-01-02") + "/" + fileID + ext
+	return opts
+}
+
+func (s *MinioStorage) Save(ctx context.Context, reader io.Reader, size int64, fileID, originalName string) (SaveResult, error) {
+	objectKey := newObjectKey(fileID, originalName)
 
 	buf := make([]byte, 512)
 	n, _ := io.ReadFull(reader, buf)
@@ -73,19 +80,25 @@ func (s *MinioStorage) Save(ctx context.Context, reader io.Reader, size int64, f
 	if n > 0 {
 		mimeType = http.DetectContentType(buf[:n])
 	}
-	contentReader := io.MultiReader(bytes.NewReader(buf[:n]), reader)
-	_, err := s.client.PutObject(
+	contentReader := newChecksumReader(io.MultiReader(bytes.NewReader(buf[:n]), reader))
+	info, err := s.client.PutObject(
 		ctx,
 		s.bucket,
 		objectKey,
 		contentReader,
 		size,
-		minio.PutObjectOptions{ContentType: mimeType},
+		putObjectOptions(size, mimeType),
 	)
 	if err != nil {
 		return SaveResult{}, err
 	}
-	return SaveResult{ObjectKey: objectKey, Size: size, MimeType: mimeType}, nil
+	return SaveResult{
+		ObjectKey: objectKey,
+		Size:      info.Size,
+		MimeType:  mimeType,
+		SHA256:    contentReader.SHA256(),
+		MD5:       contentReader.MD5(),
+	}, nil
 }
 
 func (s *MinioStorage) Get(ctx context.Context, objectKey string, rangeStart, rangeEnd *int64) (io.ReadCloser, ObjectInfo, error) {
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// ChunkPart records one chunk written to a resumable upload.
+type ChunkPart struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag,omitempty"`
+	Size   int64  `json:"size"`
+}
+
+// ResumableStorage is implemented by backends that can assemble an object
+// from chunks written in order over several requests.
+type ResumableStorage interface {
+	BeginChunked(ctx context.Context, fileID, originalName, contentType string) (objectKey, uploadID string, err error)
+	WriteChunk(ctx context.Context, objectKey, uploadID string, partNumber int, offset int64, reader io.Reader, size int64) (ChunkPart, error)
+	CompleteChunked(ctx context.Context, objectKey, uploadID string, parts []ChunkPart) error
+	AbortChunked(ctx context.Context, objectKey, uploadID string) error
+	// MinChunkSize is the smallest accepted chunk other than the last one.
+	MinChunkSize() int64
+}
+
+// S3 rejects multipart uploads whose non-final parts are below 5 MiB.
+const minioMinPartSize = 5 << 20
+
+func (s *MinioStorage) BeginChunked(ctx context.Context, fileID, originalName, contentType string) (string, string, error) {
+	objectKey := newObjectKey(fileID, originalName)
+	core := minio.Core{Client: s.client}
+	uploadID, err := core.NewMultipartUpload(ctx, s.bucket, objectKey, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return "", "", err
+	}
+	return objectKey, uploadID, nil
+}
+
+func (s *MinioStorage) WriteChunk(ctx context.Context, objectKey, uploadID string, partNumber int, offset int64, reader io.Reader, size int64) (ChunkPart, error) {
+	if size < 0 {
+		return ChunkPart{}, errors.New("chunk size required")
+	}
+	core := minio.Core{Client: s.client}
+	part, err := core.PutObjectPart(ctx, s.bucket, objectKey, uploadID, partNumber, reader, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return ChunkPart{}, err
+	}
+	return ChunkPart{Number: partNumber, ETag: part.ETag, Size: part.Size}, nil
+}
+
+func (s *MinioStorage) CompleteChunked(ctx context.Context, objectKey, uploadID string, parts []ChunkPart) error {
+	completeParts := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completeParts = append(completeParts, minio.CompletePart{PartNumber: part.Number, ETag: part.ETag})
+	}
+	core := minio.Core{Client: s.client}
+	_, err := core.CompleteMultipartUpload(ctx, s.bucket, objectKey, uploadID, completeParts, minio.PutObjectOptions{})
+	return err
+}
+
+func (s *MinioStorage) AbortChunked(ctx context.Context, objectKey, uploadID string) error {
+	core := minio.Core{Client: s.client}
+	return core.AbortMultipartUpload(ctx, s.bucket, objectKey, uploadID)
+}
+
+func (s *MinioStorage) MinChunkSize() int64 {
+	return minioMinPartSize
+}
+
+// Chunked uploads on the filesystem are staged under .uploads and renamed
+// into place once complete.
+const stagingDir = ".uploads"
+
+func (s *FilesystemStorage) BeginChunked(ctx context.Context, fileID, originalName, contentType string) (string, string, error) {
+	if err := os.MkdirAll(filepath.Join(s.root, stagingDir), 0o755); err != nil {
+		return "", "", err
+	}
+	file, err := os.CreateTemp(filepath.Join(s.root, stagingDir), fileID+"-*")
+	if err != nil {
+		return "", "", err
+	}
+	uploadID := filepath.Base(file.Name())
+	if err := file.Close(); err != nil {
+		return "", "", err
+	}
+	return newObjectKey(fileID, originalName), uploadID, nil
+}
+
+func (s *FilesystemStorage) WriteChunk(ctx context.Context, objectKey, uploadID string, partNumber int, offset int64, reader io.Reader, size int64) (ChunkPart, error) {
+	path, err := s.stagingPath(uploadID)
+	if err != nil {
+		return ChunkPart{}, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY, 0o644)
+	if err != nil {
+		return ChunkPart{}, err
+	}
+	defer file.Close()
+
+	// Drop any bytes left behind by an earlier failed chunk.
+	if err := file.Truncate(offset); err != nil {
+		return ChunkPart{}, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return ChunkPart{}, err
+	}
+	written, err := io.Copy(file, contextReader{ctx: ctx, reader: reader})
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("size mismatch: expected %d bytes, got %d", size, written)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		_ = file.Truncate(offset)
+		return ChunkPart{}, err
+	}
+	return ChunkPart{Number: partNumber, Size: written}, nil
+}
+
+func (s *FilesystemStorage) CompleteChunked(ctx context.Context, objectKey, uploadID string, parts []ChunkPart) error {
+	staged, err := s.stagingPath(uploadID)
+	if err != nil {
+		return err
+	}
+	path, err := s.objectPath(objectKey)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(staged, path)
+}
+
+func (s *FilesystemStorage) AbortChunked(ctx context.Context, objectKey, uploadID string) error {
+	path, err := s.stagingPath(uploadID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *FilesystemStorage) MinChunkSize() int64 {
+	return 0
+}
+
+func (s *FilesystemStorage) stagingPath(uploadID string) (string, error) {
+	if uploadID == "" || uploadID != filepath.Base(uploadID) || uploadID == "." || uploadID == ".." {
+		return "", errors.New("invalid upload id")
+	}
+	return filepath.Join(s.root, stagingDir, uploadID), nil
+}
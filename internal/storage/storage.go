@@ -2,13 +2,22 @@ package storage
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
 	"io"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 type SaveResult struct {
 	ObjectKey string
 	Size      int64
 	MimeType  string
+	SHA256    string
+	MD5       string
 }
 
 type ObjectInfo struct {
@@ -17,8 +26,45 @@ type ObjectInfo struct {
 }
 
 type Storage interface {
+	// Save stores reader under a new object key. size may be -1 when the
+	// length is unknown; SaveResult.Size reports the bytes actually stored.
 	Save(ctx context.Context, reader io.Reader, size int64, fileID, originalName string) (SaveResult, error)
 	Get(ctx context.Context, objectKey string, rangeStart, rangeEnd *int64) (io.ReadCloser, ObjectInfo, error)
 	Stat(ctx context.Context, objectKey string) (ObjectInfo, error)
 	Delete(ctx context.Context, objectKey string) error
 }
+
+// newObjectKey lays objects out as YYYY-MM-DD/<fileID>.<ext>.
+func newObjectKey(fileID, originalName string) string {
+	ext := strings.ToLower(filepath.Ext(originalName))
+	if ext == "" {
+		ext = ".bin"
+	}
+	return time.Now().UTC().Format("2006-01-02") + "/" + fileID + ext
+}
+
+// checksumReader hashes everything read through it so Save can record
+// checksums without a second pass over the data.
+type checksumReader struct {
+	reader io.Reader
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+func newChecksumReader(reader io.Reader) *checksumReader {
+	c := &checksumReader{sha256: sha256.New(), md5: md5.New()}
+	c.reader = io.TeeReader(reader, io.MultiWriter(c.sha256, c.md5))
+	return c
+}
+
+func (c *checksumReader) Read(buf []byte) (int, error) {
+	return c.reader.Read(buf)
+}
+
+func (c *checksumReader) SHA256() string {
+	return hex.EncodeToString(c.sha256.Sum(nil))
+}
+
+func (c *checksumReader) MD5() string {
+	return hex.EncodeToString(c.md5.Sum(nil))
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestChecksumReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		sha256 string
+		md5    string
+	}{
+		{"empty", "", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", "d41d8cd98f00b204e9800998ecf8427e"},
+		{"abc", "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", "900150983cd24fb0d6963f7d28e17f72"},
+		{"pangram", "The quick brown fox jumps over the lazy dog", "d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592", "9e107d9d372bb6826bd81d3542a419d6"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Read a byte at a time so the hashes see every chunk in order.
+			reader := newChecksumReader(iotest.OneByteReader(strings.NewReader(test.input)))
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.input {
+				t.Fatalf("data passed through as %q", data)
+			}
+			if got := reader.SHA256(); got != test.sha256 {
+				t.Errorf("sha256 %s, want %s", got, test.sha256)
+			}
+			if got := reader.MD5(); got != test.md5 {
+				t.Errorf("md5 %s, want %s", got, test.md5)
+			}
+		})
+	}
+}
+
+func TestPutObjectOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		partSize uint64
+	}{
+		{"known size", 1024, 0},
+		{"empty", 0, 0},
+		{"unknown size", -1, 16 << 20},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := putObjectOptions(test.size, "text/plain")
+			if opts.PartSize != test.partSize {
+				t.Errorf("part size = %d, want %d", opts.PartSize, test.partSize)
+			}
+			if opts.ContentType != "text/plain" {
+				t.Errorf("content type = %q", opts.ContentType)
+			}
+		})
+	}
+}
@@ -112,14 +112,38 @@ fetch_public_ip() {
   printf '%s' "$ip"
 }
 
+# Logs in as the admin and prints a new API key for the CLI on this machine.
+create_cli_key() {
+  local port="$1"
+  local admin_password="$2"
+  local base="http://localhost:${port}/api/v1"
+  local token=""
+
+  command -v curl >/dev/null 2>&1 || return 1
+  for _ in $(seq 1 30); do
+    curl -fsS "http://localhost:${port}/health" >/dev/null 2>&1 && break
+    sleep 1
+  done
+  token="$(curl -fsS -X POST "${base}/auth/login" \
+    -H 'Content-Type: application/json' \
+    -d "{\"username\":\"admin\",\"password\":\"${admin_password}\"}" 2>/dev/null |
+    sed -n 's/.*"access_token":"\([^"]*\)".*/\1/p')"
+  [[ -n "$token" ]] || return 1
+  curl -fsS -X POST "${base}/keys" \
+    -H "Authorization: Bearer ${token}" \
+    -H 'Content-Type: application/json' \
+    -d '{"name":"installer-cli","scopes":["read","upload","delete","share","admin"]}' 2>/dev/null |
+    sed -n 's/.*"key":"\([^"]*\)".*/\1/p'
+}
+
 init_cli_config() {
   local cli_bin="$1"
   local port="$2"
-  local local_key="$3"
+  local api_key="$3"
 
   "$cli_bin" config init \
     --endpoint "http://localhost:${port}" \
-    --local-key "${local_key}" >/dev/null 2>/dev/null || true
+    --api-key "${api_key}" >/dev/null 2>/dev/null || true
 }
 
 main() {
@@ -176,7 +200,7 @@ main() {
 
   local config_file="${install_dir}/config.yaml"
   local compose_file="${install_dir}/docker-compose.yml"
-  local local_key=""
+  local admin_password=""
 
   # Check if this is first-time installation
   if [[ -f "$config_file" ]]; then
@@ -184,18 +208,21 @@ main() {
     log "Keeping existing configuration and data unchanged"
     log "To reinstall with fresh config, delete ${install_dir} and run again"
     log ""
-    
-    # Extract local_key from existing config
-    local_key="$(grep "local_key:" "$config_file" | sed 's/.*local_key:[[:space:]]*"\([^"]*\)".*/\1/')"
+
+    if grep -q "^[[:space:]]*local_key:" "$config_file" && ! grep -q "^[[:space:]]*local_key_enabled:[[:space:]]*true" "$config_file"; then
+      log "Warning: auth.local_key is deprecated and no longer accepted by default."
+      log "Create an API key with 'filehub-cli keys create' and run 'filehub-cli config init --api-key ...',"
+      log "or set 'local_key_enabled: true' under auth in ${config_file} to keep using it for now."
+      log ""
+    fi
   else
     log "First time installation, generating configuration..."
     log ""
 
     # Generate random values
-    local jwt_secret admin_password minio_secret public_endpoint
+    local jwt_secret minio_secret public_endpoint
     jwt_secret="$(rand_token)$(rand_token)"
     admin_password="$(rand_token)"
-    local_key="$(rand_token)"
     minio_secret="$(rand_token)"
 
     # Try to detect public IP
@@ -222,7 +249,6 @@ main() {
     # Render config template
     sed -e "s/{{JWT_SECRET}}/${jwt_secret}/g" \
         -e "s/{{ADMIN_PASSWORD}}/${admin_password}/g" \
-        -e "s/{{LOCAL_KEY}}/${local_key}/g" \
         -e "s/{{MINIO_SECRET_KEY}}/${minio_secret}/g" \
         -e "s|{{PUBLIC_ENDPOINT}}|${public_endpoint}|g" \
         "$config_template" > "$config_file"
@@ -243,7 +269,6 @@ main() {
     log "Credentials (save these now):"
     log "- admin username: admin"
     log "- admin password: ${admin_password}"
-    log "- local_key:      ${local_key}"
     log ""
   fi
 
@@ -287,8 +312,15 @@ main() {
 
   local cli_config
   cli_config="$(cli_config_path)"
-  if [[ ! -f "$cli_config" && -n "$local_key" ]]; then
-    init_cli_config "${cli_dir}/filehub-cli" "$port" "$local_key"
+  if [[ ! -f "$cli_config" && -n "$admin_password" ]]; then
+    local api_key
+    api_key="$(create_cli_key "$port" "$admin_password")" || api_key=""
+    if [[ -n "$api_key" ]]; then
+      init_cli_config "${cli_dir}/filehub-cli" "$port" "$api_key"
+      log "CLI configured with API key 'installer-cli'"
+    else
+      log "Could not create a CLI API key; log in to the Web UI and run 'filehub-cli config init --api-key ...'"
+    fi
   else
     log "CLI config exists, keeping it unchanged"
   fi
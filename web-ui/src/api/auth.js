@@ -4,3 +4,19 @@ export const login = (username, password) =>
   client.post('/api/v1/auth/login', { username, password })
 
 export const logout = () => client.post('/api/v1/auth/logout')
+
+export const loginMFA = (mfaToken, code) =>
+  client.post('/api/v1/auth/login/mfa', { mfa_token: mfaToken, code })
+
+export const getTOTPStatus = () => client.get('/api/v1/auth/totp')
+
+export const enrollTOTP = () => client.post('/api/v1/auth/totp')
+
+export const confirmTOTP = (code) => client.post('/api/v1/auth/totp/confirm', { code })
+
+export const regenerateRecoveryCodes = (code) =>
+  client.post('/api/v1/auth/totp/recovery-codes', { code })
+
+export const disableTOTP = (code) => client.delete('/api/v1/auth/totp', { data: { code } })
+
+export const getOIDCInfo = () => client.get('/api/v1/auth/oidc')
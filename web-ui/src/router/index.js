@@ -4,6 +4,8 @@ import Files from '../pages/Files.vue'
 import Upload from '../pages/Upload.vue'
 import FileDetail from '../pages/FileDetail.vue'
 import Login from '../pages/Login.vue'
+import Security from '../pages/Security.vue'
+import AuthCallback from '../pages/AuthCallback.vue'
 
 const router = createRouter({
   history: createWebHistory(),
@@ -11,12 +13,14 @@ const router = createRouter({
     { path: '/', name: 'files', component: Files },
     { path: '/upload', name: 'upload', component: Upload },
     { path: '/file/:id', name: 'detail', component: FileDetail },
+    { path: '/security', name: 'security', component: Security },
     { path: '/login', name: 'login', component: Login },
+    { path: '/auth/callback', name: 'auth-callback', component: AuthCallback },
   ],
 })
 
 router.beforeEach((to) => {
-  if (to.path === '/login') return true
+  if (to.path === '/login' || to.path === '/auth/callback') return true
   const token = getAccessToken()
   if (!token) return { path: '/login', query: { redirect: to.fullPath } }
   return true